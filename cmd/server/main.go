@@ -42,19 +42,6 @@ func init() {
 	flag.BoolVar(&debug, "debug", false, "run tidis server in debug mode")
 }
 
-func setLogLevel(loglevel string) {
-	switch loglevel {
-	case "info":
-		log.SetLevel(log.INFO)
-	case "debug":
-		log.SetLevel(log.DEBUG)
-	case "warn":
-		log.SetLevel(log.WARN)
-	default:
-		log.SetLevel(log.INFO)
-	}
-}
-
 func main() {
 	flag.Parse()
 
@@ -79,7 +66,9 @@ func main() {
 
 	config.FillWithDefaultConfig(c)
 
-	setLogLevel(c.Tidis.LogLevel)
+	if err = server.SetLogLevel(c.Tidis.LogLevel); err != nil {
+		server.SetLogLevel("info")
+	}
 
 	app := server.NewApp(c)
 
@@ -92,5 +81,19 @@ func main() {
 
 	go app.Run()
 
-	<-quitCh
+	for sig := range quitCh {
+		if sig != syscall.SIGHUP {
+			log.Infof("receive signal %s, shutdown", sig)
+			break
+		}
+		// reload config file and apply changes can be made at runtime
+		log.Info("reload config")
+		if err = app.ReloadConfig(); err != nil {
+			log.Errorf("reload config failed, error: %s", err.Error())
+		}
+	}
+
+	if err = app.Close(); err != nil {
+		log.Errorf("shutdown failed, error: %s", err.Error())
+	}
 }
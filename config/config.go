@@ -16,6 +16,8 @@ type Config struct {
 	Desc    string
 	Tidis   tidisConfig   `toml:"tidis"`
 	Backend backendConfig `toml:"backend"`
+	// file loaded from, empty if config is built from flags
+	Path string `toml:"-"`
 }
 
 type tidisConfig struct {
@@ -31,25 +33,54 @@ type tidisConfig struct {
 	DBGcInterval        int    `toml:"db_gc_interval"`
 	DBGcConcurrency     int    `toml:"db_gc_concurrency"`
 	DBSafePointLifeTime int    `toml:"db_gc_safepoint_life_time"`
+	TTLCheckInterval    int    `toml:"ttl_check_interval"`
+	TTLCheckBatch       int    `toml:"ttl_check_batch"`
+	BlockPollInterval   int    `toml:"block_poll_interval"`
+	PubSubPollInterval  int    `toml:"pubsub_poll_interval"`
+	KeyspaceEvents      string `toml:"notify_keyspace_events"`
+	CDCEnabled          bool   `toml:"cdc_enabled"`
+	CDCName             string `toml:"cdc_name"`
+	CDCSink             string `toml:"cdc_sink"`
+	CDCStartTS          uint64 `toml:"cdc_start_ts"`
+	CDCInterval         int    `toml:"cdc_interval"`
+	MetricsListen       string `toml:"metrics_listen"`
+	SlowlogSlowerThan   int64  `toml:"slowlog_log_slower_than"`
+	SlowlogMaxLen       int    `toml:"slowlog_max_len"`
+	ACLPollInterval     int    `toml:"acl_poll_interval"`
+	TLSListen           string `toml:"tls_listen"`
+	TLSCert             string `toml:"tls_cert"`
+	TLSKey              string `toml:"tls_key"`
+	TLSCA               string `toml:"tls_ca"`
+	TLSAuthClients      string `toml:"tls_auth_clients"`
+	UnixSocket          string `toml:"unixsocket"`
+	UnixSocketPerm      string `toml:"unixsocketperm"`
+	ShutdownTimeout     int    `toml:"shutdown_timeout"`
+	TrackingEnabled     bool   `toml:"tracking_enabled"`
 }
 
 type backendConfig struct {
-	Pds string
+	// storage engine, tikv or memory, default is tikv
+	Type string `toml:"type"`
+	Pds  string
 }
 
 func LoadConfig(path string) (*Config, error) {
 	var c Config
+	// zero threshold logs every command, so default is set before decoding
+	c.Tidis.SlowlogSlowerThan = 10000
 	if _, err := toml.DecodeFile(path, &c); err != nil {
 		log.Errorf("config file parse failed, %v", err)
 		return nil, err
 	}
+	c.Path = path
 	return &c, nil
 }
 
 func NewConfig(c *Config, listen, addr string, retry int, auth string) *Config {
 	if c == nil {
 		backend := backendConfig{
-			Pds: addr,
+			Type: "tikv",
+			Pds:  addr,
 		}
 		tidis := tidisConfig{
 			Listen:  listen,
@@ -61,6 +92,18 @@ func NewConfig(c *Config, listen, addr string, retry int, auth string) *Config {
 			DBGcInterval: 10*60,
 			DBGcConcurrency: 3,
 			DBSafePointLifeTime: 10*60,
+			TTLCheckInterval: 1000,
+			TTLCheckBatch: 1000,
+			BlockPollInterval: 100,
+			PubSubPollInterval: 100,
+			CDCName: "default",
+			CDCSink: "stdout",
+			CDCInterval: 1000,
+			SlowlogSlowerThan: 10000,
+			SlowlogMaxLen: 128,
+			ACLPollInterval: 1000,
+			TLSAuthClients: "yes",
+			ShutdownTimeout: 10000,
 		}
 		c = &Config{
 			Desc:    "new config",
@@ -98,13 +141,47 @@ func NewConfig(c *Config, listen, addr string, retry int, auth string) *Config {
 		if c.Tidis.DBSafePointLifeTime == 0 {
 			c.Tidis.DBSafePointLifeTime = 10*60
 		}
+		if c.Tidis.TTLCheckInterval == 0 {
+			c.Tidis.TTLCheckInterval = 1000
+		}
+		if c.Tidis.TTLCheckBatch == 0 {
+			c.Tidis.TTLCheckBatch = 1000
+		}
+		if c.Tidis.BlockPollInterval == 0 {
+			c.Tidis.BlockPollInterval = 100
+		}
+		if c.Tidis.PubSubPollInterval == 0 {
+			c.Tidis.PubSubPollInterval = 100
+		}
+		if c.Tidis.CDCName == "" {
+			c.Tidis.CDCName = "default"
+		}
+		if c.Tidis.CDCSink == "" {
+			c.Tidis.CDCSink = "stdout"
+		}
+		if c.Tidis.CDCInterval == 0 {
+			c.Tidis.CDCInterval = 1000
+		}
+		if c.Tidis.SlowlogMaxLen == 0 {
+			c.Tidis.SlowlogMaxLen = 128
+		}
+		if c.Tidis.ACLPollInterval == 0 {
+			c.Tidis.ACLPollInterval = 1000
+		}
+		if c.Tidis.TLSAuthClients == "" {
+			c.Tidis.TLSAuthClients = "yes"
+		}
+		if c.Tidis.ShutdownTimeout == 0 {
+			c.Tidis.ShutdownTimeout = 10000
+		}
 	}
 	return c
 }
 
 // update config fields with default value if not filled
 func FillWithDefaultConfig(c *Config) {
-	if c.Tidis.Listen == "" {
+	// tcp listener is disabled if only tls listen or unix socket is set
+	if c.Tidis.Listen == "" && c.Tidis.TLSListen == "" && c.Tidis.UnixSocket == "" {
 		c.Tidis.Listen = ":5379"
 	}
 }
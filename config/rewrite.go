@@ -0,0 +1,180 @@
+//
+// rewrite.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+var errNoConfigFile = errors.New("config is not loaded from file")
+
+// key of struct field in toml file, fields without tag are matched by lower
+// case field name
+func tomlKey(f reflect.StructField) string {
+	key := f.Tag.Get("toml")
+	if key == "" {
+		key = strings.ToLower(f.Name)
+	}
+	return key
+}
+
+// FormatValue formats value in toml syntax
+func FormatValue(v interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(map[string]interface{}{"v": v}); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimPrefix(buf.String(), "v = ")), nil
+}
+
+// sectionValues returns keys and values of fields in struct v
+func sectionValues(v reflect.Value) ([]string, map[string]interface{}) {
+	var keys []string
+	values := make(map[string]interface{})
+	for i := 0; i < v.NumField(); i++ {
+		key := tomlKey(v.Type().Field(i))
+		if key == "-" || v.Field(i).Kind() == reflect.Struct {
+			continue
+		}
+		keys = append(keys, key)
+		values[key] = v.Field(i).Interface()
+	}
+	return keys, values
+}
+
+// sections returns names of sections and values of keys in each section, top
+// level keys are in section ""
+func (c *Config) sections() ([]string, map[string][]string, map[string]map[string]interface{}) {
+	sections := []string{""}
+	keys := make(map[string][]string)
+	values := make(map[string]map[string]interface{})
+
+	rv := reflect.ValueOf(c).Elem()
+	keys[""], values[""] = sectionValues(rv)
+	for i := 0; i < rv.NumField(); i++ {
+		if rv.Field(i).Kind() != reflect.Struct {
+			continue
+		}
+		name := tomlKey(rv.Type().Field(i))
+		sections = append(sections, name)
+		keys[name], values[name] = sectionValues(rv.Field(i))
+	}
+	return sections, keys, values
+}
+
+// Values returns keys and values of tidis section, keys of backend section are
+// prefixed by "backend."
+func (c *Config) Values() ([]string, map[string]interface{}) {
+	sections, keys, values := c.sections()
+
+	var names []string
+	ret := make(map[string]interface{})
+	for _, section := range sections {
+		prefix := section + "."
+		if section == "" {
+			continue
+		} else if section == "tidis" {
+			prefix = ""
+		}
+		for _, key := range keys[section] {
+			names = append(names, prefix+key)
+			ret[prefix+key] = values[section][key]
+		}
+	}
+	return names, ret
+}
+
+// Rewrite writes current values back to the loaded file, comments and order
+// of lines are kept, keys not in the file are added to the end of section
+func (c *Config) Rewrite() error {
+	if c.Path == "" {
+		return errNoConfigFile
+	}
+	info, err := os.Stat(c.Path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		return err
+	}
+
+	sections, keys, rawValues := c.sections()
+	values := make(map[string]map[string]string)
+	for section, kvs := range rawValues {
+		values[section] = make(map[string]string)
+		for key, v := range kvs {
+			if values[section][key], err = FormatValue(v); err != nil {
+				return err
+			}
+		}
+	}
+
+	var out []string
+	written := make(map[string]bool)
+	section, seen := "", map[string]bool{"": true}
+	addMissing := func() {
+		// keep blank lines between sections
+		end := len(out)
+		for end > 0 && strings.TrimSpace(out[end-1]) == "" {
+			end--
+		}
+		tail := append([]string{}, out[end:]...)
+		out = out[:end]
+		for _, key := range keys[section] {
+			if !written[section+"."+key] {
+				out = append(out, key+" = "+values[section][key])
+				written[section+"."+key] = true
+			}
+		}
+		out = append(out, tail...)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			addMissing()
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			seen[section] = true
+		} else if eq := strings.Index(trimmed, "="); eq > 0 && !strings.HasPrefix(trimmed, "#") {
+			key := strings.TrimSpace(trimmed[:eq])
+			if value, ok := values[section][key]; ok {
+				line = key + " = " + value
+				written[section+"."+key] = true
+			}
+		}
+		out = append(out, line)
+	}
+	addMissing()
+	for _, name := range sections {
+		if !seen[name] {
+			out = append(out, "", "["+name+"]")
+			section = name
+			addMissing()
+		}
+	}
+
+	// replace the file atomically
+	tmp := c.Path + ".tmp"
+	if err = ioutil.WriteFile(tmp, []byte(strings.Join(out, "\n")+"\n"), info.Mode()); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, c.Path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
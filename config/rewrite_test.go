@@ -0,0 +1,75 @@
+//
+// rewrite_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRewrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tidis-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tidis.toml")
+	content := `# sample
+[tidis]
+#listen address
+listen = ":5379"
+max_connection = 10
+auth = "old"
+
+[backend]
+type = "memory"
+`
+	if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Tidis.MaxConn = 20
+	c.Tidis.Auth = `new"pass`
+	c.Tidis.SlowlogMaxLen = 64
+	if err = c.Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	s := string(data)
+	for _, expect := range []string{
+		"# sample\ndesc = \"\"\n[tidis]\n#listen address\nlisten = \":5379\"\nmax_connection = 20\n",
+		"auth = \"new\\\"pass\"\n",
+		"slowlog_max_len = 64\n",
+		"[backend]\ntype = \"memory\"\n",
+	} {
+		if !strings.Contains(s, expect) {
+			t.Fatalf("rewrite missing %q:\n%s", expect, s)
+		}
+	}
+	// missing keys are added before blank line of the next section
+	if end := strings.Index(s, "\n\n[backend]"); end < 0 || !strings.Contains(s[strings.LastIndex(s[:end], "\n"):end], " = ") {
+		t.Fatalf("missing keys are not added to the end of section:\n%s", s)
+	}
+
+	c2, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c2.Tidis.MaxConn != 20 || c2.Tidis.Auth != `new"pass` || c2.Tidis.SlowlogMaxLen != 64 || c2.Backend.Type != "memory" {
+		t.Fatalf("reload rewritten config got %+v", *c2)
+	}
+}
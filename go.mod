@@ -26,7 +26,7 @@ require (
 	github.com/pingcap/goleveldb v0.0.0-20191226122134-f82aafb29989 // indirect
 	github.com/pingcap/kvproto v0.0.0-20200116032135-1082c388cb01
 	github.com/pingcap/tidb v1.1.0-beta.0.20200109142221-bf155a7773d8
-	github.com/prometheus/client_golang v1.3.0 // indirect
+	github.com/prometheus/client_golang v1.3.0
 	github.com/remyoudompheng/bigfft v0.0.0-20190728182440-6a916e37a237 // indirect
 	github.com/shirou/gopsutil v2.19.10+incompatible // indirect
 	github.com/spaolacci/murmur3 v1.1.0 // indirect
@@ -0,0 +1,645 @@
+//
+// acl.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yongman/go/log"
+	"github.com/yongman/tidis/terror"
+	"github.com/yongman/tidis/utils"
+)
+
+const aclDefaultUser = "default"
+
+// aclUser is permissions of an acl user, it is not modified after built, so
+// clients can check permissions without lock
+type aclUser struct {
+	name    string
+	enabled bool
+	nopass  bool
+	// sha256 of passwords in hex
+	passwords []string
+	allKeys   bool
+	patterns  []string
+	allDBs    bool
+	dbs       []uint8
+	// +/- rules of commands and categories in order
+	cmdRules []string
+	allowed  map[string]bool
+}
+
+func newACLUser(name string) *aclUser {
+	u := &aclUser{name: name}
+	u.apply("reset")
+	return u
+}
+
+// parseACLUser builds user from rules
+func parseACLUser(name string, rules []string) (*aclUser, error) {
+	u := newACLUser(name)
+	for _, rule := range rules {
+		if err := u.apply(rule); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
+
+func (u *aclUser) clone() *aclUser {
+	c := *u
+	c.passwords = append([]string{}, u.passwords...)
+	c.patterns = append([]string{}, u.patterns...)
+	c.dbs = append([]uint8{}, u.dbs...)
+	c.cmdRules = append([]string{}, u.cmdRules...)
+	c.allowed = make(map[string]bool, len(u.allowed))
+	for cmd := range u.allowed {
+		c.allowed[cmd] = true
+	}
+	return &c
+}
+
+func hashPassword(pass string) string {
+	sum := sha256.Sum256([]byte(pass))
+	return hex.EncodeToString(sum[:])
+}
+
+func removeString(ss []string, s string) []string {
+	ret := ss[:0]
+	for _, v := range ss {
+		if v != s {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+func addString(ss []string, s string) []string {
+	for _, v := range ss {
+		if v == s {
+			return ss
+		}
+	}
+	return append(ss, s)
+}
+
+// apply applies a rule of acl setuser, rules are those of redis with db
+// rules of tidis, alldbs, resetdbs and db=<n>
+func (u *aclUser) apply(rule string) error {
+	lower := strings.ToLower(rule)
+	switch lower {
+	case "on":
+		u.enabled = true
+	case "off":
+		u.enabled = false
+	case "nopass":
+		u.nopass = true
+		u.passwords = nil
+	case "resetpass":
+		u.nopass = false
+		u.passwords = nil
+	case "allkeys":
+		u.allKeys = true
+		u.patterns = nil
+	case "resetkeys":
+		u.allKeys = false
+		u.patterns = nil
+	case "alldbs":
+		u.allDBs = true
+		u.dbs = nil
+	case "resetdbs":
+		u.allDBs = false
+		u.dbs = nil
+	case "allcommands":
+		return u.apply("+@all")
+	case "nocommands":
+		return u.apply("-@all")
+	case "reset":
+		u.enabled = false
+		u.apply("resetpass")
+		u.apply("resetkeys")
+		u.apply("alldbs")
+		u.apply("-@all")
+	default:
+		if rule == "" {
+			return terror.ErrACLRule
+		}
+		switch rule[0] {
+		case '>':
+			u.passwords = addString(u.passwords, hashPassword(rule[1:]))
+			u.nopass = false
+		case '<':
+			u.passwords = removeString(u.passwords, hashPassword(rule[1:]))
+		case '#', '!':
+			hash := strings.ToLower(rule[1:])
+			if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 {
+				return terror.ErrACLRule
+			}
+			if rule[0] == '#' {
+				u.passwords = addString(u.passwords, hash)
+				u.nopass = false
+			} else {
+				u.passwords = removeString(u.passwords, hash)
+			}
+		case '~':
+			if rule == "~*" {
+				return u.apply("allkeys")
+			}
+			if !u.allKeys {
+				u.patterns = addString(u.patterns, rule[1:])
+			}
+		case '+', '-':
+			return u.applyCommandRule(lower)
+		default:
+			if !strings.HasPrefix(lower, "db=") {
+				return terror.ErrACLRule
+			}
+			db, err := strconv.ParseUint(lower[3:], 10, 8)
+			if err != nil {
+				return terror.ErrACLRule
+			}
+			// the first db rule restricts user to listed dbs
+			if u.allDBs {
+				u.allDBs = false
+				u.dbs = nil
+			}
+			for _, v := range u.dbs {
+				if v == uint8(db) {
+					return nil
+				}
+			}
+			u.dbs = append(u.dbs, uint8(db))
+		}
+	}
+	return nil
+}
+
+func (u *aclUser) applyCommandRule(rule string) error {
+	add := rule[0] == '+'
+	name := rule[1:]
+
+	var names []string
+	if strings.HasPrefix(name, "@") {
+		cat := name[1:]
+		if !aclCategoryExists(cat) {
+			return terror.ErrACLRule
+		}
+		names = aclCategoryCommands(cat)
+		if cat == "all" {
+			// all previous rules are overridden
+			u.cmdRules = nil
+			u.allowed = make(map[string]bool)
+		}
+	} else {
+		if cmdCategories(name) == nil {
+			return terror.ErrACLRule
+		}
+		names = []string{name}
+	}
+
+	if u.allowed == nil {
+		u.allowed = make(map[string]bool)
+	}
+	for _, cmd := range names {
+		if add {
+			u.allowed[cmd] = true
+		} else {
+			delete(u.allowed, cmd)
+		}
+	}
+	if rule != "-@all" {
+		u.cmdRules = append(u.cmdRules, rule)
+	}
+	return nil
+}
+
+// rules returns rules to rebuild user, they are persisted as user definition
+func (u *aclUser) rules() []string {
+	var rules []string
+	if u.enabled {
+		rules = append(rules, "on")
+	} else {
+		rules = append(rules, "off")
+	}
+	if u.nopass {
+		rules = append(rules, "nopass")
+	}
+	for _, hash := range u.passwords {
+		rules = append(rules, "#"+hash)
+	}
+	if u.allKeys {
+		rules = append(rules, "~*")
+	}
+	for _, pattern := range u.patterns {
+		rules = append(rules, "~"+pattern)
+	}
+	if u.allDBs {
+		rules = append(rules, "alldbs")
+	}
+	for _, db := range u.dbs {
+		rules = append(rules, "db="+strconv.Itoa(int(db)))
+	}
+	if len(u.cmdRules) == 0 {
+		rules = append(rules, "-@all")
+	}
+	return append(rules, u.cmdRules...)
+}
+
+// commands describes command rules like acl getuser
+func (u *aclUser) commands() string {
+	if len(u.cmdRules) == 0 {
+		return "-@all"
+	}
+	return strings.Join(u.cmdRules, " ")
+}
+
+func (u *aclUser) checkPassword(pass string) bool {
+	if u.nopass {
+		return true
+	}
+	hash := hashPassword(pass)
+	for _, v := range u.passwords {
+		if v == hash {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *aclUser) allowDB(db uint8) bool {
+	if u.allDBs {
+		return true
+	}
+	for _, v := range u.dbs {
+		if v == db {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *aclUser) allowKey(key []byte) bool {
+	if u.allKeys {
+		return true
+	}
+	for _, pattern := range u.patterns {
+		if utils.StringMatch([]byte(pattern), key) {
+			return true
+		}
+	}
+	return false
+}
+
+// aclCategories returns all categories of commands and "all"
+func aclCategories() []string {
+	set := map[string]bool{"all": true}
+	for _, name := range cmdNames() {
+		for _, cat := range cmdCategories(name) {
+			set[cat] = true
+		}
+	}
+	cats := make([]string, 0, len(set))
+	for cat := range set {
+		cats = append(cats, cat)
+	}
+	sort.Strings(cats)
+	return cats
+}
+
+func aclCategoryExists(cat string) bool {
+	for _, v := range aclCategories() {
+		if v == cat {
+			return true
+		}
+	}
+	return false
+}
+
+func aclCategoryCommands(cat string) []string {
+	var names []string
+	for _, name := range cmdNames() {
+		if cat == "all" || cmdHasCategory(name, cat) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// keySpec locates keys in args of command, negative last counts from the end
+type keySpec struct {
+	first, last, step int
+}
+
+var (
+	keysFirst    = keySpec{0, 0, 1}
+	keysAll      = keySpec{0, -1, 1}
+	keysPairs    = keySpec{0, -1, 2}
+	keysTwo      = keySpec{0, 1, 1}
+	keysTimeout  = keySpec{0, -2, 1}
+	keysNone     = keySpec{}
+	keysNumKeys  = keySpec{first: -1}
+	keysDestKeys = keySpec{first: -2}
+)
+
+// key specs of commands different from the first arg
+var cmdKeySpecs = map[string]keySpec{
+	"scan":        keysNone,
+	"keys":        keysNone,
+	"dbsize":      keysNone,
+	"randomkey":   keysNone,
+	"flushdb":     keysNone,
+	"flushall":    keysNone,
+	"exists":      keysAll,
+	"del":         keysAll,
+	"unlink":      keysAll,
+	"mget":        keysAll,
+	"watch":       keysAll,
+	"sdiff":       keysAll,
+	"sunion":      keysAll,
+	"sinter":      keysAll,
+	"sdiffstore":  keysAll,
+	"sunionstore": keysAll,
+	"sinterstore": keysAll,
+	"mset":        keysPairs,
+	"rpoplpush":   keysTwo,
+	"lmove":       keysTwo,
+	"brpoplpush":  keysTwo,
+	"blmove":      keysTwo,
+	"blpop":       keysTimeout,
+	"brpop":       keysTimeout,
+	"bzpopmin":    keysTimeout,
+	"bzpopmax":    keysTimeout,
+	"zunion":      keysNumKeys,
+	"zinter":      keysNumKeys,
+	"zdiff":       keysNumKeys,
+	"zunionstore": keysDestKeys,
+	"zinterstore": keysDestKeys,
+	"zdiffstore":  keysDestKeys,
+}
+
+// dataCategories are categories of commands accessing keys in db
+var dataCategories = []string{"keyspace", "string", "hash", "list", "set", "sortedset"}
+
+func isDataCommand(cmd string) bool {
+	for _, cat := range dataCategories {
+		if cmdHasCategory(cmd, cat) {
+			return true
+		}
+	}
+	return cmd == "watch"
+}
+
+// commandKeys returns keys in args of command
+func commandKeys(cmd string, args [][]byte) [][]byte {
+	if !isDataCommand(cmd) {
+		return nil
+	}
+	spec, ok := cmdKeySpecs[cmd]
+	if !ok {
+		spec = keysFirst
+	}
+
+	switch spec {
+	case keysNone:
+		return nil
+	case keysNumKeys, keysDestKeys:
+		// numkeys key [key ...], or destination numkeys key [key ...]
+		var keys [][]byte
+		if spec == keysDestKeys {
+			if len(args) == 0 {
+				return nil
+			}
+			keys, args = append(keys, args[0]), args[1:]
+		}
+		if len(args) == 0 {
+			return keys
+		}
+		n, err := strconv.Atoi(string(args[0]))
+		if err != nil || n < 0 {
+			return keys
+		}
+		if n > len(args)-1 {
+			n = len(args) - 1
+		}
+		return append(keys, args[1:n+1]...)
+	}
+
+	last := spec.last
+	if last < 0 {
+		last += len(args)
+	}
+	var keys [][]byte
+	for i := spec.first; i <= last && i < len(args); i += spec.step {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// aclUsers caches acl users stored in tikv, it is shared by all instances and
+// reloaded periodically
+type aclUsers struct {
+	sync.RWMutex
+	users map[string]*aclUser
+	// default user derived from auth config while it is not stored, rebuilt
+	// after auth changed
+	defaultUser *aclUser
+}
+
+func newACLUsers() *aclUsers {
+	return &aclUsers{users: make(map[string]*aclUser)}
+}
+
+// getUser returns user by name, nil if not exists. default user is on and
+// can run all commands if it is not defined, password of it is auth config
+func (app *App) getUser(name string) *aclUser {
+	app.acl.RLock()
+	u := app.acl.users[name]
+	if u == nil && name == aclDefaultUser {
+		u = app.acl.defaultUser
+	}
+	app.acl.RUnlock()
+	if u != nil || name != aclDefaultUser {
+		return u
+	}
+
+	app.acl.Lock()
+	defer app.acl.Unlock()
+	if app.acl.defaultUser != nil {
+		return app.acl.defaultUser
+	}
+	u = newACLUser(aclDefaultUser)
+	u.apply("on")
+	u.apply("allkeys")
+	u.apply("+@all")
+	if auth := app.getAuth(); auth == "" {
+		u.apply("nopass")
+	} else {
+		u.apply(">" + auth)
+	}
+	app.acl.defaultUser = u
+	return u
+}
+
+// setAuth changes auth config, default user derived from it is rebuilt
+func (app *App) setAuth(auth string) {
+	app.acl.Lock()
+	app.auth.Store(auth)
+	app.acl.defaultUser = nil
+	app.acl.Unlock()
+}
+
+// userNames returns names of all users with default user
+func (app *App) userNames() []string {
+	app.acl.RLock()
+	names := []string{aclDefaultUser}
+	for name := range app.acl.users {
+		if name != aclDefaultUser {
+			names = append(names, name)
+		}
+	}
+	app.acl.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// loadUsers reloads users from storage, invalid users are skipped
+func (app *App) loadUsers() error {
+	defs, err := app.tdb.ACLUsers()
+	if err != nil {
+		return err
+	}
+	users := make(map[string]*aclUser, len(defs))
+	for name, def := range defs {
+		u, err := parseACLUser(name, strings.Fields(def))
+		if err != nil {
+			log.Warnf("invalid acl user %s: %s", name, def)
+			continue
+		}
+		users[name] = u
+	}
+
+	app.acl.Lock()
+	app.acl.users = users
+	app.acl.Unlock()
+	return nil
+}
+
+// setUser applies rules to user and persists it, user is created if not exists
+func (app *App) setUser(name string, rules []string) error {
+	u := app.getUser(name)
+	if u == nil {
+		u = newACLUser(name)
+	} else {
+		u = u.clone()
+	}
+	for _, rule := range rules {
+		if err := u.apply(rule); err != nil {
+			return err
+		}
+	}
+	if err := app.tdb.SetACLUser(name, strings.Join(u.rules(), " ")); err != nil {
+		return err
+	}
+
+	app.acl.Lock()
+	app.acl.users[name] = u
+	app.acl.Unlock()
+	return nil
+}
+
+func (app *App) delUsers(names []string) (int, error) {
+	for _, name := range names {
+		if name == aclDefaultUser {
+			return 0, terror.ErrACLDelDefault
+		}
+	}
+	n, err := app.tdb.DelACLUsers(names)
+	if err != nil {
+		return 0, err
+	}
+
+	app.acl.Lock()
+	for _, name := range names {
+		delete(app.acl.users, name)
+	}
+	app.acl.Unlock()
+	return n, nil
+}
+
+// runACLReload reloads users changed by other instances every interval
+// milliseconds until ctx is done
+func (app *App) runACLReload(ctx context.Context, interval int) {
+	ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := app.loadUsers(); err != nil {
+				log.Errorf("reload acl users failed, error: %s", err.Error())
+			}
+		}
+	}
+}
+
+// authenticate checks password of user
+func (app *App) authenticate(name, pass string) bool {
+	u := app.getUser(name)
+	return u != nil && u.enabled && u.checkPassword(pass)
+}
+
+// checkPermission checks if user of client can run current command on keys
+// in args and current db
+func (c *Client) checkPermission() error {
+	u := c.app.getUser(c.user)
+	if u == nil {
+		// user is deleted, connection is closed like redis
+		c.closeAfterReply = true
+		return terror.ErrNoPermCommand
+	}
+	if cmdCategories(c.cmd) == nil {
+		// unknown command
+		return nil
+	}
+	if !u.allowed[c.cmd] {
+		return terror.ErrNoPermCommand
+	}
+
+	switch {
+	case c.cmd == "select":
+		if len(c.args) == 1 {
+			db, err := strconv.ParseUint(string(c.args[0]), 10, 8)
+			if err == nil && !u.allowDB(uint8(db)) {
+				return terror.ErrNoPermDB
+			}
+		}
+	case c.cmd == "flushall":
+		if !u.allDBs {
+			return terror.ErrNoPermDB
+		}
+	case isDataCommand(c.cmd):
+		if !u.allowDB(c.dbId) {
+			return terror.ErrNoPermDB
+		}
+	}
+
+	for _, key := range commandKeys(c.cmd, c.args) {
+		if !u.allowKey(key) {
+			return terror.ErrNoPermKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+//
+// acl_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/yongman/go/goredis"
+	"github.com/yongman/tidis/terror"
+)
+
+func TestCommandKeys(t *testing.T) {
+	args := func(ss ...string) [][]byte {
+		ret := make([][]byte, len(ss))
+		for i, s := range ss {
+			ret[i] = []byte(s)
+		}
+		return ret
+	}
+	for _, c := range []struct {
+		cmd    string
+		args   [][]byte
+		expect string
+	}{
+		{"get", args("k"), "[k]"},
+		{"hset", args("h", "f", "v"), "[h]"},
+		{"mset", args("k1", "v1", "k2", "v2"), "[k1 k2]"},
+		{"del", args("k1", "k2"), "[k1 k2]"},
+		{"blpop", args("l1", "l2", "0"), "[l1 l2]"},
+		{"lmove", args("src", "dst", "left", "right"), "[src dst]"},
+		{"zunion", args("2", "z1", "z2", "weights", "1", "2"), "[z1 z2]"},
+		{"zunionstore", args("dst", "2", "z1", "z2"), "[dst z1 z2]"},
+		{"zinterstore", args("dst", "5", "z1"), "[dst z1]"},
+		{"keys", args("*"), "[]"},
+		{"publish", args("ch", "msg"), "[]"},
+		{"watch", args("k1", "k2"), "[k1 k2]"},
+	} {
+		if s := fmt.Sprintf("%s", commandKeys(c.cmd, c.args)); s != c.expect {
+			t.Fatalf("keys of %s got %s, expect %s", c.cmd, s, c.expect)
+		}
+	}
+}
+
+func TestACLRules(t *testing.T) {
+	u, err := parseACLUser("u", strings.Fields("on >p1 ~k* ~k* db=1 db=2 +@string -set +hget"))
+	if err != nil {
+		t.Fatalf("parse user failed: %v", err)
+	}
+	if !u.checkPassword("p1") || u.checkPassword("p2") {
+		t.Fatalf("password check failed")
+	}
+	if !u.allowed["get"] || u.allowed["set"] || !u.allowed["hget"] || u.allowed["hset"] {
+		t.Fatalf("allowed commands %v", u.allowed)
+	}
+	if !u.allowKey([]byte("key")) || u.allowKey([]byte("other")) || len(u.patterns) != 1 {
+		t.Fatalf("key patterns %v", u.patterns)
+	}
+	if u.allowDB(0) || !u.allowDB(2) {
+		t.Fatalf("dbs %v", u.dbs)
+	}
+
+	// rules rebuild the same user
+	rules := strings.Join(u.rules(), " ")
+	u2, err := parseACLUser("u", strings.Fields(rules))
+	if err != nil || strings.Join(u2.rules(), " ") != rules {
+		t.Fatalf("rebuild user from %q got %v %v", rules, u2, err)
+	}
+	if len(u2.allowed) != len(u.allowed) {
+		t.Fatalf("rebuild user allowed %d commands, expect %d", len(u2.allowed), len(u.allowed))
+	}
+
+	// +@all overrides previous command rules
+	u.apply("+@all")
+	if u.commands() != "+@all" {
+		t.Fatalf("commands after +@all got %s", u.commands())
+	}
+
+	for _, rule := range []string{"+nosuch", "+@nosuch", "#abc", "db=256", "bad"} {
+		if _, err := parseACLUser("u", []string{rule}); err != terror.ErrACLRule {
+			t.Fatalf("rule %s got %v", rule, err)
+		}
+	}
+}
+
+func TestACL(t *testing.T) {
+	app := newTestApp(t)
+	admin := newTestConn(t, app)
+	defer admin.Close()
+
+	ok := func(c *goredis.Conn, args ...interface{}) {
+		t.Helper()
+		if _, err := c.Do(args[0].(string), args[1:]...); err != nil {
+			t.Fatalf("%v failed: %v", args, err)
+		}
+	}
+	fail := func(c *goredis.Conn, expect error, args ...interface{}) {
+		t.Helper()
+		if _, err := c.Do(args[0].(string), args[1:]...); err == nil || err.Error() != expect.Error() {
+			t.Fatalf("%v expect %v, got %v", args, expect, err)
+		}
+	}
+
+	if s, _ := goredis.String(admin.Do("acl", "whoami")); s != "default" {
+		t.Fatalf("whoami got %s", s)
+	}
+	ok(admin, "acl", "setuser", "alice", "on", ">secret", "~app:*", "db=0", "db=1", "+@read", "+set", "+select")
+	fail(admin, terror.ErrACLRule, "acl", "setuser", "bob", "+nosuch")
+	fail(admin, terror.ErrACLDelDefault, "acl", "deluser", "default")
+
+	users, _ := goredis.Strings(admin.Do("acl", "users"))
+	if fmt.Sprint(users) != "[alice default]" {
+		t.Fatalf("acl users got %v", users)
+	}
+	list, _ := goredis.Strings(admin.Do("acl", "list"))
+	if len(list) != 2 || !strings.HasPrefix(list[0], "user alice on #") || !strings.HasSuffix(list[0], " ~app:* db=0 db=1 +@read +set +select") {
+		t.Fatalf("acl list got %q", list)
+	}
+	if list[1] != "user default on nopass ~* alldbs +@all" {
+		t.Fatalf("acl list default got %q", list[1])
+	}
+	info, _ := goredis.Values(admin.Do("acl", "getuser", "alice"))
+	if len(info) != 10 || fmt.Sprintf("%s", info[9]) != "[0 1]" {
+		t.Fatalf("acl getuser got %s", info)
+	}
+	if v, err := admin.Do("acl", "getuser", "nosuch"); v != nil || err != nil {
+		t.Fatalf("getuser unknown user got %v %v", v, err)
+	}
+	cats, _ := goredis.Strings(admin.Do("acl", "cat"))
+	if !strings.Contains(strings.Join(cats, " "), "sortedset") {
+		t.Fatalf("acl cat got %v", cats)
+	}
+	cmds, _ := goredis.Strings(admin.Do("acl", "cat", "blocking"))
+	if fmt.Sprint(cmds) != "[blmove blpop brpop brpoplpush bzpopmax bzpopmin]" {
+		t.Fatalf("acl cat blocking got %v", cmds)
+	}
+
+	c := newTestConn(t, app)
+	defer c.Close()
+	fail(c, terror.ErrWrongPass, "auth", "alice", "wrong")
+	ok(c, "auth", "alice", "secret")
+	if s, _ := goredis.String(c.Do("acl", "whoami")); s != "" {
+		t.Fatalf("acl is not allowed for alice, got %s", s)
+	}
+	ok(c, "set", "app:1", "v")
+	ok(c, "get", "app:1")
+	fail(c, terror.ErrNoPermKey, "get", "other")
+	fail(c, terror.ErrNoPermKey, "mget", "app:1", "other")
+	fail(c, terror.ErrNoPermCommand, "del", "app:1")
+	fail(c, terror.ErrNoPermDB, "select", "2")
+	ok(c, "select", "1")
+	ok(c, "get", "app:1")
+
+	// changes of user apply to authenticated connections
+	ok(admin, "acl", "setuser", "alice", "-get")
+	fail(c, terror.ErrNoPermCommand, "get", "app:1")
+
+	// denied command in multi is replied at once and aborts exec
+	ok(admin, "acl", "setuser", "alice", "+multi", "+exec")
+	ok(c, "multi")
+	if s, _ := goredis.String(c.Do("set", "app:1", "v2")); s != "QUEUED" {
+		t.Fatalf("set in multi got %s", s)
+	}
+	fail(c, terror.ErrNoPermKey, "set", "other", "v")
+	fail(c, terror.ErrExecAbort, "exec")
+	if v, _ := goredis.String(app.tdb.Get(1, nil, []byte("app:1"))); v == "v2" {
+		t.Fatalf("aborted exec wrote %s", v)
+	}
+	if s, _ := goredis.String(c.Do("set", "app:1", "v")); s != "OK" {
+		t.Fatalf("set after aborted exec got %s", s)
+	}
+
+	// users are reloaded from storage
+	if err := app.tdb.SetACLUser("carol", "on nopass ~* alldbs +@all"); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.loadUsers(); err != nil {
+		t.Fatal(err)
+	}
+	if u := app.getUser("carol"); u == nil || !u.allowed["flushall"] {
+		t.Fatalf("user not reloaded, got %v", u)
+	}
+	if u := app.getUser("alice"); u == nil || u.allowed["get"] {
+		t.Fatalf("alice reloaded got %v", u)
+	}
+
+	// connections of deleted user are closed
+	if n, _ := goredis.Int64(admin.Do("acl", "deluser", "alice", "nosuch")); n != 1 {
+		t.Fatalf("deluser got %d", n)
+	}
+	c.Do("set", "app:1", "v")
+	if _, err := c.Do("ping"); err == nil {
+		t.Fatalf("connection of deleted user is not closed")
+	}
+
+	// derived default user is cached until auth changes
+	u := app.getUser(aclDefaultUser)
+	if app.getUser(aclDefaultUser) != u || !u.nopass {
+		t.Fatalf("default user not cached")
+	}
+	app.setAuth("pw")
+	if u = app.getUser(aclDefaultUser); u.nopass || !u.checkPassword("pw") {
+		t.Fatalf("default user not rebuilt after auth changed")
+	}
+	app.setAuth("")
+
+	// default user with password
+	ok(admin, "acl", "setuser", "default", "resetpass", ">pass")
+	c2 := newTestConn(t, app)
+	defer c2.Close()
+	fail(c2, terror.ErrAuthReqired, "get", "k")
+	fail(c2, terror.ErrAuthFailed, "auth", "wrong")
+	ok(c2, "auth", "pass")
+	ok(c2, "get", "k")
+}
@@ -12,6 +12,7 @@ import (
 	"net"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/yongman/go/log"
 	"github.com/yongman/tidis/config"
@@ -21,78 +22,282 @@ import (
 type App struct {
 	conf *config.Config
 
+	// plaintext listener, nil if only tls or unix listener is enabled
 	listener net.Listener
 
+	tlsListener net.Listener
+
+	unixListener net.Listener
+	// certificates of tls listener
+	tlsState atomic.Value
+
 	// wrapper and manager for db instance
 	tdb *tidis.Tidis
 
-	// connection authentication
-	auth string
+	// connection authentication, password string can be changed by config set
+	auth atomic.Value
+
+	// max client connections, 0 means no limit
+	maxConn int32
+
+	// acl users shared by all instances
+	acl *aclUsers
 
 	tenanId string
 
-	quitCh chan bool
+	// closed on shutdown, clients end after running command
+	quitCh chan struct{}
+
+	// background workers stop when ctx is canceled
+	ctx       context.Context
+	cancel    context.CancelFunc
+	workerWG  sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+
+	// subscriptions of clients on this instance
+	pubsub *pubsubHub
+
+	// keys read by tracking clients of this instance
+	tracking *trackingTable
 
 	clientWG sync.WaitGroup
 
-	clientCount int32
+	// live clients of this instance
+	clients *clientRegistry
+	// set by close, accept loop ends
+	closed int32
+
+	// commands are delayed by client pause
+	pause clientPause
 
-	//client map?
+	// clients blocked by blocking commands
+	blockedCount int32
+
+	stats *serverStats
+
+	slowlog *slowlog
+
+	gcChecker *tidis.GCChecker
+
+	// serializes config set and reload
+	confLock sync.Mutex
 }
 
 // initialize an app
 func NewApp(conf *config.Config) *App {
 	var err error
 	app := &App{
-		conf: conf,
-		auth: conf.Tidis.Auth,
+		conf:     conf,
+		quitCh:   make(chan struct{}),
+		maxConn:  conf.Tidis.MaxConn,
+		pubsub:   newPubsubHub(),
+		tracking: newTrackingTable(),
+		clients:  newClientRegistry(),
+		acl:      newACLUsers(),
+		stats:    newServerStats(),
+		slowlog: newSlowlog(conf.Tidis.SlowlogSlowerThan,
+			conf.Tidis.SlowlogMaxLen),
 	}
 
+	app.auth.Store(conf.Tidis.Auth)
+	app.ctx, app.cancel = context.WithCancel(context.Background())
+
 	app.tdb, err = tidis.NewTidis(conf)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
-
-	app.listener, err = net.Listen("tcp", conf.Tidis.Listen)
-	log.Infof("server listen in %s", conf.Tidis.Listen)
-	if err != nil {
+	if err = app.loadUsers(); err != nil {
 		log.Fatal(err.Error())
 	}
+	app.gcChecker = tidis.NewGCChecker(conf.Tidis.DBGcInterval,
+		conf.Tidis.DBSafePointLifeTime,
+		conf.Tidis.DBGcConcurrency,
+		app.tdb)
+	app.tdb.SetPubSubDeliver(func(channel, message []byte) {
+		if string(channel) == trackingSyncChannel {
+			app.deliverInvalidation(message)
+			return
+		}
+		app.pubsub.publish(channel, message)
+	})
+
+	if conf.Tidis.Listen != "" {
+		app.listener, err = net.Listen("tcp", conf.Tidis.Listen)
+		log.Infof("server listen in %s", conf.Tidis.Listen)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	if conf.Tidis.TLSListen != "" {
+		app.tlsListener, err = app.listenTLS()
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
+	if conf.Tidis.UnixSocket != "" {
+		app.unixListener, err = listenUnix(conf.Tidis.UnixSocket, conf.Tidis.UnixSocketPerm)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+	}
 
 	return app
 }
 
+func (app *App) getAuth() string {
+	return app.auth.Load().(string)
+}
+
 func (app *App) GetTidis() *tidis.Tidis {
 	return app.tdb
 }
 
+// Close shuts down app in order: stop accepting connections, wait running
+// commands of clients until shutdown timeout, stop background workers,
+// release leader lease and close storage
 func (app *App) Close() error {
-	return nil
+	app.closeOnce.Do(func() {
+		app.closeErr = app.shutdown()
+	})
+	return app.closeErr
 }
 
-func (app *App) Run() {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+func (app *App) shutdown() error {
+	atomic.StoreInt32(&app.closed, 1)
+	var err error
+	for _, l := range app.listeners() {
+		if e := l.Close(); e != nil {
+			err = e
+		}
+	}
 
-	go app.tdb.RunAsync(ctx)
+	app.confLock.Lock()
+	timeout := time.Duration(app.conf.Tidis.ShutdownTimeout) * time.Millisecond
+	app.confLock.Unlock()
+
+	// idle and blocked clients end now, others after running command
+	log.Infof("shutdown, waiting for %d clients", app.clients.len())
+	close(app.quitCh)
+	if !waitTimeout(&app.clientWG, timeout) {
+		log.Warnf("shutdown timeout, kill %d clients", app.clients.len())
+		for _, c := range app.clients.list() {
+			c.kill()
+		}
+	}
+
+	app.cancel()
+	if !waitTimeout(&app.workerWG, timeout) {
+		log.Warn("shutdown timeout, background workers are still running")
+	}
+
+	if e := app.tdb.ReleaseLeader(); e != nil {
+		log.Errorf("release leader lease failed, error: %s", e.Error())
+	}
+	if e := app.tdb.Close(); e != nil {
+		err = e
+	}
+	log.Info("shutdown done")
+	return err
+}
+
+// waitTimeout waits wg until timeout, returns false if timed out
+func waitTimeout(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// goWorker runs background worker f, it should return when ctx is canceled
+func (app *App) goWorker(f func(ctx context.Context)) {
+	app.workerWG.Add(1)
+	go func() {
+		defer app.workerWG.Done()
+		f(app.ctx)
+	}()
+}
+
+// listeners returns enabled listeners
+func (app *App) listeners() []net.Listener {
+	var ls []net.Listener
+	for _, l := range []net.Listener{app.listener, app.tlsListener, app.unixListener} {
+		if l != nil {
+			ls = append(ls, l)
+		}
+	}
+	return ls
+}
+
+func (app *App) Run() {
+	app.goWorker(app.tdb.RunAsync)
 
 	// run leader checker
 	leaderChecker := tidis.NewLeaderChecker(app.conf.Tidis.LeaderCheckInterval,
 		app.conf.Tidis.LeaderLeaseDuration,
 		app.tdb)
-	go leaderChecker.Run(ctx)
+	app.goWorker(leaderChecker.Run)
 
 	// run gc checker
-	gcChecker := tidis.NewGCChecker(app.conf.Tidis.DBGcInterval,
-		app.conf.Tidis.DBSafePointLifeTime,
-		app.conf.Tidis.DBGcConcurrency,
+	app.goWorker(app.gcChecker.Run)
+
+	// run ttl checker
+	ttlChecker := tidis.NewTTLChecker(app.conf.Tidis.TTLCheckBatch,
+		app.conf.Tidis.TTLCheckInterval,
 		app.tdb)
-	go gcChecker.Run(ctx)
+	app.goWorker(ttlChecker.Run)
 
+	// wake up blocked clients on writes of other instances
+	app.goWorker(func(ctx context.Context) {
+		app.tdb.RunBlockPoller(ctx, app.conf.Tidis.BlockPollInterval)
+	})
 
-	var currentClients int32
+	// deliver messages published on other instances
+	app.goWorker(app.tdb.RunPubSub)
+
+	// reload acl users changed by other instances
+	app.goWorker(func(ctx context.Context) {
+		app.runACLReload(ctx, app.conf.Tidis.ACLPollInterval)
+	})
+
+	// serve prometheus metrics
+	if app.conf.Tidis.MetricsListen != "" {
+		app.goWorker(app.serveMetrics)
+	}
+
+	// write committed changes to sink
+	if app.conf.Tidis.CDCEnabled {
+		sink, err := tidis.OpenJSONLinesSink(app.conf.Tidis.CDCSink)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		feed := app.tdb.NewChangeFeed(app.conf.Tidis.CDCName, sink)
+		app.goWorker(func(ctx context.Context) {
+			feed.Run(ctx, app.conf.Tidis.CDCStartTS, app.conf.Tidis.CDCInterval)
+		})
+	}
 
 	// accept connections
+	var wg sync.WaitGroup
+	for _, l := range app.listeners() {
+		wg.Add(1)
+		go func(l net.Listener) {
+			defer wg.Done()
+			app.serve(l)
+		}(l)
+	}
+	wg.Wait()
+}
+
+// serve accepts connections of listener until app is closed
+func (app *App) serve(l net.Listener) {
 	for {
 		select {
 		case <-app.quitCh:
@@ -100,14 +305,19 @@ func (app *App) Run() {
 		default:
 			// accept new client connect and perform
 			log.Debug("waiting for new connection")
-			conn, err := app.listener.Accept()
+			conn, err := l.Accept()
 			if err != nil {
+				if atomic.LoadInt32(&app.closed) == 1 {
+					return
+				}
 				log.Error(err.Error())
 				continue
 			}
-			currentClients = atomic.LoadInt32(&app.clientCount)
-			if app.conf.Tidis.MaxConn > 0 && currentClients > app.conf.Tidis.MaxConn {
-				log.Warnf("too many client connections, max client connections:%d, now:%d, reject it.", app.conf.Tidis.MaxConn, currentClients)
+			currentClients := app.clients.len()
+			maxConn := int(atomic.LoadInt32(&app.maxConn))
+			if maxConn > 0 && currentClients >= maxConn {
+				log.Warnf("too many client connections, max client connections:%d, now:%d, reject it.", maxConn, currentClients)
+				app.stats.connRejected()
 				conn.Close()
 				continue
 			}
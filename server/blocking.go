@@ -0,0 +1,89 @@
+//
+// blocking.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/yongman/tidis/terror"
+)
+
+// parse timeout of blocking commands in seconds, zero means block forever
+func parseBlockTimeout(b []byte) (time.Duration, error) {
+	timeout, err := strconv.ParseFloat(string(b), 64)
+	if err != nil || math.IsNaN(timeout) || math.IsInf(timeout, 0) {
+		return 0, terror.ErrTimeoutNotFloat
+	}
+	if timeout < 0 {
+		return 0, terror.ErrTimeoutNegative
+	}
+	return time.Duration(timeout * float64(time.Second)), nil
+}
+
+// blockPop tries pop on keys in order until one returns non-nil result, and
+// blocks until timeout if all keys are empty. clients blocked on the same key
+// are served in FIFO order on this instance, a client only pops the keys it is
+// the head waiter of, and wakeups of other keys are passed to their heads when
+// it is done. in transaction it never blocks like redis.
+func (c *Client) blockPop(keys [][]byte, timeout time.Duration, pop func(key []byte) (interface{}, error)) (interface{}, error) {
+	popKeys := func(keys [][]byte) (interface{}, error) {
+		for _, key := range keys {
+			v, err := pop(key)
+			if err != nil || v != nil {
+				return v, err
+			}
+		}
+		return nil, nil
+	}
+
+	if c.IsTxn() {
+		return popKeys(keys)
+	}
+
+	// queue before the first try, writes after it are not missed
+	w := c.tdb.WaitKeys(c.dbId, keys)
+	defer w.Done()
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	// keys with clients waiting ahead are served to them first
+	v, err := popKeys(w.HeadKeys())
+	if err != nil || v != nil {
+		return v, err
+	}
+
+	atomic.AddInt32(&c.app.blockedCount, 1)
+	defer atomic.AddInt32(&c.app.blockedCount, -1)
+	c.setBlocked(true)
+	defer c.setBlocked(false)
+
+	for {
+		select {
+		case <-w.Ready():
+		case <-deadline:
+			return nil, nil
+		case <-c.app.quitCh:
+			return nil, nil
+		case <-c.killed:
+			return nil, nil
+		}
+
+		v, err := popKeys(w.HeadKeys())
+		if err != nil || v != nil {
+			return v, err
+		}
+	}
+}
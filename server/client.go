@@ -12,7 +12,9 @@ import (
 	"bytes"
 	"io"
 	"net"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -33,6 +35,12 @@ type Command struct {
 type Client struct {
 	app *App
 
+	// assigned by client registry
+	id      int64
+	created time.Time
+	// snapshot of state for client list
+	info clientInfo
+
 	tdb *tidis.Tidis
 
 	dbId uint8
@@ -46,21 +54,59 @@ type Client struct {
 	cmds    []Command
 	txn     kv.Transaction
 	respTxn []interface{}
+	// a command is rejected while queuing, exec is aborted
+	txnAborted bool
+	// keyspace events of queued commands, published after commit
+	txnEvents []keyspaceEvent
+	// keys written by queued commands, invalidated after commit
+	txnInvalidate [][]byte
+	txnFlush      bool
+
+	// optimistic lock, exec is aborted if watched keys committed after watchTs
+	watchTs   uint64
+	watchKeys [][]byte
 
 	// connection authentation
 	isAuthed bool
+	// acl user of connection
+	user string
+
+	// subscriptions, client is in push mode if any
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	// published messages waiting to be written
+	pushCh chan []interface{}
+	// keys read by client are tracked for invalidation
+	tracking bool
 
 	buf bytes.Buffer
 
 	conn net.Conn
-
+	// closed when the client loop ends
+	done chan struct{}
+	// closed by client kill
+	killed   chan struct{}
+	killOnce sync.Once
+	// connection is closed after reply of current command
+	closeAfterReply bool
+
+	// client reply mode
+	replyMode int
+	out       *replyWriter
+
+	// bytes of requests read but not parsed, updated by reader goroutine
+	qbuf int64
+
+	br      *bufio.Reader
+	bw      *bufio.Writer
 	rReader *goredis.RespReader
-	rWriter *goredis.RespWriter
+	rWriter *respWriter
 }
 
 func newClient(app *App) *Client {
+	// authenticated as default user if it needs no password
 	authed := false
-	if app.auth == "" {
+	if u := app.getUser(aclDefaultUser); u != nil && u.enabled && u.nopass {
 		authed = true
 	}
 
@@ -68,8 +114,16 @@ func newClient(app *App) *Client {
 		app:      app,
 		tdb:      app.tdb,
 		isAuthed: authed,
+		user:     aclDefaultUser,
 		dbId:     0,
+		pushCh:   make(chan []interface{}, pushQueueSize),
+		done:     make(chan struct{}),
+		killed:   make(chan struct{}),
+		created:  time.Now(),
 	}
+	client.info.multi = -1
+	client.info.lastTime = client.created
+	client.info.resp = 2
 	return client
 }
 
@@ -79,27 +133,71 @@ func ClientHandler(conn net.Conn, app *App) {
 	c.conn = conn
 	// connection buffer setting
 
-	br := bufio.NewReader(conn)
-	c.rReader = goredis.NewRespReader(br)
+	c.br = bufio.NewReader(conn)
+	c.rReader = goredis.NewRespReader(c.br)
 
-	bw := bufio.NewWriter(conn)
-	c.rWriter = goredis.NewRespWriter(bw)
+	c.out = &replyWriter{w: conn}
+	c.bw = bufio.NewWriter(c.out)
+	c.rWriter = newRespWriter(c.bw)
 
 	app.clientWG.Add(1)
-	atomic.AddInt32(&app.clientCount, 1)
+	app.clients.add(c)
+	app.stats.connAccepted()
 
 	go c.connHandler()
 }
 
-// for multi transaction commands
+// for multi transaction commands, txn reads the newest data
 func (c *Client) NewTxn() error {
-	var ok bool
 	txn, err := c.tdb.NewTxn()
+	if err != nil {
+		return err
+	}
+	var ok bool
 	c.txn, ok = txn.(kv.Transaction)
 	if !ok {
 		return terror.ErrBackendType
 	}
-	return err
+	if err = c.lockWatchKeys(); err != nil {
+		c.RollbackTxn()
+		return err
+	}
+	return nil
+}
+
+// lockWatchKeys locks meta of watched keys until exec committed, locking
+// fails with write conflict if any of them was committed after watch, so only
+// changes of watched keys abort exec
+func (c *Client) lockWatchKeys() error {
+	if len(c.watchKeys) == 0 {
+		return nil
+	}
+	c.txn.SetOption(kv.Pessimistic, true)
+	keys := make([]kv.Key, len(c.watchKeys))
+	for i, key := range c.watchKeys {
+		keys[i] = key
+	}
+	lockCtx := &kv.LockCtx{ForUpdateTS: c.watchTs, LockWaitTime: kv.LockNoWait}
+	return c.txn.LockKeys(context.Background(), lockCtx, keys...)
+}
+
+func (c *Client) Watch(keys [][]byte) error {
+	if c.watchTs == 0 {
+		ts, err := c.tdb.GetCurrentVersion()
+		if err != nil {
+			return err
+		}
+		c.watchTs = ts
+	}
+	for _, key := range keys {
+		c.watchKeys = append(c.watchKeys, c.tdb.RawKeyPrefix(c.dbId, key))
+	}
+	return nil
+}
+
+func (c *Client) Unwatch() {
+	c.watchTs = 0
+	c.watchKeys = nil
 }
 
 func (c *Client) GetCurrentTxn() kv.Transaction {
@@ -114,11 +212,11 @@ func (c *Client) addResp(resp interface{}) {
 }
 
 func (c *Client) CommitTxn() error {
-	return c.txn.Commit(context.Background())
+	return c.tdb.CommitTxn(c.txn)
 }
 
 func (c *Client) RollbackTxn() error {
-	return c.txn.Rollback()
+	return c.tdb.RollbackTxn(c.txn)
 }
 
 func (c *Client) IsTxn() bool {
@@ -126,30 +224,11 @@ func (c *Client) IsTxn() bool {
 }
 
 func (c *Client) Resp(resp interface{}) error {
-	var err error
-
 	if c.isTxn {
 		c.addResp(resp)
-	} else {
-		switch v := resp.(type) {
-		case []interface{}:
-			err = c.rWriter.WriteArray(v)
-		case []byte:
-			err = c.rWriter.WriteBulk(v)
-		case nil:
-			err = c.rWriter.WriteBulk(nil)
-		case int64:
-			err = c.rWriter.WriteInteger(v)
-		case string:
-			err = c.rWriter.WriteString(v)
-		case error:
-			err = c.rWriter.WriteError(v)
-		default:
-			err = terror.ErrUnknownType
-		}
+		return nil
 	}
-
-	return err
+	return c.rWriter.WriteValue(resp)
 }
 
 func (c *Client) FlushResp(resp interface{}) error {
@@ -160,39 +239,20 @@ func (c *Client) FlushResp(resp interface{}) error {
 	return c.rWriter.Flush()
 }
 
-// treat string as bulk array
-func (c *Client) Resp1(resp interface{}) error {
-	var err error
-
-	if c.isTxn {
-		c.addResp(resp)
-	} else {
-		switch v := resp.(type) {
-		case []interface{}:
-			err = c.rWriter.WriteArray(v)
-		case []byte:
-			err = c.rWriter.WriteBulk(v)
-		case nil:
-			err = c.rWriter.WriteBulk(nil)
-		case int64:
-			err = c.rWriter.WriteInteger(v)
-		case string:
-			err = c.rWriter.WriteBulk([]byte(v))
-		case error:
-			err = c.rWriter.WriteError(v)
-		default:
-			err = terror.ErrUnknownType
-		}
-	}
-
-	return err
-}
 func (c *Client) connHandler() {
 
 	defer func(c *Client) {
+		// queued commands of open multi are never executed
+		if c.isTxn {
+			log.Infof("client %s closed in multi, discard %d commands", c.conn.RemoteAddr(), len(c.cmds))
+			c.resetTxnStatus()
+		}
+		c.unsubscribeAll()
+		c.app.tracking.disable(c)
+		close(c.done)
 		c.conn.Close()
+		c.app.clients.remove(c)
 		c.app.clientWG.Done()
-		atomic.AddInt32(&c.app.clientCount, -1)
 	}(c)
 
 	select {
@@ -202,10 +262,48 @@ func (c *Client) connHandler() {
 		break
 	}
 
+	// requests are read in another goroutine, so published messages can be
+	// written while waiting for requests, all writes are done here
+	reqCh := make(chan [][]byte)
+	go c.readRequests(reqCh)
+
 	for {
-		c.cmd = ""
-		c.args = nil
+		select {
+		case req, ok := <-reqCh:
+			if !ok {
+				return
+			}
+			c.cmd = ""
+			c.args = nil
+
+			err := c.handleRequest(req)
+			c.updateInfo()
+			if err != nil && err != io.EOF {
+				log.Error(err.Error())
+				return
+			}
+			if c.closeAfterReply {
+				return
+			}
+		case msg := <-c.pushCh:
+			if msg = c.pushMessage(msg); msg == nil {
+				continue
+			}
+			if err := c.rWriter.FlushValue(respPush(msg)); err != nil {
+				log.Error(err.Error())
+				return
+			}
+		case <-c.app.quitCh:
+			return
+		}
+	}
+}
 
+// readRequests parses requests from connection until it fails or client loop ends
+func (c *Client) readRequests(reqCh chan<- [][]byte) {
+	defer close(reqCh)
+
+	for {
 		req, err := c.rReader.ParseRequest()
 		if err != nil && strings.Contains(err.Error(), "short resp line") {
 			continue
@@ -215,9 +313,11 @@ func (c *Client) connHandler() {
 		} else if err != nil {
 			return
 		}
-		err = c.handleRequest(req)
-		if err != nil && err != io.EOF {
-			log.Error(err.Error())
+		atomic.StoreInt64(&c.qbuf, int64(c.br.Buffered()))
+
+		select {
+		case reqCh <- req:
+		case <-c.done:
 			return
 		}
 	}
@@ -225,8 +325,13 @@ func (c *Client) connHandler() {
 
 func (c *Client) resetTxnStatus() {
 	c.isTxn = false
+	c.txnAborted = false
 	c.cmds = []Command{}
 	c.respTxn = []interface{}{}
+	c.txnEvents = nil
+	c.txnInvalidate = nil
+	c.txnFlush = false
+	c.Unwatch()
 }
 
 func (c *Client) handleRequest(req [][]byte) error {
@@ -238,17 +343,53 @@ func (c *Client) handleRequest(req [][]byte) error {
 		c.args = req[1:]
 	}
 
-	// auth check
-	if c.cmd != "auth" {
+	// client reply off or skip
+	c.out.discard = c.replyMode != replyOn
+	if c.replyMode == replySkip {
+		c.replyMode = replyOn
+	}
+	c.updateInfo()
+
+	// auth check, hello authenticates with auth option
+	if c.cmd != "auth" && c.cmd != "hello" {
 		if !c.isAuthed {
 			c.FlushResp(terror.ErrAuthReqired)
 			return nil
 		}
 	}
 
+	// only pubsub commands in push mode, resp3 pushes are out of band
+	if c.InPubSub() && c.rWriter.proto == 2 && !pubsubCommands[c.cmd] {
+		c.FlushResp(terror.ErrPubSubContext)
+		return nil
+	}
+
+	if c.cmd != "auth" && c.cmd != "hello" {
+		if err := c.checkPermission(); err != nil {
+			if c.isTxn {
+				// responses are queued in txn, write error directly and
+				// abort exec like redis
+				c.rWriter.FlushError(err)
+				c.txnAborted = true
+			} else {
+				c.FlushResp(err)
+			}
+			return nil
+		}
+	}
+
+	// client commands are not paused, so clients can be unpaused
+	if c.cmd != "client" && !c.waitPause() {
+		// killed or shut down while paused
+		return io.EOF
+	}
+
 	var err error
 
 	log.Debugf("command: %s argc:%d", c.cmd, len(c.args))
+	if _, ok := connCommandCategories[c.cmd]; ok {
+		defer c.commandDone(c.cmd, c.args, time.Now(), nil)
+	}
 	switch c.cmd {
 	case "multi":
 		// mark connection as transactional
@@ -264,6 +405,11 @@ func (c *Client) handleRequest(req [][]byte) error {
 			c.FlushResp(terror.ErrExecWithoutMulti)
 			return nil
 		}
+		if c.txnAborted {
+			c.resetTxnStatus()
+			c.rWriter.FlushError(terror.ErrExecAbort)
+			return nil
+		}
 		err = c.NewTxn()
 		if err != nil {
 			c.resetTxnStatus()
@@ -274,18 +420,35 @@ func (c *Client) handleRequest(req [][]byte) error {
 		// execute transactional commands in txn
 		// execute commands
 		log.Debugf("command length:%d txn:%v", len(c.cmds), c.isTxn)
-		if len(c.cmds) == 0 || !c.isTxn {
-			c.rWriter.FlushBulk(nil)
+		if len(c.cmds) == 0 {
+			// watched keys are checked, locks of them are released
+			c.RollbackTxn()
+			c.rWriter.FlushValue([]interface{}{})
 			c.resetTxnStatus()
 			return nil
 		}
 
-		for _, cmd := range c.cmds {
-			log.Debugf("execute command: %s", cmd.cmd)
-			// set cmd and args processing
-			c.cmd = cmd.cmd
-			c.args = cmd.args
-			if err = c.execute(); err != nil {
+		for retry := true; ; retry = false {
+			for _, cmd := range c.cmds {
+				log.Debugf("execute command: %s", cmd.cmd)
+				// set cmd and args processing
+				c.cmd = cmd.cmd
+				c.args = cmd.args
+				if err = c.execute(); err != nil {
+					break
+				}
+			}
+			if err != terror.ErrTryAgain || !retry {
+				break
+			}
+			// zset scores were converted out of txn, run commands again once
+			// in a new txn to see them
+			c.RollbackTxn()
+			c.respTxn = []interface{}{}
+			c.txnEvents = nil
+			c.txnInvalidate = nil
+			c.txnFlush = false
+			if err = c.NewTxn(); err != nil {
 				break
 			}
 		}
@@ -295,7 +458,15 @@ func (c *Client) handleRequest(req [][]byte) error {
 		} else {
 			err = c.CommitTxn()
 			if err == nil {
-				c.rWriter.FlushArray(c.respTxn)
+				for _, ev := range c.txnEvents {
+					c.tdb.NotifyKeyspaceEvent(ev.class, ev.event, ev.dbId, ev.key)
+				}
+				if c.txnFlush {
+					c.invalidateKeys(nil)
+				} else if len(c.txnInvalidate) > 0 {
+					c.invalidateKeys(c.txnInvalidate)
+				}
+				c.rWriter.FlushValue(c.respTxn)
 			} else {
 				c.rWriter.FlushBulk(nil)
 			}
@@ -304,6 +475,23 @@ func (c *Client) handleRequest(req [][]byte) error {
 		c.resetTxnStatus()
 		return nil
 
+	case "watch":
+		if c.isTxn {
+			// responses are queued in txn, write error directly
+			c.rWriter.FlushError(terror.ErrWatchInMulti)
+			return nil
+		}
+		if len(c.args) == 0 {
+			c.FlushResp(terror.ErrCmdParams)
+			return nil
+		}
+		if err = c.Watch(c.args); err != nil {
+			c.FlushResp(err)
+		} else {
+			c.FlushResp("OK")
+		}
+		return nil
+
 	case "discard":
 		// discard transactional commands
 		if c.isTxn {
@@ -315,24 +503,47 @@ func (c *Client) handleRequest(req [][]byte) error {
 		return nil
 
 	case "auth":
-		// auth connection
-		if len(c.args) != 1 {
+		// auth password authenticates default user, or auth username password
+		if len(c.args) == 1 {
+			if u := c.app.getUser(aclDefaultUser); u != nil && u.nopass {
+				c.FlushResp(terror.ErrAuthNoNeed)
+			} else if !c.app.authenticate(aclDefaultUser, string(c.args[0])) {
+				c.FlushResp(terror.ErrAuthFailed)
+			} else {
+				c.isAuthed = true
+				c.user = aclDefaultUser
+				c.FlushResp("OK")
+			}
+		} else if len(c.args) == 2 {
+			if !c.app.authenticate(string(c.args[0]), string(c.args[1])) {
+				c.FlushResp(terror.ErrWrongPass)
+			} else {
+				c.isAuthed = true
+				c.user = string(c.args[0])
+				c.FlushResp("OK")
+			}
+		} else {
 			c.FlushResp(terror.ErrCmdParams)
 		}
-		if c.app.auth == "" {
-			c.FlushResp(terror.ErrAuthNoNeed)
-		} else if string(c.args[0]) != c.app.auth {
-			c.isAuthed = false
-			c.FlushResp(terror.ErrAuthFailed)
-		} else {
-			c.isAuthed = true
-			c.FlushResp("OK")
+		return nil
+
+	case "hello":
+		if c.isTxn {
+			// responses are queued in txn, write error directly, protocol
+			// is not switched
+			c.rWriter.FlushError(terror.ErrHelloInMulti)
+			return nil
+		}
+		if err := c.hello(); err != nil {
+			c.FlushResp(err)
 		}
 		return nil
 
 	case "ping":
 		if len(c.args) != 0 {
 			c.FlushResp(terror.ErrCmdParams)
+		} else if c.InPubSub() && c.rWriter.proto == 2 {
+			c.FlushResp([]interface{}{[]byte("pong"), []byte("")})
 		} else {
 			c.FlushResp("PONG")
 		}
@@ -344,13 +555,6 @@ func (c *Client) handleRequest(req [][]byte) error {
 			c.FlushResp(c.args[0])
 		}
 		return nil
-	case "info":
-		if len(c.args) == 1 {
-			c.FlushResp([]byte("# Cluster\r\ncluster_enabled:0\r\n"))
-		} else {
-			c.FlushResp([]byte("# Server\r\nredis_mode:standalone\r\n"))
-		}
-		return nil
 	}
 
 	if c.isTxn {
@@ -374,7 +578,18 @@ func (c *Client) execute() error {
 	} else if f, ok := cmdFind(c.cmd); !ok {
 		err = terror.ErrCommand
 	} else {
+		tracking := c.app.conf.Tidis.TrackingEnabled
+		if tracking {
+			c.trackCommand()
+		}
 		err = f(c)
+		c.commandDone(c.cmd, c.args, start, err)
+		if tracking && err == nil {
+			c.invalidateCommand()
+		}
+	}
+	if err != nil {
+		c.app.stats.commandError(err)
 	}
 	if err != nil && !c.isTxn {
 		c.rWriter.FlushError(err)
@@ -386,6 +601,75 @@ func (c *Client) execute() error {
 	return err
 }
 
+// commandDone records stats and slow log of command
+func (c *Client) commandDone(cmd string, args [][]byte, start time.Time, err error) {
+	c.app.stats.commandDone(cmd, start, err)
+	c.app.slowlog.record(cmd, args, start, time.Since(start), c.conn.RemoteAddr().String(), c.getName())
+}
+
+// hello [protover [AUTH username password] [SETNAME clientname]] switches
+// protocol of connection and replies server info in it
+func (c *Client) hello() error {
+	proto := c.rWriter.proto
+	if len(c.args) > 0 {
+		v, err := strconv.Atoi(string(c.args[0]))
+		if err != nil {
+			return terror.ErrNotInteger
+		}
+		if v != 2 && v != 3 {
+			return terror.ErrNoProto
+		}
+		proto = v
+	}
+
+	var user, pass, name []byte
+	for i := 1; i < len(c.args); i++ {
+		switch strings.ToLower(string(c.args[i])) {
+		case "auth":
+			if i+2 >= len(c.args) {
+				return terror.ErrCmdParams
+			}
+			user, pass = c.args[i+1], c.args[i+2]
+			i += 2
+		case "setname":
+			if i+1 >= len(c.args) {
+				return terror.ErrCmdParams
+			}
+			name = c.args[i+1]
+			if !validClientName(name) {
+				return terror.ErrClientName
+			}
+			i++
+		default:
+			return terror.ErrCmdParams
+		}
+	}
+
+	if user != nil {
+		if !c.app.authenticate(string(user), string(pass)) {
+			return terror.ErrWrongPass
+		}
+		c.isAuthed = true
+		c.user = string(user)
+	} else if !c.isAuthed {
+		return terror.ErrAuthReqired
+	}
+	if name != nil {
+		c.setName(string(name))
+	}
+
+	c.rWriter.proto = proto
+	return c.FlushResp(respMap{
+		[]byte("server"), []byte("redis"),
+		[]byte("version"), []byte(redisVersion),
+		[]byte("proto"), int64(proto),
+		[]byte("id"), c.id,
+		[]byte("mode"), []byte("standalone"),
+		[]byte("role"), []byte("master"),
+		[]byte("modules"), []interface{}{},
+	})
+}
+
 func (c *Client) SelectDB(dbId uint8) {
 	c.dbId = dbId
 }
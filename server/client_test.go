@@ -0,0 +1,234 @@
+//
+// client_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yongman/go/goredis"
+	"github.com/yongman/tidis/terror"
+)
+
+func TestWatch(t *testing.T) {
+	app := newTestApp(t)
+	c1 := newTestConn(t, app)
+	defer c1.Close()
+	c2 := newTestConn(t, app)
+	defer c2.Close()
+
+	c1.Do("set", "k", "1")
+	c1.Do("hset", "h", "f", "1")
+
+	// unchanged watched keys, exec succeeds
+	if s, err := goredis.String(c1.Do("watch", "k", "h")); err != nil || s != "OK" {
+		t.Fatalf("watch got %s %v", s, err)
+	}
+	c1.Do("multi")
+	c1.Do("set", "k", "2")
+	if v, err := goredis.Values(c1.Do("exec")); err != nil || len(v) != 1 {
+		t.Fatalf("exec expect 1 reply, got %v %v", v, err)
+	}
+
+	// string modified by another connection, exec aborts
+	c1.Do("watch", "k")
+	c2.Do("set", "k", "3")
+	c1.Do("multi")
+	c1.Do("set", "k", "4")
+	if v, err := c1.Do("exec"); err != nil || v != nil {
+		t.Fatalf("exec expect nil, got %v %v", v, err)
+	}
+	if s, _ := goredis.String(c1.Do("get", "k")); s != "3" {
+		t.Fatalf("aborted exec modified key, got %s", s)
+	}
+
+	// field overwritten in place, exec aborts
+	c1.Do("watch", "h")
+	c2.Do("hset", "h", "f", "2")
+	c1.Do("multi")
+	c1.Do("set", "k", "5")
+	if v, err := c1.Do("exec"); err != nil || v != nil {
+		t.Fatalf("exec expect nil, got %v %v", v, err)
+	}
+
+	// exec reads newest data, keys not watched do not abort it
+	c1.Do("watch", "k")
+	c2.Do("set", "other", "new")
+	c1.Do("multi")
+	c1.Do("get", "other")
+	c1.Do("set", "other", "mine")
+	if v, err := goredis.Values(c1.Do("exec")); err != nil || len(v) != 2 || string(v[0].([]byte)) != "new" {
+		t.Fatalf("exec expect reply of newest data, got %s %v", v, err)
+	}
+
+	// unwatch drops watched keys
+	c1.Do("watch", "k")
+	c2.Do("set", "k", "6")
+	c1.Do("unwatch")
+	c1.Do("multi")
+	c1.Do("set", "k", "7")
+	if v, err := goredis.Values(c1.Do("exec")); err != nil || len(v) != 1 {
+		t.Fatalf("exec after unwatch expect 1 reply, got %v %v", v, err)
+	}
+
+	// empty exec replies empty array and releases watched keys
+	c1.Do("watch", "k")
+	c1.Do("multi")
+	if v, err := goredis.Values(c1.Do("exec")); err != nil || v == nil || len(v) != 0 {
+		t.Fatalf("empty exec expect empty array, got %v %v", v, err)
+	}
+	start := time.Now()
+	if _, err := c2.Do("set", "k", "8"); err != nil || time.Since(start) > time.Second {
+		t.Fatalf("set after empty exec got %v in %v", err, time.Since(start))
+	}
+	c1.Do("watch", "k")
+	c2.Do("set", "k", "9")
+	c1.Do("multi")
+	if v, err := c1.Do("exec"); err != nil || v != nil {
+		t.Fatalf("empty exec with changed watched key expect nil, got %v %v", v, err)
+	}
+
+	c1.Do("multi")
+	if _, err := c1.Do("watch", "k"); err == nil {
+		t.Fatalf("watch inside multi should fail")
+	}
+	c1.Do("discard")
+}
+
+func TestClientCommands(t *testing.T) {
+	app := newTestApp(t)
+	c1 := newTestConn(t, app)
+	defer c1.Close()
+	c2 := newTestConn(t, app)
+	defer c2.Close()
+
+	id1, _ := goredis.Int64(c1.Do("client", "id"))
+	id2, _ := goredis.Int64(c2.Do("client", "id"))
+	if id1 <= 0 || id2 <= id1 {
+		t.Fatalf("client ids %d %d", id1, id2)
+	}
+
+	if v, err := c1.Do("client", "getname"); err != nil || v != nil {
+		t.Fatalf("getname got %v %v", v, err)
+	}
+	if _, err := c1.Do("client", "setname", "a b"); err == nil || err.Error() != terror.ErrClientName.Error() {
+		t.Fatalf("setname with space got %v", err)
+	}
+	c1.Do("client", "setname", "worker")
+	if s, _ := goredis.String(c1.Do("client", "getname")); s != "worker" {
+		t.Fatalf("getname got %s", s)
+	}
+
+	c2.Do("select", "3")
+	c2.Do("multi")
+	c2.Do("set", "k", "v")
+	list, err := goredis.String(c1.Do("client", "list"))
+	if err != nil {
+		t.Fatalf("client list failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(list, "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("client list got %q", list)
+	}
+	for _, expect := range []string{fmt.Sprintf("id=%d ", id1), " name=worker ", " flags=N ", " cmd=client"} {
+		if !strings.Contains(lines[0], expect) {
+			t.Fatalf("client list line %q missing %q", lines[0], expect)
+		}
+	}
+	for _, expect := range []string{fmt.Sprintf("id=%d ", id2), " flags=x ", " db=3 ", " multi=1 ", " cmd=set"} {
+		if !strings.Contains(lines[1], expect) {
+			t.Fatalf("client list line %q missing %q", lines[1], expect)
+		}
+	}
+	if s, _ := goredis.String(c1.Do("client", "list", "id", fmt.Sprint(id2))); !strings.HasPrefix(s, fmt.Sprintf("id=%d ", id2)) || strings.Count(s, "\n") != 1 {
+		t.Fatalf("client list id got %q", s)
+	}
+	if s, _ := goredis.String(c1.Do("client", "info")); !strings.HasPrefix(s, lines[0][:strings.Index(lines[0], " age=")]) {
+		t.Fatalf("client info got %q", s)
+	}
+	c2.Do("discard")
+
+	// reply off and skip
+	c1.Send("client", "reply", "skip")
+	c1.Send("set", "k", "skipped")
+	if s, _ := goredis.String(c1.Do("get", "k")); s != "skipped" {
+		t.Fatalf("get after reply skip got %s", s)
+	}
+	c1.Send("client", "reply", "off")
+	c1.Send("set", "k", "off")
+	c1.Send("client", "reply", "on")
+	if s, _ := goredis.String(c1.Receive()); s != "OK" {
+		t.Fatalf("reply on got %s", s)
+	}
+	if s, _ := goredis.String(c1.Do("get", "k")); s != "off" {
+		t.Fatalf("get after reply on got %s", s)
+	}
+
+	// pause write delays writes only
+	c1.Do("client", "pause", "200", "write")
+	start := time.Now()
+	if _, err := c2.Do("get", "k"); err != nil || time.Since(start) > 100*time.Millisecond {
+		t.Fatalf("get is paused, %v", err)
+	}
+	if _, err := c2.Do("set", "k", "v"); err != nil || time.Since(start) < 150*time.Millisecond {
+		t.Fatalf("set is not paused, %v", err)
+	}
+	c1.Do("client", "pause", "5000")
+	unpaused := make(chan struct{})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		c1.Do("client", "unpause")
+		close(unpaused)
+	}()
+	start = time.Now()
+	if _, err := c2.Do("get", "k"); err != nil || time.Since(start) > 2*time.Second {
+		t.Fatalf("get after unpause got %v", err)
+	}
+	<-unpaused
+
+	if _, err := c1.Do("client", "kill", "127.0.0.1:1"); err == nil || err.Error() != terror.ErrNoSuchClient.Error() {
+		t.Fatalf("kill unknown addr got %v", err)
+	}
+	// kill blocked client
+	go c2.Do("blpop", "q", "0")
+	time.Sleep(100 * time.Millisecond)
+	if !strings.Contains(mustString(t, c1, "client", "list", "id", fmt.Sprint(id2)), " flags=b ") {
+		t.Fatalf("client is not blocked")
+	}
+	if n, _ := goredis.Int64(c1.Do("client", "kill", "id", fmt.Sprint(id2))); n != 1 {
+		t.Fatalf("kill by id got %d", n)
+	}
+	for i := 0; i < 50 && app.clients.len() != 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := app.clients.len(); n != 1 {
+		t.Fatalf("clients after kill %d", n)
+	}
+
+	// skipme
+	if n, _ := goredis.Int64(c1.Do("client", "kill", "type", "normal")); n != 0 {
+		t.Fatalf("kill skips current client, got %d", n)
+	}
+	if n, _ := goredis.Int64(c1.Do("client", "kill", "type", "normal", "skipme", "no")); n != 1 {
+		t.Fatalf("kill skipme no got %d", n)
+	}
+	if _, err := c1.Do("ping"); err == nil {
+		t.Fatalf("killed client still serves")
+	}
+}
+
+func mustString(t *testing.T, c *goredis.Conn, cmd string, args ...interface{}) string {
+	t.Helper()
+	s, err := goredis.String(c.Do(cmd, args...))
+	if err != nil {
+		t.Fatalf("%s %v failed: %v", cmd, args, err)
+	}
+	return s
+}
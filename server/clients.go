@@ -0,0 +1,277 @@
+//
+// clients.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// clientRegistry keeps live clients of this instance by id
+type clientRegistry struct {
+	sync.RWMutex
+	nextId  int64
+	clients map[int64]*Client
+}
+
+func newClientRegistry() *clientRegistry {
+	return &clientRegistry{
+		clients: make(map[int64]*Client),
+	}
+}
+
+// add assigns id to client and registers it
+func (r *clientRegistry) add(c *Client) {
+	r.Lock()
+	defer r.Unlock()
+	r.nextId++
+	c.id = r.nextId
+	r.clients[c.id] = c
+}
+
+func (r *clientRegistry) remove(c *Client) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.clients, c.id)
+}
+
+// get returns client of id, nil if it is gone
+func (r *clientRegistry) get(id int64) *Client {
+	r.RLock()
+	defer r.RUnlock()
+	return r.clients[id]
+}
+
+func (r *clientRegistry) len() int {
+	r.RLock()
+	defer r.RUnlock()
+	return len(r.clients)
+}
+
+// list returns clients ordered by id
+func (r *clientRegistry) list() []*Client {
+	r.RLock()
+	clients := make([]*Client, 0, len(r.clients))
+	for _, c := range r.clients {
+		clients = append(clients, c)
+	}
+	r.RUnlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].id < clients[j].id
+	})
+	return clients
+}
+
+// clientInfo is state of client shown by client list, it is updated by the
+// client goroutine and read by others under lock
+type clientInfo struct {
+	sync.Mutex
+	clientState
+}
+
+type clientState struct {
+	name     string
+	db       uint8
+	lastCmd  string
+	lastTime time.Time
+	// queued commands, -1 if not in multi
+	multi   int
+	sub     int
+	psub    int
+	blocked bool
+	// bytes of replies not flushed and messages waiting to be pushed
+	obl int
+	oll int
+	// protocol version
+	resp int
+}
+
+// updateInfo snapshots state of client for client list
+func (c *Client) updateInfo() {
+	multi := -1
+	if c.isTxn {
+		multi = len(c.cmds)
+	}
+
+	c.info.Lock()
+	defer c.info.Unlock()
+	if c.cmd != "" {
+		c.info.lastCmd = c.cmd
+	}
+	c.info.lastTime = time.Now()
+	c.info.db = c.dbId
+	c.info.multi = multi
+	c.info.sub = len(c.channels)
+	c.info.psub = len(c.patterns)
+	c.info.obl = c.bw.Buffered()
+	c.info.oll = len(c.pushCh)
+	c.info.resp = c.rWriter.proto
+}
+
+func (c *Client) setBlocked(blocked bool) {
+	c.info.Lock()
+	c.info.blocked = blocked
+	c.info.Unlock()
+}
+
+func (c *Client) setName(name string) {
+	c.info.Lock()
+	c.info.name = name
+	c.info.Unlock()
+}
+
+func (c *Client) getName() string {
+	c.info.Lock()
+	defer c.info.Unlock()
+	return c.info.name
+}
+
+// describe formats client in the line format of client list
+func (c *Client) describe() string {
+	c.info.Lock()
+	info := c.info.clientState
+	c.info.Unlock()
+
+	flags := ""
+	if info.multi >= 0 {
+		flags += "x"
+	}
+	if info.blocked {
+		flags += "b"
+	}
+	if info.sub+info.psub > 0 {
+		flags += "P"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+
+	now := time.Now()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "id=%d addr=%s laddr=%s name=%s age=%d idle=%d flags=%s db=%d sub=%d psub=%d multi=%d qbuf=%d obl=%d oll=%d cmd=%s resp=%d",
+		c.id, c.conn.RemoteAddr(), c.conn.LocalAddr(), info.name,
+		int64(now.Sub(c.created)/time.Second), int64(now.Sub(info.lastTime)/time.Second),
+		flags, info.db, info.sub, info.psub, info.multi,
+		atomic.LoadInt64(&c.qbuf), info.obl, info.oll, info.lastCmd, info.resp)
+	return buf.String()
+}
+
+// kill closes connection of client, blocked and paused client are woken up
+func (c *Client) kill() {
+	c.killOnce.Do(func() {
+		close(c.killed)
+		c.conn.Close()
+	})
+}
+
+const (
+	replyOn = iota
+	replyOff
+	replySkip
+)
+
+// replyWriter discards replies written to connection if client reply is off
+type replyWriter struct {
+	w       io.Writer
+	discard bool
+}
+
+func (w *replyWriter) Write(p []byte) (int, error) {
+	if w.discard {
+		return len(p), nil
+	}
+	return w.w.Write(p)
+}
+
+// clientPause delays commands of clients until timeout or unpause
+type clientPause struct {
+	sync.Mutex
+	until time.Time
+	// only write commands are paused if false
+	all bool
+	// closed by unpause
+	unpauseCh chan struct{}
+}
+
+func (p *clientPause) pause(until time.Time, all bool) {
+	p.Lock()
+	defer p.Unlock()
+	// like redis, a shorter or weaker pause does not override current one
+	if p.unpauseCh != nil && time.Now().Before(p.until) {
+		if until.Before(p.until) {
+			until = p.until
+		}
+		all = all || p.all
+	} else {
+		p.unpauseCh = make(chan struct{})
+	}
+	p.until = until
+	p.all = all
+}
+
+func (p *clientPause) unpause() {
+	p.Lock()
+	defer p.Unlock()
+	if p.unpauseCh != nil {
+		close(p.unpauseCh)
+		p.unpauseCh = nil
+	}
+}
+
+// wait returns channels to wait on if command is paused
+func (p *clientPause) wait(write bool) (<-chan time.Time, <-chan struct{}, bool) {
+	p.Lock()
+	defer p.Unlock()
+	if p.unpauseCh == nil || !(p.all || write) {
+		return nil, nil, false
+	}
+	d := time.Until(p.until)
+	if d <= 0 {
+		return nil, nil, false
+	}
+	return time.After(d), p.unpauseCh, true
+}
+
+// waitPause blocks client while its current command is paused, returns false
+// if client is killed or app is shut down in pause
+func (c *Client) waitPause() bool {
+	// publish is paused like writes
+	isWrite := func(cmd string) bool {
+		return cmdHasCategory(cmd, "write") || cmd == "publish"
+	}
+	write := isWrite(c.cmd)
+	if c.cmd == "exec" {
+		for _, cmd := range c.cmds {
+			write = write || isWrite(cmd.cmd)
+		}
+	} else if c.isTxn {
+		// queued commands are paused at exec
+		write = false
+	}
+
+	for {
+		timeout, unpauseCh, paused := c.app.pause.wait(write)
+		if !paused {
+			return true
+		}
+		select {
+		case <-timeout:
+		case <-unpauseCh:
+		case <-c.killed:
+			return false
+		case <-c.app.quitCh:
+			return false
+		}
+	}
+}
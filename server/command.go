@@ -7,23 +7,77 @@
 
 package server
 
+import (
+	"sort"
+)
+
 type CmdFunc func(c *Client) error
 
-var cmds map[string]CmdFunc
+type cmdInfo struct {
+	f CmdFunc
+	// acl categories without @
+	categories []string
+}
+
+var cmds map[string]*cmdInfo
 
 func init() {
-	cmds = make(map[string]CmdFunc, 50)
+	cmds = make(map[string]*cmdInfo, 50)
 }
 
-func cmdRegister(cmdName string, f CmdFunc) {
+func cmdRegister(cmdName string, f CmdFunc, categories ...string) {
 	if _, ok := cmds[cmdName]; ok {
 		// cmd already exists
 		return
 	}
-	cmds[cmdName] = f
+	cmds[cmdName] = &cmdInfo{f: f, categories: categories}
 }
 
 func cmdFind(cmdName string) (CmdFunc, bool) {
 	cmd, ok := cmds[cmdName]
-	return cmd, ok
+	if !ok {
+		return nil, false
+	}
+	return cmd.f, true
+}
+
+// commands handled by connection are not registered, categories of them
+var connCommandCategories = map[string][]string{
+	"multi":   {"transaction"},
+	"exec":    {"transaction"},
+	"watch":   {"transaction"},
+	"discard": {"transaction"},
+	"auth":    {"connection"},
+	"ping":    {"connection"},
+	"echo":    {"connection"},
+	"hello":   {"connection"},
+}
+
+func cmdCategories(cmdName string) []string {
+	if cmd, ok := cmds[cmdName]; ok {
+		return cmd.categories
+	}
+	return connCommandCategories[cmdName]
+}
+
+func cmdHasCategory(cmdName, category string) bool {
+	for _, c := range cmdCategories(cmdName) {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// cmdNames returns names of all commands sorted
+func cmdNames() []string {
+	names := make([]string, 0, len(cmds)+len(connCommandCategories))
+	for name := range cmds {
+		names = append(names, name)
+	}
+	for name := range connCommandCategories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
@@ -0,0 +1,159 @@
+//
+// command_acl.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/yongman/tidis/terror"
+)
+
+func init() {
+	cmdRegister("acl", aclCommand, "admin", "dangerous")
+}
+
+func aclCommand(c *Client) error {
+	if len(c.args) < 1 {
+		return terror.ErrCmdParams
+	}
+
+	args := c.args[1:]
+	switch strings.ToLower(string(c.args[0])) {
+	case "setuser":
+		if len(args) < 1 {
+			return terror.ErrCmdParams
+		}
+		rules := make([]string, len(args)-1)
+		for i, arg := range args[1:] {
+			rules[i] = string(arg)
+		}
+		if err := c.app.setUser(string(args[0]), rules); err != nil {
+			return err
+		}
+		return c.Resp("OK")
+	case "getuser":
+		if len(args) != 1 {
+			return terror.ErrCmdParams
+		}
+		u := c.app.getUser(string(args[0]))
+		if u == nil {
+			return c.Resp(nil)
+		}
+		return c.Resp(respMap(describeUser(u)))
+	case "deluser":
+		if len(args) < 1 {
+			return terror.ErrCmdParams
+		}
+		names := make([]string, len(args))
+		for i, arg := range args {
+			names[i] = string(arg)
+		}
+		n, err := c.app.delUsers(names)
+		if err != nil {
+			return err
+		}
+		return c.Resp(int64(n))
+	case "list":
+		if len(args) != 0 {
+			return terror.ErrCmdParams
+		}
+		resp := []interface{}{}
+		for _, name := range c.app.userNames() {
+			if u := c.app.getUser(name); u != nil {
+				line := "user " + name + " " + strings.Join(u.rules(), " ")
+				resp = append(resp, []byte(line))
+			}
+		}
+		return c.Resp(resp)
+	case "users":
+		if len(args) != 0 {
+			return terror.ErrCmdParams
+		}
+		resp := []interface{}{}
+		for _, name := range c.app.userNames() {
+			resp = append(resp, []byte(name))
+		}
+		return c.Resp(resp)
+	case "whoami":
+		if len(args) != 0 {
+			return terror.ErrCmdParams
+		}
+		return c.Resp([]byte(c.user))
+	case "cat":
+		var names []string
+		switch len(args) {
+		case 0:
+			names = aclCategories()
+		case 1:
+			cat := strings.ToLower(string(args[0]))
+			if !aclCategoryExists(cat) {
+				return terror.ErrACLCategory
+			}
+			names = aclCategoryCommands(cat)
+		default:
+			return terror.ErrCmdParams
+		}
+		resp := make([]interface{}, len(names))
+		for i, name := range names {
+			resp[i] = []byte(name)
+		}
+		return c.Resp(resp)
+	}
+
+	return terror.ErrCmdParams
+}
+
+// describeUser replies user like acl getuser with dbs of tidis
+func describeUser(u *aclUser) []interface{} {
+	flags := []interface{}{}
+	if u.enabled {
+		flags = append(flags, []byte("on"))
+	} else {
+		flags = append(flags, []byte("off"))
+	}
+	if u.allKeys {
+		flags = append(flags, []byte("allkeys"))
+	}
+	if u.allDBs {
+		flags = append(flags, []byte("alldbs"))
+	}
+	if len(u.allowed) == len(aclCategoryCommands("all")) {
+		flags = append(flags, []byte("allcommands"))
+	}
+	if u.nopass {
+		flags = append(flags, []byte("nopass"))
+	}
+
+	passwords := make([]interface{}, len(u.passwords))
+	for i, hash := range u.passwords {
+		passwords[i] = []byte(hash)
+	}
+	keys := make([]interface{}, len(u.patterns))
+	for i, pattern := range u.patterns {
+		keys[i] = []byte(pattern)
+	}
+	if u.allKeys {
+		keys = []interface{}{[]byte("*")}
+	}
+	dbs := make([]interface{}, len(u.dbs))
+	for i, db := range u.dbs {
+		dbs[i] = []byte(strconv.Itoa(int(db)))
+	}
+	if u.allDBs {
+		dbs = []interface{}{[]byte("*")}
+	}
+
+	return []interface{}{
+		[]byte("flags"), flags,
+		[]byte("passwords"), passwords,
+		[]byte("commands"), []byte(u.commands()),
+		[]byte("keys"), keys,
+		[]byte("dbs"), dbs,
+	}
+}
@@ -0,0 +1,325 @@
+//
+// command_client.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yongman/tidis/terror"
+)
+
+func init() {
+	cmdRegister("client", clientCommand, "admin", "connection", "dangerous")
+}
+
+func clientCommand(c *Client) error {
+	if len(c.args) < 1 {
+		return terror.ErrCmdParams
+	}
+
+	args := c.args[1:]
+	switch strings.ToLower(string(c.args[0])) {
+	case "id":
+		if len(args) != 0 {
+			return terror.ErrCmdParams
+		}
+		return c.Resp(c.id)
+	case "info":
+		if len(args) != 0 {
+			return terror.ErrCmdParams
+		}
+		return c.Resp(respVerbatim(c.describe() + "\n"))
+	case "list":
+		return clientListCommand(c, args)
+	case "setname":
+		if len(args) != 1 {
+			return terror.ErrCmdParams
+		}
+		if !validClientName(args[0]) {
+			return terror.ErrClientName
+		}
+		c.setName(string(args[0]))
+		return c.Resp("OK")
+	case "getname":
+		if len(args) != 0 {
+			return terror.ErrCmdParams
+		}
+		if name := c.getName(); name != "" {
+			return c.Resp([]byte(name))
+		}
+		return c.Resp(nil)
+	case "kill":
+		return clientKillCommand(c, args)
+	case "tracking":
+		return clientTrackingCommand(c, args)
+	case "pause":
+		if len(args) != 1 && len(args) != 2 {
+			return terror.ErrCmdParams
+		}
+		ms, err := strconv.ParseInt(string(args[0]), 10, 64)
+		if err != nil {
+			return terror.ErrTimeoutNotFloat
+		}
+		if ms < 0 {
+			return terror.ErrTimeoutNegative
+		}
+		all := true
+		if len(args) == 2 {
+			switch strings.ToLower(string(args[1])) {
+			case "all":
+			case "write":
+				all = false
+			default:
+				return terror.ErrCmdParams
+			}
+		}
+		c.app.pause.pause(time.Now().Add(time.Duration(ms)*time.Millisecond), all)
+		return c.Resp("OK")
+	case "unpause":
+		if len(args) != 0 {
+			return terror.ErrCmdParams
+		}
+		c.app.pause.unpause()
+		return c.Resp("OK")
+	case "reply":
+		if len(args) != 1 {
+			return terror.ErrCmdParams
+		}
+		switch strings.ToLower(string(args[0])) {
+		case "on":
+			c.replyMode = replyOn
+			c.out.discard = false
+		case "off":
+			c.replyMode = replyOff
+			c.out.discard = true
+		case "skip":
+			// reply of this command and the next one are skipped
+			c.replyMode = replySkip
+			c.out.discard = true
+		default:
+			return terror.ErrCmdParams
+		}
+		return c.Resp("OK")
+	}
+
+	return terror.ErrCmdParams
+}
+
+// validClientName checks name has no spaces or special characters
+func validClientName(name []byte) bool {
+	for _, ch := range name {
+		if ch < '!' || ch > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// clientType returns type of client used by client list and kill filters
+func clientType(cl *Client) string {
+	cl.info.Lock()
+	defer cl.info.Unlock()
+	if cl.info.sub+cl.info.psub > 0 {
+		return "pubsub"
+	}
+	return "normal"
+}
+
+func validClientType(t string) bool {
+	return t == "normal" || t == "pubsub"
+}
+
+// client list [TYPE normal|pubsub] [ID id ...]
+func clientListCommand(c *Client, args [][]byte) error {
+	var (
+		typ string
+		ids map[int64]bool
+	)
+	if len(args) > 0 {
+		switch strings.ToLower(string(args[0])) {
+		case "type":
+			if len(args) != 2 {
+				return terror.ErrCmdParams
+			}
+			typ = strings.ToLower(string(args[1]))
+			if !validClientType(typ) {
+				return terror.ErrCmdParams
+			}
+		case "id":
+			if len(args) < 2 {
+				return terror.ErrCmdParams
+			}
+			ids = make(map[int64]bool)
+			for _, arg := range args[1:] {
+				id, err := strconv.ParseInt(string(arg), 10, 64)
+				if err != nil || id <= 0 {
+					return terror.ErrNotInteger
+				}
+				ids[id] = true
+			}
+		default:
+			return terror.ErrCmdParams
+		}
+	}
+
+	var buf strings.Builder
+	for _, cl := range c.app.clients.list() {
+		if (typ != "" && clientType(cl) != typ) || (ids != nil && !ids[cl.id]) {
+			continue
+		}
+		buf.WriteString(cl.describe())
+		buf.WriteString("\n")
+	}
+	return c.Resp(respVerbatim(buf.String()))
+}
+
+// client kill addr, or client kill with filters ID, ADDR, LADDR, TYPE and
+// SKIPME, the first form replies OK and the second replies count of clients
+func clientKillCommand(c *Client, args [][]byte) error {
+	if len(args) == 0 {
+		return terror.ErrCmdParams
+	}
+
+	if len(args) == 1 {
+		addr := string(args[0])
+		for _, cl := range c.app.clients.list() {
+			if cl.conn.RemoteAddr().String() == addr {
+				c.killClient(cl)
+				return c.Resp("OK")
+			}
+		}
+		return terror.ErrNoSuchClient
+	}
+
+	if len(args)%2 != 0 {
+		return terror.ErrCmdParams
+	}
+	var (
+		id               int64
+		addr, laddr, typ string
+		skipMe           = true
+	)
+	for i := 0; i < len(args); i += 2 {
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "id":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n <= 0 {
+				return terror.ErrNotInteger
+			}
+			id = n
+		case "addr":
+			addr = value
+		case "laddr":
+			laddr = value
+		case "type":
+			typ = strings.ToLower(value)
+			if !validClientType(typ) {
+				return terror.ErrCmdParams
+			}
+		case "skipme":
+			switch strings.ToLower(value) {
+			case "yes":
+				skipMe = true
+			case "no":
+				skipMe = false
+			default:
+				return terror.ErrCmdParams
+			}
+		default:
+			return terror.ErrCmdParams
+		}
+	}
+
+	var killed int64
+	for _, cl := range c.app.clients.list() {
+		if (id != 0 && cl.id != id) ||
+			(addr != "" && cl.conn.RemoteAddr().String() != addr) ||
+			(laddr != "" && cl.conn.LocalAddr().String() != laddr) ||
+			(typ != "" && clientType(cl) != typ) ||
+			(skipMe && cl == c) {
+			continue
+		}
+		c.killClient(cl)
+		killed++
+	}
+	return c.Resp(killed)
+}
+
+// killClient kills cl, current client is closed after the reply
+func (c *Client) killClient(cl *Client) {
+	if cl == c {
+		c.closeAfterReply = true
+		return
+	}
+	cl.kill()
+}
+
+// clientTrackingCommand handles client tracking on|off [REDIRECT id] [BCAST]
+// [PREFIX prefix ...] [NOLOOP]
+func clientTrackingCommand(c *Client, args [][]byte) error {
+	if !c.app.conf.Tidis.TrackingEnabled {
+		return terror.ErrTrackingDisabled
+	}
+	if len(args) < 1 {
+		return terror.ErrCmdParams
+	}
+	var on bool
+	switch strings.ToLower(string(args[0])) {
+	case "on":
+		on = true
+	case "off":
+	default:
+		return terror.ErrCmdParams
+	}
+
+	var opts trackingOpts
+	for i := 1; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "redirect":
+			if i+1 >= len(args) {
+				return terror.ErrCmdParams
+			}
+			id, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return terror.ErrNotInteger
+			}
+			opts.redirect = id
+			i++
+		case "bcast":
+			opts.bcast = true
+		case "prefix":
+			if i+1 >= len(args) {
+				return terror.ErrCmdParams
+			}
+			opts.prefixes = append(opts.prefixes, args[i+1])
+			i++
+		case "noloop":
+			opts.noloop = true
+		default:
+			return terror.ErrCmdParams
+		}
+	}
+
+	if !on {
+		c.app.tracking.disable(c)
+		c.tracking = false
+		return c.Resp("OK")
+	}
+	if len(opts.prefixes) > 0 && !opts.bcast {
+		return terror.ErrTrackingPrefix
+	}
+	if opts.redirect != 0 && c.app.clients.get(opts.redirect) == nil {
+		return terror.ErrTrackingRedirect
+	}
+	c.app.tracking.enable(c, opts)
+	c.tracking = true
+	return c.Resp("OK")
+}
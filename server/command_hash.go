@@ -9,21 +9,23 @@ package server
 
 import (
 	"github.com/yongman/tidis/terror"
+	"github.com/yongman/tidis/tidis"
 )
 
 func init() {
-	cmdRegister("hget", hgetCommand)
-	cmdRegister("hstrlen", hstrlenCommand)
-	cmdRegister("hexists", hexistsCommand)
-	cmdRegister("hlen", hlenCommand)
-	cmdRegister("hmget", hmgetCommand)
-	cmdRegister("hdel", hdelCommand)
-	cmdRegister("hset", hsetCommand)
-	cmdRegister("hsetnx", hsetnxCommand)
-	cmdRegister("hmset", hmsetCommand)
-	cmdRegister("hkeys", hkeysCommand)
-	cmdRegister("hvals", hvalsCommand)
-	cmdRegister("hgetall", hgetallCommand)
+	cmdRegister("hget", hgetCommand, "hash", "read")
+	cmdRegister("hstrlen", hstrlenCommand, "hash", "read")
+	cmdRegister("hexists", hexistsCommand, "hash", "read")
+	cmdRegister("hlen", hlenCommand, "hash", "read")
+	cmdRegister("hmget", hmgetCommand, "hash", "read")
+	cmdRegister("hdel", hdelCommand, "hash", "write")
+	cmdRegister("hset", hsetCommand, "hash", "write")
+	cmdRegister("hsetnx", hsetnxCommand, "hash", "write")
+	cmdRegister("hmset", hmsetCommand, "hash", "write")
+	cmdRegister("hkeys", hkeysCommand, "hash", "read")
+	cmdRegister("hvals", hvalsCommand, "hash", "read")
+	cmdRegister("hgetall", hgetallCommand, "hash", "read")
+	cmdRegister("hscan", hscanCommand, "hash", "read")
 }
 
 func hgetCommand(c *Client) error {
@@ -116,6 +118,10 @@ func hdelCommand(c *Client) error {
 		return err
 	}
 
+	if v > 0 {
+		c.notify(tidis.NotifyHash, "hdel", c.args[0])
+	}
+
 	return c.Resp(int64(v))
 }
 
@@ -138,6 +144,8 @@ func hsetCommand(c *Client) error {
 		return err
 	}
 
+	c.notify(tidis.NotifyHash, "hset", c.args[0])
+
 	return c.Resp(int64(v))
 }
 
@@ -160,6 +168,10 @@ func hsetnxCommand(c *Client) error {
 		return err
 	}
 
+	if v > 0 {
+		c.notify(tidis.NotifyHash, "hset", c.args[0])
+	}
+
 	return c.Resp(int64(v))
 }
 
@@ -179,6 +191,8 @@ func hmsetCommand(c *Client) error {
 		return err
 	}
 
+	c.notify(tidis.NotifyHash, "hset", c.args[0])
+
 	return c.Resp("OK")
 }
 
@@ -218,5 +232,22 @@ func hgetallCommand(c *Client) error {
 		return err
 	}
 
-	return c.Resp(v)
+	return c.Resp(respMap(v))
+}
+
+func hscanCommand(c *Client) error {
+	if len(c.args) < 2 {
+		return terror.ErrCmdParams
+	}
+	p, err := parseScanParams(c.args[2:], false)
+	if err != nil {
+		return err
+	}
+
+	next, v, err := c.tdb.Hscan(c.dbId, c.GetCurrentTxn(), c.args[0], c.args[1], p.count, p.match)
+	if err != nil {
+		return err
+	}
+
+	return c.Resp([]interface{}{next, v})
 }
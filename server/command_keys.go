@@ -0,0 +1,128 @@
+//
+// command_keys.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"strings"
+
+	"github.com/yongman/go/util"
+	"github.com/yongman/tidis/terror"
+)
+
+const (
+	// default keys count for scan in one call
+	scanDefaultCount = 10
+)
+
+func init() {
+	cmdRegister("scan", scanCommand, "keyspace", "read")
+	cmdRegister("keys", keysCommand, "keyspace", "read", "dangerous")
+	cmdRegister("exists", existsCommand, "keyspace", "read")
+	cmdRegister("dbsize", dbsizeCommand, "keyspace", "read")
+	cmdRegister("randomkey", randomkeyCommand, "keyspace", "read")
+}
+
+type scanParams struct {
+	match   []byte
+	count   int
+	keyType string
+}
+
+// parse [MATCH pattern] [COUNT count] [TYPE type] options
+func parseScanParams(args [][]byte, withType bool) (*scanParams, error) {
+	p := &scanParams{count: scanDefaultCount}
+
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return nil, terror.ErrCmdParams
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			p.match = args[i+1]
+		case "count":
+			count, err := util.StrBytesToInt64(args[i+1])
+			if err != nil || count <= 0 {
+				return nil, terror.ErrCmdParams
+			}
+			p.count = int(count)
+		case "type":
+			if !withType {
+				return nil, terror.ErrCmdParams
+			}
+			p.keyType = strings.ToLower(string(args[i+1]))
+		default:
+			return nil, terror.ErrCmdParams
+		}
+	}
+	return p, nil
+}
+
+func scanCommand(c *Client) error {
+	if len(c.args) < 1 {
+		return terror.ErrCmdParams
+	}
+	p, err := parseScanParams(c.args[1:], true)
+	if err != nil {
+		return err
+	}
+
+	next, keys, err := c.tdb.Scan(c.DBID(), c.args[0], p.count, p.match, p.keyType)
+	if err != nil {
+		return err
+	}
+
+	resp := make([]interface{}, len(keys))
+	for i, key := range keys {
+		resp[i] = key
+	}
+	return c.Resp([]interface{}{next, resp})
+}
+
+func keysCommand(c *Client) error {
+	if len(c.args) != 1 {
+		return terror.ErrCmdParams
+	}
+	keys, err := c.tdb.Keys(c.DBID(), c.args[0])
+	if err != nil {
+		return err
+	}
+	return c.Resp(keys)
+}
+
+func existsCommand(c *Client) error {
+	if len(c.args) < 1 {
+		return terror.ErrCmdParams
+	}
+	cnt, err := c.tdb.Exists(c.DBID(), c.GetCurrentTxn(), c.args...)
+	if err != nil {
+		return err
+	}
+	return c.Resp(cnt)
+}
+
+func dbsizeCommand(c *Client) error {
+	if len(c.args) != 0 {
+		return terror.ErrCmdParams
+	}
+	cnt, err := c.tdb.DBSize(c.DBID())
+	if err != nil {
+		return err
+	}
+	return c.Resp(cnt)
+}
+
+func randomkeyCommand(c *Client) error {
+	if len(c.args) != 0 {
+		return terror.ErrCmdParams
+	}
+	key, err := c.tdb.RandomKey(c.DBID())
+	if err != nil {
+		return err
+	}
+	return c.Resp(key)
+}
@@ -8,20 +8,32 @@
 package server
 
 import (
+	"strings"
+
 	"github.com/yongman/go/util"
 	"github.com/yongman/tidis/terror"
+	"github.com/yongman/tidis/tidis"
 )
 
 func init() {
-	cmdRegister("lpush", lpushCommand)
-	cmdRegister("lpop", lpopCommand)
-	cmdRegister("rpush", rpushCommand)
-	cmdRegister("rpop", rpopCommand)
-	cmdRegister("llen", llenCommand)
-	cmdRegister("lindex", lindexCommand)
-	cmdRegister("lrange", lrangeComamnd)
-	cmdRegister("lset", lsetCommand)
-	cmdRegister("ltrim", ltrimCommand)
+	cmdRegister("lpush", lpushCommand, "list", "write")
+	cmdRegister("lpop", lpopCommand, "list", "write")
+	cmdRegister("rpush", rpushCommand, "list", "write")
+	cmdRegister("rpop", rpopCommand, "list", "write")
+	cmdRegister("llen", llenCommand, "list", "read")
+	cmdRegister("lindex", lindexCommand, "list", "read")
+	cmdRegister("lrange", lrangeComamnd, "list", "read")
+	cmdRegister("lset", lsetCommand, "list", "write")
+	cmdRegister("ltrim", ltrimCommand, "list", "write")
+	cmdRegister("linsert", linsertCommand, "list", "write")
+	cmdRegister("lrem", lremCommand, "list", "write")
+	cmdRegister("lpos", lposCommand, "list", "read")
+	cmdRegister("lmove", lmoveCommand, "list", "write")
+	cmdRegister("rpoplpush", rpoplpushCommand, "list", "write")
+	cmdRegister("blpop", blpopCommand, "list", "write", "blocking")
+	cmdRegister("brpop", brpopCommand, "list", "write", "blocking")
+	cmdRegister("brpoplpush", brpoplpushCommand, "list", "write", "blocking")
+	cmdRegister("blmove", blmoveCommand, "list", "write", "blocking")
 }
 
 func lpushCommand(c *Client) error {
@@ -34,6 +46,8 @@ func lpushCommand(c *Client) error {
 		return err
 	}
 
+	c.notify(tidis.NotifyList, "lpush", c.args[0])
+
 	return c.Resp(int64(v))
 }
 
@@ -47,6 +61,10 @@ func lpopCommand(c *Client) error {
 		return err
 	}
 
+	if v != nil {
+		c.notify(tidis.NotifyList, "lpop", c.args[0])
+	}
+
 	return c.Resp(v)
 }
 
@@ -60,6 +78,8 @@ func rpushCommand(c *Client) error {
 		return err
 	}
 
+	c.notify(tidis.NotifyList, "rpush", c.args[0])
+
 	return c.Resp(int64(v))
 }
 
@@ -73,6 +93,10 @@ func rpopCommand(c *Client) error {
 		return err
 	}
 
+	if v != nil {
+		c.notify(tidis.NotifyList, "rpop", c.args[0])
+	}
+
 	return c.Resp(v)
 }
 
@@ -148,6 +172,8 @@ func lsetCommand(c *Client) error {
 		return err
 	}
 
+	c.notify(tidis.NotifyList, "lset", c.args[0])
+
 	return c.Resp("OK")
 }
 
@@ -175,5 +201,297 @@ func ltrimCommand(c *Client) error {
 		return err
 	}
 
+	c.notify(tidis.NotifyList, "ltrim", c.args[0])
+
 	return c.Resp("OK")
 }
+
+func linsertCommand(c *Client) error {
+	if len(c.args) != 4 {
+		return terror.ErrCmdParams
+	}
+
+	var before bool
+	switch strings.ToLower(string(c.args[1])) {
+	case "before":
+		before = true
+	case "after":
+		before = false
+	default:
+		return terror.ErrCmdParams
+	}
+
+	var (
+		v   int64
+		err error
+	)
+	if !c.IsTxn() {
+		v, err = c.tdb.Linsert(c.dbId, c.args[0], before, c.args[2], c.args[3])
+	} else {
+		v, err = c.tdb.LinsertWithTxn(c.dbId, c.GetCurrentTxn(), c.args[0], before, c.args[2], c.args[3])
+	}
+	if err != nil {
+		return err
+	}
+
+	if v > 0 {
+		c.notify(tidis.NotifyList, "linsert", c.args[0])
+	}
+
+	return c.Resp(v)
+}
+
+func lremCommand(c *Client) error {
+	if len(c.args) != 3 {
+		return terror.ErrCmdParams
+	}
+
+	count, err := util.StrBytesToInt64(c.args[1])
+	if err != nil {
+		return terror.ErrNotInteger
+	}
+
+	var v int64
+	if !c.IsTxn() {
+		v, err = c.tdb.Lrem(c.dbId, c.args[0], count, c.args[2])
+	} else {
+		v, err = c.tdb.LremWithTxn(c.dbId, c.GetCurrentTxn(), c.args[0], count, c.args[2])
+	}
+	if err != nil {
+		return err
+	}
+
+	if v > 0 {
+		c.notify(tidis.NotifyList, "lrem", c.args[0])
+	}
+
+	return c.Resp(v)
+}
+
+func lposCommand(c *Client) error {
+	if len(c.args) < 2 || len(c.args)%2 != 0 {
+		return terror.ErrCmdParams
+	}
+
+	var (
+		rank      int64 = 1
+		count     int64
+		maxlen    int64
+		withCount bool
+	)
+	for i := 2; i < len(c.args); i += 2 {
+		v, err := util.StrBytesToInt64(c.args[i+1])
+		if err != nil {
+			return terror.ErrNotInteger
+		}
+		switch strings.ToLower(string(c.args[i])) {
+		case "rank":
+			if v == 0 {
+				return terror.ErrLposRankZero
+			}
+			rank = v
+		case "count":
+			if v < 0 {
+				return terror.ErrLposCountNegative
+			}
+			count = v
+			withCount = true
+		case "maxlen":
+			if v < 0 {
+				return terror.ErrLposMaxlenNegative
+			}
+			maxlen = v
+		default:
+			return terror.ErrCmdParams
+		}
+	}
+	if !withCount {
+		count = 1
+	}
+
+	positions, err := c.tdb.Lpos(c.dbId, c.GetCurrentTxn(), c.args[0], c.args[1], rank, count, maxlen)
+	if err != nil {
+		return err
+	}
+
+	if !withCount {
+		if len(positions) == 0 {
+			return c.Resp(nil)
+		}
+		return c.Resp(positions[0])
+	}
+	resp := make([]interface{}, len(positions))
+	for i, pos := range positions {
+		resp[i] = pos
+	}
+
+	return c.Resp(resp)
+}
+
+func lmoveCommand(c *Client) error {
+	if len(c.args) != 4 {
+		return terror.ErrCmdParams
+	}
+	srcDirec, err := parseListDirection(c.args[2])
+	if err != nil {
+		return err
+	}
+	dstDirec, err := parseListDirection(c.args[3])
+	if err != nil {
+		return err
+	}
+
+	v, err := c.tdb.Lmove(c.dbId, c.GetCurrentTxn(), c.args[0], c.args[1], srcDirec, dstDirec)
+	if err != nil {
+		return err
+	}
+
+	if v != nil {
+		c.notifyListMove(c.args[0], c.args[1], srcDirec, dstDirec)
+	}
+
+	return c.Resp(v)
+}
+
+func rpoplpushCommand(c *Client) error {
+	if len(c.args) != 2 {
+		return terror.ErrCmdParams
+	}
+
+	v, err := c.tdb.Lmove(c.dbId, c.GetCurrentTxn(), c.args[0], c.args[1], tidis.LTailDirection, tidis.LHeadDirection)
+	if err != nil {
+		return err
+	}
+
+	if v != nil {
+		c.notifyListMove(c.args[0], c.args[1], tidis.LTailDirection, tidis.LHeadDirection)
+	}
+
+	return c.Resp(v)
+}
+
+// notify pop event of src and push event of dst
+func (c *Client) notifyListMove(src, dst []byte, srcDirec, dstDirec uint8) {
+	if srcDirec == tidis.LHeadDirection {
+		c.notify(tidis.NotifyList, "lpop", src)
+	} else {
+		c.notify(tidis.NotifyList, "rpop", src)
+	}
+	if dstDirec == tidis.LHeadDirection {
+		c.notify(tidis.NotifyList, "lpush", dst)
+	} else {
+		c.notify(tidis.NotifyList, "rpush", dst)
+	}
+}
+
+// parse LEFT or RIGHT as list direction
+func parseListDirection(b []byte) (uint8, error) {
+	switch strings.ToLower(string(b)) {
+	case "left":
+		return tidis.LHeadDirection, nil
+	case "right":
+		return tidis.LTailDirection, nil
+	}
+	return 0, terror.ErrCmdParams
+}
+
+func bpopGeneric(c *Client, direc uint8) error {
+	if len(c.args) < 2 {
+		return terror.ErrCmdParams
+	}
+	timeout, err := parseBlockTimeout(c.args[len(c.args)-1])
+	if err != nil {
+		return err
+	}
+
+	pop := func(key []byte) (interface{}, error) {
+		var (
+			v   []byte
+			err error
+		)
+		if direc == tidis.LHeadDirection {
+			v, err = c.tdb.Lpop(c.dbId, c.GetCurrentTxn(), key)
+		} else {
+			v, err = c.tdb.Rpop(c.dbId, c.GetCurrentTxn(), key)
+		}
+		if err != nil || v == nil {
+			return nil, err
+		}
+		if direc == tidis.LHeadDirection {
+			c.notify(tidis.NotifyList, "lpop", key)
+		} else {
+			c.notify(tidis.NotifyList, "rpop", key)
+		}
+		return []interface{}{key, v}, nil
+	}
+
+	v, err := c.blockPop(c.args[:len(c.args)-1], timeout, pop)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		// timeout
+		return c.Resp([]interface{}(nil))
+	}
+
+	return c.Resp(v)
+}
+
+func blpopCommand(c *Client) error {
+	return bpopGeneric(c, tidis.LHeadDirection)
+}
+
+func brpopCommand(c *Client) error {
+	return bpopGeneric(c, tidis.LTailDirection)
+}
+
+func bmoveGeneric(c *Client, src, dst []byte, srcDirec, dstDirec uint8, timeout []byte) error {
+	t, err := parseBlockTimeout(timeout)
+	if err != nil {
+		return err
+	}
+
+	pop := func(key []byte) (interface{}, error) {
+		v, err := c.tdb.Lmove(c.dbId, c.GetCurrentTxn(), key, dst, srcDirec, dstDirec)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		c.notifyListMove(key, dst, srcDirec, dstDirec)
+		return v, nil
+	}
+
+	v, err := c.blockPop([][]byte{src}, t, pop)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		// timeout
+		return c.Resp([]byte(nil))
+	}
+
+	return c.Resp(v)
+}
+
+func brpoplpushCommand(c *Client) error {
+	if len(c.args) != 3 {
+		return terror.ErrCmdParams
+	}
+
+	return bmoveGeneric(c, c.args[0], c.args[1], tidis.LTailDirection, tidis.LHeadDirection, c.args[2])
+}
+
+func blmoveCommand(c *Client) error {
+	if len(c.args) != 5 {
+		return terror.ErrCmdParams
+	}
+	srcDirec, err := parseListDirection(c.args[2])
+	if err != nil {
+		return err
+	}
+	dstDirec, err := parseListDirection(c.args[3])
+	if err != nil {
+		return err
+	}
+
+	return bmoveGeneric(c, c.args[0], c.args[1], srcDirec, dstDirec, c.args[4])
+}
@@ -0,0 +1,129 @@
+//
+// command_list_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yongman/go/goredis"
+)
+
+func TestBlockingPop(t *testing.T) {
+	app := newTestApp(t)
+	conns := make([]*goredis.Conn, 3)
+	for i := range conns {
+		conns[i] = newTestConn(t, app)
+		defer conns[i].Close()
+	}
+
+	// waiters are served in the order they blocked
+	results := make([]chan string, 2)
+	for i := range results {
+		results[i] = make(chan string, 1)
+		go func(i int) {
+			v, err := goredis.Strings(conns[i].Do("blpop", "none", "q", "5"))
+			results[i] <- fmt.Sprint(v, err)
+		}(i)
+		time.Sleep(50 * time.Millisecond)
+	}
+	conns[2].Do("rpush", "q", "a", "b")
+	for i, expect := range []string{"[q a] <nil>", "[q b] <nil>"} {
+		select {
+		case got := <-results[i]:
+			if got != expect {
+				t.Fatalf("waiter %d got %s, expect %s", i, got, expect)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("waiter %d not served", i)
+		}
+	}
+
+	c := conns[0]
+	c.Do("rpush", "src", "1", "2")
+	if v, err := goredis.Strings(c.Do("brpop", "src", "0")); err != nil || fmt.Sprint(v) != "[src 2]" {
+		t.Fatalf("brpop got %v %v", v, err)
+	}
+	if s, _ := goredis.String(c.Do("brpoplpush", "src", "dst", "1")); s != "1" {
+		t.Fatalf("brpoplpush got %s", s)
+	}
+	if v, err := c.Do("blpop", "src", "0.1"); err != nil || v != nil {
+		t.Fatalf("blpop expect nil, got %v %v", v, err)
+	}
+	if v, err := c.Do("brpoplpush", "src", "dst", "0.1"); err != nil || v != nil {
+		t.Fatalf("brpoplpush expect nil, got %v %v", v, err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		conns[1].Do("lpush", "src", "3")
+	}()
+	if s, _ := goredis.String(c.Do("blmove", "src", "dst", "left", "right", "2")); s != "3" {
+		t.Fatalf("blmove got %s", s)
+	}
+	if v, _ := goredis.Strings(c.Do("lrange", "dst", "0", "-1")); fmt.Sprint(v) != "[1 3]" {
+		t.Fatalf("dst got %v", v)
+	}
+
+	// never blocks in transaction
+	c.Do("multi")
+	c.Do("blpop", "src", "0")
+	if v, err := goredis.Values(c.Do("exec")); err != nil || len(v) != 1 || v[0] != nil {
+		t.Fatalf("blpop in multi got %v %v", v, err)
+	}
+
+	if _, err := c.Do("blmove", "src", "dst", "up", "right", "1"); err == nil {
+		t.Fatalf("blmove with invalid direction should fail")
+	}
+}
+
+func TestListMutationCommands(t *testing.T) {
+	app := newTestApp(t)
+	c := newTestConn(t, app)
+	defer c.Close()
+
+	c.Do("rpush", "l", "a", "b", "c", "b")
+	if n, _ := goredis.Int64(c.Do("linsert", "l", "after", "a", "x")); n != 5 {
+		t.Fatalf("linsert got %d", n)
+	}
+	if n, _ := goredis.Int64(c.Do("lpos", "l", "b", "rank", "-1")); n != 4 {
+		t.Fatalf("lpos got %d", n)
+	}
+	if v, err := c.Do("lpos", "l", "none"); err != nil || v != nil {
+		t.Fatalf("lpos expect nil, got %v %v", v, err)
+	}
+	if v, _ := goredis.Values(c.Do("lpos", "l", "b", "count", "0")); fmt.Sprint(v) != "[2 4]" {
+		t.Fatalf("lpos with count got %v", v)
+	}
+	if n, _ := goredis.Int64(c.Do("lrem", "l", "0", "b")); n != 2 {
+		t.Fatalf("lrem got %d", n)
+	}
+	if s, _ := goredis.String(c.Do("lmove", "l", "m", "left", "right")); s != "a" {
+		t.Fatalf("lmove got %s", s)
+	}
+	if s, _ := goredis.String(c.Do("rpoplpush", "l", "m")); s != "c" {
+		t.Fatalf("rpoplpush got %s", s)
+	}
+	if v, _ := goredis.Strings(c.Do("lrange", "m", "0", "-1")); fmt.Sprint(v) != "[c a]" {
+		t.Fatalf("lrange got %v", v)
+	}
+
+	for _, args := range [][]interface{}{
+		{"linsert", "l", "middle", "a", "x"},
+		{"lpos", "l", "b", "rank", "0"},
+		{"lpos", "l", "b", "count", "-1"},
+		{"lpos", "l", "b", "maxlen"},
+		{"lrem", "l", "x", "b"},
+		{"lmove", "l", "m", "left", "up"},
+	} {
+		if _, err := c.Do(args[0].(string), args[1:]...); err == nil {
+			t.Fatalf("%v should fail", args)
+		}
+	}
+}
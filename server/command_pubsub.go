@@ -0,0 +1,205 @@
+//
+// command_pubsub.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/yongman/go/log"
+	"github.com/yongman/tidis/terror"
+)
+
+func init() {
+	cmdRegister("subscribe", subscribeCommand, "pubsub")
+	cmdRegister("unsubscribe", unsubscribeCommand, "pubsub")
+	cmdRegister("psubscribe", psubscribeCommand, "pubsub")
+	cmdRegister("punsubscribe", punsubscribeCommand, "pubsub")
+	cmdRegister("publish", publishCommand, "pubsub")
+	cmdRegister("pubsub", pubsubCommand, "pubsub")
+}
+
+// commands allowed when client subscribes to any channel or pattern
+var pubsubCommands = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"ping":         true,
+}
+
+func (c *Client) subscriptionResp(kind string, name []byte) error {
+	var nameResp interface{}
+	if name != nil {
+		nameResp = name
+	}
+	count := int64(len(c.channels) + len(c.patterns))
+	return c.Resp(respPush{[]byte(kind), nameResp, count})
+}
+
+// sorted names of subscriptions
+func subscriptionNames(m map[string]struct{}) [][]byte {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ret := make([][]byte, len(names))
+	for i, name := range names {
+		ret[i] = []byte(name)
+	}
+	return ret
+}
+
+func subscribeCommand(c *Client) error {
+	if len(c.args) < 1 {
+		return terror.ErrCmdParams
+	}
+	if c.IsTxn() {
+		return terror.ErrCmdInBatch
+	}
+
+	if c.channels == nil {
+		c.channels = make(map[string]struct{})
+	}
+	for _, channel := range c.args {
+		if _, ok := c.channels[string(channel)]; !ok {
+			c.channels[string(channel)] = struct{}{}
+			c.app.pubsub.subscribe(c, string(channel))
+		}
+		if err := c.subscriptionResp("subscribe", channel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unsubscribeCommand(c *Client) error {
+	if c.IsTxn() {
+		return terror.ErrCmdInBatch
+	}
+
+	channels := c.args
+	if len(channels) == 0 {
+		channels = subscriptionNames(c.channels)
+		if len(channels) == 0 {
+			return c.subscriptionResp("unsubscribe", nil)
+		}
+	}
+	for _, channel := range channels {
+		if _, ok := c.channels[string(channel)]; ok {
+			delete(c.channels, string(channel))
+			c.app.pubsub.unsubscribe(c, string(channel))
+		}
+		if err := c.subscriptionResp("unsubscribe", channel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func psubscribeCommand(c *Client) error {
+	if len(c.args) < 1 {
+		return terror.ErrCmdParams
+	}
+	if c.IsTxn() {
+		return terror.ErrCmdInBatch
+	}
+
+	if c.patterns == nil {
+		c.patterns = make(map[string]struct{})
+	}
+	for _, pattern := range c.args {
+		if _, ok := c.patterns[string(pattern)]; !ok {
+			c.patterns[string(pattern)] = struct{}{}
+			c.app.pubsub.psubscribe(c, string(pattern))
+		}
+		if err := c.subscriptionResp("psubscribe", pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func punsubscribeCommand(c *Client) error {
+	if c.IsTxn() {
+		return terror.ErrCmdInBatch
+	}
+
+	patterns := c.args
+	if len(patterns) == 0 {
+		patterns = subscriptionNames(c.patterns)
+		if len(patterns) == 0 {
+			return c.subscriptionResp("punsubscribe", nil)
+		}
+	}
+	for _, pattern := range patterns {
+		if _, ok := c.patterns[string(pattern)]; ok {
+			delete(c.patterns, string(pattern))
+			c.app.pubsub.punsubscribe(c, string(pattern))
+		}
+		if err := c.subscriptionResp("punsubscribe", pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publish delivers message to subscribers of this instance directly and sends
+// it to other instances by transport. the number of receivers on this
+// instance is returned.
+func publishCommand(c *Client) error {
+	if len(c.args) != 2 {
+		return terror.ErrCmdParams
+	}
+
+	n := c.app.pubsub.publish(c.args[0], c.args[1])
+	if err := c.tdb.Publish(c.args[0], c.args[1]); err != nil {
+		log.Errorf("publish message to other instances failed, error: %s", err.Error())
+		return err
+	}
+
+	return c.Resp(n)
+}
+
+// pubsub introspection reports subscriptions of this instance
+func pubsubCommand(c *Client) error {
+	if len(c.args) < 1 {
+		return terror.ErrCmdParams
+	}
+
+	switch strings.ToLower(string(c.args[0])) {
+	case "channels":
+		var pattern []byte
+		if len(c.args) == 2 {
+			pattern = c.args[1]
+		} else if len(c.args) > 2 {
+			return terror.ErrCmdParams
+		}
+		channels := c.app.pubsub.activeChannels(pattern)
+		resp := make([]interface{}, len(channels))
+		for i, channel := range channels {
+			resp[i] = []byte(channel)
+		}
+		return c.Resp(resp)
+	case "numsub":
+		resp := make([]interface{}, 0, 2*(len(c.args)-1))
+		for _, channel := range c.args[1:] {
+			resp = append(resp, channel, c.app.pubsub.numSub(string(channel)))
+		}
+		return c.Resp(resp)
+	case "numpat":
+		if len(c.args) != 1 {
+			return terror.ErrCmdParams
+		}
+		return c.Resp(c.app.pubsub.numPat())
+	}
+
+	return terror.ErrCmdParams
+}
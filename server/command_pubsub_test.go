@@ -0,0 +1,163 @@
+//
+// command_pubsub_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yongman/go/goredis"
+	"github.com/yongman/tidis/config"
+	"github.com/yongman/tidis/tidis"
+)
+
+// newTestAppWithPubSub runs app whose messages are carried by local transport
+func newTestAppWithPubSub(t *testing.T, ps *tidis.LocalPubSub) *App {
+	conf := config.NewConfig(nil, "127.0.0.1:0", "", 10, "")
+	conf.Backend.Type = "memory"
+
+	app := NewApp(conf)
+	app.GetTidis().SetPubSubTransport(ps.Transport())
+	go app.Run()
+	return app
+}
+
+func TestPubSub(t *testing.T) {
+	ps := tidis.NewLocalPubSub()
+	app1 := newTestAppWithPubSub(t, ps)
+	app2 := newTestAppWithPubSub(t, ps)
+
+	sub := newTestConn(t, app1)
+	defer sub.Close()
+	psub := newTestConn(t, app2)
+	defer psub.Close()
+	pub := newTestConn(t, app2)
+	defer pub.Close()
+
+	receive := func(c *goredis.Conn) string {
+		t.Helper()
+		c.SetReadDeadline(time.Now().Add(2 * time.Second))
+		v, err := goredis.Values(c.Receive())
+		if err != nil {
+			t.Fatalf("receive failed: %v", err)
+		}
+		return fmt.Sprintf("%s", v)
+	}
+
+	sub.Send("subscribe", "news", "sports")
+	for _, expect := range []string{"[subscribe news %!s(int64=1)]", "[subscribe sports %!s(int64=2)]"} {
+		if got := receive(sub); got != expect {
+			t.Fatalf("subscribe got %s, expect %s", got, expect)
+		}
+	}
+	psub.Send("psubscribe", "n*")
+	if got := receive(psub); got != "[psubscribe n* %!s(int64=1)]" {
+		t.Fatalf("psubscribe got %s", got)
+	}
+
+	// only pubsub commands in push mode
+	if _, err := sub.Do("get", "a"); err == nil {
+		t.Fatalf("get in subscribed state should fail")
+	}
+	if got := fmt.Sprintf("%s", mustValues(t, sub, "ping")); got != "[pong ]" {
+		t.Fatalf("ping got %s", got)
+	}
+
+	// subscriber of app2 receives directly, subscriber of app1 by transport
+	if n, _ := goredis.Int64(pub.Do("publish", "news", "hello")); n != 1 {
+		t.Fatalf("publish got %d", n)
+	}
+	if got := receive(psub); got != "[pmessage n* news hello]" {
+		t.Fatalf("pmessage got %s", got)
+	}
+	if got := receive(sub); got != "[message news hello]" {
+		t.Fatalf("message got %s", got)
+	}
+
+	if n, _ := goredis.Int64(pub.Do("pubsub", "numpat")); n != 1 {
+		t.Fatalf("pubsub numpat got %d", n)
+	}
+	c := newTestConn(t, app1)
+	defer c.Close()
+	if got := fmt.Sprintf("%s", mustValues(t, c, "pubsub", "channels")); got != "[news sports]" {
+		t.Fatalf("pubsub channels got %s", got)
+	}
+	if got := fmt.Sprintf("%s", mustValues(t, c, "pubsub", "numsub", "news", "none")); got != "[news %!s(int64=1) none %!s(int64=0)]" {
+		t.Fatalf("pubsub numsub got %s", got)
+	}
+
+	sub.Send("unsubscribe")
+	for _, expect := range []string{"[unsubscribe news %!s(int64=1)]", "[unsubscribe sports %!s(int64=0)]"} {
+		if got := receive(sub); got != expect {
+			t.Fatalf("unsubscribe got %s, expect %s", got, expect)
+		}
+	}
+	if s, err := goredis.String(sub.Do("ping")); err != nil || s != "PONG" {
+		t.Fatalf("ping after unsubscribe got %s %v", s, err)
+	}
+}
+
+func mustValues(t *testing.T, c *goredis.Conn, cmd string, args ...interface{}) []interface{} {
+	t.Helper()
+	v, err := c.Do(cmd, args...)
+	if err != nil {
+		t.Fatalf("%s failed: %v", cmd, err)
+	}
+	values, _ := v.([]interface{})
+	return values
+}
+
+func TestKeyspaceEvents(t *testing.T) {
+	conf := config.NewConfig(nil, "127.0.0.1:0", "", 10, "")
+	conf.Backend.Type = "memory"
+	conf.Tidis.KeyspaceEvents = "KEA"
+	app := NewApp(conf)
+	go app.Run()
+
+	sub := newTestConn(t, app)
+	defer sub.Close()
+	c := newTestConn(t, app)
+	defer c.Close()
+
+	receive := func() string {
+		t.Helper()
+		sub.SetReadDeadline(time.Now().Add(2 * time.Second))
+		v, err := goredis.Values(sub.Receive())
+		if err != nil {
+			t.Fatalf("receive failed: %v", err)
+		}
+		return fmt.Sprintf("%s", v)
+	}
+
+	sub.Send("psubscribe", "__keyevent@0__:*")
+	receive()
+
+	c.Do("set", "a", "1")
+	c.Do("del", "a", "none")
+	c.Do("rpush", "l", "x")
+	c.Do("multi")
+	c.Do("zadd", "z", "1", "m")
+	c.Do("lpop", "l")
+	c.Do("exec")
+	// discarded commands publish nothing
+	c.Do("multi")
+	c.Do("hset", "h", "f", "v")
+	c.Do("discard")
+	c.Do("expire", "none", "10")
+	c.Do("sadd", "s", "m")
+
+	for _, ev := range [][2]string{
+		{"set", "a"}, {"del", "a"}, {"rpush", "l"}, {"zadd", "z"}, {"lpop", "l"}, {"sadd", "s"},
+	} {
+		expect := fmt.Sprintf("[pmessage __keyevent@0__:* __keyevent@0__:%s %s]", ev[0], ev[1])
+		if got := receive(); got != expect {
+			t.Fatalf("event got %s, expect %s", got, expect)
+		}
+	}
+}
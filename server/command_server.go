@@ -10,12 +10,17 @@ package server
 import (
 	"github.com/yongman/tidis/terror"
 	"strconv"
+	"strings"
 )
 
 func init() {
-	cmdRegister("flushdb", flushdbCommand)
-	cmdRegister("flushall", flushallCommand)
-	cmdRegister("select", selectCommand)
+	cmdRegister("flushdb", flushdbCommand, "keyspace", "write", "dangerous")
+	cmdRegister("flushall", flushallCommand, "keyspace", "write", "dangerous")
+	cmdRegister("select", selectCommand, "connection")
+	cmdRegister("unwatch", unwatchCommand, "transaction")
+	cmdRegister("info", infoCommand, "dangerous")
+	cmdRegister("slowlog", slowlogCommand, "admin", "dangerous")
+	cmdRegister("config", configCommand, "admin", "dangerous")
 }
 
 func flushdbCommand(c *Client) error {
@@ -44,4 +49,100 @@ func selectCommand(c *Client) error {
 	}
 	c.SelectDB(uint8(dbId))
 	return c.Resp("OK")
-}
\ No newline at end of file
+}
+func unwatchCommand(c *Client) error {
+	if len(c.args) != 0 {
+		return terror.ErrCmdParams
+	}
+	// watched keys in multi are dropped after exec
+	if !c.IsTxn() {
+		c.Unwatch()
+	}
+	return c.Resp("OK")
+}
+
+// info reports sections of args, default sections if no args
+func infoCommand(c *Client) error {
+	info, err := c.app.info(c.args)
+	if err != nil {
+		return err
+	}
+	return c.Resp(respVerbatim(info))
+}
+
+func slowlogCommand(c *Client) error {
+	if len(c.args) < 1 {
+		return terror.ErrCmdParams
+	}
+
+	switch strings.ToLower(string(c.args[0])) {
+	case "get":
+		count := 10
+		if len(c.args) == 2 {
+			n, err := strconv.Atoi(string(c.args[1]))
+			if err != nil {
+				return terror.ErrNotInteger
+			}
+			count = n
+		} else if len(c.args) > 2 {
+			return terror.ErrCmdParams
+		}
+
+		entries := c.app.slowlog.get(count)
+		resp := make([]interface{}, len(entries))
+		for i, entry := range entries {
+			args := make([]interface{}, len(entry.args))
+			for j, arg := range entry.args {
+				args[j] = arg
+			}
+			resp[i] = []interface{}{entry.id, entry.time, entry.duration, args,
+				[]byte(entry.addr), []byte(entry.name)}
+		}
+		return c.Resp(resp)
+	case "len":
+		if len(c.args) != 1 {
+			return terror.ErrCmdParams
+		}
+		return c.Resp(int64(c.app.slowlog.len()))
+	case "reset":
+		if len(c.args) != 1 {
+			return terror.ErrCmdParams
+		}
+		c.app.slowlog.reset()
+		return c.Resp("OK")
+	}
+
+	return terror.ErrCmdParams
+}
+
+func configCommand(c *Client) error {
+	if len(c.args) < 1 {
+		return terror.ErrCmdParams
+	}
+
+	switch strings.ToLower(string(c.args[0])) {
+	case "get":
+		if len(c.args) < 2 {
+			return terror.ErrCmdParams
+		}
+		return c.Resp(respMap(c.app.configGet(c.args[1:])))
+	case "set":
+		if len(c.args) != 3 {
+			return terror.ErrCmdParams
+		}
+		if err := c.app.configSet(string(c.args[1]), string(c.args[2])); err != nil {
+			return err
+		}
+		return c.Resp("OK")
+	case "rewrite":
+		if len(c.args) != 1 {
+			return terror.ErrCmdParams
+		}
+		if err := c.app.configRewrite(); err != nil {
+			return err
+		}
+		return c.Resp("OK")
+	}
+
+	return terror.ErrCmdParams
+}
@@ -0,0 +1,148 @@
+//
+// command_server_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/yongman/go/goredis"
+)
+
+func TestInfo(t *testing.T) {
+	app := newTestApp(t)
+	conn := newTestConn(t, app)
+	defer conn.Close()
+
+	info := func(args ...interface{}) string {
+		t.Helper()
+		s, err := goredis.String(conn.Do("info", args...))
+		if err != nil {
+			t.Fatalf("info %v failed: %v", args, err)
+		}
+		return s
+	}
+
+	conn.Do("set", "k1", "v")
+	conn.Do("set", "k2", "v", "ex", "100")
+	conn.Do("select", "2")
+	conn.Do("sadd", "s", "m")
+	conn.Do("set")
+	conn.Do("select", "0")
+
+	s := info()
+	for _, expect := range []string{
+		"# Server\r\n", "redis_mode:standalone\r\n", "connected_clients:1\r\n",
+		"total_connections_received:1\r\n", "role:master\r\n", "cluster_enabled:0\r\n",
+	} {
+		if !strings.Contains(s, expect) {
+			t.Fatalf("info missing %q:\n%s", expect, s)
+		}
+	}
+	if strings.Contains(s, "# Commandstats") || strings.Contains(s, "# Keyspace") {
+		t.Fatalf("commandstats and keyspace are not default sections:\n%s", s)
+	}
+
+	s = info("commandstats")
+	for _, expect := range []string{
+		"cmdstat_set:calls=2,", "rejected_calls=1,failed_calls=0\r\n", "cmdstat_info:calls=1,",
+	} {
+		if !strings.Contains(s, expect) {
+			t.Fatalf("commandstats missing %q:\n%s", expect, s)
+		}
+	}
+	if strings.Contains(s, "# Server") {
+		t.Fatalf("info commandstats got other sections:\n%s", s)
+	}
+
+	s = info("CLUSTER", "clients")
+	if s != "# Clients\r\nconnected_clients:1\r\nblocked_clients:0\r\nmaxclients:0\r\n\r\n# Cluster\r\ncluster_enabled:0\r\n" {
+		t.Fatalf("info cluster clients got %q", s)
+	}
+
+	s = info("keyspace")
+	for _, expect := range []string{"db0:keys=2,expires=1,", "db2:keys=1,expires=0,avg_ttl=0\r\n"} {
+		if !strings.Contains(s, expect) {
+			t.Fatalf("keyspace missing %q:\n%s", expect, s)
+		}
+	}
+
+	s = info("all")
+	if !strings.Contains(s, "# Commandstats") || !strings.Contains(s, "# Keyspace") {
+		t.Fatalf("info all got:\n%s", s)
+	}
+	if s = info("nosuchsection"); s != "" {
+		t.Fatalf("info unknown section got %q", s)
+	}
+}
+
+func TestSlowlog(t *testing.T) {
+	app := newTestApp(t)
+	conn := newTestConn(t, app)
+	defer conn.Close()
+
+	// log every command
+	app.slowlog.setSlowerThan(0)
+
+	long := strings.Repeat("x", 200)
+	conn.Do("set", "k", long)
+	args := make([]interface{}, 40)
+	for i := range args {
+		args[i] = "m"
+	}
+	conn.Do("sadd", append([]interface{}{"s"}, args...)...)
+
+	entries, err := goredis.Values(conn.Do("slowlog", "get"))
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("slowlog get got %v, error %v", entries, err)
+	}
+
+	// newest first
+	entry, _ := goredis.Values(entries[0], nil)
+	if id, _ := goredis.Int64(entry[0], nil); id != 1 {
+		t.Fatalf("newest entry id %d", id)
+	}
+	saddArgs, _ := goredis.Strings(entry[3], nil)
+	if len(saddArgs) != 32 || saddArgs[0] != "sadd" || saddArgs[31] != "... (11 more arguments)" {
+		t.Fatalf("sadd entry args %v", saddArgs)
+	}
+	if addr, _ := goredis.String(entry[4], nil); addr == "" {
+		t.Fatalf("entry has no client address")
+	}
+
+	entry, _ = goredis.Values(entries[1], nil)
+	setArgs, _ := goredis.Strings(entry[3], nil)
+	if len(setArgs) != 3 || setArgs[2] != strings.Repeat("x", 128)+"... (72 more bytes)" {
+		t.Fatalf("set entry args %v", setArgs)
+	}
+
+	// slowlog get is logged as well
+	if n, _ := goredis.Int64(conn.Do("slowlog", "len")); n != 3 {
+		t.Fatalf("slowlog len got %d", n)
+	}
+	if entries, _ = goredis.Values(conn.Do("slowlog", "get", "1")); len(entries) != 1 {
+		t.Fatalf("slowlog get 1 got %d entries", len(entries))
+	}
+
+	app.slowlog.setMaxLen(2)
+	for i := 0; i < 5; i++ {
+		conn.Do("get", "k")
+	}
+	if n, _ := goredis.Int64(conn.Do("slowlog", "len")); n != 2 {
+		t.Fatalf("slowlog len after max len changed got %d", n)
+	}
+
+	app.slowlog.setSlowerThan(-1)
+	conn.Do("get", "k")
+	if s, _ := goredis.String(conn.Do("slowlog", "reset")); s != "OK" {
+		t.Fatalf("slowlog reset got %s", s)
+	}
+	if n, _ := goredis.Int64(conn.Do("slowlog", "len")); n != 0 {
+		t.Fatalf("slowlog len after disabled got %d", n)
+	}
+}
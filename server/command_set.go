@@ -9,21 +9,23 @@ package server
 
 import (
 	"github.com/yongman/tidis/terror"
+	"github.com/yongman/tidis/tidis"
 )
 
 func init() {
-	cmdRegister("sadd", saddCommand)
-	cmdRegister("scard", scardCommand)
-	cmdRegister("sismember", sismemberCommand)
-	cmdRegister("smembers", smembersCommand)
-	cmdRegister("srem", sremCommand)
-	cmdRegister("sdiff", sdiffCommand)
-	cmdRegister("sunion", sunionCommand)
-	cmdRegister("sinter", sinterCommand)
-	cmdRegister("sdiffstore", sdiffstoreCommand)
-	cmdRegister("sunionstore", sunionstoreCommand)
-	cmdRegister("sinterstore", sinterstoreCommand)
-	cmdRegister("sclear", sclearCommand)
+	cmdRegister("sadd", saddCommand, "set", "write")
+	cmdRegister("scard", scardCommand, "set", "read")
+	cmdRegister("sismember", sismemberCommand, "set", "read")
+	cmdRegister("smembers", smembersCommand, "set", "read")
+	cmdRegister("sscan", sscanCommand, "set", "read")
+	cmdRegister("srem", sremCommand, "set", "write")
+	cmdRegister("sdiff", sdiffCommand, "set", "read")
+	cmdRegister("sunion", sunionCommand, "set", "read")
+	cmdRegister("sinter", sinterCommand, "set", "read")
+	cmdRegister("sdiffstore", sdiffstoreCommand, "set", "write")
+	cmdRegister("sunionstore", sunionstoreCommand, "set", "write")
+	cmdRegister("sinterstore", sinterstoreCommand, "set", "write")
+	cmdRegister("sclear", sclearCommand, "set", "write")
 }
 
 func saddCommand(c *Client) error {
@@ -43,6 +45,10 @@ func saddCommand(c *Client) error {
 		return err
 	}
 
+	if v > 0 {
+		c.notify(tidis.NotifySet, "sadd", c.args[0])
+	}
+
 	return c.Resp(int64(v))
 }
 
@@ -82,7 +88,7 @@ func smembersCommand(c *Client) error {
 		return err
 	}
 
-	return c.Resp(v)
+	return c.Resp(respSet(v))
 }
 
 func sremCommand(c *Client) error {
@@ -103,6 +109,10 @@ func sremCommand(c *Client) error {
 		return err
 	}
 
+	if v > 0 {
+		c.notify(tidis.NotifySet, "srem", c.args[0])
+	}
+
 	return c.Resp(int64(v))
 }
 
@@ -116,7 +126,7 @@ func sdiffCommand(c *Client) error {
 		return err
 	}
 
-	return c.Resp1(v)
+	return c.Resp(respSet(v))
 }
 
 func sunionCommand(c *Client) error {
@@ -129,7 +139,7 @@ func sunionCommand(c *Client) error {
 		return err
 	}
 
-	return c.Resp1(v)
+	return c.Resp(respSet(v))
 }
 
 func sinterCommand(c *Client) error {
@@ -142,7 +152,7 @@ func sinterCommand(c *Client) error {
 		return err
 	}
 
-	return c.Resp1(v)
+	return c.Resp(respSet(v))
 }
 func sdiffstoreCommand(c *Client) error {
 	if len(c.args) < 2 {
@@ -163,6 +173,10 @@ func sdiffstoreCommand(c *Client) error {
 		return err
 	}
 
+	if v > 0 {
+		c.notify(tidis.NotifySet, "sdiffstore", c.args[0])
+	}
+
 	return c.Resp(int64(v))
 }
 
@@ -185,6 +199,10 @@ func sinterstoreCommand(c *Client) error {
 		return err
 	}
 
+	if v > 0 {
+		c.notify(tidis.NotifySet, "sinterstore", c.args[0])
+	}
+
 	return c.Resp(int64(v))
 }
 
@@ -207,6 +225,10 @@ func sunionstoreCommand(c *Client) error {
 		return err
 	}
 
+	if v > 0 {
+		c.notify(tidis.NotifySet, "sunionstore", c.args[0])
+	}
+
 	return c.Resp(int64(v))
 }
 
@@ -231,3 +253,20 @@ func sclearCommand(c *Client) error {
 
 	return c.Resp(int64(v))
 }
+
+func sscanCommand(c *Client) error {
+	if len(c.args) < 2 {
+		return terror.ErrCmdParams
+	}
+	p, err := parseScanParams(c.args[2:], false)
+	if err != nil {
+		return err
+	}
+
+	next, v, err := c.tdb.Sscan(c.dbId, c.GetCurrentTxn(), c.args[0], c.args[1], p.count, p.match)
+	if err != nil {
+		return err
+	}
+
+	return c.Resp([]interface{}{next, v})
+}
@@ -13,30 +13,32 @@ import (
 
 	"github.com/yongman/go/util"
 	"github.com/yongman/tidis/terror"
+	"github.com/yongman/tidis/tidis"
 )
 
 func init() {
-	cmdRegister("get", getCommand)
-	cmdRegister("getbit", getBitCommand)
-	cmdRegister("set", setCommand)
-	cmdRegister("setbit", setBitCommand)
-	cmdRegister("bitcount", bitCountCommand)
-	cmdRegister("setex", setexCommand)
-	cmdRegister("del", delCommand)
-	cmdRegister("mget", mgetCommand)
-	cmdRegister("mset", msetCommand)
-	cmdRegister("incr", incrCommand)
-	cmdRegister("incrby", incrbyCommand)
-	cmdRegister("decr", decrCommand)
-	cmdRegister("decrby", decrbyCommand)
-	cmdRegister("strlen", strlenCommand)
-	cmdRegister("pexpire", pexpireCommand)
-	cmdRegister("pexpireat", pexpireatCommand)
-	cmdRegister("expire", expireCommand)
-	cmdRegister("expireat", expireatCommand)
-	cmdRegister("pttl", pttlCommand)
-	cmdRegister("ttl", ttlCommand)
-	cmdRegister("type", typeCommand)
+	cmdRegister("get", getCommand, "string", "read")
+	cmdRegister("getbit", getBitCommand, "string", "read")
+	cmdRegister("set", setCommand, "string", "write")
+	cmdRegister("setbit", setBitCommand, "string", "write")
+	cmdRegister("bitcount", bitCountCommand, "string", "read")
+	cmdRegister("setex", setexCommand, "string", "write")
+	cmdRegister("del", delCommand, "keyspace", "write")
+	cmdRegister("unlink", delCommand, "keyspace", "write")
+	cmdRegister("mget", mgetCommand, "string", "read")
+	cmdRegister("mset", msetCommand, "string", "write")
+	cmdRegister("incr", incrCommand, "string", "write")
+	cmdRegister("incrby", incrbyCommand, "string", "write")
+	cmdRegister("decr", decrCommand, "string", "write")
+	cmdRegister("decrby", decrbyCommand, "string", "write")
+	cmdRegister("strlen", strlenCommand, "string", "read")
+	cmdRegister("pexpire", pexpireCommand, "keyspace", "write")
+	cmdRegister("pexpireat", pexpireatCommand, "keyspace", "write")
+	cmdRegister("expire", expireCommand, "keyspace", "write")
+	cmdRegister("expireat", expireatCommand, "keyspace", "write")
+	cmdRegister("pttl", pttlCommand, "keyspace", "read")
+	cmdRegister("ttl", ttlCommand, "keyspace", "read")
+	cmdRegister("type", typeCommand, "keyspace", "read")
 }
 
 func getCommand(c *Client) error {
@@ -167,6 +169,7 @@ func setCommand(c *Client) error {
 		if err != nil {
 			return err
 		}
+		c.notify(tidis.NotifyString, "set", c.args[0])
 	}
 
 	if len(c.args) >= 3 {
@@ -232,6 +235,10 @@ func setCommand(c *Client) error {
 		if result == false {
 			return c.Resp(nil)
 		}
+		c.notify(tidis.NotifyString, "set", c.args[0])
+		if ttlMs > 0 {
+			c.notify(tidis.NotifyGeneric, "expire", c.args[0])
+		}
 	}
 	return c.Resp("OK")
 
@@ -315,6 +322,9 @@ func setBitCommand(c *Client) error {
 	if err != nil {
 		return err
 	}
+
+	c.notify(tidis.NotifyString, "setbit", c.args[0])
+
 	if c.args[2][0] == '0' {
 		return c.Resp(int64(1))
 	}
@@ -345,6 +355,9 @@ func setexCommand(c *Client) error {
 		return err
 	}
 
+	c.notify(tidis.NotifyString, "set", c.args[0])
+	c.notify(tidis.NotifyGeneric, "expire", c.args[0])
+
 	return c.Resp("OK")
 }
 
@@ -358,6 +371,10 @@ func msetCommand(c *Client) error {
 		return err
 	}
 
+	for i := 0; i < len(c.args); i += 2 {
+		c.notify(tidis.NotifyString, "set", c.args[i])
+	}
+
 	return c.Resp("OK")
 }
 
@@ -366,12 +383,16 @@ func delCommand(c *Client) error {
 		return terror.ErrCmdParams
 	}
 
-	ret, err := c.tdb.Delete(c.dbId, c.GetCurrentTxn(), c.args)
+	deleted, err := c.tdb.DeleteKeys(c.dbId, c.GetCurrentTxn(), c.args)
 	if err != nil {
 		return err
 	}
 
-	return c.Resp(int64(ret))
+	for _, key := range deleted {
+		c.notify(tidis.NotifyGeneric, "del", key)
+	}
+
+	return c.Resp(int64(len(deleted)))
 }
 
 func incrCommand(c *Client) error {
@@ -393,6 +414,8 @@ func incrCommand(c *Client) error {
 		return err
 	}
 
+	c.notify(tidis.NotifyString, "incrby", c.args[0])
+
 	return c.Resp(ret)
 }
 
@@ -421,6 +444,8 @@ func incrbyCommand(c *Client) error {
 		return err
 	}
 
+	c.notify(tidis.NotifyString, "incrby", c.args[0])
+
 	return c.Resp(ret)
 }
 
@@ -444,6 +469,8 @@ func decrCommand(c *Client) error {
 		return err
 	}
 
+	c.notify(tidis.NotifyString, "decrby", c.args[0])
+
 	return c.Resp(ret)
 }
 
@@ -472,6 +499,8 @@ func decrbyCommand(c *Client) error {
 		return err
 	}
 
+	c.notify(tidis.NotifyString, "decrby", c.args[0])
+
 	return c.Resp(ret)
 }
 
@@ -511,6 +540,11 @@ func pexpireCommand(c *Client) error {
 	if err != nil {
 		return err
 	}
+
+	if v > 0 {
+		c.notify(tidis.NotifyGeneric, "expire", c.args[0])
+	}
+
 	return c.Resp(int64(v))
 }
 
@@ -532,6 +566,11 @@ func pexpireatCommand(c *Client) error {
 	if err != nil {
 		return err
 	}
+
+	if v > 0 {
+		c.notify(tidis.NotifyGeneric, "expire", c.args[0])
+	}
+
 	return c.Resp(int64(v))
 }
 
@@ -553,6 +592,11 @@ func expireCommand(c *Client) error {
 	if err != nil {
 		return err
 	}
+
+	if v > 0 {
+		c.notify(tidis.NotifyGeneric, "expire", c.args[0])
+	}
+
 	return c.Resp(int64(v))
 }
 
@@ -574,6 +618,11 @@ func expireatCommand(c *Client) error {
 	if err != nil {
 		return err
 	}
+
+	if v > 0 {
+		c.notify(tidis.NotifyGeneric, "expire", c.args[0])
+	}
+
 	return c.Resp(int64(v))
 }
 
@@ -17,34 +17,71 @@ import (
 )
 
 func init() {
-	cmdRegister("zadd", zaddCommand)
-	cmdRegister("zcard", zcardCommand)
-	cmdRegister("zrange", zrangeCommand)
-	cmdRegister("zrevrange", zrevrangeCommand)
-	cmdRegister("zrangebyscore", zrangebyscoreCommand)
-	cmdRegister("zrevrangebyscore", zrevrangebyscoreCommand)
-	cmdRegister("zremrangebyscore", zremrangebyscoreCommand)
-	cmdRegister("zrangebylex", zrangebylexCommand)
-	cmdRegister("zrevrangebylex", zrevrangebylexCommand)
-	cmdRegister("zremrangebylex", zremrangebylexCommand)
-	cmdRegister("zcount", zcountCommand)
-	cmdRegister("zlexcount", zlexcountCommand)
-	cmdRegister("zscore", zscoreCommand)
-	cmdRegister("zrem", zremCommand)
-	cmdRegister("zincrby", zincrbyCommand)
-	cmdRegister("zrank", zrankCommand)
-	cmdRegister("zrevrank", zrevrankCommand)
+	cmdRegister("zadd", zaddCommand, "sortedset", "write")
+	cmdRegister("zcard", zcardCommand, "sortedset", "read")
+	cmdRegister("zrange", zrangeCommand, "sortedset", "read")
+	cmdRegister("zscan", zscanCommand, "sortedset", "read")
+	cmdRegister("zrevrange", zrevrangeCommand, "sortedset", "read")
+	cmdRegister("zrangebyscore", zrangebyscoreCommand, "sortedset", "read")
+	cmdRegister("zrevrangebyscore", zrevrangebyscoreCommand, "sortedset", "read")
+	cmdRegister("zremrangebyscore", zremrangebyscoreCommand, "sortedset", "write")
+	cmdRegister("zrangebylex", zrangebylexCommand, "sortedset", "read")
+	cmdRegister("zrevrangebylex", zrevrangebylexCommand, "sortedset", "read")
+	cmdRegister("zremrangebylex", zremrangebylexCommand, "sortedset", "write")
+	cmdRegister("zcount", zcountCommand, "sortedset", "read")
+	cmdRegister("zlexcount", zlexcountCommand, "sortedset", "read")
+	cmdRegister("zscore", zscoreCommand, "sortedset", "read")
+	cmdRegister("zrem", zremCommand, "sortedset", "write")
+	cmdRegister("zincrby", zincrbyCommand, "sortedset", "write")
+	cmdRegister("zrank", zrankCommand, "sortedset", "read")
+	cmdRegister("zrevrank", zrevrankCommand, "sortedset", "read")
+	cmdRegister("zunion", zunionCommand, "sortedset", "read")
+	cmdRegister("zinter", zinterCommand, "sortedset", "read")
+	cmdRegister("zdiff", zdiffCommand, "sortedset", "read")
+	cmdRegister("zunionstore", zunionstoreCommand, "sortedset", "write")
+	cmdRegister("zinterstore", zinterstoreCommand, "sortedset", "write")
+	cmdRegister("zdiffstore", zdiffstoreCommand, "sortedset", "write")
+	cmdRegister("zpopmin", zpopminCommand, "sortedset", "write")
+	cmdRegister("zpopmax", zpopmaxCommand, "sortedset", "write")
+	cmdRegister("bzpopmin", bzpopminCommand, "sortedset", "write", "blocking")
+	cmdRegister("bzpopmax", bzpopmaxCommand, "sortedset", "write", "blocking")
 }
 
 func zaddCommand(c *Client) error {
-	if len(c.args) < 3 && len(c.args)%2 == 0 {
+	if len(c.args) < 3 {
+		return terror.ErrCmdParams
+	}
+
+	// parse options before score member pairs
+	params := &tidis.ZaddParams{}
+	i := 1
+options:
+	for ; i < len(c.args); i++ {
+		switch strings.ToLower(string(c.args[i])) {
+		case "nx":
+			params.NX = true
+		case "xx":
+			params.XX = true
+		case "gt":
+			params.GT = true
+		case "lt":
+			params.LT = true
+		case "ch":
+			params.CH = true
+		case "incr":
+			params.Incr = true
+		default:
+			break options
+		}
+	}
+	if i == len(c.args) || (len(c.args)-i)%2 != 0 {
 		return terror.ErrCmdParams
 	}
 
 	mps := make([]*tidis.MemberPair, 0)
 
-	for i := 1; i < len(c.args); i += 2 {
-		score, err := util.StrBytesToInt64(c.args[i])
+	for ; i < len(c.args); i += 2 {
+		score, err := tidis.ParseScore(c.args[i])
 		if err != nil {
 			return err
 		}
@@ -54,6 +91,13 @@ func zaddCommand(c *Client) error {
 		}
 		mps = append(mps, mp)
 	}
+	if err := params.Validate(len(mps)); err != nil {
+		return err
+	}
+
+	if params.Incr {
+		return zaddIncr(c, params, mps[0])
+	}
 
 	var (
 		v   int
@@ -61,17 +105,44 @@ func zaddCommand(c *Client) error {
 	)
 
 	if !c.IsTxn() {
-		v, err = c.tdb.Zadd(c.dbId, c.args[0], mps...)
+		v, err = c.tdb.ZaddWithParam(c.dbId, c.args[0], params, mps...)
 	} else {
-		v, err = c.tdb.ZaddWithTxn(c.dbId, c.GetCurrentTxn(), c.args[0], mps...)
+		v, err = c.tdb.ZaddWithParamWithTxn(c.dbId, c.GetCurrentTxn(), c.args[0], params, mps...)
 	}
 	if err != nil {
 		return err
 	}
 
+	c.notify(tidis.NotifyZSet, "zadd", c.args[0])
+
 	return c.Resp(int64(v))
 }
 
+// zadd with incr option replies the new score, or nil if aborted
+func zaddIncr(c *Client, params *tidis.ZaddParams, mp *tidis.MemberPair) error {
+	var (
+		v       float64
+		updated bool
+		err     error
+	)
+
+	if !c.IsTxn() {
+		v, updated, err = c.tdb.ZincrbyWithParam(c.dbId, c.args[0], mp.Score, mp.Member, params)
+	} else {
+		v, updated, err = c.tdb.ZincrbyWithParamWithTxn(c.dbId, c.GetCurrentTxn(), c.args[0], mp.Score, mp.Member, params)
+	}
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return c.Resp([]byte(nil))
+	}
+
+	c.notify(tidis.NotifyZSet, "zincr", c.args[0])
+
+	return c.Resp(respDouble(v))
+}
+
 func zcardCommand(c *Client) error {
 	if len(c.args) != 1 {
 		return terror.ErrCmdParams
@@ -125,6 +196,9 @@ func zrangeGeneric(c *Client, reverse bool) error {
 		return err
 	}
 
+	if withscores {
+		v = scoresResp(v)
+	}
 	return c.Resp(v)
 }
 
@@ -142,7 +216,7 @@ func zrangebyscoreGeneric(c *Client, reverse bool) error {
 	}
 
 	var (
-		start, end int64
+		start, end tidis.ScoreBound
 		err        error
 		withscores bool
 		offset     int = -1
@@ -172,31 +246,13 @@ func zrangebyscoreGeneric(c *Client, reverse bool) error {
 		}
 	}
 
-	// score pre-process
-	strScore := strings.ToLower(string(c.args[1]))
-	switch strScore {
-	case "-inf":
-		start = tidis.ScoreMin
-	case "+inf":
-		start = tidis.ScoreMax
-	default:
-		start, err = util.StrBytesToInt64(c.args[1])
-		if err != nil {
-			return err
-		}
+	start, err = tidis.ParseScoreBound(c.args[1])
+	if err != nil {
+		return err
 	}
-
-	strScore = strings.ToLower(string(c.args[2]))
-	switch strScore {
-	case "-inf":
-		end = tidis.ScoreMin
-	case "+inf":
-		end = tidis.ScoreMax
-	default:
-		end, err = util.StrBytesToInt64(c.args[2])
-		if err != nil {
-			return err
-		}
+	end, err = tidis.ParseScoreBound(c.args[2])
+	if err != nil {
+		return err
 	}
 
 	v, err := c.tdb.Zrangebyscore(c.dbId, c.GetCurrentTxn(), c.args[0], start, end, withscores, offset, count, reverse)
@@ -204,6 +260,9 @@ func zrangebyscoreGeneric(c *Client, reverse bool) error {
 		return err
 	}
 
+	if withscores {
+		v = scoresResp(v)
+	}
 	return c.Resp(v)
 }
 
@@ -213,37 +272,19 @@ func zremrangebyscoreCommand(c *Client) error {
 	}
 
 	var (
-		start int64
-		end   int64
+		start tidis.ScoreBound
+		end   tidis.ScoreBound
 		v     uint64
 		err   error
 	)
 
-	// score pre-process
-	strScore := strings.ToLower(string(c.args[1]))
-	switch strScore {
-	case "-inf":
-		start = tidis.ScoreMin
-	case "+inf":
-		start = tidis.ScoreMax
-	default:
-		start, err = util.StrBytesToInt64(c.args[1])
-		if err != nil {
-			return err
-		}
+	start, err = tidis.ParseScoreBound(c.args[1])
+	if err != nil {
+		return err
 	}
-
-	strScore = strings.ToLower(string(c.args[2]))
-	switch strScore {
-	case "-inf":
-		end = tidis.ScoreMin
-	case "+inf":
-		end = tidis.ScoreMax
-	default:
-		end, err = util.StrBytesToInt64(c.args[2])
-		if err != nil {
-			return err
-		}
+	end, err = tidis.ParseScoreBound(c.args[2])
+	if err != nil {
+		return err
 	}
 
 	if !c.IsTxn() {
@@ -255,6 +296,10 @@ func zremrangebyscoreCommand(c *Client) error {
 		return err
 	}
 
+	if v > 0 {
+		c.notify(tidis.NotifyZSet, "zremrangebyscore", c.args[0])
+	}
+
 	return c.Resp(int64(v))
 }
 
@@ -321,6 +366,10 @@ func zremrangebylexCommand(c *Client) error {
 		return err
 	}
 
+	if v > 0 {
+		c.notify(tidis.NotifyZSet, "zremrangebylex", c.args[0])
+	}
+
 	return c.Resp(int64(v))
 }
 
@@ -328,34 +377,16 @@ func zcountCommand(c *Client) error {
 	if len(c.args) < 3 {
 		return terror.ErrCmdParams
 	}
-	var min, max int64
+	var min, max tidis.ScoreBound
 	var err error
 
-	// score pre-process
-	strScore := strings.ToLower(string(c.args[1]))
-	switch strScore {
-	case "-inf":
-		min = tidis.ScoreMin
-	case "+inf":
-		min = tidis.ScoreMax
-	default:
-		min, err = util.StrBytesToInt64(c.args[1])
-		if err != nil {
-			return err
-		}
+	min, err = tidis.ParseScoreBound(c.args[1])
+	if err != nil {
+		return err
 	}
-
-	strScore = strings.ToLower(string(c.args[2]))
-	switch strScore {
-	case "-inf":
-		max = tidis.ScoreMin
-	case "+inf":
-		max = tidis.ScoreMax
-	default:
-		max, err = util.StrBytesToInt64(c.args[2])
-		if err != nil {
-			return err
-		}
+	max, err = tidis.ParseScoreBound(c.args[2])
+	if err != nil {
+		return err
 	}
 
 	v, err := c.tdb.Zcount(c.dbId, c.GetCurrentTxn(), c.args[0], min, max)
@@ -390,8 +421,7 @@ func zscoreCommand(c *Client) error {
 	}
 
 	if exist {
-		str := strconv.AppendInt([]byte(nil), v, 10)
-		return c.Resp(str)
+		return c.Resp(respDouble(v))
 	} else {
 		return c.Resp([]byte(nil))
 	}
@@ -416,6 +446,10 @@ func zremCommand(c *Client) error {
 		return err
 	}
 
+	if v > 0 {
+		c.notify(tidis.NotifyZSet, "zrem", c.args[0])
+	}
+
 	return c.Resp(int64(v))
 }
 
@@ -424,12 +458,12 @@ func zincrbyCommand(c *Client) error {
 		return terror.ErrCmdParams
 	}
 
-	delta, err := util.StrBytesToInt64(c.args[1])
+	delta, err := tidis.ParseScore(c.args[1])
 	if err != nil {
 		return err
 	}
 
-	var v int64
+	var v float64
 
 	if !c.IsTxn() {
 		v, err = c.tdb.Zincrby(c.dbId, c.args[0], delta, c.args[2])
@@ -440,7 +474,9 @@ func zincrbyCommand(c *Client) error {
 		return err
 	}
 
-	return c.Resp(v)
+	c.notify(tidis.NotifyZSet, "zincr", c.args[0])
+
+	return c.Resp(respDouble(v))
 }
 
 func zrankCommand(c *Client) error {
@@ -507,3 +543,320 @@ func zrevrankCommand(c *Client) error {
 		return c.Resp([]byte(nil))
 	}
 }
+
+func zscanCommand(c *Client) error {
+	if len(c.args) < 2 {
+		return terror.ErrCmdParams
+	}
+	p, err := parseScanParams(c.args[2:], false)
+	if err != nil {
+		return err
+	}
+
+	next, v, err := c.tdb.Zscan(c.dbId, c.GetCurrentTxn(), c.args[0], c.args[1], p.count, p.match)
+	if err != nil {
+		return err
+	}
+
+	return c.Resp([]interface{}{next, v})
+}
+
+type zopsArgs struct {
+	keys       [][]byte
+	params     *tidis.ZopsParams
+	withscores bool
+}
+
+// parse numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func parseZopsArgs(args [][]byte, withAggregate, withScores bool) (*zopsArgs, error) {
+	if len(args) < 2 {
+		return nil, terror.ErrCmdParams
+	}
+	numkeys, err := util.StrBytesToInt64(args[0])
+	if err != nil || numkeys <= 0 || numkeys > int64(len(args)-1) {
+		return nil, terror.ErrCmdParams
+	}
+
+	za := &zopsArgs{
+		keys:   args[1 : numkeys+1],
+		params: &tidis.ZopsParams{Aggregate: tidis.ZAggregateSum},
+	}
+
+	for i := int(numkeys) + 1; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "weights":
+			if !withAggregate || i+int(numkeys) >= len(args) {
+				return nil, terror.ErrCmdParams
+			}
+			za.params.Weights = make([]float64, numkeys)
+			for j := range za.params.Weights {
+				i++
+				za.params.Weights[j], err = tidis.ParseScore(args[i])
+				if err != nil {
+					return nil, terror.ErrWeightNotFloat
+				}
+			}
+		case "aggregate":
+			if !withAggregate || i+1 >= len(args) {
+				return nil, terror.ErrCmdParams
+			}
+			i++
+			switch strings.ToLower(string(args[i])) {
+			case "sum":
+				za.params.Aggregate = tidis.ZAggregateSum
+			case "min":
+				za.params.Aggregate = tidis.ZAggregateMin
+			case "max":
+				za.params.Aggregate = tidis.ZAggregateMax
+			default:
+				return nil, terror.ErrCmdParams
+			}
+		case "withscores":
+			if !withScores {
+				return nil, terror.ErrCmdParams
+			}
+			za.withscores = true
+		default:
+			return nil, terror.ErrCmdParams
+		}
+	}
+	return za, nil
+}
+
+// scoresResp replies formatted scores of member score pairs as doubles
+func scoresResp(v []interface{}) []interface{} {
+	for i := 1; i < len(v); i += 2 {
+		if b, ok := v[i].([]byte); ok {
+			if score, err := strconv.ParseFloat(string(b), 64); err == nil {
+				v[i] = respDouble(score)
+			}
+		}
+	}
+	return v
+}
+
+func zopsResp(c *Client, mps []*tidis.MemberPair, withscores bool) error {
+	resp := make([]interface{}, 0, len(mps))
+	for _, mp := range mps {
+		resp = append(resp, mp.Member)
+		if withscores {
+			resp = append(resp, respDouble(mp.Score))
+		}
+	}
+	return c.Resp(resp)
+}
+
+func zunionCommand(c *Client) error {
+	za, err := parseZopsArgs(c.args, true, true)
+	if err != nil {
+		return err
+	}
+
+	v, err := c.tdb.Zunion(c.dbId, c.GetCurrentTxn(), za.params, za.keys...)
+	if err != nil {
+		return err
+	}
+
+	return zopsResp(c, v, za.withscores)
+}
+
+func zinterCommand(c *Client) error {
+	za, err := parseZopsArgs(c.args, true, true)
+	if err != nil {
+		return err
+	}
+
+	v, err := c.tdb.Zinter(c.dbId, c.GetCurrentTxn(), za.params, za.keys...)
+	if err != nil {
+		return err
+	}
+
+	return zopsResp(c, v, za.withscores)
+}
+
+func zdiffCommand(c *Client) error {
+	za, err := parseZopsArgs(c.args, false, true)
+	if err != nil {
+		return err
+	}
+
+	v, err := c.tdb.Zdiff(c.dbId, c.GetCurrentTxn(), za.keys...)
+	if err != nil {
+		return err
+	}
+
+	return zopsResp(c, v, za.withscores)
+}
+
+func zunionstoreCommand(c *Client) error {
+	if len(c.args) < 3 {
+		return terror.ErrCmdParams
+	}
+	za, err := parseZopsArgs(c.args[1:], true, false)
+	if err != nil {
+		return err
+	}
+
+	var v uint64
+
+	if !c.IsTxn() {
+		v, err = c.tdb.Zunionstore(c.dbId, c.args[0], za.params, za.keys...)
+	} else {
+		v, err = c.tdb.ZunionstoreWithTxn(c.dbId, c.GetCurrentTxn(), c.args[0], za.params, za.keys...)
+	}
+	if err != nil {
+		return err
+	}
+
+	if v > 0 {
+		c.notify(tidis.NotifyZSet, "zunionstore", c.args[0])
+	}
+
+	return c.Resp(int64(v))
+}
+
+func zinterstoreCommand(c *Client) error {
+	if len(c.args) < 3 {
+		return terror.ErrCmdParams
+	}
+	za, err := parseZopsArgs(c.args[1:], true, false)
+	if err != nil {
+		return err
+	}
+
+	var v uint64
+
+	if !c.IsTxn() {
+		v, err = c.tdb.Zinterstore(c.dbId, c.args[0], za.params, za.keys...)
+	} else {
+		v, err = c.tdb.ZinterstoreWithTxn(c.dbId, c.GetCurrentTxn(), c.args[0], za.params, za.keys...)
+	}
+	if err != nil {
+		return err
+	}
+
+	if v > 0 {
+		c.notify(tidis.NotifyZSet, "zinterstore", c.args[0])
+	}
+
+	return c.Resp(int64(v))
+}
+
+func zdiffstoreCommand(c *Client) error {
+	if len(c.args) < 3 {
+		return terror.ErrCmdParams
+	}
+	za, err := parseZopsArgs(c.args[1:], false, false)
+	if err != nil {
+		return err
+	}
+
+	var v uint64
+
+	if !c.IsTxn() {
+		v, err = c.tdb.Zdiffstore(c.dbId, c.args[0], za.keys...)
+	} else {
+		v, err = c.tdb.ZdiffstoreWithTxn(c.dbId, c.GetCurrentTxn(), c.args[0], za.keys...)
+	}
+	if err != nil {
+		return err
+	}
+
+	if v > 0 {
+		c.notify(tidis.NotifyZSet, "zdiffstore", c.args[0])
+	}
+
+	return c.Resp(int64(v))
+}
+
+func (c *Client) zpop(key []byte, count int64, max bool) ([]*tidis.MemberPair, error) {
+	var (
+		mps []*tidis.MemberPair
+		err error
+	)
+
+	if !c.IsTxn() {
+		mps, err = c.tdb.Zpop(c.dbId, key, count, max)
+	} else {
+		mps, err = c.tdb.ZpopWithTxn(c.dbId, c.GetCurrentTxn(), key, count, max)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(mps) > 0 {
+		if max {
+			c.notify(tidis.NotifyZSet, "zpopmax", key)
+		} else {
+			c.notify(tidis.NotifyZSet, "zpopmin", key)
+		}
+	}
+	return mps, nil
+}
+
+func zpopGeneric(c *Client, max bool) error {
+	if len(c.args) != 1 && len(c.args) != 2 {
+		return terror.ErrCmdParams
+	}
+
+	var count int64 = 1
+	if len(c.args) == 2 {
+		var err error
+		count, err = util.StrBytesToInt64(c.args[1])
+		if err != nil || count < 0 {
+			return terror.ErrNotInteger
+		}
+	}
+
+	v, err := c.zpop(c.args[0], count, max)
+	if err != nil {
+		return err
+	}
+
+	return zopsResp(c, v, true)
+}
+
+func zpopminCommand(c *Client) error {
+	return zpopGeneric(c, false)
+}
+
+func zpopmaxCommand(c *Client) error {
+	return zpopGeneric(c, true)
+}
+
+func bzpopGeneric(c *Client, max bool) error {
+	if len(c.args) < 2 {
+		return terror.ErrCmdParams
+	}
+	timeout, err := parseBlockTimeout(c.args[len(c.args)-1])
+	if err != nil {
+		return err
+	}
+
+	pop := func(key []byte) (interface{}, error) {
+		mps, err := c.zpop(key, 1, max)
+		if err != nil || len(mps) == 0 {
+			return nil, err
+		}
+		return []interface{}{key, mps[0].Member, respDouble(mps[0].Score)}, nil
+	}
+
+	v, err := c.blockPop(c.args[:len(c.args)-1], timeout, pop)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		// timeout
+		return c.Resp([]interface{}(nil))
+	}
+
+	return c.Resp(v)
+}
+
+func bzpopminCommand(c *Client) error {
+	return bzpopGeneric(c, false)
+}
+
+func bzpopmaxCommand(c *Client) error {
+	return bzpopGeneric(c, true)
+}
@@ -0,0 +1,151 @@
+//
+// command_zset_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yongman/go/goredis"
+)
+
+func TestZaddOptions(t *testing.T) {
+	app := newTestApp(t)
+	c := newTestConn(t, app)
+	defer c.Close()
+
+	expectInt := func(expect int64, args ...interface{}) {
+		t.Helper()
+		if n, err := goredis.Int64(c.Do("zadd", args...)); err != nil || n != expect {
+			t.Fatalf("zadd %v got %d %v, expect %d", args, n, err, expect)
+		}
+	}
+	expectScore := func(member, expect string) {
+		t.Helper()
+		if s, _ := goredis.String(c.Do("zscore", "z", member)); s != expect {
+			t.Fatalf("zscore %s got %s, expect %s", member, s, expect)
+		}
+	}
+
+	expectInt(0, "z", "xx", "1", "a")
+	if n, _ := goredis.Int64(c.Do("exists", "z")); n != 0 {
+		t.Fatalf("zadd xx created key")
+	}
+	expectInt(2, "z", "1", "a", "2", "b")
+	expectInt(1, "z", "nx", "5", "a", "3", "c")
+	expectScore("a", "1")
+	expectInt(0, "z", "xx", "5", "a", "4", "d")
+	expectScore("a", "5")
+	expectInt(1, "z", "gt", "ch", "4", "a", "3", "b", "2", "c")
+	expectScore("a", "5")
+	expectScore("c", "3")
+	expectInt(1, "z", "lt", "ch", "1", "b", "9", "c")
+	expectScore("b", "1")
+	expectInt(0, "z", "ch", "1", "b")
+
+	if s, err := goredis.String(c.Do("zadd", "z", "incr", "1.5", "a")); err != nil || s != "6.5" {
+		t.Fatalf("zadd incr got %s %v", s, err)
+	}
+	if v, err := c.Do("zadd", "z", "gt", "incr", "-1", "a"); err != nil || v != nil {
+		t.Fatalf("zadd gt incr expect nil, got %v %v", v, err)
+	}
+
+	for _, args := range [][]interface{}{
+		{"z", "nx", "xx", "1", "a"},
+		{"z", "nx", "gt", "1", "a"},
+		{"z", "incr", "1", "a", "2", "b"},
+		{"z", "1", "a", "2"},
+		{"z", "ch"},
+	} {
+		if _, err := c.Do("zadd", args...); err == nil {
+			t.Fatalf("zadd %v should fail", args)
+		}
+	}
+}
+
+func TestZsetOpsCommands(t *testing.T) {
+	app := newTestApp(t)
+	c := newTestConn(t, app)
+	defer c.Close()
+
+	c.Do("zadd", "z1", "1", "a", "2", "b")
+	c.Do("zadd", "z2", "3", "b", "4", "c")
+
+	v, err := goredis.Strings(c.Do("zunion", "2", "z1", "z2", "weights", "1", "2", "aggregate", "min", "withscores"))
+	if err != nil || fmt.Sprint(v) != "[a 1 b 2 c 8]" {
+		t.Fatalf("zunion got %v %v", v, err)
+	}
+	v, _ = goredis.Strings(c.Do("zdiff", "2", "z1", "z2"))
+	if fmt.Sprint(v) != "[a]" {
+		t.Fatalf("zdiff got %v", v)
+	}
+	if n, _ := goredis.Int64(c.Do("zinterstore", "dst", "2", "z1", "z2")); n != 1 {
+		t.Fatalf("zinterstore got %d", n)
+	}
+	if s, _ := goredis.String(c.Do("zscore", "dst", "b")); s != "5" {
+		t.Fatalf("zinterstore score got %s", s)
+	}
+
+	for _, args := range [][]interface{}{
+		{"zunion", "3", "z1", "z2"},
+		{"zunion", "2", "z1", "z2", "weights", "1"},
+		{"zunion", "2", "z1", "z2", "weights", "1", "x"},
+		{"zunion", "2", "z1", "z2", "aggregate", "avg"},
+		{"zdiff", "2", "z1", "z2", "weights", "1", "1"},
+		{"zunionstore", "dst", "2", "z1", "z2", "withscores"},
+	} {
+		if _, err := c.Do(args[0].(string), args[1:]...); err == nil {
+			t.Fatalf("%v should fail", args)
+		}
+	}
+}
+
+func TestZpop(t *testing.T) {
+	app := newTestApp(t)
+	c1 := newTestConn(t, app)
+	defer c1.Close()
+	c2 := newTestConn(t, app)
+	defer c2.Close()
+
+	c1.Do("zadd", "z", "1", "a", "2", "b", "3", "c")
+	v, _ := goredis.Strings(c1.Do("zpopmax", "z", "2"))
+	if fmt.Sprint(v) != "[c 3 b 2]" {
+		t.Fatalf("zpopmax got %v", v)
+	}
+	v, _ = goredis.Strings(c1.Do("zpopmin", "z"))
+	if fmt.Sprint(v) != "[a 1]" {
+		t.Fatalf("zpopmin got %v", v)
+	}
+	if n, _ := goredis.Int64(c1.Do("exists", "z")); n != 0 {
+		t.Fatalf("empty zset should be deleted")
+	}
+
+	// timeout with nothing to pop
+	start := time.Now()
+	if v, err := c1.Do("bzpopmin", "z", "0.2"); err != nil || v != nil {
+		t.Fatalf("bzpopmin expect nil, got %v %v", v, err)
+	}
+	if time.Since(start) < 200*time.Millisecond {
+		t.Fatalf("bzpopmin returned before timeout")
+	}
+
+	// woken up by zadd of another client
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		c2.Do("zadd", "z2", "5", "x", "7", "y")
+	}()
+	v, err := goredis.Strings(c1.Do("bzpopmax", "z", "z2", "5"))
+	if err != nil || fmt.Sprint(v) != "[z2 y 7]" {
+		t.Fatalf("bzpopmax got %v %v", v, err)
+	}
+
+	if _, err := c1.Do("bzpopmin", "z", "-1"); err == nil {
+		t.Fatalf("negative timeout should fail")
+	}
+}
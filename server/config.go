@@ -0,0 +1,282 @@
+//
+// config.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/yongman/go/log"
+	"github.com/yongman/tidis/config"
+	"github.com/yongman/tidis/terror"
+	"github.com/yongman/tidis/tidis"
+	"github.com/yongman/tidis/utils"
+)
+
+// configSetters apply value of runtime changeable parameters to running
+// components and app config, other parameters need restart, app.confLock
+// must be held by caller
+var configSetters = map[string]func(app *App, value string) error{
+	"loglevel": func(app *App, value string) error {
+		value = strings.ToLower(value)
+		if err := SetLogLevel(value); err != nil {
+			return err
+		}
+		app.conf.Tidis.LogLevel = value
+		return nil
+	},
+	"max_connection": func(app *App, value string) error {
+		n, err := parseConfigInt(value, 0)
+		if err != nil {
+			return err
+		}
+		atomic.StoreInt32(&app.maxConn, int32(n))
+		app.conf.Tidis.MaxConn = int32(n)
+		return nil
+	},
+	"auth": func(app *App, value string) error {
+		app.setAuth(value)
+		app.conf.Tidis.Auth = value
+		return nil
+	},
+	"txn_retry": func(app *App, value string) error {
+		n, err := parseConfigInt(value, 0)
+		if err != nil {
+			return err
+		}
+		app.tdb.SetTxnRetry(int(n))
+		app.conf.Tidis.TxnRetry = int(n)
+		return nil
+	},
+	"db_gc_enabled": func(app *App, value string) error {
+		enabled, err := parseConfigBool(value)
+		if err != nil {
+			return err
+		}
+		app.gcChecker.SetEnabled(enabled)
+		app.conf.Tidis.DBGCEnabled = enabled
+		return nil
+	},
+	"db_gc_interval": func(app *App, value string) error {
+		n, err := parseConfigInt(value, 1)
+		if err != nil {
+			return err
+		}
+		app.gcChecker.SetInterval(int(n))
+		app.conf.Tidis.DBGcInterval = int(n)
+		return nil
+	},
+	"db_gc_concurrency": func(app *App, value string) error {
+		n, err := parseConfigInt(value, 1)
+		if err != nil {
+			return err
+		}
+		app.gcChecker.SetConcurrency(int(n))
+		app.conf.Tidis.DBGcConcurrency = int(n)
+		return nil
+	},
+	"db_gc_safepoint_life_time": func(app *App, value string) error {
+		n, err := parseConfigInt(value, 1)
+		if err != nil {
+			return err
+		}
+		app.gcChecker.SetLifeTime(int(n))
+		app.conf.Tidis.DBSafePointLifeTime = int(n)
+		return nil
+	},
+	"slowlog_log_slower_than": func(app *App, value string) error {
+		n, err := parseConfigInt(value, -1)
+		if err != nil {
+			return err
+		}
+		app.slowlog.setSlowerThan(n)
+		app.conf.Tidis.SlowlogSlowerThan = n
+		return nil
+	},
+	"slowlog_max_len": func(app *App, value string) error {
+		n, err := parseConfigInt(value, 0)
+		if err != nil {
+			return err
+		}
+		app.slowlog.setMaxLen(int(n))
+		app.conf.Tidis.SlowlogMaxLen = int(n)
+		return nil
+	},
+	"notify_keyspace_events": func(app *App, value string) error {
+		flags, err := tidis.ParseKeyspaceEvents(value)
+		if err != nil {
+			return terror.ErrConfigValue
+		}
+		app.tdb.SetKeyspaceEvents(flags)
+		app.conf.Tidis.KeyspaceEvents = value
+		return nil
+	},
+	"shutdown_timeout": func(app *App, value string) error {
+		n, err := parseConfigInt(value, 0)
+		if err != nil {
+			return err
+		}
+		// read by close with app.confLock held
+		app.conf.Tidis.ShutdownTimeout = int(n)
+		return nil
+	},
+}
+
+// SetLogLevel sets level of logger by name, info/debug/warn/error
+func SetLogLevel(level string) error {
+	switch level {
+	case "info":
+		log.SetLevel(log.INFO)
+	case "debug":
+		log.SetLevel(log.DEBUG)
+	case "warn":
+		log.SetLevel(log.WARN)
+	case "error":
+		log.SetLevel(log.ERROR)
+	default:
+		return terror.ErrConfigValue
+	}
+	return nil
+}
+
+func parseConfigInt(value string, min int64) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || n < min {
+		return 0, terror.ErrConfigValue
+	}
+	return n, nil
+}
+
+func parseConfigBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "true":
+		return true, nil
+	case "no", "false":
+		return false, nil
+	}
+	return false, terror.ErrConfigValue
+}
+
+// formatConfigValue formats value like redis, booleans are yes or no
+func formatConfigValue(v interface{}) string {
+	if b, ok := v.(bool); ok {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	return fmt.Sprint(v)
+}
+
+// configGet returns names and values of parameters matching any of patterns
+func (app *App) configGet(patterns [][]byte) []interface{} {
+	app.confLock.Lock()
+	names, values := app.conf.Values()
+	app.confLock.Unlock()
+
+	resp := []interface{}{}
+	for _, name := range names {
+		for _, pattern := range patterns {
+			if utils.StringMatch([]byte(strings.ToLower(string(pattern))), []byte(name)) {
+				resp = append(resp, []byte(name), []byte(formatConfigValue(values[name])))
+				break
+			}
+		}
+	}
+	return resp
+}
+
+func (app *App) configSet(name, value string) error {
+	name = strings.ToLower(name)
+
+	app.confLock.Lock()
+	defer app.confLock.Unlock()
+
+	set, ok := configSetters[name]
+	if !ok {
+		if _, values := app.conf.Values(); values[name] != nil {
+			return terror.ErrConfigImmutable
+		}
+		return terror.ErrConfigUnknown
+	}
+	if err := set(app, value); err != nil {
+		return err
+	}
+	log.Infof("config %s changed to %s", name, value)
+	return nil
+}
+
+func (app *App) configRewrite() error {
+	app.confLock.Lock()
+	defer app.confLock.Unlock()
+
+	if app.conf.Path == "" {
+		return terror.ErrConfigNoFile
+	}
+	return app.conf.Rewrite()
+}
+
+// ReloadConfig loads config file again and applies changed parameters which
+// can be set at runtime, changes of others are ignored with warnings
+func (app *App) ReloadConfig() error {
+	app.confLock.Lock()
+	defer app.confLock.Unlock()
+
+	if app.conf.Path == "" {
+		return terror.ErrConfigNoFile
+	}
+	c, err := config.LoadConfig(app.conf.Path)
+	if err != nil {
+		return err
+	}
+	c = config.NewConfig(c, "", "", 0, "")
+	config.FillWithDefaultConfig(c)
+
+	names, values := c.Values()
+	_, current := app.conf.Values()
+	for _, name := range names {
+		value := formatConfigValue(values[name])
+		if value == formatConfigValue(current[name]) || tlsFiles[name] {
+			continue
+		}
+		set, ok := configSetters[name]
+		if !ok {
+			log.Warnf("config %s changed, it takes effect after restart", name)
+			continue
+		}
+		if err = set(app, value); err != nil {
+			log.Errorf("config %s reload failed, value: %s, error: %s", name, value, err.Error())
+			continue
+		}
+		log.Infof("config %s reloaded to %s", name, value)
+	}
+
+	// certificates are reloaded even if files are not changed, they may be
+	// replaced in place
+	tidisConf := &app.conf.Tidis
+	prev := []string{tidisConf.TLSCert, tidisConf.TLSKey, tidisConf.TLSCA, tidisConf.TLSAuthClients}
+	tidisConf.TLSCert = c.Tidis.TLSCert
+	tidisConf.TLSKey = c.Tidis.TLSKey
+	tidisConf.TLSCA = c.Tidis.TLSCA
+	tidisConf.TLSAuthClients = c.Tidis.TLSAuthClients
+	if err = app.reloadTLS(); err != nil {
+		log.Errorf("reload tls certificates failed, error: %s", err.Error())
+		tidisConf.TLSCert, tidisConf.TLSKey, tidisConf.TLSCA, tidisConf.TLSAuthClients = prev[0], prev[1], prev[2], prev[3]
+	}
+	return nil
+}
+
+// tls files and options are reloaded together
+var tlsFiles = map[string]bool{
+	"tls_cert":         true,
+	"tls_key":          true,
+	"tls_ca":           true,
+	"tls_auth_clients": true,
+}
@@ -0,0 +1,150 @@
+//
+// config_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/yongman/go/goredis"
+	"github.com/yongman/tidis/terror"
+)
+
+func TestConfig(t *testing.T) {
+	app := newTestApp(t)
+	conn := newTestConn(t, app)
+	defer conn.Close()
+
+	get := func(pattern string) map[string]string {
+		t.Helper()
+		kvs, err := goredis.Strings(conn.Do("config", "get", pattern))
+		if err != nil {
+			t.Fatalf("config get %s failed: %v", pattern, err)
+		}
+		ret := make(map[string]string)
+		for i := 0; i+1 < len(kvs); i += 2 {
+			ret[kvs[i]] = kvs[i+1]
+		}
+		return ret
+	}
+
+	if kvs := get("SLOWLOG_*"); len(kvs) != 2 || kvs["slowlog_log_slower_than"] != "10000" || kvs["slowlog_max_len"] != "128" {
+		t.Fatalf("config get slowlog_* got %v", kvs)
+	}
+	if kvs := get("db_gc_enabled"); kvs["db_gc_enabled"] != "yes" {
+		t.Fatalf("config get db_gc_enabled got %v", kvs)
+	}
+	if kvs := get("backend.type"); kvs["backend.type"] != "memory" {
+		t.Fatalf("config get backend.type got %v", kvs)
+	}
+	if kvs := get("nosuch*"); len(kvs) != 0 {
+		t.Fatalf("config get nosuch* got %v", kvs)
+	}
+
+	set := func(name, value string) error {
+		t.Helper()
+		_, err := conn.Do("config", "set", name, value)
+		return err
+	}
+	for _, c := range []struct {
+		name, value string
+		err         error
+	}{
+		{"nosuch", "1", terror.ErrConfigUnknown},
+		{"listen", ":6379", terror.ErrConfigImmutable},
+		{"max_connection", "x", terror.ErrConfigValue},
+		{"loglevel", "verbose", terror.ErrConfigValue},
+		{"notify_keyspace_events", "Z", terror.ErrConfigValue},
+	} {
+		if err := set(c.name, c.value); err == nil || err.Error() != c.err.Error() {
+			t.Fatalf("config set %s %s got %v", c.name, c.value, err)
+		}
+	}
+
+	if err := set("max_connection", "100"); err != nil || atomic.LoadInt32(&app.maxConn) != 100 {
+		t.Fatalf("config set max_connection got %v", err)
+	}
+	if err := set("SLOWLOG_MAX_LEN", "5"); err != nil || atomic.LoadInt64(&app.slowlog.maxLen) != 5 {
+		t.Fatalf("config set slowlog_max_len got %v", err)
+	}
+	if err := set("db_gc_enabled", "no"); err != nil {
+		t.Fatalf("config set db_gc_enabled got %v", err)
+	}
+	if kvs := get("max_connection"); kvs["max_connection"] != "100" {
+		t.Fatalf("config get after set got %v", kvs)
+	}
+	if s, _ := app.info([][]byte{[]byte("tidis")}); !strings.Contains(s, "gc_enabled:0\r\n") {
+		t.Fatalf("info after gc disabled got %s", s)
+	}
+
+	// new connections must authenticate after auth is set
+	if err := set("auth", "secret"); err != nil {
+		t.Fatalf("config set auth got %v", err)
+	}
+	conn2 := newTestConn(t, app)
+	defer conn2.Close()
+	if _, err := conn2.Do("get", "k"); err == nil || err.Error() != terror.ErrAuthReqired.Error() {
+		t.Fatalf("get without auth got %v", err)
+	}
+	if s, err := goredis.String(conn2.Do("auth", "secret")); err != nil || s != "OK" {
+		t.Fatalf("auth got %s %v", s, err)
+	}
+
+	// no config file to rewrite
+	if _, err := conn.Do("config", "rewrite"); err == nil || err.Error() != terror.ErrConfigNoFile.Error() {
+		t.Fatalf("config rewrite without file got %v", err)
+	}
+}
+
+func TestConfigRewriteAndReload(t *testing.T) {
+	app := newTestApp(t)
+	conn := newTestConn(t, app)
+	defer conn.Close()
+
+	dir, err := ioutil.TempDir("", "tidis-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	data := "[tidis]\n# slow log\nslowlog_max_len = 128\n\n[backend]\ntype = \"memory\"\n"
+	if err = ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	app.conf.Path = path
+
+	conn.Do("config", "set", "slowlog_max_len", "7")
+	if s, err := goredis.String(conn.Do("config", "rewrite")); err != nil || s != "OK" {
+		t.Fatalf("config rewrite got %s %v", s, err)
+	}
+	out, _ := ioutil.ReadFile(path)
+	if !strings.Contains(string(out), "# slow log\nslowlog_max_len = 7\n") {
+		t.Fatalf("rewritten file:\n%s", out)
+	}
+
+	// reload applies runtime changeable values only
+	data = strings.Replace(string(out), "slowlog_max_len = 7", "slowlog_max_len = 9", 1)
+	data = strings.Replace(data, "max_connection = 0", "max_connection = 50", 1)
+	data = strings.Replace(data, "ttl_check_batch = 1000", "ttl_check_batch = 10", 1)
+	if err = ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = app.ReloadConfig(); err != nil {
+		t.Fatalf("reload config failed: %v", err)
+	}
+	if atomic.LoadInt64(&app.slowlog.maxLen) != 9 || atomic.LoadInt32(&app.maxConn) != 50 {
+		t.Fatalf("reload config not applied")
+	}
+	if app.conf.Tidis.TTLCheckBatch != 1000 {
+		t.Fatalf("reload config changed ttl_check_batch to %d", app.conf.Tidis.TTLCheckBatch)
+	}
+}
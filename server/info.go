@@ -0,0 +1,188 @@
+//
+// info.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// redis version compatible with, clients check it for supported commands
+const redisVersion = "6.2.0"
+
+type infoSection struct {
+	name string
+	// reported by INFO without args
+	isDefault bool
+	write     func(app *App, buf *bytes.Buffer) error
+}
+
+var infoSections = []infoSection{
+	{"server", true, (*App).infoServer},
+	{"clients", true, (*App).infoClients},
+	{"stats", true, (*App).infoStats},
+	{"replication", true, (*App).infoReplication},
+	{"tidis", true, (*App).infoTidis},
+	{"cluster", true, (*App).infoCluster},
+	{"commandstats", false, (*App).infoCommandStats},
+	// reads keys of all dbs, reported only if selected
+	{"keyspace", false, (*App).infoKeyspace},
+}
+
+// info returns text of selected sections, "default", "all" and "everything"
+// select groups of sections, unknown sections are ignored
+func (app *App) info(args [][]byte) (string, error) {
+	selected := make(map[string]bool)
+	if len(args) == 0 {
+		selected["default"] = true
+	}
+	for _, arg := range args {
+		selected[strings.ToLower(string(arg))] = true
+	}
+	all := selected["all"] || selected["everything"]
+
+	var buf bytes.Buffer
+	for _, section := range infoSections {
+		if !all && !selected[section.name] && !(section.isDefault && selected["default"]) {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("# " + strings.Title(section.name) + "\r\n")
+		if err := section.write(app, &buf); err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
+func infoField(buf *bytes.Buffer, name string, value interface{}) {
+	fmt.Fprintf(buf, "%s:%v\r\n", name, value)
+}
+
+func (app *App) infoServer(buf *bytes.Buffer) error {
+	uptime := time.Since(app.stats.startTime)
+
+	port := func(l net.Listener) int {
+		if l == nil {
+			return 0
+		}
+		if addr, ok := l.Addr().(*net.TCPAddr); ok {
+			return addr.Port
+		}
+		return 0
+	}
+
+	infoField(buf, "redis_version", redisVersion)
+	infoField(buf, "redis_mode", "standalone")
+	infoField(buf, "os", runtime.GOOS+" "+runtime.GOARCH)
+	infoField(buf, "arch_bits", 32<<(^uint(0)>>63))
+	infoField(buf, "go_version", runtime.Version())
+	infoField(buf, "process_id", os.Getpid())
+	infoField(buf, "run_id", strings.Replace(app.tdb.InstanceId(), "-", "", -1))
+	infoField(buf, "tcp_port", port(app.listener))
+	infoField(buf, "tls_port", port(app.tlsListener))
+	infoField(buf, "uptime_in_seconds", int64(uptime/time.Second))
+	infoField(buf, "uptime_in_days", int64(uptime/(24*time.Hour)))
+	return nil
+}
+
+func (app *App) infoClients(buf *bytes.Buffer) error {
+	infoField(buf, "connected_clients", app.clients.len())
+	infoField(buf, "blocked_clients", atomic.LoadInt32(&app.blockedCount))
+	infoField(buf, "maxclients", atomic.LoadInt32(&app.maxConn))
+	return nil
+}
+
+func (app *App) infoStats(buf *bytes.Buffer) error {
+	txn := app.tdb.TxnStats()
+
+	infoField(buf, "total_connections_received", atomic.LoadUint64(&app.stats.totalConns))
+	infoField(buf, "total_commands_processed", atomic.LoadUint64(&app.stats.totalCommands))
+	infoField(buf, "rejected_connections", atomic.LoadUint64(&app.stats.rejectedConns))
+	infoField(buf, "pubsub_channels", len(app.pubsub.activeChannels(nil)))
+	infoField(buf, "pubsub_patterns", app.pubsub.numPat())
+	infoField(buf, "txn_commits", txn.Commits)
+	infoField(buf, "txn_rollbacks", txn.Rollbacks)
+	infoField(buf, "txn_retries", txn.Retries)
+	infoField(buf, "txn_conflicts", txn.Conflicts)
+	infoField(buf, "txn_failures", txn.Failures)
+	infoField(buf, "async_delete_pending", app.tdb.AsyncDelPending())
+	return nil
+}
+
+func (app *App) infoReplication(buf *bytes.Buffer) error {
+	// all instances serve reads and writes of the same storage
+	infoField(buf, "role", "master")
+	infoField(buf, "connected_slaves", 0)
+	return nil
+}
+
+func (app *App) infoTidis(buf *bytes.Buffer) error {
+	safePoint, err := app.tdb.GCSafePoint()
+	if err != nil {
+		return err
+	}
+
+	leader := 0
+	if app.tdb.IsLeader() {
+		leader = 1
+	}
+	app.confLock.Lock()
+	gcEnabled := 0
+	if app.conf.Tidis.DBGCEnabled {
+		gcEnabled = 1
+	}
+	app.confLock.Unlock()
+
+	infoField(buf, "tenant_id", app.tdb.TenantId())
+	infoField(buf, "backend", app.conf.Backend.Type)
+	infoField(buf, "leader", leader)
+	infoField(buf, "gc_enabled", gcEnabled)
+	infoField(buf, "gc_last_safe_point", safePoint)
+	return nil
+}
+
+func (app *App) infoCluster(buf *bytes.Buffer) error {
+	infoField(buf, "cluster_enabled", 0)
+	return nil
+}
+
+func (app *App) infoCommandStats(buf *bytes.Buffer) error {
+	for _, st := range app.stats.commandStats() {
+		var perCall float64
+		if st.calls > 0 {
+			perCall = float64(st.usec) / float64(st.calls)
+		}
+		fmt.Fprintf(buf, "cmdstat_%s:calls=%d,usec=%d,usec_per_call=%.2f,rejected_calls=%d,failed_calls=%d\r\n",
+			st.name, st.calls, st.usec, perCall, st.rejected, st.failed)
+	}
+	return nil
+}
+
+func (app *App) infoKeyspace(buf *bytes.Buffer) error {
+	stats, err := app.tdb.KeyspaceStats()
+	if err != nil {
+		return err
+	}
+	for _, st := range stats {
+		fmt.Fprintf(buf, "db%d:keys=%d,expires=%d,avg_ttl=%d", st.DB, st.Keys, st.Expires, st.AvgTTL)
+		if st.Sampled {
+			buf.WriteString(",sampled=1")
+		}
+		buf.WriteString("\r\n")
+	}
+	return nil
+}
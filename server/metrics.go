@@ -0,0 +1,117 @@
+//
+// metrics.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/yongman/go/log"
+)
+
+// metricsHandler serves metrics of app in prometheus text format, qps and
+// latency of commands come from the command duration histogram
+func (app *App) metricsHandler() http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(prometheus.NewGoCollector())
+	reg.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	reg.MustRegister(app.stats.commandDuration, app.stats.commandErrors)
+
+	counter := func(name, help string, f func() float64) {
+		reg.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: "tidis",
+			Name:      name,
+			Help:      help,
+		}, f))
+	}
+	gauge := func(name, help string, f func() float64) {
+		reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "tidis",
+			Name:      name,
+			Help:      help,
+		}, f))
+	}
+
+	counter("connections_received_total", "Connections accepted.", func() float64 {
+		return float64(atomic.LoadUint64(&app.stats.totalConns))
+	})
+	counter("connections_rejected_total", "Connections rejected by max_connection.", func() float64 {
+		return float64(atomic.LoadUint64(&app.stats.rejectedConns))
+	})
+	gauge("connected_clients", "Clients connected.", func() float64 {
+		return float64(app.clients.len())
+	})
+	gauge("blocked_clients", "Clients blocked by blocking commands.", func() float64 {
+		return float64(atomic.LoadInt32(&app.blockedCount))
+	})
+
+	counter("txn_commits_total", "Transactions committed.", func() float64 {
+		return float64(app.tdb.TxnStats().Commits)
+	})
+	counter("txn_rollbacks_total", "Transactions rolled back by errors of operations.", func() float64 {
+		return float64(app.tdb.TxnStats().Rollbacks)
+	})
+	counter("txn_retries_total", "Transaction retries.", func() float64 {
+		return float64(app.tdb.TxnStats().Retries)
+	})
+	counter("txn_conflicts_total", "Transaction commits failed by write conflicts.", func() float64 {
+		return float64(app.tdb.TxnStats().Conflicts)
+	})
+	counter("txn_failures_total", "Transaction commits failed after all retries.", func() float64 {
+		return float64(app.tdb.TxnStats().Failures)
+	})
+
+	gauge("async_delete_pending", "Big collections waiting to be purged.", func() float64 {
+		return float64(app.tdb.AsyncDelPending())
+	})
+	counter("ttl_expired_keys_total", "Keys deleted by ttl sweeper of this instance.", func() float64 {
+		expired, _ := app.tdb.TTLStats()
+		return float64(expired)
+	})
+	gauge("ttl_last_sweep_timestamp_seconds", "Time the last ttl sweep finished, 0 if it never sweeps.", func() float64 {
+		_, lastSweep := app.tdb.TTLStats()
+		return float64(lastSweep) / 1000
+	})
+	gauge("gc_safe_point_age_seconds", "Age of the last gc safe point, NaN if gc never runs.", func() float64 {
+		safePoint, err := app.tdb.GCSafePoint()
+		if err != nil || safePoint == 0 {
+			return math.NaN()
+		}
+		return time.Since(time.Unix(int64(safePoint), 0)).Seconds()
+	})
+	gauge("leader", "1 if this instance is leader.", func() float64 {
+		if app.tdb.IsLeader() {
+			return 1
+		}
+		return 0
+	})
+
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
+
+// serveMetrics serves /metrics on metrics listen address until ctx is done
+func (app *App) serveMetrics(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", app.metricsHandler())
+	srv := &http.Server{Addr: app.conf.Tidis.MetricsListen, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	log.Infof("metrics listen in %s", app.conf.Tidis.MetricsListen)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Errorf("metrics listener failed, error: %s", err.Error())
+	}
+}
@@ -0,0 +1,53 @@
+//
+// metrics_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	app := newTestApp(t)
+	conn := newTestConn(t, app)
+	defer conn.Close()
+
+	conn.Do("set", "k", "v")
+	conn.Do("get", "k")
+	conn.Do("incr", "k")
+	conn.Do("nosuchcommand")
+
+	srv := httptest.NewServer(app.metricsHandler())
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	for _, expect := range []string{
+		`tidis_command_duration_seconds_count{command="set"} 1`,
+		`tidis_command_duration_seconds_count{command="get"} 1`,
+		`tidis_command_errors_total{error="ErrCommand"} 1`,
+		`tidis_command_errors_total{error="ErrNotInteger"} 1`,
+		"tidis_connected_clients 1",
+		"tidis_connections_received_total 1",
+		"tidis_txn_commits_total ",
+		"tidis_async_delete_pending 0",
+		"tidis_ttl_expired_keys_total 0",
+		"tidis_gc_safe_point_age_seconds NaN",
+		"go_goroutines ",
+	} {
+		if !strings.Contains(string(body), expect) {
+			t.Fatalf("metrics missing %q:\n%s", expect, body)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+//
+// pubsub.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/yongman/go/log"
+	"github.com/yongman/tidis/utils"
+)
+
+// max messages queued for a subscriber, slow subscribers are disconnected
+const pushQueueSize = 1024
+
+// pubsubHub keeps subscriptions of clients on this instance, messages from
+// other instances are delivered by the transport of tidis
+type pubsubHub struct {
+	sync.RWMutex
+	channels map[string]map[*Client]struct{}
+	patterns map[string]map[*Client]struct{}
+}
+
+func newPubsubHub() *pubsubHub {
+	return &pubsubHub{
+		channels: make(map[string]map[*Client]struct{}),
+		patterns: make(map[string]map[*Client]struct{}),
+	}
+}
+
+func hubAdd(m map[string]map[*Client]struct{}, name string, c *Client) {
+	clients, ok := m[name]
+	if !ok {
+		clients = make(map[*Client]struct{})
+		m[name] = clients
+	}
+	clients[c] = struct{}{}
+}
+
+func hubRemove(m map[string]map[*Client]struct{}, name string, c *Client) {
+	clients := m[name]
+	delete(clients, c)
+	if len(clients) == 0 {
+		delete(m, name)
+	}
+}
+
+func (h *pubsubHub) subscribe(c *Client, channel string) {
+	h.Lock()
+	defer h.Unlock()
+	hubAdd(h.channels, channel, c)
+}
+
+func (h *pubsubHub) unsubscribe(c *Client, channel string) {
+	h.Lock()
+	defer h.Unlock()
+	hubRemove(h.channels, channel, c)
+}
+
+func (h *pubsubHub) psubscribe(c *Client, pattern string) {
+	h.Lock()
+	defer h.Unlock()
+	hubAdd(h.patterns, pattern, c)
+}
+
+func (h *pubsubHub) punsubscribe(c *Client, pattern string) {
+	h.Lock()
+	defer h.Unlock()
+	hubRemove(h.patterns, pattern, c)
+}
+
+// publish pushes message to subscribers on this instance, it returns the
+// number of clients received
+func (h *pubsubHub) publish(channel, message []byte) int64 {
+	h.RLock()
+	defer h.RUnlock()
+
+	var n int64
+	for c := range h.channels[string(channel)] {
+		c.push([]interface{}{[]byte("message"), channel, message})
+		n++
+	}
+	for pattern, clients := range h.patterns {
+		if !utils.StringMatch([]byte(pattern), channel) {
+			continue
+		}
+		for c := range clients {
+			c.push([]interface{}{[]byte("pmessage"), []byte(pattern), channel, message})
+			n++
+		}
+	}
+	return n
+}
+
+// activeChannels returns channels with subscribers matching pattern
+func (h *pubsubHub) activeChannels(pattern []byte) []string {
+	h.RLock()
+	defer h.RUnlock()
+
+	channels := make([]string, 0, len(h.channels))
+	for channel := range h.channels {
+		if pattern == nil || utils.StringMatch(pattern, []byte(channel)) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+func (h *pubsubHub) numSub(channel string) int64 {
+	h.RLock()
+	defer h.RUnlock()
+	return int64(len(h.channels[channel]))
+}
+
+func (h *pubsubHub) numPat() int64 {
+	h.RLock()
+	defer h.RUnlock()
+	return int64(len(h.patterns))
+}
+
+type keyspaceEvent struct {
+	class int
+	event string
+	dbId  uint8
+	key   []byte
+}
+
+// notify publishes keyspace event of key modified by command, events in
+// transaction are published after commit
+func (c *Client) notify(class int, event string, key []byte) {
+	if c.tdb.KeyspaceEvents()&class == 0 {
+		return
+	}
+	if c.isTxn {
+		c.txnEvents = append(c.txnEvents, keyspaceEvent{class: class, event: event, dbId: c.dbId, key: key})
+		return
+	}
+	c.tdb.NotifyKeyspaceEvent(class, event, c.dbId, key)
+}
+
+// push queues message for the connection goroutine to write
+func (c *Client) push(msg []interface{}) {
+	select {
+	case c.pushCh <- msg:
+	default:
+		// closing the connection ends the client loop
+		log.Warnf("client %s pubsub queue is full, close it", c.conn.RemoteAddr())
+		c.conn.Close()
+	}
+}
+
+// InPubSub returns true if client subscribes to any channel or pattern, only
+// pubsub commands are allowed in this state
+func (c *Client) InPubSub() bool {
+	return len(c.channels)+len(c.patterns) > 0
+}
+
+// unsubscribeAll removes all subscriptions of client when it quits
+func (c *Client) unsubscribeAll() {
+	for channel := range c.channels {
+		c.app.pubsub.unsubscribe(c, channel)
+	}
+	for pattern := range c.patterns {
+		c.app.pubsub.punsubscribe(c, pattern)
+	}
+	c.channels = nil
+	c.patterns = nil
+}
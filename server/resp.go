@@ -0,0 +1,195 @@
+//
+// resp.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"bufio"
+	"strconv"
+
+	"github.com/yongman/tidis/terror"
+	"github.com/yongman/tidis/tidis"
+)
+
+// resp3 reply types, commands reply them to all clients and they are written
+// as resp2 equivalents to clients not switched to resp3 by hello
+
+// respMap is flat list of key value pairs, resp2 array
+type respMap []interface{}
+
+// respSet is list of unique elements, resp2 array
+type respSet []interface{}
+
+// respPush is out-of-band message like pubsub message, resp2 array
+type respPush []interface{}
+
+// respDouble is written in format of zset scores, resp2 bulk string
+type respDouble float64
+
+// respBool is resp2 integer 1 or 0
+type respBool bool
+
+// respBigNumber is integer in decimal out of int64 range, resp2 bulk string
+type respBigNumber string
+
+// respVerbatim is plain text like info, resp2 bulk string
+type respVerbatim []byte
+
+// respWriter writes replies in protocol negotiated by client
+type respWriter struct {
+	bw *bufio.Writer
+	// 2 or 3
+	proto int
+}
+
+func newRespWriter(bw *bufio.Writer) *respWriter {
+	return &respWriter{bw: bw, proto: 2}
+}
+
+func (w *respWriter) Flush() error {
+	return w.bw.Flush()
+}
+
+func (w *respWriter) writeLine(prefix byte, s string) error {
+	w.bw.WriteByte(prefix)
+	w.bw.WriteString(s)
+	_, err := w.bw.WriteString("\r\n")
+	return err
+}
+
+func (w *respWriter) writeNull(resp2 string) error {
+	if w.proto == 3 {
+		return w.writeLine('_', "")
+	}
+	return w.writeLine(resp2[0], resp2[1:])
+}
+
+// writeAggregate writes nil map or set of missing key as null array to resp2
+// clients like before, resp3 clients get an empty one
+func (w *respWriter) writeAggregate(prefix byte, n int, ay []interface{}) error {
+	if w.proto == 2 {
+		if ay == nil {
+			return w.writeLine('*', "-1")
+		}
+		prefix, n = '*', len(ay)
+	}
+	w.writeLine(prefix, strconv.Itoa(n))
+	for _, v := range ay {
+		if err := w.WriteValue(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *respWriter) WriteInteger(n int64) error {
+	return w.writeLine(':', strconv.FormatInt(n, 10))
+}
+
+func (w *respWriter) WriteString(s string) error {
+	return w.writeLine('+', s)
+}
+
+func (w *respWriter) WriteError(e error) error {
+	if e == nil {
+		return w.writeLine('-', "error is nil, invalid")
+	}
+	return w.writeLine('-', e.Error())
+}
+
+func (w *respWriter) WriteBulk(b []byte) error {
+	if b == nil {
+		return w.writeNull("$-1")
+	}
+	w.writeLine('$', strconv.Itoa(len(b)))
+	w.bw.Write(b)
+	_, err := w.bw.WriteString("\r\n")
+	return err
+}
+
+func (w *respWriter) WriteArray(ay []interface{}) error {
+	if ay == nil {
+		return w.writeNull("*-1")
+	}
+	return w.writeAggregate('*', len(ay), ay)
+}
+
+// WriteValue writes reply by its type
+func (w *respWriter) WriteValue(v interface{}) error {
+	switch v := v.(type) {
+	case []interface{}:
+		return w.WriteArray(v)
+	case []byte:
+		return w.WriteBulk(v)
+	case nil:
+		return w.WriteBulk(nil)
+	case int64:
+		return w.WriteInteger(v)
+	case string:
+		return w.WriteString(v)
+	case error:
+		return w.WriteError(v)
+	case respMap:
+		return w.writeAggregate('%', len(v)/2, v)
+	case respSet:
+		return w.writeAggregate('~', len(v), v)
+	case respPush:
+		return w.writeAggregate('>', len(v), v)
+	case respDouble:
+		s := tidis.FormatScore(float64(v))
+		if w.proto == 3 {
+			return w.writeLine(',', string(s))
+		}
+		return w.WriteBulk(s)
+	case respBool:
+		if w.proto == 3 {
+			if v {
+				return w.writeLine('#', "t")
+			}
+			return w.writeLine('#', "f")
+		}
+		if v {
+			return w.WriteInteger(1)
+		}
+		return w.WriteInteger(0)
+	case respBigNumber:
+		if w.proto == 3 {
+			return w.writeLine('(', string(v))
+		}
+		return w.WriteBulk([]byte(v))
+	case respVerbatim:
+		if w.proto == 3 {
+			w.writeLine('=', strconv.Itoa(len(v)+4))
+			w.bw.WriteString("txt:")
+			w.bw.Write(v)
+			_, err := w.bw.WriteString("\r\n")
+			return err
+		}
+		return w.WriteBulk(v)
+	}
+	return terror.ErrUnknownType
+}
+
+func (w *respWriter) FlushString(s string) error {
+	w.WriteString(s)
+	return w.Flush()
+}
+
+func (w *respWriter) FlushError(e error) error {
+	w.WriteError(e)
+	return w.Flush()
+}
+
+func (w *respWriter) FlushBulk(b []byte) error {
+	w.WriteBulk(b)
+	return w.Flush()
+}
+
+func (w *respWriter) FlushValue(v interface{}) error {
+	w.WriteValue(v)
+	return w.Flush()
+}
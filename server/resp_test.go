@@ -0,0 +1,178 @@
+//
+// resp_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yongman/tidis/terror"
+)
+
+func TestRespWriter(t *testing.T) {
+	for _, c := range []struct {
+		v            interface{}
+		resp2, resp3 string
+	}{
+		{nil, "$-1\r\n", "_\r\n"},
+		{[]interface{}(nil), "*-1\r\n", "_\r\n"},
+		{"OK", "+OK\r\n", "+OK\r\n"},
+		{[]interface{}{int64(1), []byte("a")}, "*2\r\n:1\r\n$1\r\na\r\n", "*2\r\n:1\r\n$1\r\na\r\n"},
+		{respMap{[]byte("k"), respDouble(1.5)}, "*2\r\n$1\r\nk\r\n$3\r\n1.5\r\n", "%1\r\n$1\r\nk\r\n,1.5\r\n"},
+		{respMap(nil), "*-1\r\n", "%0\r\n"},
+		{respSet{[]byte("a")}, "*1\r\n$1\r\na\r\n", "~1\r\n$1\r\na\r\n"},
+		{respPush{[]byte("message")}, "*1\r\n$7\r\nmessage\r\n", ">1\r\n$7\r\nmessage\r\n"},
+		{respDouble(math.Inf(-1)), "$4\r\n-inf\r\n", ",-inf\r\n"},
+		{respBool(true), ":1\r\n", "#t\r\n"},
+		{respBigNumber("12345678901234567890"), "$20\r\n12345678901234567890\r\n", "(12345678901234567890\r\n"},
+		{respVerbatim("a:1\r\n"), "$5\r\na:1\r\n\r\n", "=9\r\ntxt:a:1\r\n\r\n"},
+	} {
+		for proto, expect := range map[int]string{2: c.resp2, 3: c.resp3} {
+			var buf bytes.Buffer
+			w := newRespWriter(bufio.NewWriter(&buf))
+			w.proto = proto
+			if err := w.FlushValue(c.v); err != nil || buf.String() != expect {
+				t.Fatalf("resp%d of %#v got %q %v, expect %q", proto, c.v, buf.String(), err, expect)
+			}
+		}
+	}
+}
+
+// rawConn sends requests and checks replies byte by byte
+type rawConn struct {
+	t *testing.T
+	net.Conn
+	br *bufio.Reader
+}
+
+func newRawConn(t *testing.T, app *App) *rawConn {
+	conn, err := net.Dial("tcp", app.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	return &rawConn{t: t, Conn: conn, br: bufio.NewReader(conn)}
+}
+
+func (c *rawConn) send(args ...string) {
+	c.t.Helper()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.Write(buf.Bytes()); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *rawConn) expect(reply string) {
+	c.t.Helper()
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, len(reply))
+	if _, err := io.ReadFull(c.br, buf); err != nil || string(buf) != reply {
+		c.t.Fatalf("expect %q, got %q %v", reply, buf, err)
+	}
+}
+
+func (c *rawConn) do(reply string, args ...string) {
+	c.t.Helper()
+	c.send(args...)
+	c.expect(reply)
+}
+
+func helloReply(proto int, id string) string {
+	prefix := "%7"
+	if proto == 2 {
+		prefix = "*14"
+	}
+	return prefix + "\r\n$6\r\nserver\r\n$5\r\nredis\r\n" +
+		"$7\r\nversion\r\n$" + fmt.Sprint(len(redisVersion)) + "\r\n" + redisVersion + "\r\n" +
+		"$5\r\nproto\r\n:" + fmt.Sprint(proto) + "\r\n$2\r\nid\r\n" + id +
+		"$4\r\nmode\r\n$10\r\nstandalone\r\n$4\r\nrole\r\n$6\r\nmaster\r\n" +
+		"$7\r\nmodules\r\n*0\r\n"
+}
+
+func TestHello(t *testing.T) {
+	app := newTestApp(t)
+	c := newRawConn(t, app)
+	defer c.Close()
+
+	c.send("client", "id")
+	id, _ := c.br.ReadString('\n')
+	c.do(helloReply(3, id), "hello", "3")
+	if !strings.Contains(c.describeSelf(), " resp=3") {
+		t.Fatalf("client info has no resp=3")
+	}
+
+	c.do("_\r\n", "get", "nosuch")
+	c.do(":1\r\n", "hset", "h", "f", "v")
+	c.do("%1\r\n$1\r\nf\r\n$1\r\nv\r\n", "hgetall", "h")
+	c.do(":1\r\n", "zadd", "z", "1.5", "m")
+	c.do(",1.5\r\n", "zscore", "z", "m")
+	c.do("*2\r\n$1\r\nm\r\n,1.5\r\n", "zrange", "z", "0", "-1", "withscores")
+	c.do(":1\r\n", "sadd", "s", "a")
+	c.do("~1\r\n$1\r\na\r\n", "smembers", "s")
+	c.do("%1\r\n$14\r\nmax_connection\r\n$1\r\n0\r\n", "config", "get", "max_connection")
+
+	// commands in subscribed context, messages are pushed
+	c.do(">3\r\n$9\r\nsubscribe\r\n$2\r\nch\r\n:1\r\n", "subscribe", "ch")
+	c.do("+PONG\r\n", "ping")
+	pub := newTestConn(t, app)
+	defer pub.Close()
+	pub.Do("publish", "ch", "msg")
+	c.expect(">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$3\r\nmsg\r\n")
+	c.do("$1\r\nv\r\n", "hget", "h", "f")
+
+	c.do("-NOPROTO unsupported protocol version\r\n", "hello", "4")
+	c.do(helloReply(2, id), "hello", "2")
+	c.do("-"+terror.ErrPubSubContext.Error()+"\r\n", "get", "k")
+
+	// hello authenticates and sets name
+	pub.Do("acl", "setuser", "default", "resetpass", ">pass")
+	c2 := newRawConn(t, app)
+	defer c2.Close()
+	c2.do("-NOAUTH Authentication required.\r\n", "hello", "3")
+	c2.do("-WRONGPASS invalid username-password pair or user is disabled.\r\n", "hello", "3", "auth", "default", "wrong")
+	c2.send("hello", "3", "auth", "default", "pass", "setname", "conn2")
+	c2.expect("%7\r\n")
+	for line := ""; line != "*0\r\n"; {
+		var err error
+		if line, err = c2.br.ReadString('\n'); err != nil {
+			t.Fatalf("read hello reply failed: %v", err)
+		}
+	}
+	c2.do("$5\r\nconn2\r\n", "client", "getname")
+
+	// hello in multi is rejected without switching protocol
+	c2.do("+OK\r\n", "multi")
+	c2.do("-"+terror.ErrHelloInMulti.Error()+"\r\n", "hello", "2")
+	c2.do("*0\r\n", "exec")
+	c2.do("_\r\n", "get", "nosuch")
+}
+
+// describeSelf reads client info line of connection in resp3
+func (c *rawConn) describeSelf() string {
+	c.t.Helper()
+	c.send("client", "info")
+	head, err := c.br.ReadString('\n')
+	if err != nil || !strings.HasPrefix(head, "=") {
+		c.t.Fatalf("client info got %q %v", head, err)
+	}
+	var n int
+	fmt.Sscanf(head, "=%d", &n)
+	buf := make([]byte, n+2)
+	io.ReadFull(c.br, buf)
+	return string(buf)
+}
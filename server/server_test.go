@@ -0,0 +1,33 @@
+//
+// server_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"testing"
+
+	"github.com/yongman/go/goredis"
+	"github.com/yongman/tidis/config"
+)
+
+// newTestApp runs app with in-memory backend on a random port
+func newTestApp(t *testing.T) *App {
+	conf := config.NewConfig(nil, "127.0.0.1:0", "", 10, "")
+	conf.Backend.Type = "memory"
+
+	app := NewApp(conf)
+	go app.Run()
+	return app
+}
+
+func newTestConn(t *testing.T, app *App) *goredis.Conn {
+	conn, err := goredis.Connect(app.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	return conn
+}
@@ -0,0 +1,101 @@
+//
+// shutdown_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yongman/go/goredis"
+)
+
+func TestReleaseLeader(t *testing.T) {
+	app := newTestApp(t)
+	defer app.Close()
+
+	tdb := app.GetTidis()
+	tdb.CheckLeader(60)
+	if !tdb.IsLeader() {
+		t.Fatalf("not leader after check")
+	}
+	if err := tdb.ReleaseLeader(); err != nil || tdb.IsLeader() {
+		t.Fatalf("leader not released, error %v", err)
+	}
+	// released lease can be taken at once
+	tdb.CheckLeader(60)
+	if !tdb.IsLeader() {
+		t.Fatalf("not leader after release")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	app := newTestApp(t)
+
+	idle := newTestConn(t, app)
+	defer idle.Close()
+	multi := newTestConn(t, app)
+	defer multi.Close()
+	blocked := newTestConn(t, app)
+	defer blocked.Close()
+	paused := newTestConn(t, app)
+	defer paused.Close()
+
+	multi.Do("multi")
+	if s, _ := goredis.String(multi.Do("set", "k", "v")); s != "QUEUED" {
+		t.Fatalf("set in multi got %s", s)
+	}
+	if err := blocked.Send("blpop", "l", "0"); err != nil {
+		t.Fatal(err)
+	}
+	for atomic.LoadInt32(&app.blockedCount) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	idle.Do("client", "pause", "10000")
+	if err := paused.Send("get", "k"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- app.Close()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("close failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("close timeout")
+	}
+	if app.clients.len() != 0 {
+		t.Fatalf("%d clients left after close", app.clients.len())
+	}
+
+	// blocked client is woken up before closed
+	blocked.SetReadDeadline(time.Now().Add(time.Second))
+	if v, err := blocked.Receive(); v != nil || err != nil {
+		t.Fatalf("blocked client got %v %v", v, err)
+	}
+	// paused command is not executed
+	paused.SetReadDeadline(time.Now().Add(time.Second))
+	if v, err := paused.Receive(); err == nil {
+		t.Fatalf("paused client got %v", v)
+	}
+	for _, c := range []*goredis.Conn{idle, multi, blocked} {
+		if _, err := c.Do("ping"); err == nil {
+			t.Fatalf("client still serves after close")
+		}
+	}
+	if _, err := goredis.Connect(app.listener.Addr().String()); err == nil {
+		t.Fatalf("connect after close")
+	}
+	if err := app.Close(); err != nil {
+		t.Fatalf("close again got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+//
+// slowlog.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// args of slow log entry are truncated like redis
+	slowlogMaxArgc   = 32
+	slowlogMaxArgLen = 128
+)
+
+type slowlogEntry struct {
+	id       int64
+	time     int64
+	duration int64
+	args     [][]byte
+	addr     string
+	name     string
+}
+
+// slowlog keeps the latest commands slower than threshold on this instance
+type slowlog struct {
+	// microseconds, negative disables slow log
+	slowerThan int64
+	maxLen     int64
+
+	sync.Mutex
+	nextId int64
+	// newest entry first
+	entries []*slowlogEntry
+}
+
+func newSlowlog(slowerThan int64, maxLen int) *slowlog {
+	return &slowlog{
+		slowerThan: slowerThan,
+		maxLen:     int64(maxLen),
+	}
+}
+
+func (l *slowlog) setSlowerThan(usec int64) {
+	atomic.StoreInt64(&l.slowerThan, usec)
+}
+
+func (l *slowlog) setMaxLen(n int) {
+	atomic.StoreInt64(&l.maxLen, int64(n))
+
+	l.Lock()
+	defer l.Unlock()
+	if len(l.entries) > n {
+		l.entries = l.entries[:n]
+	}
+}
+
+// record adds command to slow log if it is slower than threshold
+func (l *slowlog) record(cmd string, args [][]byte, start time.Time, cost time.Duration, addr, name string) {
+	slowerThan := atomic.LoadInt64(&l.slowerThan)
+	usec := int64(cost / time.Microsecond)
+	if slowerThan < 0 || usec < slowerThan {
+		return
+	}
+
+	argc := len(args) + 1
+	if argc > slowlogMaxArgc {
+		argc = slowlogMaxArgc
+	}
+	entryArgs := make([][]byte, 0, argc)
+	entryArgs = append(entryArgs, []byte(cmd))
+	for i, arg := range args {
+		if len(entryArgs) == slowlogMaxArgc-1 && i < len(args)-1 {
+			more := "... (" + strconv.Itoa(len(args)-i) + " more arguments)"
+			entryArgs = append(entryArgs, []byte(more))
+			break
+		}
+		if len(arg) > slowlogMaxArgLen {
+			more := "... (" + strconv.Itoa(len(arg)-slowlogMaxArgLen) + " more bytes)"
+			arg = append(append([]byte{}, arg[:slowlogMaxArgLen]...), more...)
+		} else {
+			arg = append([]byte{}, arg...)
+		}
+		entryArgs = append(entryArgs, arg)
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	maxLen := int(atomic.LoadInt64(&l.maxLen))
+	if maxLen <= 0 {
+		return
+	}
+	entry := &slowlogEntry{
+		id:       l.nextId,
+		time:     start.Unix(),
+		duration: usec,
+		args:     entryArgs,
+		addr:     addr,
+		name:     name,
+	}
+	l.nextId++
+
+	if len(l.entries) < maxLen {
+		l.entries = append(l.entries, nil)
+	}
+	copy(l.entries[1:], l.entries)
+	l.entries[0] = entry
+}
+
+// get returns at most count newest entries, all entries if count is negative
+func (l *slowlog) get(count int) []*slowlogEntry {
+	l.Lock()
+	defer l.Unlock()
+	if count < 0 || count > len(l.entries) {
+		count = len(l.entries)
+	}
+	return append([]*slowlogEntry{}, l.entries[:count]...)
+}
+
+func (l *slowlog) len() int {
+	l.Lock()
+	defer l.Unlock()
+	return len(l.entries)
+}
+
+func (l *slowlog) reset() {
+	l.Lock()
+	defer l.Unlock()
+	l.entries = nil
+}
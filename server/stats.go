@@ -0,0 +1,119 @@
+//
+// stats.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/yongman/tidis/terror"
+)
+
+type commandStat struct {
+	calls    uint64
+	usec     uint64
+	rejected uint64
+	failed   uint64
+}
+
+// serverStats counts connections and commands of this instance
+type serverStats struct {
+	// updated atomically, keep them first for 64-bit alignment
+	totalConns    uint64
+	rejectedConns uint64
+	totalCommands uint64
+
+	startTime time.Time
+
+	sync.Mutex
+	commands map[string]*commandStat
+
+	// exported by metrics listener
+	commandDuration *prometheus.HistogramVec
+	commandErrors   *prometheus.CounterVec
+}
+
+func newServerStats() *serverStats {
+	return &serverStats{
+		startTime: time.Now(),
+		commands:  make(map[string]*commandStat),
+		commandDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "tidis",
+			Name:      "command_duration_seconds",
+			Help:      "Duration of commands by command name.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 18),
+		}, []string{"command"}),
+		commandErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "tidis",
+			Name:      "command_errors_total",
+			Help:      "Errors replied to commands by error type.",
+		}, []string{"error"}),
+	}
+}
+
+func (s *serverStats) connAccepted() {
+	atomic.AddUint64(&s.totalConns, 1)
+}
+
+func (s *serverStats) connRejected() {
+	atomic.AddUint64(&s.rejectedConns, 1)
+}
+
+// commandDone records a call of known command, argument errors are counted
+// as rejected and other errors as failed
+func (s *serverStats) commandDone(cmd string, start time.Time, err error) {
+	cost := time.Since(start)
+	usec := uint64(cost / time.Microsecond)
+	atomic.AddUint64(&s.totalCommands, 1)
+	s.commandDuration.WithLabelValues(cmd).Observe(cost.Seconds())
+
+	s.Lock()
+	defer s.Unlock()
+	st, ok := s.commands[cmd]
+	if !ok {
+		st = &commandStat{}
+		s.commands[cmd] = st
+	}
+	if err == terror.ErrCmdParams {
+		st.rejected++
+		return
+	}
+	st.calls++
+	st.usec += usec
+	if err != nil {
+		st.failed++
+	}
+}
+
+// commandError records error replied to client, including unknown commands
+func (s *serverStats) commandError(err error) {
+	s.commandErrors.WithLabelValues(terror.Name(err)).Inc()
+}
+
+type namedCommandStat struct {
+	name string
+	commandStat
+}
+
+// commandStats returns copies of command stats sorted by name
+func (s *serverStats) commandStats() []namedCommandStat {
+	s.Lock()
+	stats := make([]namedCommandStat, 0, len(s.commands))
+	for name, st := range s.commands {
+		stats = append(stats, namedCommandStat{name: name, commandStat: *st})
+	}
+	s.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].name < stats[j].name
+	})
+	return stats
+}
@@ -0,0 +1,105 @@
+//
+// tls.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+
+	"github.com/yongman/go/log"
+	"github.com/yongman/tidis/config"
+)
+
+var errTLSCA = errors.New("no certificate found in tls ca file")
+
+// tlsState is certificates used by tls listener, it is replaced on reload
+type tlsState struct {
+	cert tls.Certificate
+	// client certificates are verified if not nil
+	clientCAs *x509.CertPool
+	// client certificate is optional if false
+	requireClientCert bool
+}
+
+func loadTLSState(conf *config.Config) (*tlsState, error) {
+	cert, err := tls.LoadX509KeyPair(conf.Tidis.TLSCert, conf.Tidis.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+	st := &tlsState{cert: cert}
+	if conf.Tidis.TLSCA == "" {
+		return st, nil
+	}
+
+	pem, err := ioutil.ReadFile(conf.Tidis.TLSCA)
+	if err != nil {
+		return nil, err
+	}
+	st.clientCAs = x509.NewCertPool()
+	if !st.clientCAs.AppendCertsFromPEM(pem) {
+		return nil, errTLSCA
+	}
+	st.requireClientCert = conf.Tidis.TLSAuthClients != "optional"
+	return st, nil
+}
+
+// tlsConfig returns config using current certificates for each handshake, so
+// reloaded certificates are used by new connections
+func (app *App) tlsConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			st := app.tlsState.Load().(*tlsState)
+			c := &tls.Config{
+				Certificates: []tls.Certificate{st.cert},
+				MinVersion:   tls.VersionTLS12,
+			}
+			if st.clientCAs != nil {
+				c.ClientCAs = st.clientCAs
+				if st.requireClientCert {
+					c.ClientAuth = tls.RequireAndVerifyClientCert
+				} else {
+					c.ClientAuth = tls.VerifyClientCertIfGiven
+				}
+			}
+			return c, nil
+		},
+	}
+}
+
+// listenTLS listens on tls listen address with certificates in config
+func (app *App) listenTLS() (net.Listener, error) {
+	st, err := loadTLSState(app.conf)
+	if err != nil {
+		return nil, err
+	}
+	app.tlsState.Store(st)
+
+	l, err := net.Listen("tcp", app.conf.Tidis.TLSListen)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("server tls listen in %s", app.conf.Tidis.TLSListen)
+	return tls.NewListener(l, app.tlsConfig()), nil
+}
+
+// reloadTLS loads certificates again, connected clients are not affected
+func (app *App) reloadTLS() error {
+	if app.tlsListener == nil {
+		return nil
+	}
+	st, err := loadTLSState(app.conf)
+	if err != nil {
+		return err
+	}
+	app.tlsState.Store(st)
+	log.Info("tls certificates reloaded")
+	return nil
+}
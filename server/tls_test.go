@@ -0,0 +1,207 @@
+//
+// tls_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yongman/go/goredis"
+	"github.com/yongman/tidis/config"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCert creates certificate signed by parent, self-signed if parent is nil
+func newTestCert(t *testing.T, serial int64, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "tidis test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func (c *testCert) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (c *testCert) tlsCert(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.pem, c.keyPEM(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tidis-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := newTestCert(t, 1, nil, true)
+	server := newTestCert(t, 2, ca, false)
+	client := newTestCert(t, 3, ca, false)
+
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	writeTestFile(t, certFile, server.pem)
+	writeTestFile(t, keyFile, server.keyPEM(t))
+	writeTestFile(t, caFile, ca.pem)
+
+	confFile := filepath.Join(dir, "tidis.toml")
+	writeTestFile(t, confFile, []byte("[tidis]\nlisten = \"\"\ntls_listen = \"127.0.0.1:0\"\n"+
+		"tls_cert = \""+certFile+"\"\ntls_key = \""+keyFile+"\"\ntls_ca = \""+caFile+"\"\n"+
+		"[backend]\ntype = \"memory\"\n"))
+	conf, err := config.LoadConfig(confFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf = config.NewConfig(conf, "", "", 0, "")
+	config.FillWithDefaultConfig(conf)
+	app := NewApp(conf)
+	go app.Run()
+	defer app.Close()
+
+	if app.listener != nil {
+		t.Fatalf("plaintext listener is enabled")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	dial := func(certs ...tls.Certificate) (*tls.Conn, error) {
+		conn, err := tls.Dial("tcp", app.tlsListener.Addr().String(), &tls.Config{
+			RootCAs:      roots,
+			Certificates: certs,
+		})
+		if err != nil {
+			return nil, err
+		}
+		// client certificate is rejected after handshake of client side
+		if err = conn.Handshake(); err == nil {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			_, err = conn.Write([]byte("*1\r\n$4\r\nPING\r\n"))
+			if err == nil {
+				buf := make([]byte, 7)
+				_, err = conn.Read(buf)
+				if err == nil && string(buf) != "+PONG\r\n" {
+					t.Fatalf("ping got %q", buf)
+				}
+			}
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Time{})
+		return conn, nil
+	}
+
+	// client certificate is required
+	if _, err = dial(); err == nil {
+		t.Fatalf("connection without client certificate is accepted")
+	}
+	conn, err := dial(client.tlsCert(t))
+	if err != nil {
+		t.Fatalf("dial with client certificate failed: %v", err)
+	}
+	rc, _ := goredis.NewConn(conn)
+	defer rc.Close()
+	if s, err := goredis.String(rc.Do("set", "k", "v")); err != nil || s != "OK" {
+		t.Fatalf("set over tls got %s %v", s, err)
+	}
+
+	// reload replaced certificate and optional client certificate
+	server2 := newTestCert(t, 4, ca, false)
+	writeTestFile(t, certFile, server2.pem)
+	writeTestFile(t, keyFile, server2.keyPEM(t))
+	data, _ := ioutil.ReadFile(confFile)
+	data = []byte(strings.Replace(string(data), "[backend]", "tls_auth_clients = \"optional\"\n[backend]", 1))
+	writeTestFile(t, confFile, data)
+	if err = app.ReloadConfig(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	conn2, err := dial()
+	if err != nil {
+		t.Fatalf("dial without client certificate after reload failed: %v", err)
+	}
+	defer conn2.Close()
+	if serial := conn2.ConnectionState().PeerCertificates[0].SerialNumber.Int64(); serial != 4 {
+		t.Fatalf("certificate serial after reload %d", serial)
+	}
+
+	// connected client is not affected
+	if s, err := goredis.String(rc.Do("get", "k")); err != nil || s != "v" {
+		t.Fatalf("get over tls after reload got %s %v", s, err)
+	}
+
+	// broken files keep current certificates
+	writeTestFile(t, keyFile, []byte("broken"))
+	app.ReloadConfig()
+	if app.conf.Tidis.TLSAuthClients != "optional" {
+		t.Fatalf("tls config changed by failed reload")
+	}
+	conn3, err := dial()
+	if err != nil {
+		t.Fatalf("dial after failed reload: %v", err)
+	}
+	conn3.Close()
+}
@@ -0,0 +1,278 @@
+//
+// tracking.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/yongman/go/log"
+	"github.com/yongman/go/util"
+	"github.com/yongman/tidis/terror"
+)
+
+const (
+	// resp2 clients get invalidations redirected to them as messages of it
+	trackingChannel = "__redis__:invalidate"
+	// keys written on an instance are published to others in it
+	trackingSyncChannel = "__tidis__:tracking"
+)
+
+// trackingOpts are options of client tracking on
+type trackingOpts struct {
+	// id of client invalidations are sent to, 0 for the tracking client
+	redirect int64
+	// keys matching prefixes are invalidated without being read, all keys
+	// if no prefix
+	bcast    bool
+	prefixes [][]byte
+	// keys written by the tracking client are not invalidated to it
+	noloop bool
+}
+
+type trackingState struct {
+	trackingOpts
+	// keys read by client and not invalidated yet
+	keys map[string]struct{}
+}
+
+// trackingTable keeps keys read by tracking clients of this instance, a key is
+// forgotten after it is invalidated until it is read again
+type trackingTable struct {
+	sync.Mutex
+	clients map[*Client]*trackingState
+	keys    map[string]map[*Client]struct{}
+}
+
+func newTrackingTable() *trackingTable {
+	return &trackingTable{
+		clients: make(map[*Client]*trackingState),
+		keys:    make(map[string]map[*Client]struct{}),
+	}
+}
+
+// enable turns tracking on or changes options of it, keys read before are kept
+// unless client switches to bcast
+func (t *trackingTable) enable(c *Client, opts trackingOpts) {
+	t.Lock()
+	defer t.Unlock()
+	st, ok := t.clients[c]
+	if !ok {
+		st = &trackingState{keys: make(map[string]struct{})}
+		t.clients[c] = st
+	} else if opts.bcast {
+		t.forget(c, st)
+	}
+	st.trackingOpts = opts
+}
+
+func (t *trackingTable) disable(c *Client) {
+	t.Lock()
+	defer t.Unlock()
+	if st, ok := t.clients[c]; ok {
+		t.forget(c, st)
+		delete(t.clients, c)
+	}
+}
+
+func (t *trackingTable) forget(c *Client, st *trackingState) {
+	for key := range st.keys {
+		hubRemove(t.keys, key, c)
+	}
+	st.keys = make(map[string]struct{})
+}
+
+// track remembers keys read by client, bcast clients track nothing
+func (t *trackingTable) track(c *Client, keys [][]byte) {
+	t.Lock()
+	defer t.Unlock()
+	st, ok := t.clients[c]
+	if !ok || st.bcast {
+		return
+	}
+	for _, key := range keys {
+		hubAdd(t.keys, string(key), c)
+		st.keys[string(key)] = struct{}{}
+	}
+}
+
+// invalidation is keys to invalidate on a tracking client, nil keys means all
+// keys are flushed
+type invalidation struct {
+	c        *Client
+	redirect int64
+	keys     [][]byte
+}
+
+// invalidate forgets keys written by client from, nil from for keys written
+// on other instances, and returns invalidations to send. nil keys flushes all
+func (t *trackingTable) invalidate(keys [][]byte, from *Client) []invalidation {
+	t.Lock()
+	defer t.Unlock()
+
+	var invs []invalidation
+	if keys == nil {
+		for c, st := range t.clients {
+			st.keys = make(map[string]struct{})
+			invs = append(invs, invalidation{c: c, redirect: st.redirect})
+		}
+		t.keys = make(map[string]map[*Client]struct{})
+		return invs
+	}
+
+	pending := make(map[*Client][][]byte)
+	for _, key := range keys {
+		for c := range t.keys[string(key)] {
+			st := t.clients[c]
+			delete(st.keys, string(key))
+			if !st.noloop || c != from {
+				pending[c] = append(pending[c], key)
+			}
+		}
+		delete(t.keys, string(key))
+
+		for c, st := range t.clients {
+			if st.bcast && (!st.noloop || c != from) && matchPrefixes(st.prefixes, key) {
+				pending[c] = append(pending[c], key)
+			}
+		}
+	}
+	for c, keys := range pending {
+		invs = append(invs, invalidation{c: c, redirect: t.clients[c].redirect, keys: keys})
+	}
+	return invs
+}
+
+func matchPrefixes(prefixes [][]byte, key []byte) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if bytes.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidate pushes invalidation messages of keys to tracking clients of this
+// instance, nil keys means all keys are flushed
+func (app *App) invalidate(keys [][]byte, from *Client) {
+	for _, inv := range app.tracking.invalidate(keys, from) {
+		to := inv.c
+		if inv.redirect != 0 {
+			// messages are lost if redirect client is gone
+			if to = app.clients.get(inv.redirect); to == nil {
+				continue
+			}
+		}
+		var ay []interface{}
+		if inv.keys != nil {
+			ay = make([]interface{}, len(inv.keys))
+			for i, key := range inv.keys {
+				ay[i] = key
+			}
+		}
+		to.push([]interface{}{[]byte("invalidate"), ay})
+	}
+}
+
+// trackCommand remembers keys read by tracking client, it runs before the
+// command so writes committed after the read are always invalidated
+func (c *Client) trackCommand() {
+	if c.tracking && !cmdHasCategory(c.cmd, "write") && cmdHasCategory(c.cmd, "read") {
+		c.app.tracking.track(c, commandKeys(c.cmd, c.args))
+	}
+}
+
+// invalidateCommand invalidates keys written by command on all instances,
+// writes in transaction are invalidated after commit
+func (c *Client) invalidateCommand() {
+	var keys [][]byte
+	flush := c.cmd == "flushdb" || c.cmd == "flushall"
+	if !flush {
+		if !cmdHasCategory(c.cmd, "write") {
+			return
+		}
+		if keys = commandKeys(c.cmd, c.args); len(keys) == 0 {
+			return
+		}
+	}
+
+	if c.isTxn {
+		c.txnFlush = c.txnFlush || flush
+		c.txnInvalidate = append(c.txnInvalidate, keys...)
+		return
+	}
+	c.invalidateKeys(keys)
+}
+
+// invalidateKeys invalidates keys on this instance and publishes them to
+// others, nil keys means all keys are flushed
+func (c *Client) invalidateKeys(keys [][]byte) {
+	c.app.invalidate(keys, c)
+	if err := c.tdb.Publish([]byte(trackingSyncChannel), encodeTrackingKeys(keys)); err != nil {
+		log.Warnf("publish invalidation failed: %v", err)
+	}
+}
+
+// encodeTrackingKeys encodes keys with length prefix, empty message means all
+// keys are flushed
+func encodeTrackingKeys(keys [][]byte) []byte {
+	var buf []byte
+	for _, key := range keys {
+		n := make([]byte, 4)
+		util.Uint32ToBytes1(n, uint32(len(key)))
+		buf = append(append(buf, n...), key...)
+	}
+	return buf
+}
+
+func decodeTrackingKeys(raw []byte) ([][]byte, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	keys := [][]byte{}
+	for len(raw) > 0 {
+		if len(raw) < 4 {
+			return nil, terror.ErrInvalidMeta
+		}
+		n, _ := util.BytesToUint32(raw)
+		if len(raw) < 4+int(n) {
+			return nil, terror.ErrInvalidMeta
+		}
+		keys = append(keys, raw[4:4+n])
+		raw = raw[4+n:]
+	}
+	return keys, nil
+}
+
+// deliverInvalidation invalidates keys written on other instances
+func (app *App) deliverInvalidation(message []byte) {
+	keys, err := decodeTrackingKeys(message)
+	if err != nil {
+		log.Warnf("decode invalidation failed: %v", err)
+		return
+	}
+	app.invalidate(keys, nil)
+}
+
+// pushMessage converts invalidation to message of tracking channel for resp2
+// client, it returns nil if the client does not subscribe to the channel
+func (c *Client) pushMessage(msg []interface{}) []interface{} {
+	if c.rWriter.proto != 2 || len(msg) != 2 {
+		return msg
+	}
+	if kind, ok := msg[0].([]byte); !ok || string(kind) != "invalidate" {
+		return msg
+	}
+	if _, ok := c.channels[trackingChannel]; !ok {
+		return nil
+	}
+	return []interface{}{[]byte("message"), []byte(trackingChannel), msg[1]}
+}
@@ -0,0 +1,153 @@
+//
+// tracking_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/yongman/tidis/config"
+	"github.com/yongman/tidis/terror"
+	"github.com/yongman/tidis/tidis"
+)
+
+// newTestTrackingApp runs app with client tracking enabled, messages of other
+// instances are carried by ps if it is not nil
+func newTestTrackingApp(t *testing.T, ps *tidis.LocalPubSub) *App {
+	conf := config.NewConfig(nil, "127.0.0.1:0", "", 10, "")
+	conf.Backend.Type = "memory"
+	conf.Tidis.TrackingEnabled = true
+
+	app := NewApp(conf)
+	if ps != nil {
+		app.GetTidis().SetPubSubTransport(ps.Transport())
+	}
+	go app.Run()
+	return app
+}
+
+// newTrackingConn connects in resp3 and turns tracking on with options
+func newTrackingConn(t *testing.T, app *App, opts ...string) *rawConn {
+	c := newRawConn(t, app)
+	c.send("hello", "3")
+	c.expect("%7\r\n")
+	for line := ""; line != "*0\r\n"; {
+		var err error
+		if line, err = c.br.ReadString('\n'); err != nil {
+			t.Fatalf("read hello reply failed: %v", err)
+		}
+	}
+	c.do("+OK\r\n", append([]string{"client", "tracking", "on"}, opts...)...)
+	return c
+}
+
+func invalidateReply(keys ...string) string {
+	if keys == nil {
+		return ">2\r\n$10\r\ninvalidate\r\n_\r\n"
+	}
+	reply := ">2\r\n$10\r\ninvalidate\r\n*" + fmt.Sprint(len(keys)) + "\r\n"
+	for _, key := range keys {
+		reply += "$" + fmt.Sprint(len(key)) + "\r\n" + key + "\r\n"
+	}
+	return reply
+}
+
+func TestClientTracking(t *testing.T) {
+	app := newTestTrackingApp(t, nil)
+	c := newTrackingConn(t, app)
+	defer c.Close()
+	w := newRawConn(t, app)
+	defer w.Close()
+
+	c.do("_\r\n", "get", "k")
+	w.do("+OK\r\n", "set", "k", "v")
+	c.expect(invalidateReply("k"))
+	// invalidated key is not tracked until it is read again
+	w.do("+OK\r\n", "set", "k", "v2")
+	c.do("+PONG\r\n", "ping")
+
+	// writes of client itself are invalidated after reply
+	c.do("$2\r\nv2\r\n", "get", "k")
+	c.do(":1\r\n", "del", "k")
+	c.expect(invalidateReply("k"))
+
+	// writes in multi are invalidated after exec
+	c.do("%0\r\n", "hgetall", "h")
+	w.do("+OK\r\n", "multi")
+	w.do("+QUEUED\r\n", "hset", "h", "f", "v")
+	c.do("+PONG\r\n", "ping")
+	w.do("*1\r\n:1\r\n", "exec")
+	c.expect(invalidateReply("h"))
+
+	c.do("_\r\n", "get", "k")
+	w.do("+OK\r\n", "flushdb")
+	c.expect(invalidateReply())
+
+	// tracking off
+	c.do("_\r\n", "get", "k")
+	c.do("+OK\r\n", "client", "tracking", "off")
+	w.do("+OK\r\n", "set", "k", "v")
+	c.do("+PONG\r\n", "ping")
+}
+
+func TestClientTrackingOptions(t *testing.T) {
+	app := newTestTrackingApp(t, nil)
+	w := newRawConn(t, app)
+	defer w.Close()
+
+	// bcast receives keys matching prefixes without reading them
+	b := newTrackingConn(t, app, "bcast", "prefix", "user:", "noloop")
+	defer b.Close()
+	w.do("+OK\r\n", "set", "user:1", "v")
+	b.expect(invalidateReply("user:1"))
+	w.do("+OK\r\n", "set", "other", "v")
+	b.do("+OK\r\n", "set", "user:2", "v")
+	b.do("+PONG\r\n", "ping")
+
+	// resp2 client gets invalidations redirected to it as messages
+	r := newRawConn(t, app)
+	defer r.Close()
+	r.send("client", "id")
+	id, _ := r.br.ReadString('\n')
+	id = strings.TrimSuffix(strings.TrimPrefix(id, ":"), "\r\n")
+	r.do("*3\r\n$9\r\nsubscribe\r\n$20\r\n__redis__:invalidate\r\n:1\r\n", "subscribe", trackingChannel)
+	c := newRawConn(t, app)
+	defer c.Close()
+	c.do("+OK\r\n", "client", "tracking", "on", "redirect", id)
+	c.do("$-1\r\n", "get", "k")
+	w.do("+OK\r\n", "set", "k", "v")
+	r.expect("*3\r\n$7\r\nmessage\r\n$20\r\n__redis__:invalidate\r\n*1\r\n$1\r\nk\r\n")
+
+	c.do("-"+terror.ErrTrackingRedirect.Error()+"\r\n", "client", "tracking", "on", "redirect", "1000")
+	c.do("-"+terror.ErrTrackingPrefix.Error()+"\r\n", "client", "tracking", "on", "prefix", "a")
+	c.do("-"+terror.ErrCmdParams.Error()+"\r\n", "client", "tracking", "on", "optin")
+
+	// tracking needs to be enabled in config
+	app2 := newTestApp(t)
+	c2 := newRawConn(t, app2)
+	defer c2.Close()
+	c2.do("-"+terror.ErrTrackingDisabled.Error()+"\r\n", "client", "tracking", "on")
+}
+
+func TestClientTrackingInstances(t *testing.T) {
+	ps := tidis.NewLocalPubSub()
+	app1 := newTestTrackingApp(t, ps)
+	app2 := newTestTrackingApp(t, ps)
+
+	c := newTrackingConn(t, app1)
+	defer c.Close()
+	w := newRawConn(t, app2)
+	defer w.Close()
+
+	c.do("_\r\n", "get", "k")
+	w.do("+OK\r\n", "mset", "k", "v", "k2", "v")
+	c.expect(invalidateReply("k"))
+	w.do("+OK\r\n", "flushall")
+	c.expect(invalidateReply())
+}
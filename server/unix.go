@@ -0,0 +1,52 @@
+//
+// unix.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/yongman/go/log"
+)
+
+var errUnixSocketPerm = errors.New("invalid unixsocketperm, it should be octal like 700")
+
+// listenUnix listens on unix socket path with permission in octal, empty perm
+// keeps permission decided by umask. stale socket file of previous process is
+// removed, other files are kept
+func listenUnix(path, perm string) (net.Listener, error) {
+	var mode os.FileMode
+	if perm != "" {
+		m, err := strconv.ParseUint(perm, 8, 32)
+		if err != nil || m > 0777 {
+			return nil, errUnixSocketPerm
+		}
+		mode = os.FileMode(m)
+	}
+
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if perm != "" {
+		if err = os.Chmod(path, mode); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	log.Infof("server listen in unix socket %s", path)
+	return l, nil
+}
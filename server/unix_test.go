@@ -0,0 +1,87 @@
+//
+// unix_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yongman/go/goredis"
+	"github.com/yongman/tidis/config"
+)
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tidis-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "tidis.sock")
+
+	// stale socket file is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	conf := config.NewConfig(nil, "127.0.0.1:0", "", 10, "")
+	conf.Backend.Type = "memory"
+	conf.Tidis.UnixSocket = path
+	conf.Tidis.UnixSocketPerm = "600"
+	conf.Tidis.MaxConn = 2
+	app := NewApp(conf)
+	go app.Run()
+	defer app.Close()
+
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("socket file mode %v, error %v", info.Mode(), err)
+	}
+
+	unixConn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uc, _ := goredis.NewConn(unixConn)
+	defer uc.Close()
+	tc := newTestConn(t, app)
+	defer tc.Close()
+
+	if s, err := goredis.String(uc.Do("set", "k", "v")); err != nil || s != "OK" {
+		t.Fatalf("set over unix socket got %s %v", s, err)
+	}
+	if s, err := goredis.String(tc.Do("get", "k")); err != nil || s != "v" {
+		t.Fatalf("get over tcp got %s %v", s, err)
+	}
+
+	// max connection counts clients of all listeners
+	extra, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer extra.Close()
+	extra.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err = extra.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("connection over max connection is not closed")
+	}
+	if n := app.clients.len(); n != 2 {
+		t.Fatalf("clients %d", n)
+	}
+}
+
+func TestListenUnixPerm(t *testing.T) {
+	if _, err := listenUnix(filepath.Join(os.TempDir(), "tidis-perm.sock"), "999"); err != errUnixSocketPerm {
+		t.Fatalf("invalid perm got %v", err)
+	}
+}
@@ -7,6 +7,10 @@
 
 package store
 
+import (
+	"github.com/yongman/tidis/store/tikv"
+)
+
 // backend db interface
 type DB interface {
 	Close() error
@@ -15,6 +19,7 @@ type DB interface {
 	GetWithSnapshot(key []byte, ss interface{}) ([]byte, error)
 	GetNewestSnapshot() (interface{}, error)
 	GetSnapshotFromTxn(txn interface{}) interface{}
+	GetSnapshotWithVersion(version uint64) (interface{}, error)
 	GetWithVersion(key []byte, version uint64) ([]byte, error)
 	MGet(key [][]byte) (map[string][]byte, error)
 	MGetWithVersion(key [][]byte, version uint64) (map[string][]byte, error)
@@ -44,10 +49,16 @@ type DB interface {
 
 	BatchWithTxn(f func(txn interface{}) (interface{}, error), txn1 interface{}) (interface{}, error)
 	NewTxn() (interface{}, error)
+	CommitTxn(txn interface{}) error
+	RollbackTxn(txn interface{}) error
+	SetCommitHook(hook func(txn interface{}) error)
+	SetTxnDoneHook(hook func(txn interface{}, committed bool))
 
 	UnsafeDeleteRange(start, end []byte) error
 	RunGC(safePoint uint64, concurrency int) error
 	GetCurrentVersion() (uint64, error)
+	TxnStats() tikv.TxnStats
+	SetTxnRetry(count int)
 }
 
 // iterator for backend store
@@ -0,0 +1,45 @@
+//
+// memory.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package memory
+
+import (
+	"github.com/pingcap/tidb/store/mockstore"
+	"github.com/yongman/tidis/config"
+	"github.com/yongman/tidis/store/tikv"
+)
+
+const deleteRangeBatch = 1024
+
+// Memory is an in-process backend without any outside services, data is kept in
+// a mocked tikv cluster with full mvcc support, so snapshots, versions and
+// optimistic transaction conflicts behave the same as a real tikv cluster.
+// It is used by unit tests and embedded deployments, data is lost after close.
+type Memory struct {
+	*tikv.Tikv
+}
+
+func Open(conf *config.Config) (*Memory, error) {
+	store, err := mockstore.NewMockTikvStore()
+	if err != nil {
+		return nil, err
+	}
+	return &Memory{Tikv: tikv.NewTikv(store, conf.Tidis.TxnRetry)}, nil
+}
+
+// mocked tikv does not support destroy range rpc, delete keys in batches instead
+func (m *Memory) UnsafeDeleteRange(start, end []byte) error {
+	for {
+		deleted, err := m.DeleteRange(start, end, deleteRangeBatch)
+		if err != nil {
+			return err
+		}
+		if deleted < deleteRangeBatch {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,177 @@
+//
+// memory_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package memory
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/pingcap/tidb/kv"
+	"github.com/yongman/tidis/config"
+)
+
+func newTestMemory(t *testing.T) *Memory {
+	conf := config.NewConfig(nil, "", "", 0, "")
+	conf.Backend.Type = "memory"
+	conf.Tidis.TxnRetry = 10
+	db, err := Open(conf)
+	if err != nil {
+		t.Fatalf("open memory backend failed: %v", err)
+	}
+	return db
+}
+
+func TestSetGetDelete(t *testing.T) {
+	db := newTestMemory(t)
+	defer db.Close()
+
+	if err := db.Set([]byte("foo"), []byte("bar")); err != nil {
+		t.Fatal(err)
+	}
+	v, err := db.Get([]byte("foo"))
+	if err != nil || string(v) != "bar" {
+		t.Fatalf("get foo, expect bar, got %s %v", v, err)
+	}
+
+	n, err := db.Delete([][]byte{[]byte("foo"), []byte("nokey")})
+	if err != nil || n != 1 {
+		t.Fatalf("delete expect 1, got %d %v", n, err)
+	}
+	v, err = db.Get([]byte("foo"))
+	if err != nil || v != nil {
+		t.Fatalf("get deleted key, got %s %v", v, err)
+	}
+}
+
+func TestSnapshotAndVersion(t *testing.T) {
+	db := newTestMemory(t)
+	defer db.Close()
+
+	db.Set([]byte("k"), []byte("v1"))
+	ver, err := db.GetCurrentVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, err := db.GetNewestSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Set([]byte("k"), []byte("v2"))
+
+	v, _ := db.GetWithSnapshot([]byte("k"), ss)
+	if string(v) != "v1" {
+		t.Fatalf("snapshot read expect v1, got %s", v)
+	}
+	v, _ = db.GetWithVersion([]byte("k"), ver)
+	if string(v) != "v1" {
+		t.Fatalf("version read expect v1, got %s", v)
+	}
+	v, _ = db.Get([]byte("k"))
+	if string(v) != "v2" {
+		t.Fatalf("newest read expect v2, got %s", v)
+	}
+}
+
+func TestRangeAndRank(t *testing.T) {
+	db := newTestMemory(t)
+	defer db.Close()
+
+	kvm := map[string][]byte{
+		"r1": []byte("1"),
+		"r2": []byte("2"),
+		"r3": []byte("3"),
+		"r4": []byte("4"),
+		"s1": []byte("x"),
+	}
+	if _, err := db.MSet(kvm); err != nil {
+		t.Fatal(err)
+	}
+
+	start := []byte("r")
+	end := kv.Key(start).PrefixNext()
+
+	keys, err := db.GetRangeKeys(start, end, 1, 2, nil)
+	if err != nil || len(keys) != 2 || string(keys[0]) != "r2" || string(keys[1]) != "r3" {
+		t.Fatalf("range keys with offset got %q %v", keys, err)
+	}
+
+	cnt, err := db.GetRangeKeysCount([]byte("r1"), false, []byte("r4"), false, 10, nil)
+	if err != nil || cnt != 2 {
+		t.Fatalf("range count expect 2, got %d %v", cnt, err)
+	}
+
+	kvs, err := db.GetRangeKeysVals(start, end, 10, nil)
+	if err != nil || len(kvs) != 8 || !bytes.Equal(kvs[7], []byte("4")) {
+		t.Fatalf("range keys vals got %q %v", kvs, err)
+	}
+
+	rank, exist, err := db.GetRank(start, end, []byte("r3"), nil)
+	if err != nil || !exist || rank != 2 {
+		t.Fatalf("rank of r3 expect 2, got %d %v %v", rank, exist, err)
+	}
+
+	deleted, err := db.DeleteRange(start, end, 0)
+	if err != nil || deleted != 4 {
+		t.Fatalf("delete range expect 4, got %d %v", deleted, err)
+	}
+	v, _ := db.Get([]byte("s1"))
+	if string(v) != "x" {
+		t.Fatalf("key out of range deleted")
+	}
+}
+
+func TestBatchInTxnConflictRetry(t *testing.T) {
+	db := newTestMemory(t)
+	defer db.Close()
+
+	key := []byte("counter")
+	db.Set(key, []byte{0})
+
+	incr := func(txn interface{}) (interface{}, error) {
+		v, err := db.GetWithTxn(key, txn)
+		if err != nil {
+			return nil, err
+		}
+		return nil, db.SetWithTxn(key, []byte{v[0] + 1}, txn)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := db.BatchInTxn(incr); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	v, _ := db.Get(key)
+	if v[0] != 5 {
+		t.Fatalf("concurrent increment expect 5, got %d", v[0])
+	}
+}
+
+func TestUnsafeDeleteRange(t *testing.T) {
+	db := newTestMemory(t)
+	defer db.Close()
+
+	db.Set([]byte("a1"), []byte("1"))
+	db.Set([]byte("b1"), []byte("1"))
+	if err := db.UnsafeDeleteRange([]byte("a"), []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := db.Get([]byte("a1")); v != nil {
+		t.Fatalf("key in range not deleted")
+	}
+	if v, _ := db.Get([]byte("b1")); v == nil {
+		t.Fatalf("key out of range deleted")
+	}
+}
@@ -9,14 +9,33 @@ package store
 
 import (
 	"github.com/yongman/tidis/config"
+	"github.com/yongman/tidis/store/memory"
 	"github.com/yongman/tidis/store/tikv"
+	"github.com/yongman/tidis/terror"
+)
+
+const (
+	BackendTikv   = "tikv"
+	BackendMemory = "memory"
 )
 
 func init() {
 }
 
 func Open(conf *config.Config) (DB, error) {
-	db, err := tikv.Open(conf)
+	var (
+		db  DB
+		err error
+	)
+
+	switch conf.Backend.Type {
+	case "", BackendTikv:
+		db, err = tikv.Open(conf)
+	case BackendMemory:
+		db, err = memory.Open(conf)
+	default:
+		return nil, terror.ErrBackendType
+	}
 	if err != nil {
 		return nil, err
 	}
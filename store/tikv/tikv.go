@@ -15,6 +15,7 @@ import (
 	"math"
 	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"context"
@@ -27,9 +28,26 @@ import (
 	"github.com/yongman/tidis/terror"
 )
 
+// TxnStats counts transactions run by BatchInTxn, rollbacks are caused by
+// errors of operations, failures are commits failed after all retries
+type TxnStats struct {
+	Commits   uint64
+	Rollbacks uint64
+	Retries   uint64
+	Conflicts uint64
+	Failures  uint64
+}
+
 type Tikv struct {
+	// updated atomically, keep it first for 64-bit alignment
+	txnStats TxnStats
 	store    kv.Storage
-	txnRetry int
+	// changed at runtime, accessed atomically
+	txnRetry int64
+	// called with txn before it is committed, set before serving
+	commitHook func(txn interface{}) error
+	// called with txn after it is committed or rolled back
+	doneHook func(txn interface{}, committed bool)
 }
 
 func Open(conf *config.Config) (*Tikv, error) {
@@ -38,7 +56,12 @@ func Open(conf *config.Config) (*Tikv, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Tikv{store: store, txnRetry: conf.Tidis.TxnRetry}, nil
+	return NewTikv(store, conf.Tidis.TxnRetry), nil
+}
+
+// NewTikv wraps an opened kv storage, it is shared by all backends which speak tikv txn protocol
+func NewTikv(store kv.Storage, txnRetry int) *Tikv {
+	return &Tikv{store: store, txnRetry: int64(txnRetry)}
 }
 
 var (
@@ -56,11 +79,46 @@ func BackOff(attempts uint) int {
 }
 
 func (tikv *Tikv) GetTxnRetry() int {
-	return tikv.txnRetry
+	return int(atomic.LoadInt64(&tikv.txnRetry))
 }
 
 func (tikv *Tikv) SetTxnRetry(count int) {
-	tikv.txnRetry = count
+	atomic.StoreInt64(&tikv.txnRetry, int64(count))
+}
+
+// SetCommitHook sets hook called before commit of txns, txn is rolled back
+// if hook returns error
+func (tikv *Tikv) SetCommitHook(hook func(txn interface{}) error) {
+	tikv.commitHook = hook
+}
+
+func (tikv *Tikv) runCommitHook(txn kv.Transaction) error {
+	if tikv.commitHook == nil {
+		return nil
+	}
+	return tikv.commitHook(txn)
+}
+
+// SetTxnDoneHook sets hook called after txns are committed or rolled back,
+// txns failed to commit are passed as not committed
+func (tikv *Tikv) SetTxnDoneHook(hook func(txn interface{}, committed bool)) {
+	tikv.doneHook = hook
+}
+
+func (tikv *Tikv) runDoneHook(txn kv.Transaction, committed bool) {
+	if tikv.doneHook != nil {
+		tikv.doneHook(txn, committed)
+	}
+}
+
+func (tikv *Tikv) TxnStats() TxnStats {
+	return TxnStats{
+		Commits:   atomic.LoadUint64(&tikv.txnStats.Commits),
+		Rollbacks: atomic.LoadUint64(&tikv.txnStats.Rollbacks),
+		Retries:   atomic.LoadUint64(&tikv.txnStats.Retries),
+		Conflicts: atomic.LoadUint64(&tikv.txnStats.Conflicts),
+		Failures:  atomic.LoadUint64(&tikv.txnStats.Failures),
+	}
 }
 
 func (tikv *Tikv) Close() error {
@@ -119,8 +177,20 @@ func (tikv *Tikv) GetSnapshotFromTxn(txn1 interface{}) interface{} {
 	return ss
 }
 
+// snapshot with MaxVersion is resolved on each read, use current version to
+// make multiple reads on the returned snapshot consistent
 func (tikv *Tikv) GetNewestSnapshot() (interface{}, error) {
-	return tikv.store.GetSnapshot(kv.MaxVersion)
+	ver, err := tikv.store.CurrentVersion()
+	if err != nil {
+		return nil, err
+	}
+	return tikv.store.GetSnapshot(ver)
+}
+
+// snapshot of data committed before version, reads fail if version is older
+// than gc safe point
+func (tikv *Tikv) GetSnapshotWithVersion(version uint64) (interface{}, error) {
+	return tikv.store.GetSnapshot(kv.Version{Ver: version})
 }
 
 func (tikv *Tikv) GetWithVersion(key []byte, version uint64) ([]byte, error) {
@@ -625,6 +695,7 @@ func (tikv *Tikv) BatchInTxn(f func(txn interface{}) (interface{}, error)) (inte
 		res        interface{}
 		txn        kv.Transaction
 		err        error
+		tryAgain   bool
 	)
 
 	retryCount = tikv.GetTxnRetry()
@@ -635,26 +706,44 @@ func (tikv *Tikv) BatchInTxn(f func(txn interface{}) (interface{}, error)) (inte
 		}
 
 		res, err = f(txn)
+		if err == nil {
+			err = tikv.runCommitHook(txn)
+		}
 		if err != nil {
 			err1 := txn.Rollback()
+			tikv.runDoneHook(txn, false)
+			if err == terror.ErrTryAgain && !tryAgain {
+				// data read by f was changed in other txns, run f again once
+				tryAgain = true
+				continue
+			}
 			if err1 != nil {
 				if retryCount >= 0 && kv.IsTxnRetryableError(err1) {
 					log.Warnf("txn %v rollback retry, err: %v", txn, err1)
+					atomic.AddUint64(&tikv.txnStats.Retries, 1)
 					retryCount--
 					continue
 				}
 			}
+			atomic.AddUint64(&tikv.txnStats.Rollbacks, 1)
 			return nil, err
 		}
 		err = txn.Commit(context.Background())
+		tikv.runDoneHook(txn, err == nil)
 		if err == nil {
+			atomic.AddUint64(&tikv.txnStats.Commits, 1)
 			break
 		}
+		if kv.IsTxnRetryableError(err) {
+			atomic.AddUint64(&tikv.txnStats.Conflicts, 1)
+		}
 		if retryCount >= 0 && kv.IsTxnRetryableError(err) {
 			log.Warnf("txn %v commit retry, err: %v", txn, err)
+			atomic.AddUint64(&tikv.txnStats.Retries, 1)
 			retryCount--
 			continue
 		} else {
+			atomic.AddUint64(&tikv.txnStats.Failures, 1)
 			break
 		}
 	}
@@ -673,6 +762,7 @@ func (tikv *Tikv) BatchWithTxn(f func(txn interface{}) (interface{}, error), txn
 
 	if err != nil {
 		err1 := txn.Rollback()
+		tikv.runDoneHook(txn, false)
 		if err1 != nil {
 			return nil, err1
 		}
@@ -680,6 +770,26 @@ func (tikv *Tikv) BatchWithTxn(f func(txn interface{}) (interface{}, error), txn
 	return res, err
 }
 
+// CommitTxn commits txn created by NewTxn after commit hook
+func (tikv *Tikv) CommitTxn(txn1 interface{}) error {
+	txn := txn1.(kv.Transaction)
+	if err := tikv.runCommitHook(txn); err != nil {
+		tikv.RollbackTxn(txn)
+		return err
+	}
+	err := txn.Commit(context.Background())
+	tikv.runDoneHook(txn, err == nil)
+	return err
+}
+
+// RollbackTxn rolls back txn created by NewTxn
+func (tikv *Tikv) RollbackTxn(txn1 interface{}) error {
+	txn := txn1.(kv.Transaction)
+	err := txn.Rollback()
+	tikv.runDoneHook(txn, false)
+	return err
+}
+
 func (tikv *Tikv) NewTxn() (interface{}, error) {
 	return tikv.store.Begin()
 }
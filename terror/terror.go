@@ -27,7 +27,110 @@ var (
 	ErrAuthFailed          error = errors.New("ERR invalid password")
 	ErrAuthReqired         error = errors.New("NOAUTH Authentication required.")
 	ErrKeyBusy             error = errors.New("BUSYKEY key is deleting, retry later")
+	ErrTryAgain            error = errors.New("TRYAGAIN sorted set scores are converting, retry later")
 	ErrNotInteger          error = errors.New("ERR value is not an integer or out of range")
+	ErrNotFloat            error = errors.New("ERR value is not a valid float")
+	ErrMinMaxNotFloat      error = errors.New("ERR min or max is not a float")
+	ErrScoreNaN            error = errors.New("ERR resulting score is not a number (NaN)")
+	ErrZaddNXAndXX         error = errors.New("ERR XX and NX options at the same time are not compatible")
+	ErrZaddGTLTNX          error = errors.New("ERR GT, LT, and/or NX options at the same time are not compatible")
+	ErrZaddIncrPair        error = errors.New("ERR INCR option supports a single increment-element pair")
+	ErrWeightNotFloat      error = errors.New("ERR weight value is not a float")
+	ErrTimeoutNotFloat     error = errors.New("ERR timeout is not a float or out of range")
+	ErrTimeoutNegative     error = errors.New("ERR timeout is negative")
+	ErrKeyspaceEvents      error = errors.New("ERR Invalid event class character. Use 'g$lshzxeA'.")
+	ErrPubSubContext       error = errors.New("ERR only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context")
+	ErrLposRankZero        error = errors.New("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+	ErrLposCountNegative   error = errors.New("ERR COUNT can't be negative")
+	ErrLposMaxlenNegative  error = errors.New("ERR MAXLEN can't be negative")
 	ErrDiscardWithoutMulti error = errors.New("ERR DISCARD without MULTI")
 	ErrExecWithoutMulti    error = errors.New("ERR EXEC without MULTI")
+	ErrWatchInMulti        error = errors.New("ERR WATCH inside MULTI is not allowed")
+	ErrHelloInMulti        error = errors.New("ERR HELLO inside MULTI is not allowed")
+	ErrExecAbort           error = errors.New("EXECABORT Transaction discarded because of previous errors.")
+	ErrInvalidCursor       error = errors.New("ERR invalid cursor")
+	ErrConfigUnknown       error = errors.New("ERR unknown config parameter")
+	ErrConfigImmutable     error = errors.New("ERR can't set immutable config")
+	ErrConfigValue         error = errors.New("ERR invalid config value")
+	ErrConfigNoFile        error = errors.New("ERR the server is running without a config file")
+	ErrNoSuchClient        error = errors.New("ERR No such client")
+	ErrClientName          error = errors.New("ERR Client names cannot contain spaces, newlines or special characters.")
+	ErrWrongPass           error = errors.New("WRONGPASS invalid username-password pair or user is disabled.")
+	ErrNoPermCommand       error = errors.New("NOPERM this user has no permissions to run this command")
+	ErrNoPermKey           error = errors.New("NOPERM this user has no permissions to access one of the keys used as arguments")
+	ErrNoPermDB            error = errors.New("NOPERM this user has no permissions to access this database")
+	ErrACLRule             error = errors.New("ERR Error in ACL SETUSER modifier: Syntax error")
+	ErrACLDelDefault       error = errors.New("ERR The 'default' user cannot be removed")
+	ErrACLCategory         error = errors.New("ERR Unknown category")
+	ErrNoProto             error = errors.New("NOPROTO unsupported protocol version")
+	ErrTrackingDisabled    error = errors.New("ERR client tracking is disabled, set tracking_enabled to enable it")
+	ErrTrackingPrefix      error = errors.New("ERR PREFIX option requires BCAST mode to be enabled")
+	ErrTrackingRedirect    error = errors.New("ERR The client ID you want redirect to does not exist")
 )
+
+var names = map[error]string{
+	ErrCommand:             "ErrCommand",
+	ErrCmdParams:           "ErrCmdParams",
+	ErrKeyEmpty:            "ErrKeyEmpty",
+	ErrKeyOrFieldEmpty:     "ErrKeyOrFieldEmpty",
+	ErrTypeNotMatch:        "ErrTypeNotMatch",
+	ErrCmdInBatch:          "ErrCmdInBatch",
+	ErrCmdNumber:           "ErrCmdNumber",
+	ErrBackendType:         "ErrBackendType",
+	ErrTypeAssertion:       "ErrTypeAssertion",
+	ErrOutOfIndex:          "ErrOutOfIndex",
+	ErrInvalidMeta:         "ErrInvalidMeta",
+	ErrUnknownType:         "ErrUnknownType",
+	ErrRunWithTxn:          "ErrRunWithTxn",
+	ErrAuthNoNeed:          "ErrAuthNoNeed",
+	ErrAuthFailed:          "ErrAuthFailed",
+	ErrAuthReqired:         "ErrAuthReqired",
+	ErrKeyBusy:             "ErrKeyBusy",
+	ErrTryAgain:            "ErrTryAgain",
+	ErrNotInteger:          "ErrNotInteger",
+	ErrNotFloat:            "ErrNotFloat",
+	ErrMinMaxNotFloat:      "ErrMinMaxNotFloat",
+	ErrScoreNaN:            "ErrScoreNaN",
+	ErrZaddNXAndXX:         "ErrZaddNXAndXX",
+	ErrZaddGTLTNX:          "ErrZaddGTLTNX",
+	ErrZaddIncrPair:        "ErrZaddIncrPair",
+	ErrWeightNotFloat:      "ErrWeightNotFloat",
+	ErrTimeoutNotFloat:     "ErrTimeoutNotFloat",
+	ErrTimeoutNegative:     "ErrTimeoutNegative",
+	ErrKeyspaceEvents:      "ErrKeyspaceEvents",
+	ErrPubSubContext:       "ErrPubSubContext",
+	ErrLposRankZero:        "ErrLposRankZero",
+	ErrLposCountNegative:   "ErrLposCountNegative",
+	ErrLposMaxlenNegative:  "ErrLposMaxlenNegative",
+	ErrDiscardWithoutMulti: "ErrDiscardWithoutMulti",
+	ErrExecWithoutMulti:    "ErrExecWithoutMulti",
+	ErrWatchInMulti:        "ErrWatchInMulti",
+	ErrHelloInMulti:        "ErrHelloInMulti",
+	ErrExecAbort:           "ErrExecAbort",
+	ErrInvalidCursor:       "ErrInvalidCursor",
+	ErrConfigUnknown:       "ErrConfigUnknown",
+	ErrConfigImmutable:     "ErrConfigImmutable",
+	ErrConfigValue:         "ErrConfigValue",
+	ErrConfigNoFile:        "ErrConfigNoFile",
+	ErrNoSuchClient:        "ErrNoSuchClient",
+	ErrClientName:          "ErrClientName",
+	ErrWrongPass:           "ErrWrongPass",
+	ErrNoPermCommand:       "ErrNoPermCommand",
+	ErrNoPermKey:           "ErrNoPermKey",
+	ErrNoPermDB:            "ErrNoPermDB",
+	ErrACLRule:             "ErrACLRule",
+	ErrACLDelDefault:       "ErrACLDelDefault",
+	ErrACLCategory:         "ErrACLCategory",
+	ErrNoProto:             "ErrNoProto",
+	ErrTrackingDisabled:    "ErrTrackingDisabled",
+	ErrTrackingPrefix:      "ErrTrackingPrefix",
+	ErrTrackingRedirect:    "ErrTrackingRedirect",
+}
+
+// Name returns variable name of err, "Other" for errors not defined here
+func Name(err error) string {
+	if name, ok := names[err]; ok {
+		return name
+	}
+	return "Other"
+}
@@ -0,0 +1,54 @@
+//
+// acl.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"github.com/pingcap/tidb/kv"
+)
+
+const aclUsersBatch = 100
+
+// ACLUsers returns rules of all acl users of tenant by user name, rules are
+// stored as the text after user name in redis acl file format
+func (tidis *Tidis) ACLUsers() (map[string]string, error) {
+	prefix := RawSysACLPrefix(tidis.TenantId())
+	startKey := prefix
+	endKey := kv.Key(prefix).PrefixNext()
+
+	users := make(map[string]string)
+	for {
+		kvs, err := tidis.db.GetRangeKeysVals(startKey, endKey, aclUsersBatch, nil)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(kvs)-1; i += 2 {
+			if !kv.Key(kvs[i]).HasPrefix(prefix) {
+				continue
+			}
+			users[string(kvs[i][len(prefix):])] = string(kvs[i+1])
+		}
+		if uint64(len(kvs)) < aclUsersBatch*2 {
+			return users, nil
+		}
+		startKey = kv.Key(kvs[len(kvs)-2]).Next()
+	}
+}
+
+// SetACLUser creates or replaces rules of acl user
+func (tidis *Tidis) SetACLUser(name, rules string) error {
+	return tidis.db.Set(RawSysACLUserKey(tidis.TenantId(), name), []byte(rules))
+}
+
+// DelACLUsers deletes acl users and returns count of users existed
+func (tidis *Tidis) DelACLUsers(names []string) (int, error) {
+	keys := make([][]byte, len(names))
+	for i, name := range names {
+		keys[i] = RawSysACLUserKey(tidis.TenantId(), name)
+	}
+	return tidis.db.Delete(keys)
+}
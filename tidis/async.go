@@ -8,44 +8,304 @@
 package tidis
 
 import (
+	"bytes"
 	"context"
+	"time"
+
+	"github.com/pingcap/tidb/kv"
 	"github.com/yongman/go/log"
+	"github.com/yongman/go/util"
+	"github.com/yongman/tidis/terror"
+)
+
+const (
+	// collections with more elements than threshold are deleted asynchronously
+	asyncDelThreshold uint64 = 1024
+	// max data keys deleted in one txn when purging
+	asyncDelBatch uint64 = 1024
+	// workers purging data keys of deleted collections
+	asyncDelConcurrency = 4
+	// interval for leader to reload the pending deletions left by other instances
+	asyncDelReloadInterval = 60
 )
 
+// asyncDelEntry is a deleted collection of key, all of them are recorded in
+// the async deletion key of the key until purged
+type asyncDelEntry struct {
+	keyType byte   // deleted collection type
+	ver     uint64 // version of deleted zset
+}
+
+func marshalAsyncDel(entries []asyncDelEntry) []byte {
+	raw := make([]byte, 0, len(entries)*9)
+	for _, e := range entries {
+		verBytes, _ := util.Uint64ToBytes(e.ver)
+		raw = append(append(raw, e.keyType), verBytes...)
+	}
+	return raw
+}
+
+func unmarshalAsyncDel(raw []byte) []asyncDelEntry {
+	if len(raw)%9 != 0 {
+		// written by old versions, only the type of one collection
+		return []asyncDelEntry{{keyType: raw[0]}}
+	}
+	entries := make([]asyncDelEntry, 0, len(raw)/9)
+	for i := 0; i < len(raw); i += 9 {
+		ver, _ := util.BytesToUint64(raw[i+1:])
+		entries = append(entries, asyncDelEntry{keyType: raw[i], ver: ver})
+	}
+	return entries
+}
+
 type AsyncDelItem struct {
+	dbId    uint8  // user key db
 	keyType byte   // user key type
 	ukey    []byte // user key
 }
 
-func (tidis *Tidis) AsyncDelAdd(keyType byte, ukey []byte) error {
+func (tidis *Tidis) AsyncDelAdd(dbId uint8, keyType byte, ukey []byte) error {
 	tidis.Lock.Lock()
 	defer tidis.Lock.Unlock()
 
-	key := string(keyType) + string(ukey)
+	key := string([]byte{dbId, keyType}) + string(ukey)
 	// key already added to chan queue
 	if tidis.asyncDelSet.Contains(key) {
 		return nil
 	}
-	tidis.asyncDelCh <- AsyncDelItem{keyType: keyType, ukey: ukey}
-	tidis.asyncDelSet.Add(key)
+	select {
+	case tidis.asyncDelCh <- AsyncDelItem{dbId: dbId, keyType: keyType, ukey: ukey}:
+		tidis.asyncDelSet.Add(key)
+	default:
+		// queue is full, item is persisted and will be reloaded later
+		log.Warnf("async deletion queue is full, key %s delayed", string(ukey))
+	}
 
 	return nil
 }
 
-func (tidis *Tidis) AsyncDelDone(keyType byte, ukey []byte) error {
+// asyncDelAfterCommit records deletions marked in txn, the persisted records
+// are invisible to workers until the txn committed
+func (tidis *Tidis) asyncDelAfterCommit(txn interface{}, items []AsyncDelItem) {
+	if len(items) == 0 {
+		return
+	}
 	tidis.Lock.Lock()
 	defer tidis.Lock.Unlock()
+	tidis.asyncDelTxns[txn] = append(tidis.asyncDelTxns[txn], items...)
+}
 
-	key := string(keyType) + string(ukey)
+// txnDone is called by store after txn committed or rolled back, async
+// deletions recorded in txn are queued if it committed
+func (tidis *Tidis) txnDone(txn interface{}, committed bool) {
+	tidis.Lock.Lock()
+	items := tidis.asyncDelTxns[txn]
+	delete(tidis.asyncDelTxns, txn)
+	tidis.Lock.Unlock()
+
+	if !committed {
+		return
+	}
+	for _, item := range items {
+		tidis.AsyncDelAdd(item.dbId, item.keyType, item.ukey)
+	}
+}
+
+func (tidis *Tidis) AsyncDelDone(dbId uint8, keyType byte, ukey []byte) error {
+	tidis.Lock.Lock()
+	defer tidis.Lock.Unlock()
+
+	key := string([]byte{dbId, keyType}) + string(ukey)
 	if tidis.asyncDelSet.Contains(key) {
 		tidis.asyncDelSet.Remove(key)
 	}
 	return nil
 }
 
-func (tidis *Tidis) RunAsync(ctx context.Context) {
-	// TODO
-	log.Infof("Async tasks started for async deletion")
+func (tidis *Tidis) AsyncDelPending() int {
+	return len(tidis.asyncDelCh)
+}
+
+func (tidis *Tidis) RawAsyncDelKey(dbId uint8, key []byte) []byte {
+	return RawSysAsyncDelKey(tidis.TenantId(), dbId, key)
+}
+
+// checkKeyBusy returns ErrKeyBusy if data keys of key are still purging, new
+// collection must not be created on the key until purge finished, except zset
+// which is created with a new version
+func (tidis *Tidis) checkKeyBusy(dbId uint8, txn interface{}, key []byte) error {
+	v, err := tidis.db.GetWithTxn(tidis.RawAsyncDelKey(dbId, key), txn)
+	if err != nil {
+		return err
+	}
+	if v != nil {
+		return terror.ErrKeyBusy
+	}
+	return nil
+}
+
+func collectionSize(obj IObject) uint64 {
+	switch v := obj.(type) {
+	case *HashObj:
+		return v.Size
+	case *ListObj:
+		return v.Size
+	case *SetObj:
+		return v.Size
+	case *ZSetObj:
+		return v.Size
+	}
+	return 0
+}
+
+// asyncDelWithTxn marks big collection deleted and records it for purging,
+// returns false if the key should be deleted synchronously
+func (tidis *Tidis) asyncDelWithTxn(dbId uint8, txn interface{}, key []byte) (bool, byte, error) {
+	objType, obj, err := tidis.GetObject(dbId, txn, key)
+	if err != nil {
+		return false, 0, err
+	}
+	if obj == nil || collectionSize(obj) <= asyncDelThreshold {
+		return false, 0, nil
+	}
+
+	// keep tombstone meta until all data keys purged
+	obj.MarkDeleted()
+	err = tidis.db.SetWithTxn(tidis.RawKeyPrefix(dbId, key), MarshalObj(obj), txn)
+	if err != nil {
+		return false, 0, err
+	}
+
+	// zset with a version may be created while older ones are purging
+	delKey := tidis.RawAsyncDelKey(dbId, key)
+	v, err := tidis.db.GetWithTxn(delKey, txn)
+	if err != nil {
+		return false, 0, err
+	}
+	var entries []asyncDelEntry
+	if v != nil {
+		entries = unmarshalAsyncDel(v)
+	}
+	entry := asyncDelEntry{keyType: objType}
+	if zsetObj, ok := obj.(*ZSetObj); ok {
+		entry.ver = zsetObj.Version
+	}
+	err = tidis.db.SetWithTxn(delKey, marshalAsyncDel(append(entries, entry)), txn)
+	if err != nil {
+		return false, 0, err
+	}
+	return true, objType, nil
+}
+
+// asyncDelPrefixes returns prefixes of data keys of deleted collection
+func (tidis *Tidis) asyncDelPrefixes(dbId uint8, key []byte, e asyncDelEntry) [][]byte {
+	switch e.keyType {
+	case TLISTMETA, THASHMETA, TSETMETA:
+		return [][]byte{append(tidis.RawKeyPrefix(dbId, key), DataTypeKey)}
+	case TZSETMETA:
+		return [][]byte{
+			tidis.rawZSetDataPrefix(dbId, key, e.ver),
+			tidis.rawZSetScorePrefix(dbId, key, e.ver),
+		}
+	}
+	return nil
+}
+
+// purge deletes all data keys of the deleted collections of item in batches,
+// then the tombstone meta
+func (tidis *Tidis) asyncPurge(item AsyncDelItem) error {
+	delKey := tidis.RawAsyncDelKey(item.dbId, item.ukey)
+	for {
+		v, err := tidis.db.Get(delKey)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			// already purged by others
+			return nil
+		}
+
+		for _, e := range unmarshalAsyncDel(v) {
+			for _, startKey := range tidis.asyncDelPrefixes(item.dbId, item.ukey, e) {
+				endKey := kv.Key(startKey).PrefixNext()
+				for {
+					deleted, err := tidis.db.DeleteRange(startKey, endKey, asyncDelBatch)
+					if err != nil {
+						return err
+					}
+					if deleted < asyncDelBatch {
+						break
+					}
+				}
+			}
+		}
+
+		f := func(txn interface{}) (interface{}, error) {
+			cur, err := tidis.db.GetWithTxn(delKey, txn)
+			if err != nil {
+				return false, err
+			}
+			// collections deleted during purging are left for the next round
+			if bytes.HasPrefix(cur, v) {
+				cur = cur[len(v):]
+			}
+			if len(cur) > 0 {
+				return false, tidis.db.SetWithTxn(delKey, cur, txn)
+			}
+
+			metaKey := tidis.RawKeyPrefix(item.dbId, item.ukey)
+			metaValue, err := tidis.db.GetWithTxn(metaKey, txn)
+			if err != nil {
+				return false, err
+			}
+			// meta may be overwritten by a string during purging, tomb flag
+			// follows type and expire time in all object types
+			if len(metaValue) > 9 && metaValue[9] == FDELETED {
+				_, err = tidis.db.DeleteWithTxn([][]byte{metaKey}, txn)
+				if err != nil {
+					return false, err
+				}
+			}
+			_, err = tidis.db.DeleteWithTxn([][]byte{delKey}, txn)
+			return true, err
+		}
+
+		done, err := tidis.db.BatchInTxn(f)
+		if err != nil {
+			return err
+		}
+		if done.(bool) {
+			return nil
+		}
+	}
+}
+
+// reload pending deletions persisted in storage
+func (tidis *Tidis) asyncDelReload() error {
+	startKey := RawSysAsyncDelPrefix(tidis.TenantId())
+	endKey := kv.Key(startKey).PrefixNext()
+	sysPrefixLen := len(startKey) - len(RawTenantPrefix(tidis.TenantId()))
+
+	for {
+		kvs, err := tidis.db.GetRangeKeysVals(startKey, endKey, asyncDelBatch, nil)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(kvs)-1; i += 2 {
+			dbId, ukey, err := RawKeyDecoder(tidis.TenantId(), kvs[i][sysPrefixLen:])
+			if err != nil || len(kvs[i+1]) == 0 {
+				continue
+			}
+			tidis.AsyncDelAdd(dbId, kvs[i+1][0], ukey)
+		}
+		if uint64(len(kvs)) < asyncDelBatch*2 {
+			return nil
+		}
+		startKey = kv.Key(kvs[len(kvs)-2]).Next()
+	}
+}
+
+func (tidis *Tidis) asyncDelWorker(ctx context.Context) {
 	for {
 		select {
 		case item := <-tidis.asyncDelCh:
@@ -53,13 +313,53 @@ func (tidis *Tidis) RunAsync(ctx context.Context) {
 			log.Debugf("Async recv key deletion %s", key)
 
 			switch item.keyType {
-			case TLISTMETA:
-			case THASHMETA:
-			case TSETMETA:
-			case TZSETMETA:
+			case TLISTMETA, THASHMETA, TSETMETA, TZSETMETA:
+				err := tidis.asyncPurge(item)
+				if err != nil {
+					// left in storage, retry after reload
+					log.Errorf("Async delete key %s failed, error: %s", key, err.Error())
+				}
 			default:
+			}
+			tidis.AsyncDelDone(item.dbId, item.keyType, item.ukey)
+		case <-ctx.Done():
+			return
 		}
+	}
+}
+
+func (tidis *Tidis) RunAsync(ctx context.Context) {
+	log.Infof("Async tasks started for async deletion")
+
+	err := tidis.asyncDelReload()
+	if err != nil {
+		log.Errorf("Async load pending deletion failed, error: %s", err.Error())
+	}
+
+	for i := 0; i < asyncDelConcurrency; i++ {
+		tidis.wg.Add(1)
+		go func() {
+			defer tidis.wg.Done()
+			tidis.asyncDelWorker(ctx)
+		}()
+	}
+
+	c := time.Tick(asyncDelReloadInterval * time.Second)
+	for {
+		select {
+		case <-c:
+			// pick up deletions of crashed instances
+			if !tidis.IsLeader() {
+				continue
+			}
+			err = tidis.asyncDelReload()
+			if err != nil {
+				log.Errorf("Async reload pending deletion failed, error: %s", err.Error())
+			}
 		case <-ctx.Done():
+			// deletions in progress are done, pending ones are left in
+			// storage and reloaded by leader
+			tidis.wg.Wait()
 			return
 		}
 	}
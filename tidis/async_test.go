@@ -0,0 +1,130 @@
+//
+// async_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pingcap/tidb/kv"
+	"github.com/yongman/tidis/terror"
+)
+
+func TestAsyncDelete(t *testing.T) {
+	tdb := newTestTidis(t)
+	defer tdb.Close()
+
+	key := []byte("bigset")
+	members := make([][]byte, 0, asyncDelThreshold+1)
+	for i := uint64(0); i <= asyncDelThreshold; i++ {
+		members = append(members, []byte(fmt.Sprintf("m%d", i)))
+	}
+	if n, err := tdb.Sadd(0, key, members...); err != nil || n != asyncDelThreshold+1 {
+		t.Fatalf("sadd got %d %v", n, err)
+	}
+
+	if n, err := tdb.Delete(0, nil, [][]byte{key}); err != nil || n != 1 {
+		t.Fatalf("delete got %d %v", n, err)
+	}
+
+	// tombstoned key is invisible and not writable until purged
+	if n, _ := tdb.Scard(0, nil, key); n != 0 {
+		t.Fatalf("scard of deleting key got %d", n)
+	}
+	if _, err := tdb.Sadd(0, key, []byte("m")); err != terror.ErrKeyBusy {
+		t.Fatalf("sadd to deleting key expect busy, got %v", err)
+	}
+
+	// pending deletion survives restart
+	item := <-tdb.asyncDelCh
+	tdb.AsyncDelDone(item.dbId, item.keyType, item.ukey)
+	if err := tdb.asyncDelReload(); err != nil {
+		t.Fatal(err)
+	}
+	if tdb.AsyncDelPending() != 1 {
+		t.Fatalf("reload expect 1 pending, got %d", tdb.AsyncDelPending())
+	}
+	item = <-tdb.asyncDelCh
+	if err := tdb.asyncPurge(item); err != nil {
+		t.Fatal(err)
+	}
+
+	startKey := tdb.RawSetDataKey(0, key, nil)
+	keys, _ := tdb.db.GetRangeKeys(startKey, kv.Key(startKey).PrefixNext(), 0, 10, nil)
+	if len(keys) != 0 {
+		t.Fatalf("data keys left after purge: %d", len(keys))
+	}
+	if v, _ := tdb.db.Get(tdb.RawKeyPrefix(0, key)); v != nil {
+		t.Fatalf("tombstone meta left after purge")
+	}
+	if v, _ := tdb.db.Get(tdb.RawAsyncDelKey(0, key)); v != nil {
+		t.Fatalf("deletion record left after purge")
+	}
+
+	if n, err := tdb.Sadd(0, key, []byte("m")); err != nil || n != 1 {
+		t.Fatalf("sadd after purge got %d %v", n, err)
+	}
+}
+
+func TestAsyncDeleteInTxn(t *testing.T) {
+	tdb := newTestTidis(t)
+	defer tdb.Close()
+
+	members := make([][]byte, 0, asyncDelThreshold+1)
+	for i := uint64(0); i <= asyncDelThreshold; i++ {
+		members = append(members, []byte(fmt.Sprintf("m%d", i)))
+	}
+	for _, key := range []string{"s1", "s2"} {
+		if _, err := tdb.Sadd(0, []byte(key), members...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// deletion is queued after outer txn committed
+	txn, _ := tdb.NewTxn()
+	if n, err := tdb.Delete(0, txn, [][]byte{[]byte("s1")}); err != nil || n != 1 {
+		t.Fatalf("delete in txn got %d %v", n, err)
+	}
+	if tdb.AsyncDelPending() != 0 {
+		t.Fatalf("deletion queued before commit")
+	}
+	if err := tdb.CommitTxn(txn); err != nil {
+		t.Fatal(err)
+	}
+	if tdb.AsyncDelPending() != 1 {
+		t.Fatalf("expect 1 pending after commit, got %d", tdb.AsyncDelPending())
+	}
+	item := <-tdb.asyncDelCh
+	if err := tdb.asyncPurge(item); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := tdb.db.Get(tdb.RawAsyncDelKey(0, []byte("s1"))); v != nil {
+		t.Fatalf("deletion record left after purge")
+	}
+
+	// and dropped if it is rolled back
+	txn, _ = tdb.NewTxn()
+	if _, err := tdb.Delete(0, txn, [][]byte{[]byte("s2")}); err != nil {
+		t.Fatal(err)
+	}
+	tdb.RollbackTxn(txn)
+	if tdb.AsyncDelPending() != 0 || len(tdb.asyncDelTxns) != 0 {
+		t.Fatalf("rolled back deletion is queued")
+	}
+	if n, _ := tdb.Scard(0, nil, []byte("s2")); n != asyncDelThreshold+1 {
+		t.Fatalf("scard after rollback got %d", n)
+	}
+
+	// txns of any caller release recorded deletions
+	tdb.db.BatchInTxn(func(txn interface{}) (interface{}, error) {
+		return tdb.Delete(0, txn, [][]byte{[]byte("s2")})
+	})
+	if tdb.AsyncDelPending() != 1 || len(tdb.asyncDelTxns) != 0 {
+		t.Fatalf("deletion in store txn pending %d, recorded txns %d", tdb.AsyncDelPending(), len(tdb.asyncDelTxns))
+	}
+}
@@ -0,0 +1,194 @@
+//
+// blocking.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/yongman/go/log"
+)
+
+// KeyWaiter is a client blocked on keys. waiters of a key are queued in FIFO
+// order, only the head waiter is woken up when the key may be ready, it wakes
+// up the next one after it is done, so elements are served in waiting order.
+type KeyWaiter struct {
+	tidis *Tidis
+	dbId  uint8
+	keys  [][]byte
+	ready chan struct{}
+}
+
+// keyWaiters keeps blocked clients of this instance. writes on this instance
+// signal the waiters directly, writes on other instances are found by polling
+// meta keys of the waited keys from storage.
+type keyWaiters struct {
+	sync.Mutex
+	queues map[string][]*KeyWaiter
+	// meta values seen by the last poll
+	metas map[string][]byte
+}
+
+func newKeyWaiters() *keyWaiters {
+	return &keyWaiters{
+		queues: make(map[string][]*KeyWaiter),
+		metas:  make(map[string][]byte),
+	}
+}
+
+func waiterKey(dbId uint8, key []byte) string {
+	return string([]byte{dbId}) + string(key)
+}
+
+// WaitKeys queues a waiter on keys, Done must be called when the waiter is
+// served or timed out
+func (tidis *Tidis) WaitKeys(dbId uint8, keys [][]byte) *KeyWaiter {
+	kw := tidis.keyWaiters
+	w := &KeyWaiter{
+		tidis: tidis,
+		dbId:  dbId,
+		keys:  keys,
+		ready: make(chan struct{}, 1),
+	}
+
+	kw.Lock()
+	defer kw.Unlock()
+	for _, key := range keys {
+		wk := waiterKey(dbId, key)
+		kw.queues[wk] = append(kw.queues[wk], w)
+	}
+	return w
+}
+
+// Ready is signaled when any of the keys may be ready
+func (w *KeyWaiter) Ready() <-chan struct{} {
+	return w.ready
+}
+
+// HeadKeys returns keys in order on which no other waiter is ahead of w, w
+// must not pop other keys, their elements are served to the waiters ahead
+func (w *KeyWaiter) HeadKeys() [][]byte {
+	kw := w.tidis.keyWaiters
+
+	kw.Lock()
+	defer kw.Unlock()
+	var keys [][]byte
+	for _, key := range w.keys {
+		if q := kw.queues[waiterKey(w.dbId, key)]; len(q) > 0 && q[0] == w {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Done removes w from the queues and wakes up the next waiters, elements left
+// in the keys are served to them
+func (w *KeyWaiter) Done() {
+	kw := w.tidis.keyWaiters
+
+	kw.Lock()
+	defer kw.Unlock()
+	for _, key := range w.keys {
+		wk := waiterKey(w.dbId, key)
+		q := kw.queues[wk]
+		for i := range q {
+			if q[i] == w {
+				q = append(q[:i], q[i+1:]...)
+				break
+			}
+		}
+		if len(q) == 0 {
+			delete(kw.queues, wk)
+			delete(kw.metas, wk)
+			continue
+		}
+		kw.queues[wk] = q
+		q[0].signal()
+	}
+}
+
+func (w *KeyWaiter) signal() {
+	select {
+	case w.ready <- struct{}{}:
+	default:
+		// already signaled
+	}
+}
+
+// SignalKeyReady wakes up the head waiter of key, it is called after writes
+// that may make key ready are committed
+func (tidis *Tidis) SignalKeyReady(dbId uint8, key []byte) {
+	kw := tidis.keyWaiters
+
+	kw.Lock()
+	defer kw.Unlock()
+	if q := kw.queues[waiterKey(dbId, key)]; len(q) > 0 {
+		q[0].signal()
+	}
+}
+
+// RunBlockPoller polls meta keys of waited keys in one batch each interval,
+// head waiters of the changed keys are woken up. meta key of a list or zset
+// is rewritten by each push on any instance, so no extra key is written.
+func (tidis *Tidis) RunBlockPoller(ctx context.Context, interval int) {
+	ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := tidis.pollWaitedKeys(); err != nil {
+				log.Errorf("poll blocked keys failed, error: %s", err.Error())
+			}
+		}
+	}
+}
+
+func (tidis *Tidis) pollWaitedKeys() error {
+	kw := tidis.keyWaiters
+
+	kw.Lock()
+	waited := make(map[string][]byte, len(kw.queues))
+	metaKeys := make([][]byte, 0, len(kw.queues))
+	for wk := range kw.queues {
+		metaKey := tidis.RawKeyPrefix(wk[0], []byte(wk[1:]))
+		waited[wk] = metaKey
+		metaKeys = append(metaKeys, metaKey)
+	}
+	kw.Unlock()
+
+	if len(metaKeys) == 0 {
+		return nil
+	}
+	metas, err := tidis.db.MGet(metaKeys)
+	if err != nil {
+		return err
+	}
+
+	kw.Lock()
+	defer kw.Unlock()
+	for wk, metaKey := range waited {
+		q := kw.queues[wk]
+		if len(q) == 0 {
+			continue
+		}
+		meta := metas[string(metaKey)]
+		last, seen := kw.metas[wk]
+		kw.metas[wk] = meta
+		// first poll of key wakes up the waiter if key exists, the write may
+		// happen before the waiter is queued
+		if (!seen && meta != nil) || (seen && !bytes.Equal(last, meta)) {
+			q[0].signal()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+//
+// blocking_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestKeyWaiters(t *testing.T) {
+	tdb := newTestTidis(t)
+	defer tdb.Close()
+
+	isReady := func(w *KeyWaiter) bool {
+		select {
+		case <-w.Ready():
+			return true
+		default:
+			return false
+		}
+	}
+
+	key := []byte("list")
+	w1 := tdb.WaitKeys(0, [][]byte{key})
+	w2 := tdb.WaitKeys(0, [][]byte{[]byte("other"), key})
+	if len(w1.HeadKeys()) != 1 || fmt.Sprintf("%s", w2.HeadKeys()) != "[other]" {
+		t.Fatalf("waiters should be queued in order")
+	}
+
+	tdb.SignalKeyReady(0, key)
+	if !isReady(w1) || isReady(w2) {
+		t.Fatalf("only head waiter should be signaled")
+	}
+	w1.Done()
+	if !isReady(w2) || len(w2.HeadKeys()) != 2 {
+		t.Fatalf("next waiter should be signaled after done")
+	}
+
+	// write from another instance is found by polling
+	tdb.pollWaitedKeys()
+	if isReady(w2) {
+		t.Fatalf("missing key should not signal")
+	}
+	tdb.db.Set(tdb.RawKeyPrefix(0, key), []byte("meta"))
+	tdb.pollWaitedKeys()
+	if !isReady(w2) {
+		t.Fatalf("changed meta should signal")
+	}
+	tdb.pollWaitedKeys()
+	if isReady(w2) {
+		t.Fatalf("unchanged meta should not signal")
+	}
+	w2.Done()
+	if len(tdb.keyWaiters.queues) != 0 || len(tdb.keyWaiters.metas) != 0 {
+		t.Fatalf("waiters not cleaned up")
+	}
+}
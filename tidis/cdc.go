@@ -0,0 +1,573 @@
+//
+// cdc.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pingcap/tidb/kv"
+	"github.com/yongman/go/log"
+	"github.com/yongman/go/util"
+	"github.com/yongman/tidis/store"
+	"github.com/yongman/tidis/terror"
+)
+
+// change operations
+const (
+	ChangeSet = "set"
+	ChangeDel = "del"
+)
+
+// max members of collection in value of event, the rest are left out
+const changeValueLimit = 1000
+
+// ChangeEvent is a redis level change of key made by a txn, value is read in
+// snapshot of its commit ts.
+type ChangeEvent struct {
+	Tenant string `json:"tenant"`
+	DB     uint8  `json:"db"`
+	Key    string `json:"key"`
+	Type   string `json:"type"`
+	Op     string `json:"op"`
+	// string for string, field to value for hash, items for list, members
+	// for set and member to score for zset, empty for del
+	Value interface{} `json:"value,omitempty"`
+	// value of collection holds its first changeValueLimit members only
+	Truncated bool   `json:"truncated,omitempty"`
+	ExpireAt  uint64 `json:"expire_at,omitempty"`
+	CommitTs  uint64 `json:"commit_ts"`
+}
+
+// ChangeSink receives change events of the feed
+type ChangeSink interface {
+	// Write persists events, checkpoint is saved after it returns, so events
+	// may be written again after restart
+	Write(events []*ChangeEvent) error
+	Close() error
+}
+
+type jsonLinesSink struct {
+	w      *bufio.Writer
+	closer io.Closer
+}
+
+// NewJSONLinesSink writes one json encoded event per line to w
+func NewJSONLinesSink(w io.Writer) ChangeSink {
+	return &jsonLinesSink{w: bufio.NewWriter(w)}
+}
+
+// OpenJSONLinesSink writes events to stdout if path is "stdout", or appends
+// them to file of path
+func OpenJSONLinesSink(path string) (ChangeSink, error) {
+	if path == "" || path == "stdout" {
+		return NewJSONLinesSink(os.Stdout), nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonLinesSink{w: bufio.NewWriter(f), closer: f}, nil
+}
+
+func (s *jsonLinesSink) Write(events []*ChangeEvent) error {
+	enc := json.NewEncoder(s.w)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if f, ok := s.closer.(*os.File); ok {
+		return f.Sync()
+	}
+	return nil
+}
+
+func (s *jsonLinesSink) Close() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+// ChangeFeed tails committed changes of the tenant to sink, the last version
+// written to sink is saved as checkpoint under name
+type ChangeFeed struct {
+	tidis *Tidis
+	name  string
+	sink  ChangeSink
+}
+
+func (tidis *Tidis) NewChangeFeed(name string, sink ChangeSink) *ChangeFeed {
+	return &ChangeFeed{
+		tidis: tidis,
+		name:  name,
+		sink:  sink,
+	}
+}
+
+// Checkpoint returns the version all changes before it are written to sink,
+// 0 is returned if no checkpoint is saved
+func (cf *ChangeFeed) Checkpoint() (uint64, error) {
+	val, err := cf.tidis.db.Get(RawSysChangeFeedKey(cf.tidis.TenantId(), cf.name))
+	if err != nil || val == nil {
+		return 0, err
+	}
+	return util.BytesToUint64(val)
+}
+
+// Run writes changes to sink every interval milliseconds until ctx is done,
+// changes are read on leader only. it resumes from checkpoint, or starts from
+// startTs if no checkpoint is saved, or from now if startTs is 0. versions
+// older than gc safe point can not be read, so the feed must not fall behind
+// gc life time.
+func (cf *ChangeFeed) Run(ctx context.Context, startTs uint64, interval int) {
+	log.Infof("start change feed %s with interval %d milliseconds", cf.name, interval)
+	defer cf.sink.Close()
+
+	ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+	defer ticker.Stop()
+
+	var from uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if !cf.tidis.IsLeader() {
+			// checkpoint is moved by other leader, load it again
+			from = 0
+			continue
+		}
+
+		var err error
+		if from == 0 {
+			from, err = cf.startVersion(startTs)
+			if err != nil {
+				log.Errorf("change feed %s load checkpoint failed, error: %s", cf.name, err.Error())
+				continue
+			}
+			log.Infof("change feed %s starts from version %d", cf.name, from)
+		}
+
+		to, err := cf.tidis.db.GetCurrentVersion()
+		if err != nil {
+			log.Errorf("change feed %s get current version failed, error: %s", cf.name, err.Error())
+			continue
+		}
+		if _, err = cf.Poll(from, to); err != nil {
+			log.Errorf("change feed %s poll changes failed, error: %s", cf.name, err.Error())
+			continue
+		}
+		from = to
+	}
+}
+
+func (cf *ChangeFeed) startVersion(startTs uint64) (uint64, error) {
+	ts, err := cf.Checkpoint()
+	if err != nil || ts > 0 {
+		return ts, err
+	}
+	if startTs > 0 {
+		return startTs, nil
+	}
+	return cf.tidis.db.GetCurrentVersion()
+}
+
+// Poll writes changes committed after version from until version to to sink
+// and saves to as checkpoint, change logs read are deleted with checkpoint.
+// it returns the number of events written
+func (cf *ChangeFeed) Poll(from, to uint64) (int, error) {
+	events, logKeys, err := cf.tidis.changes(from, to)
+	if err != nil {
+		return 0, err
+	}
+	if len(events) > 0 {
+		if err = cf.sink.Write(events); err != nil {
+			return 0, err
+		}
+	}
+
+	val, _ := util.Uint64ToBytes(to)
+	_, err = cf.tidis.db.BatchInTxn(func(txn interface{}) (interface{}, error) {
+		if err := cf.tidis.db.SetWithTxn(RawSysChangeFeedKey(cf.tidis.TenantId(), cf.name), val, txn); err != nil {
+			return nil, err
+		}
+		if len(logKeys) > 0 {
+			return cf.tidis.db.DeleteWithTxn(logKeys, txn)
+		}
+		return nil, nil
+	})
+	return len(events), err
+}
+
+type changedKey struct {
+	dbId uint8
+	key  []byte
+}
+
+// changeLog is keys written by a txn, it is saved in the txn under start ts
+type changeLog struct {
+	rawKey   []byte
+	startTs  uint64
+	commitTs uint64
+	keys     []changedKey
+}
+
+// recordChanges is commit hook saving keys written by txn to change log, the
+// feed runs on leader, so all instances must record changes
+func (tidis *Tidis) recordChanges(txn1 interface{}) error {
+	txn, ok := txn1.(kv.Transaction)
+	if !ok {
+		return terror.ErrBackendType
+	}
+	start := RawTenantPrefix(tidis.TenantId())
+	it, err := txn.GetMemBuffer().Iter(start, kv.Key(start).PrefixNext())
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	var (
+		value  []byte
+		last   []byte
+		lastDb uint8
+	)
+	for it.Valid() {
+		// ttl keys change with meta keys, raw keys of a user key are
+		// adjacent as they share the meta key as prefix
+		dbId, key, err := RawKeyDecoder(tidis.TenantId(), it.Key())
+		if err == nil && (last == nil || dbId != lastDb || !bytes.Equal(key, last)) {
+			b := make([]byte, 5)
+			b[0] = dbId
+			util.Uint32ToBytes1(b[1:], uint32(len(key)))
+			value = append(append(value, b...), key...)
+			last, lastDb = value[len(value)-len(key):], dbId
+		}
+		if err = it.Next(); err != nil {
+			return err
+		}
+	}
+	if value == nil {
+		return nil
+	}
+	return txn.Set(RawSysChangeLogKey(tidis.TenantId(), txn.StartTS()), value)
+}
+
+// dbid(1)|keylen(4)|key of each key
+func decodeChangeLog(value []byte) []changedKey {
+	var keys []changedKey
+	for len(value) >= 5 {
+		n, _ := util.BytesToUint32(value[1:])
+		if len(value) < 5+int(n) {
+			break
+		}
+		keys = append(keys, changedKey{dbId: value[0], key: value[5 : 5+n]})
+		value = value[5+n:]
+	}
+	return keys
+}
+
+// Changes returns events of txns committed after version from until version
+// to in commit order, changes of a txn are ordered by db and raw key. keys
+// removed by flushdb or flushall are not reported.
+func (tidis *Tidis) Changes(from, to uint64) ([]*ChangeEvent, error) {
+	events, _, err := tidis.changes(from, to)
+	return events, err
+}
+
+// changes also returns raw keys of change logs committed until version to
+func (tidis *Tidis) changes(from, to uint64) ([]*ChangeEvent, [][]byte, error) {
+	logs, err := tidis.changeLogs(to)
+	if err != nil || len(logs) == 0 {
+		return nil, nil, err
+	}
+
+	logKeys := make([][]byte, len(logs))
+	for i, l := range logs {
+		logKeys[i] = l.rawKey
+	}
+	// logs left by feed stopped before saving checkpoint or committed before
+	// start version
+	olds, err := tidis.db.MGetWithVersion(logKeys, from)
+	if err != nil {
+		return nil, nil, err
+	}
+	var pending []*changeLog
+	for _, l := range logs {
+		if _, ok := olds[string(l.rawKey)]; !ok {
+			pending = append(pending, l)
+		}
+	}
+	if err = tidis.resolveCommitTs(pending, from, to); err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].commitTs < pending[j].commitTs
+	})
+
+	var events []*ChangeEvent
+	for _, l := range pending {
+		oldSS, err := tidis.db.GetSnapshotWithVersion(l.commitTs - 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		newSS, err := tidis.db.GetSnapshotWithVersion(l.commitTs)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, ck := range l.keys {
+			ev, err := tidis.changeEvent(ck.dbId, ck.key, oldSS, newSS)
+			if err != nil {
+				return nil, nil, err
+			}
+			if ev != nil {
+				ev.CommitTs = l.commitTs
+				events = append(events, ev)
+			}
+		}
+	}
+	return events, logKeys, nil
+}
+
+// changeLogs reads change logs committed until version to, txns committed
+// before to started before it
+func (tidis *Tidis) changeLogs(to uint64) ([]*changeLog, error) {
+	ss, err := tidis.db.GetSnapshotWithVersion(to)
+	if err != nil {
+		return nil, err
+	}
+	prefix := RawSysChangeLogPrefix(tidis.TenantId())
+	scanner := newRawScanner(tidis.db, ss, prefix, RawSysChangeLogKey(tidis.TenantId(), to))
+
+	var logs []*changeLog
+	for {
+		k, v, err := scanner.peek()
+		if err != nil {
+			return nil, err
+		}
+		if k == nil {
+			return logs, nil
+		}
+		startTs, _ := util.BytesToUint64(k[len(prefix):])
+		logs = append(logs, &changeLog{rawKey: k, startTs: startTs, keys: decodeChangeLog(v)})
+		scanner.next()
+	}
+}
+
+// resolveCommitTs finds commit ts of change logs committed after version lo
+// until version hi. logs are visible in snapshots of their commit ts and
+// later, so the range is halved by reading logs in the middle version
+func (tidis *Tidis) resolveCommitTs(logs []*changeLog, lo, hi uint64) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	if hi-lo <= 1 {
+		for _, l := range logs {
+			l.commitTs = hi
+		}
+		return nil
+	}
+
+	mid := lo + (hi-lo)/2
+	var keys [][]byte
+	for _, l := range logs {
+		// txn commits after it starts
+		if l.startTs < mid {
+			keys = append(keys, l.rawKey)
+		}
+	}
+	var (
+		vals map[string][]byte
+		err  error
+	)
+	if len(keys) > 0 {
+		if vals, err = tidis.db.MGetWithVersion(keys, mid); err != nil {
+			return err
+		}
+	}
+
+	var before, after []*changeLog
+	for _, l := range logs {
+		if _, ok := vals[string(l.rawKey)]; ok {
+			before = append(before, l)
+		} else {
+			after = append(after, l)
+		}
+	}
+	if err = tidis.resolveCommitTs(before, lo, mid); err != nil {
+		return err
+	}
+	return tidis.resolveCommitTs(after, mid, hi)
+}
+
+// changeEvent decodes key in new snapshot, nil is returned if key does not
+// exist in both snapshots, eg. data keys of deleted collection are purged
+func (tidis *Tidis) changeEvent(dbId uint8, key []byte, oldSS, newSS interface{}) (*ChangeEvent, error) {
+	oldType, oldObj, err := tidis.snapshotObject(dbId, key, oldSS)
+	if err != nil {
+		return nil, err
+	}
+	newType, newObj, err := tidis.snapshotObject(dbId, key, newSS)
+	if err != nil {
+		return nil, err
+	}
+	if oldObj == nil && newObj == nil {
+		return nil, nil
+	}
+
+	ev := &ChangeEvent{
+		Tenant: tidis.TenantId(),
+		DB:     dbId,
+		Key:    string(key),
+	}
+	if newObj == nil {
+		ev.Type, ev.Op = TypeName(oldType), ChangeDel
+		return ev, nil
+	}
+
+	ev.Type, ev.Op, ev.ExpireAt = TypeName(newType), ChangeSet, newObj.GetExpireAt()
+	ev.Value, ev.Truncated, err = tidis.snapshotValue(dbId, key, newObj, newSS)
+	if err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+func (tidis *Tidis) snapshotObject(dbId uint8, key []byte, ss interface{}) (byte, IObject, error) {
+	metaValue, err := tidis.db.GetWithSnapshot(tidis.RawKeyPrefix(dbId, key), ss)
+	if err != nil {
+		return 0, nil, err
+	}
+	objType, obj := UnmarshalObj(metaValue)
+	if obj == nil || obj.IsDeleted() {
+		return 0, nil, nil
+	}
+	return objType, obj, nil
+}
+
+// snapshotValue reads value of key in snapshot, collection is truncated to its
+// first changeValueLimit members
+func (tidis *Tidis) snapshotValue(dbId uint8, key []byte, obj IObject, ss interface{}) (interface{}, bool, error) {
+	if v, ok := obj.(*StringObj); ok {
+		return string(v.Value), false, nil
+	}
+
+	dataPrefix := append(tidis.RawKeyPrefix(dbId, key), DataTypeKey)
+	if o, ok := obj.(*ZSetObj); ok {
+		dataPrefix = tidis.rawZSetDataPrefix(dbId, key, o.Version)
+	}
+	scanner := newRawScanner(tidis.db, ss, dataPrefix, kv.Key(dataPrefix).PrefixNext())
+
+	var (
+		items     []string
+		members   map[string]string
+		truncated bool
+	)
+	for n := 0; ; n++ {
+		k, v, err := scanner.peek()
+		if err != nil {
+			return nil, false, err
+		}
+		if k == nil {
+			break
+		}
+		if n == changeValueLimit {
+			truncated = true
+			break
+		}
+		sub := string(k[len(dataPrefix):])
+		switch o := obj.(type) {
+		case *HashObj:
+			if members == nil {
+				members = make(map[string]string)
+			}
+			members[sub] = string(v)
+		case *ListObj:
+			items = append(items, string(v))
+		case *SetObj:
+			items = append(items, sub)
+		case *ZSetObj:
+			if members == nil {
+				members = make(map[string]string)
+			}
+			members[sub] = string(FormatScore(o.UnmarshalScore(v)))
+		}
+		scanner.next()
+	}
+
+	if members != nil {
+		return members, truncated, nil
+	}
+	return items, truncated, nil
+}
+
+// rawScanner iterates key values in range of snapshot by batches
+type rawScanner struct {
+	db    store.DB
+	ss    interface{}
+	start []byte
+	end   []byte
+	kvs   [][]byte
+	pos   int
+	done  bool
+}
+
+func newRawScanner(db store.DB, ss interface{}, start, end []byte) *rawScanner {
+	return &rawScanner{
+		db:    db,
+		ss:    ss,
+		start: start,
+		end:   end,
+	}
+}
+
+// peek returns current key and value, key is nil if no more keys
+func (s *rawScanner) peek() ([]byte, []byte, error) {
+	if s.pos >= len(s.kvs) {
+		if s.done {
+			return nil, nil, nil
+		}
+		kvs, err := s.db.GetRangeKeysVals(s.start, s.end, keysIterBatch, s.ss)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.kvs, s.pos = kvs, 0
+		if len(kvs) < keysIterBatch*2 {
+			s.done = true
+		} else {
+			s.start = kv.Key(kvs[len(kvs)-2]).Next()
+		}
+		if len(kvs) == 0 {
+			return nil, nil, nil
+		}
+	}
+	// end of range is inclusive in store
+	if bytes.Compare(s.kvs[s.pos], s.end) >= 0 {
+		return nil, nil, nil
+	}
+	return s.kvs[s.pos], s.kvs[s.pos+1], nil
+}
+
+func (s *rawScanner) next() {
+	s.pos += 2
+}
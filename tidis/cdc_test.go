@@ -0,0 +1,181 @@
+//
+// cdc_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pingcap/tidb/kv"
+	"github.com/yongman/tidis/config"
+)
+
+func newCDCTestTidis(t *testing.T) *Tidis {
+	conf := config.NewConfig(nil, "", "", 0, "")
+	conf.Backend.Type = "memory"
+	conf.Tidis.TxnRetry = 10
+	conf.Tidis.CDCEnabled = true
+
+	tdb, err := NewTidis(conf)
+	if err != nil {
+		t.Fatalf("open tidis failed: %v", err)
+	}
+	return tdb
+}
+
+func TestChangeFeed(t *testing.T) {
+	tdb := newCDCTestTidis(t)
+	defer tdb.Close()
+
+	tdb.Set(0, nil, []byte("gone"), []byte("v"))
+	tdb.Hset(0, []byte("hash"), []byte("f1"), []byte("v1"))
+	from, _ := tdb.GetCurrentVersion()
+
+	tdb.Set(0, nil, []byte("str"), []byte("a"))
+	tdb.Set(0, nil, []byte("str"), []byte("b"))
+	tdb.Hset(0, []byte("hash"), []byte("f1"), []byte("v2"))
+	tdb.Rpush(0, nil, []byte("list"), []byte("x"), []byte("y"))
+	tdb.Sadd(1, []byte("set"), []byte("m"))
+	tdb.Zadd(0, []byte("zset"), &MemberPair{Score: 1.5, Member: []byte("m")})
+	tdb.Delete(0, nil, [][]byte{[]byte("gone")})
+	to, _ := tdb.GetCurrentVersion()
+
+	var buf bytes.Buffer
+	feed := tdb.NewChangeFeed("test", NewJSONLinesSink(&buf))
+	n, err := feed.Poll(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 7 {
+		t.Fatalf("poll got %d events: %s", n, buf.String())
+	}
+	if ts, _ := feed.Checkpoint(); ts != to {
+		t.Fatalf("checkpoint %d, expect %d", ts, to)
+	}
+
+	var events []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var ev map[string]interface{}
+		// commit ts does not fit in float64
+		dec := json.NewDecoder(strings.NewReader(line))
+		dec.UseNumber()
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+	}
+
+	// ordered by commit, every write is reported
+	expect := []struct {
+		key, typ, op string
+		value        interface{}
+	}{
+		{"str", "string", "set", "a"},
+		{"str", "string", "set", "b"},
+		{"hash", "hash", "set", map[string]interface{}{"f1": "v2"}},
+		{"list", "list", "set", []interface{}{"x", "y"}},
+		{"set", "set", "set", []interface{}{"m"}},
+		{"zset", "zset", "set", map[string]interface{}{"m": "1.5"}},
+		{"gone", "string", "del", nil},
+	}
+	var prev uint64
+	for i, e := range expect {
+		ev := events[i]
+		if ev["key"] != e.key || ev["type"] != e.typ || ev["op"] != e.op || !reflect.DeepEqual(ev["value"], e.value) {
+			t.Fatalf("event %d got %v, expect %v", i, ev, e)
+		}
+		// commit ts is the first version the write is visible in
+		commitTs, _ := strconv.ParseUint(string(ev["commit_ts"].(json.Number)), 10, 64)
+		if commitTs <= prev || commitTs <= from || commitTs > to {
+			t.Fatalf("event %d commit ts %d out of order", i, commitTs)
+		}
+		prev = commitTs
+		if e.typ == "string" {
+			rawKey := tdb.RawKeyPrefix(0, []byte(e.key))
+			newObj, _ := tdb.db.GetWithVersion(rawKey, commitTs)
+			oldObj, _ := tdb.db.GetWithVersion(rawKey, commitTs-1)
+			if bytes.Equal(newObj, oldObj) {
+				t.Fatalf("event %d key not changed at commit ts %d", i, commitTs)
+			}
+		}
+	}
+	if events[4]["db"] != json.Number("1") {
+		t.Fatalf("set event in db %v", events[4]["db"])
+	}
+	// change logs read are deleted with checkpoint
+	logs, _ := tdb.db.GetRangeKeys(RawSysChangeLogPrefix(tdb.TenantId()), kv.Key(RawSysChangeLogPrefix(tdb.TenantId())).PrefixNext(), 0, 100, nil)
+	if len(logs) != 0 {
+		t.Fatalf("%d change logs left", len(logs))
+	}
+
+	// no changes after checkpoint
+	buf.Reset()
+	now, _ := tdb.GetCurrentVersion()
+	if n, err = feed.Poll(to, now); err != nil || n != 0 {
+		t.Fatalf("poll again got %d events, error %v", n, err)
+	}
+
+	// big collection is truncated in event
+	items := make([][]byte, changeValueLimit+1)
+	for i := range items {
+		items[i] = []byte(strconv.Itoa(i))
+	}
+	tdb.Rpush(0, nil, []byte("biglist"), items...)
+	to, _ = tdb.GetCurrentVersion()
+	buf.Reset()
+	if n, err = feed.Poll(now, to); err != nil || n != 1 {
+		t.Fatalf("poll big list got %d events, error %v", n, err)
+	}
+	var ev ChangeEvent
+	if err = json.Unmarshal(buf.Bytes(), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := ev.Value.([]interface{}); !ok || len(value) != changeValueLimit || !ev.Truncated {
+		t.Fatalf("big list event truncated %v with %d items", ev.Truncated, len(value))
+	}
+}
+
+func TestChangeFeedRunOnLeader(t *testing.T) {
+	tdb := newCDCTestTidis(t)
+	defer tdb.Close()
+
+	start, _ := tdb.GetCurrentVersion()
+	tdb.Set(0, nil, []byte("k"), []byte("v"))
+
+	var buf bytes.Buffer
+	feed := tdb.NewChangeFeed("test", NewJSONLinesSink(&buf))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		feed.Run(ctx, start, 10)
+		close(done)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if ts, _ := feed.Checkpoint(); ts != 0 {
+		t.Fatalf("feed runs on follower, checkpoint %d", ts)
+	}
+	tdb.CheckLeader(60)
+	for i := 0; i < 100; i++ {
+		if ts, _ := feed.Checkpoint(); ts > start {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if !strings.Contains(buf.String(), `"key":"k"`) {
+		t.Fatalf("feed on leader got %q", buf.String())
+	}
+}
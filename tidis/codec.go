@@ -8,14 +8,23 @@
 package tidis
 
 import (
+	"math"
+
 	"github.com/yongman/go/util"
 	"github.com/yongman/tidis/terror"
 )
 
 const (
-	// tenant length should be less than 250, 251-255 can be used by system
+	// tenant length should be less than 250, 250-255 can be used by system
+	PubSubKey = 250
 	LeaderKey = 251
 	GCPointKey = 252
+	AsyncDelKey = 253
+	ScanCursorKey = 254
+	ChangeFeedKey = 255
+	// first byte of larger values is never used by tenant length
+	ACLKey = 256
+	ChangeLogKey = 257
 )
 // encoder and decoder for key of data
 
@@ -40,6 +49,26 @@ func RawKeyPrefix(tenantid string, dbid uint8, key []byte) []byte {
 	return buf
 }
 
+// decode dbid and user key from key generated by RawKeyPrefix
+func RawKeyDecoder(tenantId string, rawkey []byte) (uint8, []byte, error) {
+	pos := 2 + len(tenantId)
+
+	if len(rawkey) < pos+2+4 || rawkey[pos+1] != ObjectData {
+		return 0, nil, terror.ErrTypeNotMatch
+	}
+	dbId := rawkey[pos]
+	pos += 2
+
+	keyLen, _ := util.BytesToUint32(rawkey[pos:])
+	pos += 4
+
+	if len(rawkey) < pos+int(keyLen) {
+		return 0, nil, terror.ErrTypeNotMatch
+	}
+
+	return dbId, rawkey[pos : pos+int(keyLen)], nil
+}
+
 func RawTenantPrefix(tenantId string) []byte {
 	buf := make([]byte, 2+len(tenantId))
 
@@ -59,6 +88,35 @@ func RawDBPrefix(tenantId string, dbId uint8) []byte {
 	return buf
 }
 
+// tenantlen(2)|tenant|dbid(1)|typettl(1)|expireat(8)|userkey
+// ttl keys of a db are ordered by expire time, so expired keys can be found by
+// a range scan from the beginning
+func RawTTLKey(tenantId string, dbId uint8, expireAt uint64, key []byte) []byte {
+	buf := RawDBPrefix(tenantId, dbId)
+	buf = append(buf, ObjectTTL)
+
+	tsBytes, _ := util.Uint64ToBytes(expireAt)
+	buf = append(buf, tsBytes...)
+	buf = append(buf, key...)
+
+	return buf
+}
+
+func TTLKeyDecoder(tenantId string, rawkey []byte) (uint64, []byte, error) {
+	pos := 2 + len(tenantId) + 1
+
+	if len(rawkey) < pos+1+8 || rawkey[pos] != ObjectTTL {
+		return 0, nil, terror.ErrTypeNotMatch
+	}
+	pos++
+
+	ts, _ := util.BytesToUint64(rawkey[pos:])
+	pos = pos + 8
+
+	return ts, rawkey[pos:], nil
+}
+
+// int64 score encoding used by zsets created by old versions
 func ZScoreOffset(score int64) uint64 {
 	return uint64(score + ScoreMax)
 }
@@ -67,10 +125,37 @@ func ZScoreRestore(rscore uint64) int64 {
 	return int64(rscore - uint64(ScoreMax))
 }
 
-func ZScoreDecoder(rawkeyPrefixLen int, rawkey []byte) (int64, []byte, error) {
+// order-preserving encoding of float64 score, sign bit of positive number is
+// set and all bits of negative number are flipped
+func ZScoreFloatEncode(score float64) uint64 {
+	if score == 0 {
+		// -0 equals to 0
+		score = 0
+	}
+	b := math.Float64bits(score)
+	if b&(1<<63) != 0 {
+		return ^b
+	}
+	return b | 1<<63
+}
+
+func ZScoreFloatDecode(rscore uint64) float64 {
+	if rscore&(1<<63) != 0 {
+		return math.Float64frombits(rscore &^ (1 << 63))
+	}
+	return math.Float64frombits(^rscore)
+}
+
+// decode encoded score and member from score key
+func ZScoreDecoder(rawkeyPrefixLen int, rawkey []byte) (uint64, []byte, error) {
 	pos := rawkeyPrefixLen
 
-	if rawkey[pos] != ScoreTypeKey {
+	switch rawkey[pos] {
+	case ScoreTypeKey:
+	case VersionScoreTypeKey:
+		// skip version of zset
+		pos += 8
+	default:
 		return 0, nil, terror.ErrTypeNotMatch
 	}
 	pos++
@@ -80,7 +165,7 @@ func ZScoreDecoder(rawkeyPrefixLen int, rawkey []byte) (int64, []byte, error) {
 
 	mem := rawkey[pos:]
 
-	return ZScoreRestore(score), mem, nil
+	return score, mem, nil
 }
 
 func RawSysLeaderKey() []byte {
@@ -91,4 +176,71 @@ func RawSysLeaderKey() []byte {
 func RawSysGCPointKey() []byte {
 	b, _ := util.Uint16ToBytes(GCPointKey)
 	return b
-}
\ No newline at end of file
+}
+
+// sys(2)|tenantlen(2)|tenant|dbid(1)|typedata(1)|userkeylen(4)|userkey
+func RawSysAsyncDelKey(tenantId string, dbId uint8, key []byte) []byte {
+	b, _ := util.Uint16ToBytes(AsyncDelKey)
+	return append(b, RawKeyPrefix(tenantId, dbId, key)...)
+}
+
+func RawSysAsyncDelPrefix(tenantId string) []byte {
+	b, _ := util.Uint16ToBytes(AsyncDelKey)
+	return append(b, RawTenantPrefix(tenantId)...)
+}
+
+// sys(2)|tenantlen(2)|tenant|cursor(8)
+func RawSysScanCursorKey(tenantId string, cursor uint64) []byte {
+	b := RawSysScanCursorPrefix(tenantId)
+	c, _ := util.Uint64ToBytes(cursor)
+	return append(b, c...)
+}
+
+func RawSysScanCursorPrefix(tenantId string) []byte {
+	b, _ := util.Uint16ToBytes(ScanCursorKey)
+	return append(b, RawTenantPrefix(tenantId)...)
+}
+
+// sys(2)|tenantlen(2)|tenant|ts(8)|instance
+// messages are ordered by publish time
+func RawSysPubSubKey(tenantId string, ts uint64, instance []byte) []byte {
+	b := RawSysPubSubPrefix(tenantId)
+	t, _ := util.Uint64ToBytes(ts)
+	b = append(b, t...)
+	return append(b, instance...)
+}
+
+func RawSysPubSubPrefix(tenantId string) []byte {
+	b, _ := util.Uint16ToBytes(PubSubKey)
+	return append(b, RawTenantPrefix(tenantId)...)
+}
+
+// sys(2)|tenantlen(2)|tenant|startts(8)
+// keys written by txn, saved in the txn
+func RawSysChangeLogKey(tenantId string, startTs uint64) []byte {
+	t, _ := util.Uint64ToBytes(startTs)
+	return append(RawSysChangeLogPrefix(tenantId), t...)
+}
+
+func RawSysChangeLogPrefix(tenantId string) []byte {
+	b, _ := util.Uint16ToBytes(ChangeLogKey)
+	return append(b, RawTenantPrefix(tenantId)...)
+}
+
+// sys(2)|tenantlen(2)|tenant|name
+// checkpoint of change feed
+func RawSysChangeFeedKey(tenantId string, name string) []byte {
+	b, _ := util.Uint16ToBytes(ChangeFeedKey)
+	b = append(b, RawTenantPrefix(tenantId)...)
+	return append(b, name...)
+}
+
+// sys(2)|tenantlen(2)|tenant|username
+func RawSysACLUserKey(tenantId string, name string) []byte {
+	return append(RawSysACLPrefix(tenantId), name...)
+}
+
+func RawSysACLPrefix(tenantId string) []byte {
+	b, _ := util.Uint16ToBytes(ACLKey)
+	return append(b, RawTenantPrefix(tenantId)...)
+}
@@ -12,37 +12,69 @@ import (
 	"github.com/pingcap/tidb/store/tikv/oracle"
 	"github.com/yongman/go/log"
 	"github.com/yongman/go/util"
+	"sync/atomic"
 	"time"
 )
 
 // ttl for user key checker and operator
 
-type gcChecker struct {
-	interval    int
-	timeout     int
-	concurrency int
+// fields can be changed at runtime, they are accessed atomically
+type GCChecker struct {
+	interval    int64
+	timeout     int64
+	concurrency int64
+	enabled     int32
 	tdb         *Tidis
 }
 
-func NewGCChecker(interval, timeout, concurrency int, tdb *Tidis) *gcChecker {
-	return &gcChecker{
-		interval:    interval,
-		timeout:     timeout,
-		concurrency: concurrency,
+func NewGCChecker(interval, timeout, concurrency int, tdb *Tidis) *GCChecker {
+	ch := &GCChecker{
+		interval:    int64(interval),
+		timeout:     int64(timeout),
+		concurrency: int64(concurrency),
 		tdb:         tdb,
 	}
+	ch.SetEnabled(tdb.conf.Tidis.DBGCEnabled)
+	return ch
 }
 
-func (ch *gcChecker) Run(ctx context.Context) {
-	log.Infof("start db gc checker with interval %d seconds", ch.interval)
-	c := time.Tick(time.Duration(ch.interval) * time.Second)
+// SetInterval changes interval in seconds, it takes effect after current wait
+func (ch *GCChecker) SetInterval(interval int) {
+	atomic.StoreInt64(&ch.interval, int64(interval))
+}
+
+// SetLifeTime changes life time of versions in seconds
+func (ch *GCChecker) SetLifeTime(timeout int) {
+	atomic.StoreInt64(&ch.timeout, int64(timeout))
+}
+
+func (ch *GCChecker) SetConcurrency(concurrency int) {
+	atomic.StoreInt64(&ch.concurrency, int64(concurrency))
+}
+
+func (ch *GCChecker) SetEnabled(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&ch.enabled, v)
+}
+
+func (ch *GCChecker) Run(ctx context.Context) {
+	log.Infof("start db gc checker with interval %d seconds", atomic.LoadInt64(&ch.interval))
 	for {
+		interval := atomic.LoadInt64(&ch.interval)
+		wait := interval
+		if wait <= 0 {
+			// check again later if interval is changed
+			wait = 1
+		}
 		select {
-		case <-c:
-			if ch.interval == 0 {
+		case <-time.After(time.Duration(wait) * time.Second):
+			if interval <= 0 {
 				continue
 			}
-			if !ch.tdb.conf.Tidis.DBGCEnabled {
+			if atomic.LoadInt32(&ch.enabled) == 0 {
 				continue
 			}
 			if !ch.tdb.IsLeader() {
@@ -55,21 +87,23 @@ func (ch *gcChecker) Run(ctx context.Context) {
 				continue
 			}
 
-			newPoint, err := ch.getNewPoint(time.Duration(ch.timeout) * time.Second)
+			timeout := time.Duration(atomic.LoadInt64(&ch.timeout)) * time.Second
+			newPoint, err := ch.getNewPoint(timeout)
 			if err != nil {
 				log.Errorf("get db safe point for gc error: %s", err.Error())
 				continue
 			}
 
 			lastPointTime := time.Unix(int64(lastPoint), 0)
-			if newPoint.Sub(lastPointTime) < time.Duration(ch.timeout)*time.Second {
+			if newPoint.Sub(lastPointTime) < timeout {
 				log.Warnf("do not need run gc this time, %d seconds past after last gc", newPoint.Sub(lastPointTime)/time.Second)
 				continue
 			}
 
 			safePoint := oracle.ComposeTS(oracle.GetPhysical(newPoint), 0)
-			log.Debugf("start run db gc with safePoint %d, concurrency: %d", safePoint, 3)
-			err = ch.tdb.RunGC(safePoint, ch.concurrency)
+			concurrency := int(atomic.LoadInt64(&ch.concurrency))
+			log.Debugf("start run db gc with safePoint %d, concurrency: %d", safePoint, concurrency)
+			err = ch.tdb.RunGC(safePoint, concurrency)
 			if err != nil {
 				log.Errorf("run gc failed, error: %s", err.Error())
 			}
@@ -80,7 +114,7 @@ func (ch *gcChecker) Run(ctx context.Context) {
 	}
 }
 
-func (ch *gcChecker) getNewPoint(ttl time.Duration) (time.Time, error) {
+func (ch *GCChecker) getNewPoint(ttl time.Duration) (time.Time, error) {
 	ver, err := ch.tdb.GetCurrentVersion()
 	if err != nil {
 		return time.Time{}, err
@@ -92,7 +126,7 @@ func (ch *gcChecker) getNewPoint(ttl time.Duration) (time.Time, error) {
 	return safePoint, nil
 }
 
-func (ch *gcChecker) saveSafePoint(ts uint64) error {
+func (ch *GCChecker) saveSafePoint(ts uint64) error {
 	gcPointKey := RawSysGCPointKey()
 	val, err := util.Uint64ToBytes(ts)
 	if err != nil {
@@ -102,9 +136,15 @@ func (ch *gcChecker) saveSafePoint(ts uint64) error {
 	return err
 }
 
-func (ch *gcChecker) loadSafePoint() (uint64, error) {
+func (ch *GCChecker) loadSafePoint() (uint64, error) {
+	return ch.tdb.GCSafePoint()
+}
+
+// GCSafePoint returns unix time in seconds of the last gc safe point, 0 if gc
+// never runs
+func (tidis *Tidis) GCSafePoint() (uint64, error) {
 	gcPointKey := RawSysGCPointKey()
-	val, err := ch.tdb.db.Get(gcPointKey)
+	val, err := tidis.db.Get(gcPointKey)
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,125 @@
+//
+// notify.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/yongman/go/log"
+	"github.com/yongman/tidis/terror"
+)
+
+// keyspace event classes, same as flags of notify-keyspace-events in redis
+const (
+	NotifyKeyspace = 1 << iota // K
+	NotifyKeyevent             // E
+	NotifyGeneric              // g
+	NotifyString               // $
+	NotifyList                 // l
+	NotifySet                  // s
+	NotifyHash                 // h
+	NotifyZSet                 // z
+	NotifyExpired              // x
+	NotifyEvicted              // e, keys are never evicted by tidis
+
+	NotifyAll = NotifyGeneric | NotifyString | NotifyList | NotifySet | NotifyHash | NotifyZSet | NotifyExpired | NotifyEvicted // A
+)
+
+var notifyFlagChars = []struct {
+	flag int
+	char byte
+}{
+	{NotifyGeneric, 'g'},
+	{NotifyString, '$'},
+	{NotifyList, 'l'},
+	{NotifySet, 's'},
+	{NotifyHash, 'h'},
+	{NotifyZSet, 'z'},
+	{NotifyExpired, 'x'},
+	{NotifyEvicted, 'e'},
+	{NotifyKeyspace, 'K'},
+	{NotifyKeyevent, 'E'},
+}
+
+// ParseKeyspaceEvents parses flags string of notify-keyspace-events
+func ParseKeyspaceEvents(s string) (int, error) {
+	var flags int
+	for i := 0; i < len(s); i++ {
+		if s[i] == 'A' {
+			flags |= NotifyAll
+			continue
+		}
+		found := false
+		for _, fc := range notifyFlagChars {
+			if fc.char == s[i] {
+				flags |= fc.flag
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, terror.ErrKeyspaceEvents
+		}
+	}
+	return flags, nil
+}
+
+// FormatKeyspaceEvents formats flags to string of notify-keyspace-events
+func FormatKeyspaceEvents(flags int) string {
+	var buf []byte
+	if flags&NotifyAll == NotifyAll {
+		buf = append(buf, 'A')
+	}
+	for _, fc := range notifyFlagChars {
+		if fc.flag&NotifyAll != 0 && flags&NotifyAll == NotifyAll {
+			continue
+		}
+		if flags&fc.flag != 0 {
+			buf = append(buf, fc.char)
+		}
+	}
+	return string(buf)
+}
+
+func (tidis *Tidis) SetKeyspaceEvents(flags int) {
+	atomic.StoreInt32(&tidis.notifyFlags, int32(flags))
+}
+
+func (tidis *Tidis) KeyspaceEvents() int {
+	return int(atomic.LoadInt32(&tidis.notifyFlags))
+}
+
+// NotifyKeyspaceEvent publishes event of key to __keyspace@<db>__:<key> and
+// __keyevent@<db>__:<event> if class is enabled, it is called after the
+// modification is committed
+func (tidis *Tidis) NotifyKeyspaceEvent(class int, event string, dbId uint8, key []byte) {
+	flags := tidis.KeyspaceEvents()
+	if flags&class == 0 {
+		return
+	}
+
+	db := strconv.Itoa(int(dbId))
+	if flags&NotifyKeyspace != 0 {
+		channel := append([]byte("__keyspace@"+db+"__:"), key...)
+		tidis.publishEvent(channel, []byte(event))
+	}
+	if flags&NotifyKeyevent != 0 {
+		channel := []byte("__keyevent@" + db + "__:" + event)
+		tidis.publishEvent(channel, key)
+	}
+}
+
+func (tidis *Tidis) publishEvent(channel, message []byte) {
+	if tidis.pubsubDeliver != nil {
+		tidis.pubsubDeliver(channel, message)
+	}
+	if err := tidis.pubsub.Publish(channel, message); err != nil {
+		log.Errorf("publish keyspace event failed, error: %s", err.Error())
+	}
+}
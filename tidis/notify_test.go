@@ -0,0 +1,62 @@
+//
+// notify_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParseKeyspaceEvents(t *testing.T) {
+	for s, expect := range map[string]string{
+		"":          "",
+		"KEA":       "AKE",
+		"Kx":        "xK",
+		"E$lgz":     "g$lzE",
+		"g$lshzxeE": "AE",
+	} {
+		flags, err := ParseKeyspaceEvents(s)
+		if err != nil {
+			t.Fatalf("parse %s failed: %v", s, err)
+		}
+		if got := FormatKeyspaceEvents(flags); got != expect {
+			t.Fatalf("format %s got %s, expect %s", s, got, expect)
+		}
+	}
+	if _, err := ParseKeyspaceEvents("Kq"); err == nil {
+		t.Fatalf("invalid class should fail")
+	}
+}
+
+func TestExpiredEvent(t *testing.T) {
+	tdb := newTestTidis(t)
+	defer tdb.Close()
+
+	var got []string
+	tdb.SetPubSubDeliver(func(channel, message []byte) {
+		got = append(got, fmt.Sprintf("%s %s", channel, message))
+	})
+	flags, _ := ParseKeyspaceEvents("KEx")
+	tdb.SetKeyspaceEvents(flags)
+
+	tdb.SetWithParam(3, nil, []byte("k"), []byte("v"), 1, false, false)
+	time.Sleep(5 * time.Millisecond)
+	tdb.ExpireKeys(3, 1<<62, 10)
+
+	if fmt.Sprint(got) != "[__keyspace@3__:k expired __keyevent@3__:expired k]" {
+		t.Fatalf("expired events got %v", got)
+	}
+
+	// disabled class is not published
+	got = nil
+	tdb.NotifyKeyspaceEvent(NotifyString, "set", 3, []byte("k"))
+	if len(got) != 0 {
+		t.Fatalf("disabled event published %v", got)
+	}
+}
@@ -0,0 +1,272 @@
+//
+// pubsub.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pingcap/tidb/kv"
+	"github.com/yongman/go/log"
+	"github.com/yongman/go/util"
+	"github.com/yongman/tidis/terror"
+	"github.com/yongman/tidis/utils"
+)
+
+const (
+	// messages older than lifetime are deleted by leader, in milliseconds
+	pubsubMessageLifeTime = 60 * 1000
+	// messages committed later than their publish time by less than lookback
+	// are still delivered, in milliseconds
+	pubsubLookback = 1000
+)
+
+// PubSubTransport carries published messages between tidis instances
+type PubSubTransport interface {
+	// Publish sends message to other instances
+	Publish(channel, message []byte) error
+	// Run calls deliver with messages published by other instances until ctx
+	// is done
+	Run(ctx context.Context, deliver func(channel, message []byte))
+}
+
+// SetPubSubTransport replaces the transport, it must be called before RunPubSub
+func (tidis *Tidis) SetPubSubTransport(t PubSubTransport) {
+	tidis.pubsub = t
+}
+
+// SetPubSubDeliver sets the function delivering messages to subscribers of
+// this instance, it must be called before RunPubSub
+func (tidis *Tidis) SetPubSubDeliver(deliver func(channel, message []byte)) {
+	tidis.pubsubDeliver = deliver
+}
+
+// Publish sends message to subscribers on other instances, subscribers on
+// this instance are served by caller
+func (tidis *Tidis) Publish(channel, message []byte) error {
+	return tidis.pubsub.Publish(channel, message)
+}
+
+// RunPubSub delivers messages published on other instances to subscribers of
+// this instance until ctx is done
+func (tidis *Tidis) RunPubSub(ctx context.Context) {
+	tidis.pubsub.Run(ctx, tidis.pubsubDeliver)
+}
+
+// ClearPubSubMessages deletes messages published before lifetime
+func (tidis *Tidis) ClearPubSubMessages() error {
+	now := utils.Now()
+	if now < pubsubMessageLifeTime {
+		return nil
+	}
+	startKey := RawSysPubSubPrefix(tidis.TenantId())
+	endKey := RawSysPubSubKey(tidis.TenantId(), (now-pubsubMessageLifeTime)<<tsoLogicalBits, nil)
+
+	for {
+		deleted, err := tidis.db.DeleteRange(startKey, endKey, keysIterBatch)
+		if err != nil {
+			return err
+		}
+		if deleted < keysIterBatch {
+			return nil
+		}
+	}
+}
+
+// storePubSub writes messages to storage keyed by publish time, each instance
+// polls messages after the last one it has seen
+type storePubSub struct {
+	tidis    *Tidis
+	instance []byte
+	interval int
+}
+
+func newStorePubSub(tidis *Tidis) *storePubSub {
+	id := tidis.uuid
+	return &storePubSub{
+		tidis:    tidis,
+		instance: id[:],
+		interval: tidis.conf.Tidis.PubSubPollInterval,
+	}
+}
+
+// chanlen(4)|channel|message
+func encodePubSubMessage(channel, message []byte) []byte {
+	buf := make([]byte, 4, 4+len(channel)+len(message))
+	util.Uint32ToBytes1(buf, uint32(len(channel)))
+	buf = append(buf, channel...)
+	return append(buf, message...)
+}
+
+func decodePubSubMessage(raw []byte) ([]byte, []byte, error) {
+	if len(raw) < 4 {
+		return nil, nil, terror.ErrInvalidMeta
+	}
+	chanLen, _ := util.BytesToUint32(raw)
+	if len(raw) < 4+int(chanLen) {
+		return nil, nil, terror.ErrInvalidMeta
+	}
+	return raw[4 : 4+chanLen], raw[4+chanLen:], nil
+}
+
+func (ps *storePubSub) Publish(channel, message []byte) error {
+	// tso is unique across instances and carries the publish time
+	ts, err := ps.tidis.db.GetCurrentVersion()
+	if err != nil {
+		return err
+	}
+	key := RawSysPubSubKey(ps.tidis.TenantId(), ts, ps.instance)
+	return ps.tidis.db.Set(key, encodePubSubMessage(channel, message))
+}
+
+func (ps *storePubSub) Run(ctx context.Context, deliver func(channel, message []byte)) {
+	log.Infof("start pubsub poller with interval %d milliseconds", ps.interval)
+
+	// messages published before start are not delivered
+	since, err := ps.tidis.db.GetCurrentVersion()
+	for err != nil {
+		log.Errorf("pubsub poller get current version failed, error: %s", err.Error())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(ps.interval) * time.Millisecond):
+		}
+		since, err = ps.tidis.db.GetCurrentVersion()
+	}
+
+	ticker := time.NewTicker(time.Duration(ps.interval) * time.Millisecond)
+	defer ticker.Stop()
+
+	cursor, seen := since, make(map[string]uint64)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cursor, err = ps.poll(since, cursor, seen, deliver)
+			if err != nil {
+				log.Errorf("pubsub poller read messages failed, error: %s", err.Error())
+			}
+		}
+	}
+}
+
+// poll delivers messages after cursor minus lookback which are not seen yet,
+// it returns the largest publish time seen
+func (ps *storePubSub) poll(since, cursor uint64, seen map[string]uint64, deliver func(channel, message []byte)) (uint64, error) {
+	prefix := RawSysPubSubPrefix(ps.tidis.TenantId())
+	lookback := uint64(pubsubLookback) << tsoLogicalBits
+
+	from := since
+	if cursor > from+lookback {
+		from = cursor - lookback
+	}
+	for key, ts := range seen {
+		if ts < from {
+			delete(seen, key)
+		}
+	}
+
+	start := RawSysPubSubKey(ps.tidis.TenantId(), from, nil)
+	end := kv.Key(prefix).PrefixNext()
+	for {
+		kvs, err := ps.tidis.db.GetRangeKeysVals(start, end, keysIterBatch, nil)
+		if err != nil {
+			return cursor, err
+		}
+		for i := 0; i < len(kvs); i += 2 {
+			key := kvs[i]
+			if len(key) < len(prefix)+8 {
+				continue
+			}
+			ts, _ := util.BytesToUint64(key[len(prefix):])
+			if _, ok := seen[string(key)]; ok || string(key[len(prefix)+8:]) == string(ps.instance) {
+				continue
+			}
+			seen[string(key)] = ts
+			if ts > cursor {
+				cursor = ts
+			}
+
+			channel, message, err := decodePubSubMessage(kvs[i+1])
+			if err != nil {
+				log.Errorf("pubsub poller decode message failed, error: %s", err.Error())
+				continue
+			}
+			deliver(channel, message)
+		}
+		if len(kvs) < keysIterBatch*2 {
+			return cursor, nil
+		}
+		start = kv.Key(kvs[len(kvs)-2]).Next()
+	}
+}
+
+// LocalPubSub connects tidis instances in the same process, it stands in for
+// the storage transport in tests
+type LocalPubSub struct {
+	sync.Mutex
+	endpoints map[*localPubSubEndpoint]struct{}
+}
+
+func NewLocalPubSub() *LocalPubSub {
+	return &LocalPubSub{
+		endpoints: make(map[*localPubSubEndpoint]struct{}),
+	}
+}
+
+// Transport returns a new endpoint for one instance
+func (l *LocalPubSub) Transport() PubSubTransport {
+	ep := &localPubSubEndpoint{
+		hub: l,
+		ch:  make(chan [2][]byte, 1024),
+	}
+	l.Lock()
+	l.endpoints[ep] = struct{}{}
+	l.Unlock()
+	return ep
+}
+
+type localPubSubEndpoint struct {
+	hub *LocalPubSub
+	ch  chan [2][]byte
+}
+
+func (ep *localPubSubEndpoint) Publish(channel, message []byte) error {
+	ep.hub.Lock()
+	defer ep.hub.Unlock()
+	for other := range ep.hub.endpoints {
+		if other == ep {
+			continue
+		}
+		select {
+		case other.ch <- [2][]byte{channel, message}:
+		default:
+			log.Warnf("local pubsub endpoint is full, message dropped")
+		}
+	}
+	return nil
+}
+
+func (ep *localPubSubEndpoint) Run(ctx context.Context, deliver func(channel, message []byte)) {
+	defer func() {
+		ep.hub.Lock()
+		delete(ep.hub.endpoints, ep)
+		ep.hub.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-ep.ch:
+			deliver(msg[0], msg[1])
+		}
+	}
+}
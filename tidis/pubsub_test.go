@@ -0,0 +1,51 @@
+//
+// pubsub_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestStorePubSub(t *testing.T) {
+	tdb := newTestTidis(t)
+	defer tdb.Close()
+
+	// two instances sharing the storage
+	local := newStorePubSub(tdb)
+	other := newStorePubSub(tdb)
+	id := uuid.New()
+	other.instance = id[:]
+
+	since, _ := tdb.GetCurrentVersion()
+	var got []string
+	deliver := func(channel, message []byte) {
+		got = append(got, string(channel)+":"+string(message))
+	}
+
+	local.Publish([]byte("c"), []byte("own"))
+	other.Publish([]byte("c"), []byte("m1"))
+	other.Publish([]byte("d"), []byte("m2"))
+
+	cursor, seen := since, make(map[string]uint64)
+	cursor, err := local.poll(since, cursor, seen, deliver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != "c:m1" || got[1] != "d:m2" {
+		t.Fatalf("poll got %v", got)
+	}
+
+	// messages are delivered once
+	other.Publish([]byte("c"), []byte("m3"))
+	local.poll(since, cursor, seen, deliver)
+	if len(got) != 3 || got[2] != "c:m3" {
+		t.Fatalf("poll again got %v", got)
+	}
+}
@@ -87,6 +87,10 @@ func (tidis *Tidis) HashMetaObjWithExpire(dbId uint8, txn interface{}, key []byt
 	if err != nil {
 		return nil, err
 	}
+	if obj.IsDeleted() {
+		// data keys are purging in background, treat as not exists
+		return nil, nil
+	}
 	if checkExpire && obj.ObjectExpired(utils.Now()) {
 		if txn == nil {
 			tidis.Hclear(dbId, key)
@@ -358,6 +362,10 @@ func (tidis *Tidis) HsetWithTxn(dbId uint8, txn interface{}, key, field, value [
 		return 0, err
 	}
 	if metaObj == nil {
+		// key may be purging after async deletion
+		if err = tidis.checkKeyBusy(dbId, txn, key); err != nil {
+			return 0, err
+		}
 		metaObj = tidis.newHashObj()
 	}
 
@@ -382,14 +390,15 @@ func (tidis *Tidis) HsetWithTxn(dbId uint8, txn interface{}, key, field, value [
 			// new insert field, add hsize
 			ret = 1
 			metaObj.Size++
+		}
 
-			// update meta key
-			eMetaValue := MarshalHashObj(metaObj)
-			eMetaKey := tidis.RawKeyPrefix(dbId, key)
-			err = txn.Set(eMetaKey, eMetaValue)
-			if err != nil {
-				return nil, err
-			}
+		// update meta key even if size not changed, watchers of the key
+		// detect modification by write conflict on meta key
+		eMetaValue := MarshalHashObj(metaObj)
+		eMetaKey := tidis.RawKeyPrefix(dbId, key)
+		err = txn.Set(eMetaKey, eMetaValue)
+		if err != nil {
+			return nil, err
 		}
 
 		// set or update field
@@ -433,6 +442,10 @@ func (tidis *Tidis) HsetnxWithTxn(dbId uint8, txn interface{}, key, field, value
 		return 0, err
 	}
 	if metaObj == nil {
+		// key may be purging after async deletion
+		if err = tidis.checkKeyBusy(dbId, txn, key); err != nil {
+			return 0, err
+		}
 		metaObj = tidis.newHashObj()
 	}
 
@@ -509,6 +522,10 @@ func (tidis *Tidis) HmsetWithTxn(dbId uint8, txn interface{}, key []byte, fields
 		return err
 	}
 	if metaObj == nil {
+		// key may be purging after async deletion
+		if err = tidis.checkKeyBusy(dbId, txn, key); err != nil {
+			return err
+		}
 		metaObj = tidis.newHashObj()
 	}
 
@@ -715,6 +732,46 @@ func (tidis *Tidis) Hgetall(dbId uint8, txn interface{}, key []byte) ([]interfac
 	return retkvs, nil
 }
 
+// Hscan iterates count fields of hash from cursor, returns the next cursor and
+// fields with values
+func (tidis *Tidis) Hscan(dbId uint8, txn interface{}, key, cursor []byte, count int, pattern []byte) ([]byte, []interface{}, error) {
+	if len(key) == 0 {
+		return nil, nil, terror.ErrKeyEmpty
+	}
+
+	var (
+		ss  interface{}
+		err error
+	)
+
+	if txn == nil {
+		ss, err = tidis.db.GetNewestSnapshot()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	metaObj, err := tidis.HashMetaObj(dbId, txn, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if metaObj == nil {
+		return cursorStart, EmptyListOrSet, nil
+	}
+
+	eDataKey := tidis.RawHashDataKey(dbId, key, nil)
+	next, kvs, err := tidis.scanDataKeys(eDataKey, txn, ss, cursor, count, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	retkvs := make([]interface{}, len(kvs))
+	for i := range kvs {
+		retkvs[i] = kvs[i]
+	}
+	return next, retkvs, nil
+}
+
 func (tidis *Tidis) Hclear(dbId uint8, key []byte) (uint8, error) {
 	if len(key) == 0 {
 		return 0, terror.ErrKeyEmpty
@@ -0,0 +1,406 @@
+//
+// t_keys.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strconv"
+
+	"github.com/pingcap/tidb/kv"
+	"github.com/yongman/tidis/terror"
+	"github.com/yongman/tidis/utils"
+)
+
+const (
+	// max keys fetched in one range scan when iterating keyspace
+	keysIterBatch = 256
+	// tso is physical time in ms shifted by logical bits
+	tsoLogicalBits = 18
+	// max length of random key used to seek in RANDOMKEY
+	randomKeyMaxLen = 16
+	// max keys counted in each db for keyspace info
+	keyspaceStatsSample = 1000
+	// scan cursors older than lifetime are cleared by leader, in ms
+	scanCursorLifeTime = 10 * 60 * 1000
+)
+
+func (tidis *Tidis) rawDBMetaPrefix(dbId uint8) []byte {
+	return append(RawDBPrefix(tidis.TenantId(), dbId), ObjectData)
+}
+
+// iterMetaKeys iterates alive objects of db from start in snapshot ss, data and
+// score keys of collections are skipped within the fetched batch, and a
+// collection filling the batch is skipped by seeking to the next meta key.
+// iteration stops when f returns false, and the key of the last iterated object
+// is returned to resume after it, nil means all keys are iterated.
+func (tidis *Tidis) iterMetaKeys(dbId uint8, ss interface{}, start []byte, f func(key []byte, objType byte, obj IObject) bool) ([]byte, error) {
+	metaPrefix := tidis.rawDBMetaPrefix(dbId)
+	if start == nil {
+		start = metaPrefix
+	}
+	end := kv.Key(metaPrefix).PrefixNext()
+	now := utils.Now()
+
+	for {
+		kvs, err := tidis.db.GetRangeKeysVals(start, end, keysIterBatch, ss)
+		if err != nil {
+			return nil, err
+		}
+
+		var meta []byte
+		for i := 0; i < len(kvs)-1; i += 2 {
+			rawKey := kvs[i]
+			if meta != nil && bytes.HasPrefix(rawKey, meta) {
+				// data keys of the last meta key
+				continue
+			}
+			if !bytes.HasPrefix(rawKey, metaPrefix) {
+				return nil, nil
+			}
+			_, key, err := RawKeyDecoder(tidis.TenantId(), rawKey)
+			if err != nil {
+				return nil, err
+			}
+			metaLen := len(metaPrefix) + 4 + len(key)
+			meta = rawKey[:metaLen]
+			if len(rawKey) != metaLen {
+				continue
+			}
+
+			objType, obj := UnmarshalObj(kvs[i+1])
+			if obj == nil || obj.IsDeleted() || obj.ObjectExpired(now) {
+				continue
+			}
+			if !f(key, objType, obj) {
+				return append([]byte{}, key...), nil
+			}
+		}
+		if len(kvs) < keysIterBatch*2 {
+			return nil, nil
+		}
+		start = kv.Key(meta).PrefixNext()
+	}
+}
+
+// cursors are ids of resume keys persisted in storage, so scan can be resumed
+// on any instance. "0" means start or end of iteration.
+var cursorStart = []byte("0")
+
+// saveCursor persists start key to resume iteration and returns its cursor,
+// tso is unique across instances and carries the creation time
+func (tidis *Tidis) saveCursor(start []byte) ([]byte, error) {
+	if start == nil {
+		return cursorStart, nil
+	}
+	id, err := tidis.db.GetCurrentVersion()
+	if err != nil {
+		return nil, err
+	}
+	if err = tidis.db.Set(RawSysScanCursorKey(tidis.TenantId(), id), start); err != nil {
+		return nil, err
+	}
+	return []byte(strconv.FormatUint(id, 10)), nil
+}
+
+// loadCursor returns start key saved for cursor, it must be in range of prefix
+func (tidis *Tidis) loadCursor(cursor, prefix []byte) ([]byte, error) {
+	if bytes.Equal(cursor, cursorStart) {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(string(cursor), 10, 64)
+	if err != nil {
+		return nil, terror.ErrInvalidCursor
+	}
+	start, err := tidis.db.Get(RawSysScanCursorKey(tidis.TenantId(), id))
+	if err != nil {
+		return nil, err
+	}
+	if start == nil || !bytes.HasPrefix(start, prefix) {
+		return nil, terror.ErrInvalidCursor
+	}
+	return start, nil
+}
+
+// ClearScanCursors deletes scan cursors created before lifetime
+func (tidis *Tidis) ClearScanCursors() error {
+	now := utils.Now()
+	if now < scanCursorLifeTime {
+		return nil
+	}
+	startKey := RawSysScanCursorPrefix(tidis.TenantId())
+	endKey := RawSysScanCursorKey(tidis.TenantId(), (now-scanCursorLifeTime)<<tsoLogicalBits)
+
+	for {
+		deleted, err := tidis.db.DeleteRange(startKey, endKey, keysIterBatch)
+		if err != nil {
+			return err
+		}
+		if deleted < keysIterBatch {
+			return nil
+		}
+	}
+}
+
+// Scan iterates count meta keys of db from cursor, keys matching pattern and
+// type are returned. cursor is persisted in storage, so scan can be resumed
+// on any instance.
+func (tidis *Tidis) Scan(dbId uint8, cursor []byte, count int, pattern []byte, keyType string) ([]byte, [][]byte, error) {
+	var keys [][]byte
+
+	if count <= 0 {
+		return nil, nil, terror.ErrCmdParams
+	}
+
+	start, err := tidis.loadCursor(cursor, tidis.rawDBMetaPrefix(dbId))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ss, err := tidis.db.GetNewestSnapshot()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scanned := 0
+	f := func(key []byte, objType byte, obj IObject) bool {
+		if (pattern == nil || utils.StringMatch(pattern, key)) &&
+			(keyType == "" || keyType == TypeName(objType)) {
+			keys = append(keys, key)
+		}
+		scanned++
+		return scanned < count
+	}
+
+	last, err := tidis.iterMetaKeys(dbId, ss, start, f)
+	if err != nil {
+		return nil, nil, err
+	}
+	if last != nil {
+		// continue after the last iterated key
+		start = kv.Key(tidis.RawKeyPrefix(dbId, last)).PrefixNext()
+	} else {
+		start = nil
+	}
+	next, err := tidis.saveCursor(start)
+	if err != nil {
+		return nil, nil, err
+	}
+	return next, keys, nil
+}
+
+func (tidis *Tidis) Keys(dbId uint8, pattern []byte) ([]interface{}, error) {
+	ss, err := tidis.db.GetNewestSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]interface{}, 0)
+	f := func(key []byte, objType byte, obj IObject) bool {
+		if utils.StringMatch(pattern, key) {
+			keys = append(keys, key)
+		}
+		return true
+	}
+
+	_, err = tidis.iterMetaKeys(dbId, ss, nil, f)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (tidis *Tidis) Exists(dbId uint8, txn interface{}, keys ...[]byte) (int64, error) {
+	var cnt int64
+
+	now := utils.Now()
+	for _, key := range keys {
+		_, obj, err := tidis.GetObject(dbId, txn, key)
+		if err != nil {
+			return 0, err
+		}
+		if obj != nil && !obj.ObjectExpired(now) {
+			cnt++
+		}
+	}
+	return cnt, nil
+}
+
+func (tidis *Tidis) DBSize(dbId uint8) (int64, error) {
+	ss, err := tidis.db.GetNewestSnapshot()
+	if err != nil {
+		return 0, err
+	}
+
+	var cnt int64
+	f := func(key []byte, objType byte, obj IObject) bool {
+		cnt++
+		return true
+	}
+
+	_, err = tidis.iterMetaKeys(dbId, ss, nil, f)
+	if err != nil {
+		return 0, err
+	}
+	return cnt, nil
+}
+
+// DBStats is the keyspace info of a db
+type DBStats struct {
+	DB      uint8
+	Keys    int64
+	Expires int64
+	// average ttl of keys with expire in ms
+	AvgTTL uint64
+	// only the first keys of db are counted, keys and expires are lower bounds
+	Sampled bool
+}
+
+// KeyspaceStats counts keys of all non-empty dbs, dbs are found by seeking to
+// the first key of each db. at most keyspaceStatsSample keys are counted in a
+// db, so it does not scan the whole keyspace
+func (tidis *Tidis) KeyspaceStats() ([]DBStats, error) {
+	ss, err := tidis.db.GetNewestSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []DBStats
+	start := RawTenantPrefix(tidis.TenantId())
+	end := kv.Key(start).PrefixNext()
+	pos := len(start)
+	for {
+		keys, err := tidis.db.GetRangeKeys(start, end, 0, 1, ss)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 || len(keys[0]) <= pos || bytes.Compare(keys[0], end) >= 0 {
+			return stats, nil
+		}
+		dbId := keys[0][pos]
+
+		st := DBStats{DB: dbId}
+		var ttlSum uint64
+		now := utils.Now()
+		f := func(key []byte, objType byte, obj IObject) bool {
+			if st.Keys == keyspaceStatsSample {
+				st.Sampled = true
+				return false
+			}
+			st.Keys++
+			if obj.IsExpireSet() {
+				st.Expires++
+				ttlSum += obj.TTL(now)
+			}
+			return true
+		}
+		if _, err = tidis.iterMetaKeys(dbId, ss, nil, f); err != nil {
+			return nil, err
+		}
+		if st.Expires > 0 {
+			st.AvgTTL = ttlSum / uint64(st.Expires)
+		}
+		if st.Keys > 0 {
+			stats = append(stats, st)
+		}
+
+		if dbId == math.MaxUint8 {
+			return stats, nil
+		}
+		start = RawDBPrefix(tidis.TenantId(), dbId+1)
+	}
+}
+
+// RandomKey seeks to a random position of db and returns the first key after
+// it, keys are not picked with uniform probability
+func (tidis *Tidis) RandomKey(dbId uint8) ([]byte, error) {
+	ss, err := tidis.db.GetNewestSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	var randKey []byte
+	f := func(key []byte, objType byte, obj IObject) bool {
+		randKey = key
+		return false
+	}
+
+	seekKey := make([]byte, rand.Intn(randomKeyMaxLen)+1)
+	rand.Read(seekKey)
+
+	start := tidis.RawKeyPrefix(dbId, seekKey)
+	_, err = tidis.iterMetaKeys(dbId, ss, start, f)
+	if err != nil {
+		return nil, err
+	}
+	if randKey == nil {
+		// wrap around from the beginning
+		_, err = tidis.iterMetaKeys(dbId, ss, nil, f)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return randKey, nil
+}
+
+// scanDataKeys pages count data keys with dataPrefix after cursor in txn or
+// snapshot ss, fields matching pattern are returned with their values
+func (tidis *Tidis) scanDataKeys(dataPrefix []byte, txn, ss interface{}, cursor []byte, count int, pattern []byte) ([]byte, [][]byte, error) {
+	var (
+		kvs [][]byte
+		err error
+	)
+
+	if count <= 0 {
+		return nil, nil, terror.ErrCmdParams
+	}
+	startKey, err := tidis.loadCursor(cursor, dataPrefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	if startKey == nil {
+		startKey = dataPrefix
+	}
+	endKey := kv.Key(dataPrefix).PrefixNext()
+
+	if txn == nil {
+		kvs, err = tidis.db.GetRangeKeysVals(startKey, endKey, uint64(count), ss)
+	} else {
+		kvs, err = tidis.db.GetRangeKeysValsWithTxn(startKey, endKey, uint64(count), txn)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		next []byte
+		rets [][]byte
+	)
+	for i := 0; i < len(kvs)-1; i += 2 {
+		if !bytes.HasPrefix(kvs[i], dataPrefix) {
+			break
+		}
+		field := kvs[i][len(dataPrefix):]
+		if pattern == nil || utils.StringMatch(pattern, field) {
+			rets = append(rets, field, kvs[i+1])
+		}
+		// continue after the last iterated field
+		next = kv.Key(kvs[i]).Next()
+	}
+	if len(kvs) < count*2 {
+		// all data keys iterated
+		next = nil
+	}
+
+	cursor, err = tidis.saveCursor(next)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cursor, rets, nil
+}
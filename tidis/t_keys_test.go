@@ -0,0 +1,217 @@
+//
+// t_keys_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestKeyspace(t *testing.T) {
+	tdb := newTestTidis(t)
+	defer tdb.Close()
+
+	expect := []string{}
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("str%d", i)
+		tdb.Set(0, nil, []byte(key), []byte("v"))
+		expect = append(expect, key)
+	}
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("hash%d", i)
+		for j := 0; j < 10; j++ {
+			tdb.Hset(0, []byte(key), []byte(fmt.Sprintf("f%d", j)), []byte("v"))
+		}
+		expect = append(expect, key)
+	}
+	tdb.Zadd(0, []byte("zset"), &MemberPair{Score: 1, Member: []byte("m")})
+	expect = append(expect, "zset")
+	// expired and other db keys are skipped
+	tdb.SetWithParam(0, nil, []byte("expired"), []byte("v"), 1, false, false)
+	tdb.Set(1, nil, []byte("db1"), []byte("v"))
+	time.Sleep(5 * time.Millisecond)
+	sort.Strings(expect)
+
+	var (
+		cursor = []byte("0")
+		got    []string
+	)
+	for {
+		next, keys, err := tdb.Scan(0, cursor, 3, nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range keys {
+			got = append(got, string(key))
+		}
+		if string(next) == "0" {
+			break
+		}
+		cursor = next
+	}
+	sort.Strings(got)
+	if fmt.Sprint(got) != fmt.Sprint(expect) {
+		t.Fatalf("scan got %v, expect %v", got, expect)
+	}
+
+	_, keys, _ := tdb.Scan(0, []byte("0"), 100, []byte("hash*"), "")
+	if len(keys) != 5 {
+		t.Fatalf("scan match got %d keys", len(keys))
+	}
+	_, keys, _ = tdb.Scan(0, []byte("0"), 100, nil, "zset")
+	if len(keys) != 1 || string(keys[0]) != "zset" {
+		t.Fatalf("scan type got %q", keys)
+	}
+	for _, cursor := range []string{"12345", "-1", "abc"} {
+		if _, _, err := tdb.Scan(0, []byte(cursor), 10, nil, ""); err == nil {
+			t.Fatalf("scan with invalid cursor %s should fail", cursor)
+		}
+	}
+	// cursor fits in 64 bits for long keys, big collections are skipped
+	for i := 0; i < keysIterBatch; i++ {
+		tdb.Sadd(0, []byte("session:big-collection"), []byte(fmt.Sprint(i)))
+	}
+	seen := make(map[string]int)
+	next := []byte("0")
+	for {
+		var err error
+		next, keys, err = tdb.Scan(0, next, 1, nil, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = strconv.ParseUint(string(next), 10, 64); err != nil {
+			t.Fatalf("scan got cursor %s", next)
+		}
+		for _, key := range keys {
+			seen[string(key)]++
+		}
+		if string(next) == "0" {
+			break
+		}
+		if len(keys) == 1 && string(keys[0]) == "session:big-collection" {
+			// cursor after a long key
+			if _, _, err = tdb.Scan(1, next, 1, nil, ""); err == nil {
+				t.Fatalf("scan db1 with cursor of db0 should fail")
+			}
+		}
+	}
+	if len(seen) != len(expect)+1 || seen["session:big-collection"] != 1 {
+		t.Fatalf("scan by one got %v", seen)
+	}
+	all, _ := tdb.Keys(0, []byte("str[0-2]"))
+	if len(all) != 3 {
+		t.Fatalf("keys got %d keys", len(all))
+	}
+	if n, _ := tdb.DBSize(0); n != int64(len(expect))+1 {
+		t.Fatalf("dbsize got %d, expect %d", n, len(expect))
+	}
+	if n, _ := tdb.Exists(0, nil, []byte("str0"), []byte("str0"), []byte("hash1"), []byte("expired"), []byte("none")); n != 3 {
+		t.Fatalf("exists got %d", n)
+	}
+	if key, _ := tdb.RandomKey(0); key == nil {
+		t.Fatalf("randomkey got nil")
+	}
+	if key, _ := tdb.RandomKey(2); key != nil {
+		t.Fatalf("randomkey of empty db got %s", key)
+	}
+}
+
+func TestKeyspaceStats(t *testing.T) {
+	tdb := newTestTidis(t)
+	defer tdb.Close()
+
+	var keyvals [][]byte
+	for i := 0; i <= keyspaceStatsSample; i++ {
+		keyvals = append(keyvals, []byte(fmt.Sprintf("k%d", i)), []byte("v"))
+	}
+	tdb.MSet(0, nil, keyvals)
+	tdb.SetWithParam(1, nil, []byte("k"), []byte("v"), 100000, false, false)
+
+	stats, err := tdb.KeyspaceStats()
+	if err != nil || len(stats) != 2 {
+		t.Fatalf("keyspace stats got %v %v", stats, err)
+	}
+	// big db is sampled
+	if st := stats[0]; st.DB != 0 || st.Keys != keyspaceStatsSample || !st.Sampled {
+		t.Fatalf("db0 stats got %+v", st)
+	}
+	if st := stats[1]; st.DB != 1 || st.Keys != 1 || st.Expires != 1 || st.AvgTTL == 0 || st.Sampled {
+		t.Fatalf("db1 stats got %+v", st)
+	}
+}
+
+func TestCollectionScan(t *testing.T) {
+	tdb := newTestTidis(t)
+	defer tdb.Close()
+
+	for i := 0; i < 25; i++ {
+		field := []byte(fmt.Sprintf("f%02d:member-of-collection", i))
+		tdb.Hset(0, []byte("hash"), field, []byte("v"))
+		tdb.Sadd(0, []byte("set"), field)
+		tdb.Zadd(0, []byte("zset"), &MemberPair{Score: float64(i), Member: field})
+	}
+
+	scanAll := func(scan func(cursor []byte) ([]byte, []interface{}, error)) (int, []interface{}) {
+		var (
+			pages  int
+			items  []interface{}
+			cursor = []byte("0")
+		)
+		for {
+			next, v, err := scan(cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = strconv.ParseUint(string(next), 10, 64); err != nil {
+				t.Fatalf("cursor %s is not an integer", next)
+			}
+			pages++
+			items = append(items, v...)
+			if string(next) == "0" {
+				return pages, items
+			}
+			cursor = next
+		}
+	}
+
+	pages, items := scanAll(func(cursor []byte) ([]byte, []interface{}, error) {
+		return tdb.Hscan(0, nil, []byte("hash"), cursor, 10, nil)
+	})
+	if pages != 3 || len(items) != 50 {
+		t.Fatalf("hscan got %d pages %d items", pages, len(items))
+	}
+	_, items = scanAll(func(cursor []byte) ([]byte, []interface{}, error) {
+		return tdb.Sscan(0, nil, []byte("set"), cursor, 10, []byte("f1*"))
+	})
+	if len(items) != 10 {
+		t.Fatalf("sscan match got %d items", len(items))
+	}
+	_, items = scanAll(func(cursor []byte) ([]byte, []interface{}, error) {
+		return tdb.Zscan(0, nil, []byte("zset"), cursor, 7, []byte("f24:*"))
+	})
+	if len(items) != 2 || string(items[1].([]byte)) != "24" {
+		t.Fatalf("zscan got %q", items)
+	}
+
+	// scan in txn sees uncommitted fields
+	txn, _ := tdb.NewTxn()
+	tdb.HsetWithTxn(0, txn, []byte("hash"), []byte("new"), []byte("v"))
+	_, items = scanAll(func(cursor []byte) ([]byte, []interface{}, error) {
+		return tdb.Hscan(0, txn, []byte("hash"), cursor, 10, []byte("new"))
+	})
+	if len(items) != 2 {
+		t.Fatalf("hscan in txn got %q", items)
+	}
+
+	if _, _, err := tdb.Hscan(0, nil, []byte("hash"), []byte("!"), 10, nil); err == nil {
+		t.Fatalf("hscan with invalid cursor should fail")
+	}
+}
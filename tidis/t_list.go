@@ -12,6 +12,8 @@ import (
 	"github.com/yongman/go/util"
 	"github.com/yongman/tidis/terror"
 	"github.com/yongman/tidis/utils"
+
+	"bytes"
 )
 
 const (
@@ -22,6 +24,9 @@ const (
 	LItemMaxIndex uint64 = 1<<64 - 1024
 
 	LItemInitIndex uint64 = 1<<32 - 512
+
+	// items read in one batch when scanning a list
+	lItemBatch int64 = 256
 )
 
 type ListObj struct {
@@ -104,6 +109,10 @@ func (tidis *Tidis) ListMetaObjWithExpire(dbId uint8, txn, ss interface{}, key [
 	if err != nil {
 		return nil, false, err
 	}
+	if obj.IsDeleted() {
+		// data keys are purging in background, treat as not exists
+		return nil, false, nil
+	}
 	if checkExpire && obj.ObjectExpired(utils.Now()) {
 		if txn == nil {
 			tidis.Ldelete(dbId, key)
@@ -371,6 +380,13 @@ func (tidis *Tidis) LsetWithTxn(dbId uint8, txn interface{}, key []byte, index i
 		if err != nil {
 			return nil, err
 		}
+
+		// touch meta key for watchers
+		eMetaKey := tidis.RawKeyPrefix(dbId, key)
+		err = txn.Set(eMetaKey, MarshalListObj(metaObj))
+		if err != nil {
+			return nil, err
+		}
 		return nil, nil
 	}
 
@@ -690,6 +706,7 @@ func (tidis *Tidis) lPush(dbId uint8, key []byte, direc uint8, items ...[]byte)
 	if err != nil {
 		return 0, err
 	}
+	tidis.SignalKeyReady(dbId, key)
 
 	if ret == nil {
 		return 0, nil
@@ -710,6 +727,10 @@ func (tidis *Tidis) lPushWithTxn(dbId uint8, txn interface{}, key []byte, direc
 		return 0, err
 	}
 	if metaObj == nil {
+		// key may be purging after async deletion
+		if err = tidis.checkKeyBusy(dbId, txn, key); err != nil {
+			return 0, err
+		}
 		metaObj = tidis.newListMetaObj()
 	}
 
@@ -773,3 +794,380 @@ func (tidis *Tidis) lPushWithTxn(dbId uint8, txn interface{}, key []byte, direc
 
 	return ret.(uint64), nil
 }
+
+// Lmove pops an item from src and pushes it to dst atomically
+func (tidis *Tidis) Lmove(dbId uint8, txn interface{}, src, dst []byte, srcDirec, dstDirec uint8) ([]byte, error) {
+	if txn != nil {
+		return tidis.lMoveWithTxn(dbId, txn, src, dst, srcDirec, dstDirec)
+	}
+
+	// txn function
+	f := func(txn interface{}) (interface{}, error) {
+		return tidis.lMoveWithTxn(dbId, txn, src, dst, srcDirec, dstDirec)
+	}
+
+	// run txn
+	ret, err := tidis.db.BatchInTxn(f)
+	if err != nil {
+		return nil, err
+	}
+	item := ret.([]byte)
+	if item != nil {
+		tidis.SignalKeyReady(dbId, dst)
+	}
+
+	return item, nil
+}
+
+func (tidis *Tidis) lMoveWithTxn(dbId uint8, txn interface{}, src, dst []byte, srcDirec, dstDirec uint8) ([]byte, error) {
+	if len(src) == 0 || len(dst) == 0 {
+		return nil, terror.ErrKeyEmpty
+	}
+
+	// dst must be a list, check before pop
+	_, _, err := tidis.ListMetaObj(dbId, txn, nil, dst)
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := tidis.lPopWithTxn(dbId, txn, src, srcDirec)
+	if err != nil || item == nil {
+		return nil, err
+	}
+
+	_, err = tidis.lPushWithTxn(dbId, txn, dst, dstDirec, item)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// lForEach calls fn on items at positions [start, stop] from head, in reverse
+// order if reverse is true, until fn returns false. items are read in batches
+// with txn if it is not nil, otherwise with snapshot ss.
+func (tidis *Tidis) lForEach(dbId uint8, txn, ss interface{}, key []byte, head uint64, start, stop int64, reverse bool, fn func(pos int64, item []byte) (bool, error)) error {
+	for start <= stop {
+		from, to := start, start+lItemBatch-1
+		if reverse {
+			from, to = stop-lItemBatch+1, stop
+		}
+		if from < start {
+			from = start
+		}
+		if to > stop {
+			to = stop
+		}
+
+		keys := make([][]byte, to-from+1)
+		for i := range keys {
+			keys[i] = tidis.RawListKey(dbId, key, head+uint64(from)+uint64(i))
+		}
+
+		var (
+			items map[string][]byte
+			err   error
+		)
+		if txn == nil {
+			items, err = tidis.db.MGetWithSnapshot(keys, ss)
+		} else {
+			items, err = tidis.db.MGetWithTxn(keys, txn)
+		}
+		if err != nil {
+			return err
+		}
+
+		for i := range keys {
+			if reverse {
+				i = len(keys) - 1 - i
+			}
+			more, err := fn(from+int64(i), items[string(keys[i])])
+			if err != nil || !more {
+				return err
+			}
+		}
+
+		if reverse {
+			stop = from - 1
+		} else {
+			start = to + 1
+		}
+	}
+	return nil
+}
+
+// Lpos returns positions of items equal to element. matches before the rank-th
+// one are skipped, negative rank scans from tail. count limits the number of
+// positions returned and maxlen limits the number of items compared, zero
+// means no limit.
+func (tidis *Tidis) Lpos(dbId uint8, txn interface{}, key, element []byte, rank, count, maxlen int64) ([]int64, error) {
+	if len(key) == 0 {
+		return nil, terror.ErrKeyEmpty
+	}
+
+	var (
+		ss  interface{}
+		err error
+	)
+	if txn == nil {
+		ss, err = tidis.db.GetNewestSnapshot()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	metaObj, _, err := tidis.ListMetaObj(dbId, txn, ss, key)
+	if err != nil {
+		return nil, err
+	}
+	if metaObj == nil {
+		return nil, nil
+	}
+
+	reverse := rank < 0
+	if reverse {
+		rank = -rank
+	}
+	start, stop := int64(0), int64(metaObj.Size)-1
+	if maxlen > 0 && maxlen < int64(metaObj.Size) {
+		if reverse {
+			start = stop - maxlen + 1
+		} else {
+			stop = maxlen - 1
+		}
+	}
+
+	var positions []int64
+	err = tidis.lForEach(dbId, txn, ss, key, metaObj.Head, start, stop, reverse, func(pos int64, item []byte) (bool, error) {
+		if !bytes.Equal(item, element) {
+			return true, nil
+		}
+		if rank--; rank > 0 {
+			return true, nil
+		}
+		positions = append(positions, pos)
+		return count == 0 || int64(len(positions)) < count, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return positions, nil
+}
+
+func (tidis *Tidis) Linsert(dbId uint8, key []byte, before bool, pivot, value []byte) (int64, error) {
+	// txn function
+	f := func(txn interface{}) (interface{}, error) {
+		return tidis.LinsertWithTxn(dbId, txn, key, before, pivot, value)
+	}
+
+	// execute txn func
+	v, err := tidis.db.BatchInTxn(f)
+	if err != nil {
+		return 0, err
+	}
+
+	return v.(int64), nil
+}
+
+// LinsertWithTxn inserts value before or after the first pivot from head. the
+// shorter side of the list is moved by one index to make room for value. it
+// returns the list length, -1 if pivot is not found and 0 if key not exists.
+func (tidis *Tidis) LinsertWithTxn(dbId uint8, txn interface{}, key []byte, before bool, pivot, value []byte) (int64, error) {
+	if len(key) == 0 {
+		return 0, terror.ErrKeyEmpty
+	}
+
+	eMetaKey := tidis.RawKeyPrefix(dbId, key)
+
+	metaObj, _, err := tidis.ListMetaObj(dbId, txn, nil, key)
+	if err != nil {
+		return 0, err
+	}
+	if metaObj == nil {
+		return 0, nil
+	}
+
+	// txn function
+	f := func(txn1 interface{}) (interface{}, error) {
+		txn, ok := txn1.(kv.Transaction)
+		if !ok {
+			return nil, terror.ErrBackendType
+		}
+
+		head := metaObj.Head
+		size := int64(metaObj.Size)
+
+		// find position of pivot
+		pos := int64(-1)
+		err := tidis.lForEach(dbId, txn1, nil, key, head, 0, size-1, false, func(i int64, item []byte) (bool, error) {
+			if bytes.Equal(item, pivot) {
+				pos = i
+				return false, nil
+			}
+			return true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if pos < 0 {
+			return int64(-1), nil
+		}
+		if !before {
+			pos++
+		}
+
+		if pos < size-pos {
+			// move items before pos towards head
+			err = tidis.lForEach(dbId, txn1, nil, key, head, 0, pos-1, false, func(i int64, item []byte) (bool, error) {
+				return true, txn.Set(tidis.RawListKey(dbId, key, head+uint64(i)-1), item)
+			})
+			metaObj.Head--
+		} else {
+			// move items from pos towards tail
+			err = tidis.lForEach(dbId, txn1, nil, key, head, pos, size-1, true, func(i int64, item []byte) (bool, error) {
+				return true, txn.Set(tidis.RawListKey(dbId, key, head+uint64(i)+1), item)
+			})
+			metaObj.Tail++
+		}
+		if err != nil {
+			return nil, err
+		}
+		metaObj.Size++
+
+		err = txn.Set(tidis.RawListKey(dbId, key, metaObj.Head+uint64(pos)), value)
+		if err != nil {
+			return nil, err
+		}
+
+		err = txn.Set(eMetaKey, MarshalListObj(metaObj))
+		if err != nil {
+			return nil, err
+		}
+
+		return int64(metaObj.Size), nil
+	}
+
+	// execute txn func
+	v, err := tidis.db.BatchWithTxn(f, txn)
+	if err != nil {
+		return 0, err
+	}
+
+	return v.(int64), nil
+}
+
+func (tidis *Tidis) Lrem(dbId uint8, key []byte, count int64, value []byte) (int64, error) {
+	// txn function
+	f := func(txn interface{}) (interface{}, error) {
+		return tidis.LremWithTxn(dbId, txn, key, count, value)
+	}
+
+	// execute txn func
+	v, err := tidis.db.BatchInTxn(f)
+	if err != nil {
+		return 0, err
+	}
+
+	return v.(int64), nil
+}
+
+// LremWithTxn removes the first count items equal to value from head, or from
+// tail if count is negative, all of them if count is zero. items are compacted
+// towards the scanning start so indexes between head and tail stay dense.
+func (tidis *Tidis) LremWithTxn(dbId uint8, txn interface{}, key []byte, count int64, value []byte) (int64, error) {
+	if len(key) == 0 {
+		return 0, terror.ErrKeyEmpty
+	}
+
+	eMetaKey := tidis.RawKeyPrefix(dbId, key)
+
+	metaObj, _, err := tidis.ListMetaObj(dbId, txn, nil, key)
+	if err != nil {
+		return 0, err
+	}
+	if metaObj == nil {
+		return 0, nil
+	}
+
+	// txn function
+	f := func(txn1 interface{}) (interface{}, error) {
+		txn, ok := txn1.(kv.Transaction)
+		if !ok {
+			return nil, terror.ErrBackendType
+		}
+
+		reverse := count < 0
+		if reverse {
+			count = -count
+		}
+		head := metaObj.Head
+		size := int64(metaObj.Size)
+
+		// next position to keep item in
+		var removed, next int64
+		if reverse {
+			next = size - 1
+		}
+		err := tidis.lForEach(dbId, txn1, nil, key, head, 0, size-1, reverse, func(i int64, item []byte) (bool, error) {
+			if (count == 0 || removed < count) && bytes.Equal(item, value) {
+				removed++
+				return true, nil
+			}
+			if i != next {
+				if err := txn.Set(tidis.RawListKey(dbId, key, head+uint64(next)), item); err != nil {
+					return false, err
+				}
+			}
+			if reverse {
+				next--
+			} else {
+				next++
+			}
+			return true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if removed == 0 {
+			return int64(0), nil
+		}
+
+		// delete vacated items
+		start, stop := next, size-1
+		if reverse {
+			start, stop = 0, next
+		}
+		for i := start; i <= stop; i++ {
+			err = txn.Delete(tidis.RawListKey(dbId, key, head+uint64(i)))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		metaObj.Size -= uint64(removed)
+		if metaObj.Size == 0 {
+			err = txn.Delete(eMetaKey)
+		} else {
+			if reverse {
+				metaObj.Head = head + uint64(next) + 1
+			} else {
+				metaObj.Tail = head + uint64(next)
+			}
+			err = txn.Set(eMetaKey, MarshalListObj(metaObj))
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return removed, nil
+	}
+
+	// execute txn func
+	v, err := tidis.db.BatchWithTxn(f, txn)
+	if err != nil {
+		return 0, err
+	}
+
+	return v.(int64), nil
+}
@@ -0,0 +1,96 @@
+//
+// t_list_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestListMutation(t *testing.T) {
+	tdb := newTestTidis(t)
+	defer tdb.Close()
+
+	key := []byte("list")
+	expect := func(want string) {
+		t.Helper()
+		v, err := tdb.Lrange(0, nil, key, 0, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%s", v); got != want {
+			t.Fatalf("lrange got %s, expect %s", got, want)
+		}
+		if n, _ := tdb.Llen(0, nil, key); n != uint64(len(v)) {
+			t.Fatalf("llen got %d, expect %d", n, len(v))
+		}
+	}
+
+	tdb.Rpush(0, nil, key, []byte("a"), []byte("b"), []byte("c"), []byte("b"), []byte("d"))
+	if n, _ := tdb.Linsert(0, key, true, []byte("b"), []byte("x")); n != 6 {
+		t.Fatalf("linsert got %d", n)
+	}
+	if n, _ := tdb.Linsert(0, key, false, []byte("d"), []byte("y")); n != 7 {
+		t.Fatalf("linsert got %d", n)
+	}
+	if n, _ := tdb.Linsert(0, key, false, []byte("none"), []byte("y")); n != -1 {
+		t.Fatalf("linsert without pivot got %d", n)
+	}
+	if n, _ := tdb.Linsert(0, []byte("none"), false, []byte("a"), []byte("y")); n != 0 {
+		t.Fatalf("linsert on missing key got %d", n)
+	}
+	expect("[a x b c b d y]")
+	if v, _ := tdb.Lindex(0, nil, key, 1); string(v) != "x" {
+		t.Fatalf("lindex got %s", v)
+	}
+
+	tdb.Rpush(0, nil, key, []byte("b"))
+	if n, _ := tdb.Lrem(0, key, -2, []byte("b")); n != 2 {
+		t.Fatalf("lrem got %d", n)
+	}
+	expect("[a x b c d y]")
+	tdb.Lpush(0, nil, key, []byte("x"))
+	if n, _ := tdb.Lrem(0, key, 1, []byte("x")); n != 1 {
+		t.Fatalf("lrem got %d", n)
+	}
+	expect("[a x b c d y]")
+	tdb.Lpush(0, nil, key, []byte("y"))
+	tdb.Rpush(0, nil, key, []byte("z"))
+	expect("[y a x b c d y z]")
+	if n, _ := tdb.Lrem(0, key, 0, []byte("y")); n != 2 {
+		t.Fatalf("lrem got %d", n)
+	}
+	expect("[a x b c d z]")
+
+	// items span several batches
+	big := []byte("big")
+	for i := 0; i < int(lItemBatch)*2+10; i++ {
+		tdb.Rpush(0, nil, big, []byte(fmt.Sprint(i%3)))
+	}
+	if pos, _ := tdb.Lpos(0, nil, big, []byte("1"), -2, 2, 0); fmt.Sprint(pos) != "[517 514]" {
+		t.Fatalf("lpos got %v", pos)
+	}
+	if pos, _ := tdb.Lpos(0, nil, big, []byte("2"), 1, 0, 10); fmt.Sprint(pos) != "[2 5 8]" {
+		t.Fatalf("lpos with maxlen got %v", pos)
+	}
+	if n, _ := tdb.Lrem(0, big, 0, []byte("0")); n != 174 {
+		t.Fatalf("lrem got %d", n)
+	}
+	if v, _ := tdb.Lrange(0, nil, big, 344, -1); fmt.Sprintf("%s", v) != "[1 2 1 2]" {
+		t.Fatalf("lrange after lrem got %s", v)
+	}
+	if n, _ := tdb.Lrem(0, big, 0, []byte("1")); n != 174 {
+		t.Fatalf("lrem got %d", n)
+	}
+	if n, _ := tdb.Lrem(0, big, -200, []byte("2")); n != 174 {
+		t.Fatalf("lrem got %d", n)
+	}
+	if n, _ := tdb.Exists(0, nil, big); n != 0 {
+		t.Fatalf("empty list should be deleted")
+	}
+}
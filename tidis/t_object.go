@@ -14,6 +14,9 @@ import (
 type IObject interface {
 	ObjectExpired(now uint64) bool
 	SetExpireAt(ts uint64)
+	GetExpireAt() uint64
+	IsDeleted() bool
+	MarkDeleted()
 	TTL(now uint64) uint64
 	IsExpireSet() bool
 }
@@ -59,6 +62,19 @@ func (obj *Object) SetExpireAt(ts uint64) {
 	obj.ExpireAt = ts
 }
 
+// object is marked deleted and data keys are purging in background
+func (obj *Object) IsDeleted() bool {
+	return obj.Tomb == FDELETED
+}
+
+func (obj *Object) MarkDeleted() {
+	obj.Tomb = FDELETED
+}
+
+func (obj *Object) GetExpireAt() uint64 {
+	return obj.ExpireAt
+}
+
 func (obj *Object) TTL(now uint64) uint64 {
 	if obj.ExpireAt > now {
 		return obj.ExpireAt - now
@@ -87,24 +103,47 @@ func (tidis *Tidis) GetObject(dbId uint8, txn interface{}, key []byte) (byte, IO
 		return 0, nil, nil
 	}
 
+	objType, obj := UnmarshalObj(metaValue)
+	if obj != nil && obj.IsDeleted() {
+		return 0, nil, nil
+	}
+
+	return objType, obj, nil
+}
+
+// unmarshal meta value of any type, obj is nil if value is invalid
+func UnmarshalObj(metaValue []byte) (byte, IObject) {
 	var obj IObject
 
+	if len(metaValue) == 0 {
+		return 0, nil
+	}
+
 	// unmarshal with type
 	objType := metaValue[0]
 	switch objType {
 	case TSTRING:
-		obj, _ = UnmarshalStringObj(metaValue)
+		if o, _ := UnmarshalStringObj(metaValue); o != nil {
+			obj = o
+		}
 	case THASHMETA:
-		obj, _ = UnmarshalHashObj(metaValue)
+		if o, _ := UnmarshalHashObj(metaValue); o != nil {
+			obj = o
+		}
 	case TLISTMETA:
-		obj, _ = UnmarshalListObj(metaValue)
+		if o, _ := UnmarshalListObj(metaValue); o != nil {
+			obj = o
+		}
 	case TSETMETA:
-		obj, _ = UnmarshalSetObj(metaValue)
+		if o, _ := UnmarshalSetObj(metaValue); o != nil {
+			obj = o
+		}
 	case TZSETMETA:
-		obj, _ = UnmarshalZSetObj(metaValue)
+		if o, _ := UnmarshalZSetObj(metaValue); o != nil {
+			obj = o
+		}
 	}
-
-	return objType, obj, nil
+	return objType, obj
 }
 
 func (tidis *Tidis) FlushDB(dbId uint8) error {
@@ -101,6 +101,10 @@ func (tidis *Tidis) SetMetaObjWithExpire(dbId uint8, txn, ss interface{}, key []
 	if err != nil {
 		return nil, false, err
 	}
+	if obj.IsDeleted() {
+		// data keys are purging in background, treat as not exists
+		return nil, false, nil
+	}
 	if checkExpire && obj.ObjectExpired(utils.Now()) {
 		if txn == nil {
 			tidis.Sclear(dbId, key)
@@ -148,6 +152,10 @@ func (tidis *Tidis) SaddWithTxn(dbId uint8, txn interface{}, key []byte, members
 		return 0, err
 	}
 	if metaObj == nil {
+		// key may be purging after async deletion
+		if err = tidis.checkKeyBusy(dbId, txn, key); err != nil {
+			return 0, err
+		}
 		metaObj = tidis.newSetMetaObj()
 	}
 
@@ -304,6 +312,45 @@ func (tidis *Tidis) Smembers(dbId uint8, txn interface{}, key []byte) ([]interfa
 	return imembers, nil
 }
 
+// Sscan iterates count members of set from cursor, returns the next cursor
+// and members
+func (tidis *Tidis) Sscan(dbId uint8, txn interface{}, key, cursor []byte, count int, pattern []byte) ([]byte, []interface{}, error) {
+	if len(key) == 0 {
+		return nil, nil, terror.ErrKeyEmpty
+	}
+
+	var (
+		ss  interface{}
+		err error
+	)
+	if txn == nil {
+		ss, err = tidis.db.GetNewestSnapshot()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	metaObj, _, err := tidis.SetMetaObj(dbId, txn, ss, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if metaObj == nil {
+		return cursorStart, EmptyListOrSet, nil
+	}
+
+	startKey := tidis.RawSetDataKey(dbId, key, nil)
+	next, kvs, err := tidis.scanDataKeys(startKey, txn, ss, cursor, count, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	members := make([]interface{}, 0, len(kvs)/2)
+	for i := 0; i < len(kvs)-1; i += 2 {
+		members = append(members, kvs[i])
+	}
+	return next, members, nil
+}
+
 func (tidis *Tidis) skeyExists(dbId uint8, metaKey []byte, ss, txn interface{}) (bool, error) {
 	metaObj, _, err := tidis.SetMetaObj(dbId, txn, ss, metaKey)
 	if err != nil {
@@ -685,6 +732,10 @@ func (tidis *Tidis) SopsStoreWithTxn(dbId uint8, txn interface{}, opType int, de
 				return uint64(0), err
 			}
 		} else {
+			// dest may be purging after async deletion
+			if err = tidis.checkKeyBusy(dbId, txn, dest); err != nil {
+				return uint64(0), err
+			}
 			destMetaObj = tidis.newSetMetaObj()
 		}
 		if opSet == nil || opSet.Cardinality() == 0 {
@@ -218,6 +218,12 @@ func (tidis *Tidis) SetWithParam(dbId uint8, txn interface{}, key, value []byte,
 			return false, err
 		}
 
+		// index previous ttl of the key is left and dropped by ttl checker
+		err = tidis.updateTTLIndex(dbId, txn, key, 0, obj.ExpireAt)
+		if err != nil {
+			return false, err
+		}
+
 		return true, nil
 	}
 
@@ -255,24 +261,11 @@ func (tidis *Tidis) SetexWithTxn(dbId uint8, txn interface{}, key []byte, sec in
 		return terror.ErrKeyEmpty
 	}
 
-	obj := StringObj{
-		Object: Object{
-			Type:     TSTRING,
-			Tomb:     0,
-			ExpireAt: utils.Now() + uint64(sec)*1000,
-		},
-		Value: value,
-	}
-	value = MarshalStringObj(&obj)
-	f := func(txn interface{}) (interface{}, error) {
-		err := tidis.Set(dbId, txn, key, value)
-		if err != nil {
-			return nil, err
-		}
-		return nil, nil
+	if sec <= 0 {
+		return terror.ErrCmdParams
 	}
 
-	_, err := tidis.db.BatchWithTxn(f, txn)
+	_, err := tidis.SetWithParam(dbId, txn, key, value, uint64(sec)*1000, false, false)
 
 	return err
 }
@@ -304,8 +297,17 @@ func (tidis *Tidis) MSet(dbId uint8, txn interface{}, keyvals [][]byte) (int, er
 
 // Delete is a generic api for all type keys
 func (tidis *Tidis) Delete(dbId uint8, txn interface{}, keys [][]byte) (int, error) {
+	deleted, err := tidis.DeleteKeys(dbId, txn, keys)
+	if err != nil {
+		return 0, err
+	}
+	return len(deleted), nil
+}
+
+// DeleteKeys deletes keys and returns the keys existed
+func (tidis *Tidis) DeleteKeys(dbId uint8, txn interface{}, keys [][]byte) ([][]byte, error) {
 	if len(keys) == 0 {
-		return 0, terror.ErrKeyEmpty
+		return nil, terror.ErrKeyEmpty
 	}
 
 	nkeys := make([][]byte, len(keys))
@@ -314,54 +316,70 @@ func (tidis *Tidis) Delete(dbId uint8, txn interface{}, keys [][]byte) (int, err
 	}
 
 	var (
-		ret interface{}
-		err error
-
+		ret       interface{}
+		err       error
+		asyncDels []AsyncDelItem
 	)
 
 	// check object type
 	f := func(txn interface{}) (interface{}, error) {
-		var deleted int = 0
+		var deleted [][]byte
+		asyncDels = nil
 		for idx, key := range nkeys {
 			metaValue, err := tidis.db.GetWithTxn(key, txn)
 			if err != nil {
-				return 0, err
+				return nil, err
 			}
 			if metaValue == nil {
-				return 0, nil
+				continue
 			}
 			objType := metaValue[0]
+			if objType != TSTRING {
+				// big collection is marked deleted and purged in background
+				async, keyType, err := tidis.asyncDelWithTxn(dbId, txn, keys[idx])
+				if err != nil {
+					return nil, err
+				}
+				if async {
+					asyncDels = append(asyncDels, AsyncDelItem{dbId: dbId, keyType: keyType, ukey: keys[idx]})
+					deleted = append(deleted, keys[idx])
+					continue
+				}
+			}
 			switch objType {
 			case TSTRING:
-				ret, err = tidis.db.DeleteWithTxn([][]byte{key}, txn)
-				deleted++
+				_, err = tidis.db.DeleteWithTxn([][]byte{key}, txn)
+				deleted = append(deleted, keys[idx])
 			case THASHMETA:
 				var hasDeleted uint8
 				hasDeleted, err = tidis.HclearWithTxn(dbId, txn, keys[idx])
 				if hasDeleted == 1 {
-					deleted++
+					deleted = append(deleted, keys[idx])
 				}
 			case TLISTMETA:
 				var deleteCount int
 				deleteCount, err = tidis.LdelWithTxn(dbId, txn, keys[idx])
 				if deleteCount > 0 {
-					deleted++
+					deleted = append(deleted, keys[idx])
 				}
 			case TSETMETA:
 				var deleteCount int
 				deleteCount, err = tidis.SclearKeyWithTxn(dbId, txn, keys[idx])
 				if deleteCount > 0 {
-					deleted++
+					deleted = append(deleted, keys[idx])
 				}
 			case TZSETMETA:
 				var deleteCount uint64
-				deleteCount, err = tidis.ZremrangebyscoreWithTxn(dbId, txn, keys[idx], ScoreMin, ScoreMax)
+				deleteCount, err = tidis.ZremrangebyscoreWithTxn(dbId, txn, keys[idx], ScoreRangeMin, ScoreRangeMax)
 				if deleteCount > 0 {
-					deleted++
+					deleted = append(deleted, keys[idx])
 				}
 			}
+			if err != nil {
+				return nil, err
+			}
 		}
-		return deleted, err
+		return deleted, nil
 	}
 
 	if txn == nil {
@@ -370,10 +388,20 @@ func (tidis *Tidis) Delete(dbId uint8, txn interface{}, keys [][]byte) (int, err
 		ret, err = tidis.db.BatchWithTxn(f, txn)
 	}
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return ret.(int), nil
+	// queued deletion checks the persisted record, which is invisible until
+	// the outer txn committed, so it is queued by the owner after commit
+	if txn == nil {
+		for _, item := range asyncDels {
+			tidis.AsyncDelAdd(item.dbId, item.keyType, item.ukey)
+		}
+	} else {
+		tidis.asyncDelAfterCommit(txn, asyncDels)
+	}
+
+	return ret.([][]byte), nil
 }
 
 func (tidis *Tidis) Incr(dbId uint8, key []byte, step int64) (int64, error) {
@@ -492,7 +520,7 @@ func (tidis *Tidis) PExpireAt(dbId uint8, key []byte, ts int64) (int, error) {
 		return tidis.PExpireAtWithTxn(dbId, txn, key, ts)
 	}
 
-	// execute txn
+	// execute txn, expired key may be deleted in it
 	v, err := tidis.db.BatchInTxn(f)
 	if err != nil {
 		return 0, err
@@ -533,6 +561,7 @@ func (tidis *Tidis) PExpireAtWithTxn(dbId uint8, txn interface{}, key []byte, ts
 		}
 
 		// update expireAt
+		oldTs := obj.GetExpireAt()
 		obj.SetExpireAt(uint64(ts))
 		metaValue := MarshalObj(obj)
 
@@ -540,6 +569,11 @@ func (tidis *Tidis) PExpireAtWithTxn(dbId uint8, txn interface{}, key []byte, ts
 		if err != nil {
 			return 0, err
 		}
+
+		err = tidis.updateTTLIndex(dbId, txn, key, oldTs, uint64(ts))
+		if err != nil {
+			return 0, err
+		}
 		return 1, nil
 	}
 
@@ -618,23 +652,29 @@ func (tidis *Tidis) Type(dbId uint8, txn interface{}, key []byte) (string, error
 		return "", terror.ErrKeyEmpty
 	}
 
-	t, _, err := tidis.GetObject(dbId, txn, key)
+	t, obj, err := tidis.GetObject(dbId, txn, key)
 	if err != nil {
 		return "", err
 	}
+	if obj == nil || obj.ObjectExpired(utils.Now()) {
+		return "none", nil
+	}
+	return TypeName(t), nil
+}
+
+func TypeName(t byte) string {
 	switch t {
 	case TSTRING:
-		return "string", nil
+		return "string"
 	case TLISTMETA:
-		return "list", nil
+		return "list"
 	case TZSETMETA:
-		return "zset", nil
+		return "zset"
 	case TSETMETA:
-		return "set", nil
+		return "set"
 	case THASHMETA:
-		return "hash", nil
+		return "hash"
 	default:
-		return "unknown", nil
+		return "unknown"
 	}
-
 }
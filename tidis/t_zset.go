@@ -13,22 +13,57 @@ import (
 	"github.com/yongman/go/util"
 	"github.com/yongman/tidis/terror"
 	"github.com/yongman/tidis/utils"
+	"bytes"
 	"math"
+	"sort"
 	"strconv"
 )
 
 var (
+	// score range of zsets with int64 scores
 	ScoreMin int64 = math.MinInt64 + 2
 	ScoreMax int64 = math.MaxInt64 - 1
+
+	// score range of all members
+	ScoreRangeMin = ScoreBound{Score: math.Inf(-1)}
+	ScoreRangeMax = ScoreBound{Score: math.Inf(1)}
+)
+
+const (
+	// zsets created by old versions keep int64 scores until a non-integer
+	// score is added, then they are converted to float64 scores
+	ZScoreInt byte = iota
+	ZScoreFloat
+	// members up to the converted one have float64 scores, the others int64
+	ZScoreConverting
 )
 
+// members converted in one txn, bigger zsets are converted in batches
+const zsetConvertBatch = 1024
+
 type ZSetObj struct {
 	Object
-	Size uint64
+	Size      uint64
+	ScoreType byte
+	// last converted member of converting zset
+	Converted []byte
+	// zset created while old data keys of the key are purging has a version
+	// in its data keys and score keys
+	Version uint64
 }
 
 func MarshalZSetObj(obj *ZSetObj) []byte {
 	totalLen := 1 + 8 + 1 + 8
+	if obj.ScoreType != ZScoreInt {
+		// int64 score zset keeps the old meta format
+		totalLen++
+	}
+	if obj.ScoreType == ZScoreConverting {
+		totalLen += len(obj.Converted)
+	}
+	if obj.ScoreType == ZScoreFloat && obj.Version != 0 {
+		totalLen += 8
+	}
 	raw := make([]byte, totalLen)
 
 	idx := 0
@@ -39,12 +74,23 @@ func MarshalZSetObj(obj *ZSetObj) []byte {
 	raw[idx] = obj.Tomb
 	idx++
 	_ = util.Uint64ToBytes1(raw[idx:], obj.Size)
+	idx += 8
+	if obj.ScoreType != ZScoreInt {
+		raw[idx] = obj.ScoreType
+		idx++
+	}
+	if obj.ScoreType == ZScoreConverting {
+		copy(raw[idx:], obj.Converted)
+	}
+	if obj.ScoreType == ZScoreFloat && obj.Version != 0 {
+		_ = util.Uint64ToBytes1(raw[idx:], obj.Version)
+	}
 
 	return raw
 }
 
 func UnmarshalZSetObj(raw []byte) (*ZSetObj, error) {
-	if len(raw) != 18 {
+	if len(raw) < 18 {
 		return nil, nil
 	}
 	obj := ZSetObj{}
@@ -59,9 +105,64 @@ func UnmarshalZSetObj(raw []byte) (*ZSetObj, error) {
 	obj.Tomb = raw[idx]
 	idx++
 	obj.Size, _ = util.BytesToUint64(raw[idx:])
+	idx += 8
+	if len(raw) > idx {
+		obj.ScoreType = raw[idx]
+		idx++
+	}
+	if obj.ScoreType == ZScoreConverting {
+		obj.Converted = raw[idx:]
+	}
+	if obj.ScoreType == ZScoreFloat && len(raw) >= idx+8 {
+		obj.Version, _ = util.BytesToUint64(raw[idx:])
+	}
 	return &obj, nil
 }
 
+// EncodeScore encodes score for score key, the order of scores is preserved
+func (obj *ZSetObj) EncodeScore(score float64) uint64 {
+	if obj.ScoreType == ZScoreInt {
+		return ZScoreOffset(int64(score))
+	}
+	return ZScoreFloatEncode(score)
+}
+
+func (obj *ZSetObj) DecodeScore(rscore uint64) float64 {
+	if obj.ScoreType == ZScoreInt {
+		return float64(ZScoreRestore(rscore))
+	}
+	return ZScoreFloatDecode(rscore)
+}
+
+// MarshalScore encodes score for the value of data key
+func (obj *ZSetObj) MarshalScore(score float64) []byte {
+	var raw []byte
+	if obj.ScoreType == ZScoreInt {
+		raw, _ = util.Int64ToBytes(int64(score))
+	} else {
+		raw, _ = util.Uint64ToBytes(ZScoreFloatEncode(score))
+	}
+	return raw
+}
+
+func (obj *ZSetObj) UnmarshalScore(raw []byte) float64 {
+	if obj.ScoreType == ZScoreInt {
+		score, _ := util.BytesToInt64(raw)
+		return float64(score)
+	}
+	rscore, _ := util.BytesToUint64(raw)
+	return ZScoreFloatDecode(rscore)
+}
+
+// ScoreAccepted checks whether score can be stored without conversion
+func (obj *ZSetObj) ScoreAccepted(score float64) bool {
+	if obj.ScoreType != ZScoreInt {
+		return true
+	}
+	// integers beyond 2^53 lose precision in float64
+	return score == math.Trunc(score) && math.Abs(score) <= 1<<53
+}
+
 func (tidis *Tidis) ZSetMetaObj(dbId uint8, txn, ss interface{}, key []byte) (*ZSetObj, bool, error) {
 	return tidis.ZSetMetaObjWithExpire(dbId, txn, ss, key, true)
 }
@@ -84,18 +185,35 @@ func (tidis *Tidis) ZSetMetaObjWithExpire(dbId uint8, txn, ss interface{}, key [
 	if err != nil {
 		return nil, false, err
 	}
-	if v == nil {
+	if v == nil || (len(v) > 9 && v[9] == FDELETED) {
+		// tombstone of any type is purging, treat as not exists
 		return nil, false, nil
 	}
 	obj, err := UnmarshalZSetObj(v)
 	if err != nil {
 		return nil, false, err
 	}
+	if obj.IsDeleted() {
+		// data keys are purging in background, treat as not exists
+		return nil, false, nil
+	}
+	if obj.ScoreType == ZScoreConverting {
+		// conversion is running or interrupted, finish it before access
+		if err = tidis.zsetConvert(dbId, key); err != nil {
+			return nil, false, err
+		}
+		if txn != nil || ss != nil {
+			// converted scores are invisible to txn or snapshot, run the
+			// command again in a new one
+			return nil, false, terror.ErrTryAgain
+		}
+		return tidis.ZSetMetaObjWithExpire(dbId, txn, ss, key, checkExpire)
+	}
 	if checkExpire && obj.ObjectExpired(utils.Now()) {
 		if txn == nil {
-			tidis.Zremrangebyscore(dbId, key, ScoreMin, ScoreMax)
+			tidis.Zremrangebyscore(dbId, key, ScoreRangeMin, ScoreRangeMax)
 		} else {
-			tidis.ZremrangebyscoreWithTxn(dbId, txn, key, ScoreMin, ScoreMax)
+			tidis.ZremrangebyscoreWithTxn(dbId, txn, key, ScoreRangeMin, ScoreRangeMax)
 		}
 
 		return nil, true, nil
@@ -103,6 +221,36 @@ func (tidis *Tidis) ZSetMetaObjWithExpire(dbId uint8, txn, ss interface{}, key [
 	return obj, false, nil
 }
 
+// zsetSnapshot returns the newest snapshot to read zsets of keys, converting
+// zsets are converted first, so their scores can be read in it
+func (tidis *Tidis) zsetSnapshot(dbId uint8, keys ...[]byte) (interface{}, error) {
+	for {
+		ss, err := tidis.db.GetNewestSnapshot()
+		if err != nil {
+			return nil, err
+		}
+		converted := false
+		for _, key := range keys {
+			v, err := tidis.db.GetWithSnapshot(tidis.RawKeyPrefix(dbId, key), ss)
+			if err != nil {
+				return nil, err
+			}
+			// other types are reported by reads
+			obj, err := UnmarshalZSetObj(v)
+			if err != nil || obj == nil || obj.IsDeleted() || obj.ScoreType != ZScoreConverting {
+				continue
+			}
+			if err = tidis.zsetConvert(dbId, key); err != nil {
+				return nil, err
+			}
+			converted = true
+		}
+		if !converted {
+			return ss, nil
+		}
+	}
+}
+
 func (tidis *Tidis) newZSetMetaObj() *ZSetObj {
 	return &ZSetObj{
 		Object: Object{
@@ -110,35 +258,218 @@ func (tidis *Tidis) newZSetMetaObj() *ZSetObj {
 			Type:     TZSETMETA,
 			Tomb:     0,
 		},
-		Size: 0,
+		Size:      0,
+		ScoreType: ZScoreFloat,
 	}
 }
 
-func (tidis *Tidis) RawZSetDataKey(dbId uint8, key, member []byte) []byte {
-	keyPrefix := tidis.RawKeyPrefix(dbId, key)
-	dataKey := append(keyPrefix, DataTypeKey)
+// newZSetMetaObjWithTxn returns meta of a new zset on key, it gets a version
+// if data keys of key are purging, so they are not mixed with the new ones
+func (tidis *Tidis) newZSetMetaObjWithTxn(dbId uint8, txn1 interface{}, key []byte) (*ZSetObj, error) {
+	txn, ok := txn1.(kv.Transaction)
+	if !ok {
+		return nil, terror.ErrBackendType
+	}
+	v, err := tidis.db.GetWithTxn(tidis.RawAsyncDelKey(dbId, key), txn)
+	if err != nil {
+		return nil, err
+	}
+
+	metaObj := tidis.newZSetMetaObj()
+	if v == nil {
+		return metaObj, nil
+	}
+	// versions of purging zsets are not reused
+	metaObj.Version = txn.StartTS()
+	for _, e := range unmarshalAsyncDel(v) {
+		if e.ver >= metaObj.Version {
+			metaObj.Version = e.ver + 1
+		}
+	}
+	return metaObj, nil
+}
+
+func (tidis *Tidis) RawZSetDataKey(dbId uint8, key []byte, ver uint64, member []byte) []byte {
+	dataKey := tidis.rawZSetDataPrefix(dbId, key, ver)
 	dataKey = append(dataKey, member...)
 	return dataKey
 }
 
-func (tidis *Tidis) RawZSetScoreKey(dbId uint8, key, member []byte, score int64) []byte {
+func (tidis *Tidis) rawZSetDataPrefix(dbId uint8, key []byte, ver uint64) []byte {
 	keyPrefix := tidis.RawKeyPrefix(dbId, key)
-	scoreKey := append(keyPrefix, ScoreTypeKey)
-	scoreBytes, _ := util.Uint64ToBytes(ZScoreOffset(score))
+	if ver == 0 {
+		return append(keyPrefix, DataTypeKey)
+	}
+	verBytes, _ := util.Uint64ToBytes(ver)
+	return append(append(keyPrefix, VersionDataTypeKey), verBytes...)
+}
+
+// rscore is the score encoded by ZSetObj.EncodeScore
+func (tidis *Tidis) RawZSetScoreKey(dbId uint8, key []byte, ver uint64, member []byte, rscore uint64) []byte {
+	scoreKey := tidis.rawZSetScorePrefix(dbId, key, ver)
+	scoreBytes, _ := util.Uint64ToBytes(rscore)
 	scoreKey = append(scoreKey, scoreBytes...)
 	scoreKey = append(scoreKey, member...)
 	return scoreKey
 }
 
+func (tidis *Tidis) rawZSetScorePrefix(dbId uint8, key []byte, ver uint64) []byte {
+	keyPrefix := tidis.RawKeyPrefix(dbId, key)
+	if ver == 0 {
+		return append(keyPrefix, ScoreTypeKey)
+	}
+	verBytes, _ := util.Uint64ToBytes(ver)
+	return append(append(keyPrefix, VersionScoreTypeKey), verBytes...)
+}
+
+// scoreRangeKeys returns the score key range [start, end) of members with score
+// in range min and max, empty is true if no score is in the range
+func (tidis *Tidis) scoreRangeKeys(dbId uint8, key []byte, obj *ZSetObj, min, max ScoreBound) ([]byte, []byte, bool) {
+	prefix := tidis.rawZSetScorePrefix(dbId, key, obj.Version)
+	rawKey := func(rscore uint64) []byte {
+		b, _ := util.Uint64ToBytes(rscore)
+		return append(append([]byte{}, prefix...), b...)
+	}
+
+	if obj.ScoreType == ZScoreInt {
+		// convert to inclusive int64 range
+		lo, hi := math.Ceil(min.Score), math.Floor(max.Score)
+		if min.Exclusive && lo == min.Score {
+			lo++
+		}
+		if max.Exclusive && hi == max.Score {
+			hi--
+		}
+		if lo > hi || lo > float64(ScoreMax) || hi < float64(ScoreMin) {
+			return nil, nil, true
+		}
+		// clamp in int64, bounds of int64 are not exact in float64
+		loInt, hiInt := ScoreMin, ScoreMax
+		if lo > float64(ScoreMin) {
+			loInt = int64(lo)
+		}
+		if hi < float64(ScoreMax) {
+			hiInt = int64(hi)
+		}
+		return rawKey(ZScoreOffset(loInt)), kv.Key(rawKey(ZScoreOffset(hiInt))).PrefixNext(), false
+	}
+
+	if min.Score > max.Score || (min.Score == max.Score && (min.Exclusive || max.Exclusive)) {
+		return nil, nil, true
+	}
+	start := rawKey(ZScoreFloatEncode(min.Score))
+	if min.Exclusive {
+		start = kv.Key(start).PrefixNext()
+	}
+	end := rawKey(ZScoreFloatEncode(max.Score))
+	if !max.Exclusive {
+		end = kv.Key(end).PrefixNext()
+	}
+	return start, end, false
+}
+
 type MemberPair struct {
-	Score  int64
+	Score  float64
 	Member []byte
 }
 
+// one side of score range, exclusive if prefixed by '('
+type ScoreBound struct {
+	Score     float64
+	Exclusive bool
+}
+
+// ParseScore parses float score, inf and -inf are accepted
+func ParseScore(b []byte) (float64, error) {
+	score, err := strconv.ParseFloat(string(b), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, terror.ErrNotFloat
+	}
+	return score, nil
+}
+
+func ParseScoreBound(b []byte) (ScoreBound, error) {
+	var bound ScoreBound
+	if len(b) > 0 && b[0] == '(' {
+		bound.Exclusive = true
+		b = b[1:]
+	}
+	score, err := ParseScore(b)
+	if err != nil {
+		return bound, terror.ErrMinMaxNotFloat
+	}
+	bound.Score = score
+	return bound, nil
+}
+
+// FormatScore formats score as redis does, integers have no decimal point
+func FormatScore(score float64) []byte {
+	switch {
+	case math.IsInf(score, 1):
+		return []byte("inf")
+	case math.IsInf(score, -1):
+		return []byte("-inf")
+	case score == math.Trunc(score) && math.Abs(score) < 1e17:
+		return strconv.AppendInt(nil, int64(score), 10)
+	case math.Abs(score) >= 1e-4 && math.Abs(score) < 1e17:
+		return strconv.AppendFloat(nil, score, 'f', -1, 64)
+	}
+	return strconv.AppendFloat(nil, score, 'g', -1, 64)
+}
+
+// options of zadd, nil params means no option
+type ZaddParams struct {
+	NX   bool // only add new members
+	XX   bool // only update existing members
+	GT   bool // only update when new score is greater
+	LT   bool // only update when new score is less
+	CH   bool // count changed members besides added
+	Incr bool // increase score like zincrby
+}
+
+func (p *ZaddParams) Validate(pairs int) error {
+	if p == nil {
+		return nil
+	}
+	if p.NX && p.XX {
+		return terror.ErrZaddNXAndXX
+	}
+	if (p.GT && p.LT) || (p.NX && (p.GT || p.LT)) {
+		return terror.ErrZaddGTLTNX
+	}
+	if p.Incr && pairs != 1 {
+		return terror.ErrZaddIncrPair
+	}
+	return nil
+}
+
+// allowed checks whether member can be set to score, exists and old are the
+// current state of member
+func (p *ZaddParams) allowed(exists bool, old, score float64) bool {
+	if p == nil {
+		return true
+	}
+	if !exists {
+		return !p.XX
+	}
+	if p.NX || (p.GT && score <= old) || (p.LT && score >= old) {
+		return false
+	}
+	return true
+}
+
 func (tidis *Tidis) Zadd(dbId uint8, key []byte, mps ...*MemberPair) (int, error) {
+	return tidis.ZaddWithParam(dbId, key, nil, mps...)
+}
+
+func (tidis *Tidis) ZaddWithTxn(dbId uint8, txn interface{}, key []byte, mps ...*MemberPair) (int, error) {
+	return tidis.ZaddWithParamWithTxn(dbId, txn, key, nil, mps...)
+}
+
+func (tidis *Tidis) ZaddWithParam(dbId uint8, key []byte, params *ZaddParams, mps ...*MemberPair) (int, error) {
 	// txn func
 	f := func(txn interface{}) (interface{}, error) {
-		return tidis.ZaddWithTxn(dbId, txn, key, mps...)
+		return tidis.ZaddWithParamWithTxn(dbId, txn, key, params, mps...)
 	}
 
 	// execute txn
@@ -146,21 +477,38 @@ func (tidis *Tidis) Zadd(dbId uint8, key []byte, mps ...*MemberPair) (int, error
 	if err != nil {
 		return 0, err
 	}
+	tidis.SignalKeyReady(dbId, key)
 
 	return v.(int), nil
 }
 
-func (tidis *Tidis) ZaddWithTxn(dbId uint8, txn interface{}, key []byte, mps ...*MemberPair) (int, error) {
+// ZaddWithParamWithTxn adds members under params, returns count of added members,
+// changed members are counted too with CH option. INCR option is handled by
+// ZincrbyWithParamWithTxn.
+func (tidis *Tidis) ZaddWithParamWithTxn(dbId uint8, txn interface{}, key []byte, params *ZaddParams, mps ...*MemberPair) (int, error) {
 	if len(key) == 0 {
 		return 0, terror.ErrKeyEmpty
 	}
+	if err := params.Validate(len(mps)); err != nil {
+		return 0, err
+	}
+	if params != nil && params.Incr {
+		return 0, terror.ErrCmdParams
+	}
 
 	metaObj, _, err := tidis.ZSetMetaObj(dbId, txn, nil, key)
 	if err != nil {
 		return 0, err
 	}
 	if metaObj == nil {
-		metaObj = tidis.newZSetMetaObj()
+		if params != nil && params.XX {
+			// no member can be updated
+			return 0, nil
+		}
+		metaObj, err = tidis.newZSetMetaObjWithTxn(dbId, txn, key)
+		if err != nil {
+			return 0, err
+		}
 	}
 
 	// txn func
@@ -171,40 +519,57 @@ func (tidis *Tidis) ZaddWithTxn(dbId uint8, txn interface{}, key []byte, mps ...
 		}
 
 		var (
-			added int
+			added   int
+			changed int
 		)
 
-		// add data key and score key for each member pair
 		for _, mp := range mps {
-			eDataKey := tidis.RawZSetDataKey(dbId, key, mp.Member)
-			eScoreKey := tidis.RawZSetScoreKey(dbId, key, mp.Member, mp.Score)
-			score, err := util.Int64ToBytes(mp.Score)
-			if err != nil {
-				return nil, err
+			if math.IsNaN(mp.Score) {
+				return nil, terror.ErrNotFloat
+			}
+			if !metaObj.ScoreAccepted(mp.Score) {
+				err := tidis.zsetConvertWithTxn(dbId, txn, key, metaObj)
+				if err != nil {
+					return nil, err
+				}
 			}
+		}
+
+		// add data key and score key for each member pair
+		for _, mp := range mps {
+			eDataKey := tidis.RawZSetDataKey(dbId, key, metaObj.Version, mp.Member)
+			eScoreKey := tidis.RawZSetScoreKey(dbId, key, metaObj.Version, mp.Member, metaObj.EncodeScore(mp.Score))
 
 			v, err := tidis.db.GetWithTxn(eDataKey, txn)
 			if err != nil {
 				return nil, err
 			}
+			var oldScore float64
+			if v != nil {
+				oldScore = metaObj.UnmarshalScore(v)
+			}
+			if !params.allowed(v != nil, oldScore, mp.Score) {
+				continue
+			}
+
 			if v == nil {
 				// member not exists
 				metaObj.Size++
 				added++
 			} else {
-				// delete old score item
-				oldScore, err := util.BytesToInt64(v)
-				if err != nil {
-					return nil, err
+				if oldScore == mp.Score {
+					continue
 				}
-				oldScoreKey := tidis.RawZSetScoreKey(dbId, key, mp.Member, oldScore)
+				changed++
+				// delete old score item
+				oldScoreKey := tidis.RawZSetScoreKey(dbId, key, metaObj.Version, mp.Member, metaObj.EncodeScore(oldScore))
 				err = txn.Delete(oldScoreKey)
 				if err != nil {
 					return nil, err
 				}
 			}
 
-			err = txn.Set(eDataKey, score)
+			err = txn.Set(eDataKey, metaObj.MarshalScore(mp.Score))
 			if err != nil {
 				return nil, err
 			}
@@ -214,6 +579,10 @@ func (tidis *Tidis) ZaddWithTxn(dbId uint8, txn interface{}, key []byte, mps ...
 				return nil, err
 			}
 		}
+		if metaObj.Size == 0 {
+			// nothing added to new zset
+			return 0, nil
+		}
 		// update meta key
 		eMetaKey := tidis.RawKeyPrefix(dbId, key)
 		eMetaValue := MarshalZSetObj(metaObj)
@@ -221,6 +590,9 @@ func (tidis *Tidis) ZaddWithTxn(dbId uint8, txn interface{}, key []byte, mps ...
 		if err != nil {
 			return nil, err
 		}
+		if params != nil && params.CH {
+			return added + changed, nil
+		}
 		return added, nil
 	}
 
@@ -233,6 +605,123 @@ func (tidis *Tidis) ZaddWithTxn(dbId uint8, txn interface{}, key []byte, mps ...
 	return v.(int), nil
 }
 
+// zsetConvertWithTxn converts zset with int64 scores to float64 scores, all
+// data keys and score keys are rewritten in txn. zsets too big for one txn are
+// converted by zsetConvert, and ErrTryAgain is returned to run the command in
+// a new txn.
+func (tidis *Tidis) zsetConvertWithTxn(dbId uint8, txn1 interface{}, key []byte, metaObj *ZSetObj) error {
+	if metaObj.ScoreType == ZScoreFloat {
+		return nil
+	}
+	if metaObj.Size > zsetConvertBatch {
+		if err := tidis.zsetConvert(dbId, key); err != nil {
+			return err
+		}
+		return terror.ErrTryAgain
+	}
+	txn, ok := txn1.(kv.Transaction)
+	if !ok {
+		return terror.ErrBackendType
+	}
+
+	if metaObj.Size > 0 {
+		if _, err := tidis.zsetConvertMembersWithTxn(dbId, txn, key, nil, metaObj.Size); err != nil {
+			return err
+		}
+	}
+
+	metaObj.ScoreType = ZScoreFloat
+	return txn.Set(tidis.RawKeyPrefix(dbId, key), MarshalZSetObj(metaObj))
+}
+
+// zsetConvertMembersWithTxn converts scores of at most limit members after
+// member last, the last converted member is returned
+func (tidis *Tidis) zsetConvertMembersWithTxn(dbId uint8, txn kv.Transaction, key, last []byte, limit uint64) ([]byte, error) {
+	intObj := &ZSetObj{ScoreType: ZScoreInt}
+	floatObj := &ZSetObj{ScoreType: ZScoreFloat}
+
+	// zsets of old versions are not versioned
+	dataPrefix := tidis.rawZSetDataPrefix(dbId, key, 0)
+	startKey := dataPrefix
+	if last != nil {
+		startKey = kv.Key(tidis.RawZSetDataKey(dbId, key, 0, last)).Next()
+	}
+	endKey := kv.Key(dataPrefix).PrefixNext()
+
+	kvs, err := tidis.db.GetRangeKeysValsWithTxn(startKey, endKey, limit, txn)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(kvs)-1; i += 2 {
+		last = kvs[i][len(dataPrefix):]
+		score := intObj.UnmarshalScore(kvs[i+1])
+
+		err = txn.Delete(tidis.RawZSetScoreKey(dbId, key, 0, last, intObj.EncodeScore(score)))
+		if err != nil {
+			return nil, err
+		}
+		err = txn.Set(tidis.RawZSetScoreKey(dbId, key, 0, last, floatObj.EncodeScore(score)), []byte{0})
+		if err != nil {
+			return nil, err
+		}
+		err = txn.Set(kvs[i], floatObj.MarshalScore(score))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if uint64(len(kvs)) < limit*2 {
+		// all members converted
+		return nil, nil
+	}
+	return last, nil
+}
+
+// zsetConvert converts zset with int64 scores to float64 scores in batches,
+// each batch is committed in its own txn with the last converted member saved
+// in meta, so an interrupted conversion is resumed by the next access
+func (tidis *Tidis) zsetConvert(dbId uint8, key []byte) error {
+	f := func(txn1 interface{}) (interface{}, error) {
+		txn, ok := txn1.(kv.Transaction)
+		if !ok {
+			return false, terror.ErrBackendType
+		}
+
+		eMetaKey := tidis.RawKeyPrefix(dbId, key)
+		v, err := tidis.db.GetWithTxn(eMetaKey, txn)
+		if err != nil {
+			return false, err
+		}
+		metaObj, err := UnmarshalZSetObj(v)
+		if err != nil {
+			return false, err
+		}
+		if metaObj == nil || metaObj.IsDeleted() || metaObj.ScoreType == ZScoreFloat {
+			// deleted or converted by others
+			return true, nil
+		}
+
+		last, err := tidis.zsetConvertMembersWithTxn(dbId, txn, key, metaObj.Converted, zsetConvertBatch)
+		if err != nil {
+			return false, err
+		}
+		metaObj.ScoreType, metaObj.Converted = ZScoreConverting, last
+		if last == nil {
+			metaObj.ScoreType = ZScoreFloat
+		}
+		return last == nil, txn.Set(eMetaKey, MarshalZSetObj(metaObj))
+	}
+
+	for {
+		done, err := tidis.db.BatchInTxn(f)
+		if err != nil {
+			return err
+		}
+		if done.(bool) {
+			return nil
+		}
+	}
+}
+
 func (tidis *Tidis) Zcard(dbId uint8, txn interface{}, key []byte) (uint64, error) {
 	if len(key) == 0 {
 		return 0, terror.ErrKeyEmpty
@@ -250,13 +739,13 @@ func (tidis *Tidis) Zcard(dbId uint8, txn interface{}, key []byte) (uint64, erro
 }
 
 // zrange key [start stop] => zrange key offset count
-func (tidis *Tidis) zRangeParse(dbId uint8, key []byte, start, stop int64, ss, txn interface{}, reverse bool) (int64, int64, error) {
+func (tidis *Tidis) zRangeParse(dbId uint8, key []byte, start, stop int64, ss, txn interface{}, reverse bool) (*ZSetObj, int64, int64, error) {
 	metaObj, _, err := tidis.ZSetMetaObj(dbId, txn, ss, key)
 	if err != nil {
-		return 0, 0, err
+		return nil, 0, 0, err
 	}
 	if metaObj == nil {
-		return 0, 0, nil
+		return nil, 0, 0, nil
 	}
 
 	// convert zero based index
@@ -269,7 +758,7 @@ func (tidis *Tidis) zRangeParse(dbId uint8, key []byte, start, stop int64, ss, t
 		}
 	} else {
 		if start >= zz {
-			return 0, 0, nil
+			return metaObj, 0, 0, nil
 		}
 	}
 
@@ -285,11 +774,11 @@ func (tidis *Tidis) zRangeParse(dbId uint8, key []byte, start, stop int64, ss, t
 		}
 	}
 	if !reverse {
-		return start, stop - start + 1, nil
+		return metaObj, start, stop - start + 1, nil
 	}
 
 	start, stop = zz-stop-1, zz-start
-	return start, stop - start, nil
+	return metaObj, start, stop - start, nil
 }
 
 func (tidis *Tidis) Zrange(dbId uint8, txn interface{}, key []byte, start, stop int64, withscores bool, reverse bool) ([]interface{}, error) {
@@ -298,7 +787,7 @@ func (tidis *Tidis) Zrange(dbId uint8, txn interface{}, key []byte, start, stop
 	}
 
 	var (
-		s       int64
+		s       uint64
 		ss      interface{}
 		err     error
 		members [][]byte
@@ -310,16 +799,13 @@ func (tidis *Tidis) Zrange(dbId uint8, txn interface{}, key []byte, start, stop
 	}
 
 	if txn == nil {
-		ss, err = tidis.db.GetNewestSnapshot()
+		ss, err = tidis.zsetSnapshot(dbId, key)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	startKey := tidis.RawZSetScoreKey(dbId, key, []byte{0}, ScoreMin)
-	endKey := tidis.RawZSetScoreKey(dbId, key, []byte{0}, ScoreMax)
-
-	offset, count, err := tidis.zRangeParse(dbId, key, start, stop, ss, txn, reverse)
+	metaObj, offset, count, err := tidis.zRangeParse(dbId, key, start, stop, ss, txn, reverse)
 	if err != nil {
 		return nil, err
 	}
@@ -328,6 +814,9 @@ func (tidis *Tidis) Zrange(dbId uint8, txn interface{}, key []byte, start, stop
 		return EmptyListOrSet, nil
 	}
 
+	startKey := tidis.rawZSetScorePrefix(dbId, key, metaObj.Version)
+	endKey := kv.Key(startKey).PrefixNext()
+
 	// get all key range slice
 	if txn == nil {
 		members, err = tidis.db.GetRangeKeys(startKey, endKey, uint64(offset), uint64(count), ss)
@@ -359,12 +848,12 @@ func (tidis *Tidis) Zrange(dbId uint8, txn interface{}, key []byte, start, stop
 		if !reverse {
 			for i, idx := 0, 0; i < respLen; i, idx = i+2, idx+1 {
 				s, resp[i], _ = ZScoreDecoder(keyPrefixLen, members[idx])
-				resp[i+1] = []byte(strconv.FormatInt(s, 10))
+				resp[i+1] = FormatScore(metaObj.DecodeScore(s))
 			}
 		} else {
 			for i, idx := respLen-2, 0; i >= 0; i, idx = i-2, idx+1 {
 				s, resp[i], _ = ZScoreDecoder(keyPrefixLen, members[idx])
-				resp[i+1] = []byte(strconv.FormatInt(s, 10))
+				resp[i+1] = FormatScore(metaObj.DecodeScore(s))
 			}
 		}
 	}
@@ -373,24 +862,64 @@ func (tidis *Tidis) Zrange(dbId uint8, txn interface{}, key []byte, start, stop
 
 }
 
-func (tidis *Tidis) Zrangebyscore(dbId uint8, txn interface{}, key []byte, min, max int64, withscores bool, offset, count int, reverse bool) ([]interface{}, error) {
+// Zscan iterates count members of zset from cursor, returns the next cursor
+// and members with scores
+func (tidis *Tidis) Zscan(dbId uint8, txn interface{}, key, cursor []byte, count int, pattern []byte) ([]byte, []interface{}, error) {
+	if len(key) == 0 {
+		return nil, nil, terror.ErrKeyEmpty
+	}
+
+	var (
+		ss  interface{}
+		err error
+	)
+	if txn == nil {
+		ss, err = tidis.zsetSnapshot(dbId, key)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	metaObj, _, err := tidis.ZSetMetaObj(dbId, txn, ss, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if metaObj == nil {
+		return cursorStart, EmptyListOrSet, nil
+	}
+
+	startKey := tidis.rawZSetDataPrefix(dbId, key, metaObj.Version)
+	next, kvs, err := tidis.scanDataKeys(startKey, txn, ss, cursor, count, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp := make([]interface{}, len(kvs))
+	for i := 0; i < len(kvs)-1; i += 2 {
+		resp[i] = kvs[i]
+		resp[i+1] = FormatScore(metaObj.UnmarshalScore(kvs[i+1]))
+	}
+	return next, resp, nil
+}
+
+// min and max are swapped in reverse order as zrevrangebyscore
+func (tidis *Tidis) Zrangebyscore(dbId uint8, txn interface{}, key []byte, min, max ScoreBound, withscores bool, offset, count int, reverse bool) ([]interface{}, error) {
 	if len(key) == 0 {
 		return nil, terror.ErrKeyEmpty
 	}
-	if (!reverse && min > max) || (reverse && min < max) {
-		// empty range
-		return EmptyListOrSet, nil
+	if reverse {
+		min, max = max, min
 	}
 
 	var (
 		ss      interface{}
-		s       int64
+		s       uint64
 		members [][]byte
 		err     error
 	)
 
 	if txn == nil {
-		ss, err = tidis.db.GetNewestSnapshot()
+		ss, err = tidis.zsetSnapshot(dbId, key)
 		if err != nil {
 			return nil, err
 		}
@@ -404,20 +933,15 @@ func (tidis *Tidis) Zrangebyscore(dbId uint8, txn interface{}, key []byte, min,
 		return EmptyListOrSet, nil
 	}
 
-	var startKey, endKey []byte
-
-	if !reverse {
-		startKey = tidis.RawZSetScoreKey(dbId, key, []byte{0}, min)
-		endKey = tidis.RawZSetScoreKey(dbId, key, []byte{0}, max+1)
-	} else {
-		endKey = tidis.RawZSetScoreKey(dbId, key, []byte{0}, min+1)
-		startKey = tidis.RawZSetScoreKey(dbId, key, []byte{0}, max)
+	startKey, endKey, empty := tidis.scoreRangeKeys(dbId, key, metaObj, min, max)
+	if empty {
+		return EmptyListOrSet, nil
 	}
 
 	if txn == nil {
-		members, err = tidis.db.GetRangeKeys(startKey, endKey, 0, metaObj.Size, ss)
+		members, err = tidis.db.GetRangeKeysWithFrontier(startKey, true, endKey, false, 0, metaObj.Size, ss)
 	} else {
-		members, err = tidis.db.GetRangeKeysWithTxn(startKey, endKey, 0, metaObj.Size, txn)
+		members, err = tidis.db.GetRangeKeysWithFrontierWithTxn(startKey, true, endKey, false, 0, metaObj.Size, txn)
 	}
 	if err != nil {
 		return nil, err
@@ -465,12 +989,12 @@ func (tidis *Tidis) Zrangebyscore(dbId uint8, txn interface{}, key []byte, min,
 		if !reverse {
 			for i, idx := 0, 0; i < respLen; i, idx = i+2, idx+1 {
 				s, resp[i], _ = ZScoreDecoder(keyPrefixLen, members[idx])
-				resp[i+1] = []byte(strconv.FormatInt(s, 10))
+				resp[i+1] = FormatScore(metaObj.DecodeScore(s))
 			}
 		} else {
 			for i, idx := respLen-2, 0; i >= 0; i, idx = i-2, idx+1 {
 				s, resp[i], _ = ZScoreDecoder(keyPrefixLen, members[idx])
-				resp[i+1] = []byte(strconv.FormatInt(s, 10))
+				resp[i+1] = FormatScore(metaObj.DecodeScore(s))
 			}
 		}
 	}
@@ -520,7 +1044,7 @@ func (tidis *Tidis) Zrangebylex(dbId uint8, txn interface{}, key []byte, start,
 	)
 
 	if txn == nil {
-		ss, err = tidis.db.GetNewestSnapshot()
+		ss, err = tidis.zsetSnapshot(dbId, key)
 		if err != nil {
 			return nil, err
 		}
@@ -534,8 +1058,8 @@ func (tidis *Tidis) Zrangebylex(dbId uint8, txn interface{}, key []byte, start,
 		return EmptyListOrSet, nil
 	}
 
-	eStartKey, withStart = tidis.zlexParse(dbId, key, start)
-	eEndKey, withEnd = tidis.zlexParse(dbId, key, stop)
+	eStartKey, withStart = tidis.zlexParse(dbId, key, metaObj.Version, start)
+	eEndKey, withEnd = tidis.zlexParse(dbId, key, metaObj.Version, stop)
 
 	if offset > int(metaObj.Size)-1 {
 		return EmptyListOrSet, nil
@@ -563,24 +1087,21 @@ func (tidis *Tidis) Zrangebylex(dbId uint8, txn interface{}, key []byte, start,
 	}
 
 	resp := make([]interface{}, len(members))
-	keyPreFixLen := len(tidis.RawKeyPrefix(dbId, key))
+	dataPrefixLen := len(tidis.rawZSetDataPrefix(dbId, key, metaObj.Version))
 	if !reverse {
 		for i, member := range members {
-			resp[i] = member[keyPreFixLen+1:]
+			resp[i] = member[dataPrefixLen:]
 		}
 	} else {
 		for i, idx := 0, len(members)-1; idx >= 0; i, idx = i+1, idx-1 {
-			resp[i] = members[idx][keyPreFixLen+1:]
+			resp[i] = members[idx][dataPrefixLen:]
 		}
 	}
 
 	return resp, nil
 }
 
-func (tidis *Tidis) ZremrangebyscoreWithTxn(dbId uint8, txn1 interface{}, key []byte, min, max int64) (uint64, error) {
-	startKey := tidis.RawZSetScoreKey(dbId, key, []byte{0}, min)
-	endKey := tidis.RawZSetScoreKey(dbId, key, []byte{0}, max+1)
-
+func (tidis *Tidis) ZremrangebyscoreWithTxn(dbId uint8, txn1 interface{}, key []byte, min, max ScoreBound) (uint64, error) {
 	txn, ok := txn1.(kv.Transaction)
 	if !ok {
 		return 0, terror.ErrBackendType
@@ -592,7 +1113,7 @@ func (tidis *Tidis) ZremrangebyscoreWithTxn(dbId uint8, txn1 interface{}, key []
 		err error
 	)
 
-	if min == ScoreMin && max == ScoreMax {
+	if min == ScoreRangeMin && max == ScoreRangeMax {
 		metaObj, _, err = tidis.ZSetMetaObjWithExpire(dbId, txn, nil, key, false)
 	} else {
 		metaObj, _, err = tidis.ZSetMetaObj(dbId, txn, nil, key)
@@ -604,7 +1125,12 @@ func (tidis *Tidis) ZremrangebyscoreWithTxn(dbId uint8, txn1 interface{}, key []
 		return 0, nil
 	}
 
-	members, err := tidis.db.GetRangeKeysWithTxn(startKey, endKey, 0, metaObj.Size, txn)
+	startKey, endKey, empty := tidis.scoreRangeKeys(dbId, key, metaObj, min, max)
+	if empty {
+		return 0, nil
+	}
+
+	members, err := tidis.db.GetRangeKeysWithFrontierWithTxn(startKey, true, endKey, false, 0, metaObj.Size, txn)
 	if err != nil {
 		return 0, err
 	}
@@ -620,7 +1146,7 @@ func (tidis *Tidis) ZremrangebyscoreWithTxn(dbId uint8, txn1 interface{}, key []
 		}
 
 		// encode data key
-		eDataKey := tidis.RawZSetDataKey(dbId, key, mem)
+		eDataKey := tidis.RawZSetDataKey(dbId, key, metaObj.Version, mem)
 
 		err = txn.Delete(member)
 		if err != nil {
@@ -654,7 +1180,7 @@ func (tidis *Tidis) ZremrangebyscoreWithTxn(dbId uint8, txn1 interface{}, key []
 	return deleted, nil
 }
 
-func (tidis *Tidis) Zremrangebyscore(dbId uint8, key []byte, min, max int64) (uint64, error) {
+func (tidis *Tidis) Zremrangebyscore(dbId uint8, key []byte, min, max ScoreBound) (uint64, error) {
 	if len(key) == 0 {
 		return 0, terror.ErrKeyEmpty
 	}
@@ -710,8 +1236,8 @@ func (tidis *Tidis) ZremrangebylexWithTxn(dbId uint8, txn interface{}, key, star
 			withStart, withEnd bool
 		)
 
-		eStartKey, withStart = tidis.zlexParse(dbId, key, start)
-		eEndKey, withEnd = tidis.zlexParse(dbId, key, stop)
+		eStartKey, withStart = tidis.zlexParse(dbId, key, metaObj.Version, start)
+		eEndKey, withEnd = tidis.zlexParse(dbId, key, metaObj.Version, stop)
 
 		members, err := tidis.db.GetRangeKeysWithFrontierWithTxn(eStartKey, withStart, eEndKey, withEnd, 0, metaObj.Size, txn)
 		if err != nil {
@@ -725,17 +1251,17 @@ func (tidis *Tidis) ZremrangebylexWithTxn(dbId uint8, txn interface{}, key, star
 
 		eMetaKey := tidis.RawKeyPrefix(dbId, key)
 
-		keyPrefixLen := len(eMetaKey)
+		dataPrefixLen := len(tidis.rawZSetDataPrefix(dbId, key, metaObj.Version))
 		// delete all members in score and data
 		for _, member := range members {
-			mem := member[keyPrefixLen+1:]
+			mem := member[dataPrefixLen:]
 			// generate score key
 			scoreRaw, err := tidis.db.GetWithTxn(member, txn)
 			if err != nil {
 				return nil, err
 			}
-			score, _ := util.BytesToInt64(scoreRaw)
-			eScoreKey := tidis.RawZSetScoreKey(dbId, key, mem, score)
+			score := metaObj.UnmarshalScore(scoreRaw)
+			eScoreKey := tidis.RawZSetScoreKey(dbId, key, metaObj.Version, mem, metaObj.EncodeScore(score))
 
 			err = txn.Delete(member)
 			if err != nil {
@@ -777,7 +1303,7 @@ func (tidis *Tidis) ZremrangebylexWithTxn(dbId uint8, txn interface{}, key, star
 	return v.(uint64), nil
 }
 
-func (tidis *Tidis) Zcount(dbId uint8, txn interface{}, key []byte, min, max int64) (uint64, error) {
+func (tidis *Tidis) Zcount(dbId uint8, txn interface{}, key []byte, min, max ScoreBound) (uint64, error) {
 	if len(key) == 0 {
 		return 0, terror.ErrKeyEmpty
 	}
@@ -787,12 +1313,9 @@ func (tidis *Tidis) Zcount(dbId uint8, txn interface{}, key []byte, min, max int
 		err   error
 		ss    interface{}
 	)
-	if min > max {
-		return 0, nil
-	}
 
 	if txn == nil {
-		ss, err = tidis.db.GetNewestSnapshot()
+		ss, err = tidis.zsetSnapshot(dbId, key)
 		if err != nil {
 			return 0, err
 		}
@@ -806,19 +1329,21 @@ func (tidis *Tidis) Zcount(dbId uint8, txn interface{}, key []byte, min, max int
 		return 0, nil
 	}
 
-	startKey := tidis.RawZSetScoreKey(dbId, key, []byte{0}, min)
-	endKey := tidis.RawZSetScoreKey(dbId, key, []byte{0}, max+1)
+	startKey, endKey, empty := tidis.scoreRangeKeys(dbId, key, metaObj, min, max)
+	if empty {
+		return 0, nil
+	}
 
 	if txn == nil {
-		count, err = tidis.db.GetRangeKeysCount(startKey, true, endKey, true, metaObj.Size, ss)
+		count, err = tidis.db.GetRangeKeysCount(startKey, true, endKey, false, metaObj.Size, ss)
 	} else {
-		count, err = tidis.db.GetRangeKeysCountWithTxn(startKey, true, endKey, true, metaObj.Size, txn)
+		count, err = tidis.db.GetRangeKeysCountWithTxn(startKey, true, endKey, false, metaObj.Size, txn)
 	}
 
 	return count, err
 }
 
-func (tidis *Tidis) zlexParse(dbId uint8, key, lex []byte) ([]byte, bool) {
+func (tidis *Tidis) zlexParse(dbId uint8, key []byte, ver uint64, lex []byte) ([]byte, bool) {
 	if len(lex) == 0 {
 		return nil, false
 	}
@@ -840,7 +1365,7 @@ func (tidis *Tidis) zlexParse(dbId uint8, key, lex []byte) ([]byte, bool) {
 	default:
 		return nil, false
 	}
-	lexKey = tidis.RawZSetDataKey(dbId, key, m)
+	lexKey = tidis.RawZSetDataKey(dbId, key, ver, m)
 
 	return lexKey, withFrontier
 }
@@ -862,7 +1387,7 @@ func (tidis *Tidis) Zlexcount(dbId uint8, txn interface{}, key, start, stop []by
 	)
 
 	if txn == nil {
-		ss, err = tidis.db.GetNewestSnapshot()
+		ss, err = tidis.zsetSnapshot(dbId, key)
 		if err != nil {
 			return 0, err
 		}
@@ -881,8 +1406,8 @@ func (tidis *Tidis) Zlexcount(dbId uint8, txn interface{}, key, start, stop []by
 		withStart, withEnd bool
 	)
 
-	eStartKey, withStart = tidis.zlexParse(dbId, key, start)
-	eEndKey, withEnd = tidis.zlexParse(dbId, key, stop)
+	eStartKey, withStart = tidis.zlexParse(dbId, key, metaObj.Version, start)
+	eEndKey, withEnd = tidis.zlexParse(dbId, key, metaObj.Version, stop)
 
 	if txn == nil {
 		count, err = tidis.db.GetRangeKeysCount(eStartKey, withStart, eEndKey, withEnd, metaObj.Size, ss)
@@ -896,7 +1421,7 @@ func (tidis *Tidis) Zlexcount(dbId uint8, txn interface{}, key, start, stop []by
 	return count, nil
 }
 
-func (tidis *Tidis) Zscore(dbId uint8, txn interface{}, key, member []byte) (int64, bool, error) {
+func (tidis *Tidis) Zscore(dbId uint8, txn interface{}, key, member []byte) (float64, bool, error) {
 	if len(key) == 0 || len(member) == 0 {
 		return 0, false, terror.ErrKeyEmpty
 	}
@@ -908,40 +1433,33 @@ func (tidis *Tidis) Zscore(dbId uint8, txn interface{}, key, member []byte) (int
 	)
 
 	if txn == nil {
-		ss, err = tidis.db.GetNewestSnapshot()
-		if err != nil {
-			return 0, false, err
-		}
-		metaObj, _, err := tidis.ZSetMetaObj(dbId, txn, ss, key)
-		if err != nil {
-			return 0, false, err
-		}
-		if metaObj == nil {
-			return 0, false, nil
-		}
-		eDataKey := tidis.RawZSetDataKey(dbId, key, member)
-
-		scoreRaw, err = tidis.db.GetWithSnapshot(eDataKey, ss)
+		ss, err = tidis.zsetSnapshot(dbId, key)
 		if err != nil {
 			return 0, false, err
 		}
+	}
+	metaObj, _, err := tidis.ZSetMetaObj(dbId, txn, ss, key)
+	if err != nil {
+		return 0, false, err
+	}
+	if metaObj == nil {
+		return 0, false, nil
+	}
+
+	eDataKey := tidis.RawZSetDataKey(dbId, key, metaObj.Version, member)
+	if txn == nil {
+		scoreRaw, err = tidis.db.GetWithSnapshot(eDataKey, ss)
 	} else {
-		metaObj, _, err := tidis.ZSetMetaObj(dbId, txn, ss, key)
-		if err != nil {
-			return 0, false, err
-		}
-		if metaObj == nil {
-			return 0, false, nil
-		}
-		eDataKey := tidis.RawZSetDataKey(dbId, key, member)
 		scoreRaw, err = tidis.db.GetWithTxn(eDataKey, txn)
-		if err != nil {
-			return 0, false, err
-		}
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if scoreRaw == nil {
+		return 0, false, nil
 	}
 
-	score, _ := util.BytesToInt64(scoreRaw)
-	return score, true, nil
+	return metaObj.UnmarshalScore(scoreRaw), true, nil
 }
 
 func (tidis *Tidis) Zrem(dbId uint8, key []byte, members ...[]byte) (uint64, error) {
@@ -982,7 +1500,7 @@ func (tidis *Tidis) ZremWithTxn(dbId uint8, txn interface{}, key []byte, members
 		)
 
 		for _, member := range members {
-			eDataKey := tidis.RawZSetDataKey(dbId, key, member)
+			eDataKey := tidis.RawZSetDataKey(dbId, key, metaObj.Version, member)
 
 			scoreRaw, err := tidis.db.GetWithTxn(eDataKey, txn)
 			if err != nil {
@@ -995,12 +1513,8 @@ func (tidis *Tidis) ZremWithTxn(dbId uint8, txn interface{}, key []byte, members
 
 			deleted++
 
-			score, err := util.BytesToInt64(scoreRaw)
-			if err != nil {
-				return 0, err
-			}
-
-			eScoreKey := tidis.RawZSetScoreKey(dbId, key, member, score)
+			score := metaObj.UnmarshalScore(scoreRaw)
+			eScoreKey := tidis.RawZSetScoreKey(dbId, key, metaObj.Version, member, metaObj.EncodeScore(score))
 
 			err = txn.Delete(eDataKey)
 			if err != nil {
@@ -1037,7 +1551,7 @@ func (tidis *Tidis) ZremWithTxn(dbId uint8, txn interface{}, key []byte, members
 	return v.(uint64), nil
 }
 
-func (tidis *Tidis) Zincrby(dbId uint8, key []byte, delta int64, member []byte) (int64, error) {
+func (tidis *Tidis) Zincrby(dbId uint8, key []byte, delta float64, member []byte) (float64, error) {
 	f := func(txn interface{}) (interface{}, error) {
 		return tidis.ZincrbyWithTxn(dbId, txn, key, delta, member)
 	}
@@ -1047,25 +1561,66 @@ func (tidis *Tidis) Zincrby(dbId uint8, key []byte, delta int64, member []byte)
 	if err != nil {
 		return 0, err
 	}
+	tidis.SignalKeyReady(dbId, key)
+
+	return v.(float64), nil
+}
 
-	return v.(int64), nil
+func (tidis *Tidis) ZincrbyWithTxn(dbId uint8, txn interface{}, key []byte, delta float64, member []byte) (float64, error) {
+	v, _, err := tidis.ZincrbyWithParamWithTxn(dbId, txn, key, delta, member, nil)
+	return v, err
 }
 
-func (tidis *Tidis) ZincrbyWithTxn(dbId uint8, txn interface{}, key []byte, delta int64, member []byte) (int64, error) {
+func (tidis *Tidis) ZincrbyWithParam(dbId uint8, key []byte, delta float64, member []byte, params *ZaddParams) (float64, bool, error) {
+	var updated bool
+
+	f := func(txn interface{}) (interface{}, error) {
+		v, ok, err := tidis.ZincrbyWithParamWithTxn(dbId, txn, key, delta, member, params)
+		updated = ok
+		return v, err
+	}
+
+	// execute txn
+	v, err := tidis.db.BatchInTxn(f)
+	if err != nil {
+		return 0, false, err
+	}
+	tidis.SignalKeyReady(dbId, key)
+
+	return v.(float64), updated, nil
+}
+
+// ZincrbyWithParamWithTxn increases score of member under zadd params, false
+// is returned if the update is aborted by NX, XX, GT or LT option
+func (tidis *Tidis) ZincrbyWithParamWithTxn(dbId uint8, txn interface{}, key []byte, delta float64, member []byte, params *ZaddParams) (float64, bool, error) {
 	if len(key) == 0 || len(member) == 0 {
-		return 0, terror.ErrKeyEmpty
+		return 0, false, terror.ErrKeyEmpty
+	}
+	if math.IsNaN(delta) {
+		return 0, false, terror.ErrNotFloat
+	}
+	if err := params.Validate(1); err != nil {
+		return 0, false, err
 	}
 
 	eMetaKey := tidis.RawKeyPrefix(dbId, key)
 
 	metaObj, _, err := tidis.ZSetMetaObj(dbId, txn, nil, key)
 	if err != nil {
-		return 0, err
+		return 0, false, err
 	}
 	if metaObj == nil {
-		return 0, nil
+		if params != nil && params.XX {
+			return 0, false, nil
+		}
+		metaObj, err = tidis.newZSetMetaObjWithTxn(dbId, txn, key)
+		if err != nil {
+			return 0, false, err
+		}
 	}
 
+	var updated bool
+
 	f := func(txn1 interface{}) (interface{}, error) {
 		txn, ok := txn1.(kv.Transaction)
 		if !ok {
@@ -1073,71 +1628,59 @@ func (tidis *Tidis) ZincrbyWithTxn(dbId uint8, txn interface{}, key []byte, delt
 		}
 
 		var (
-			newScore  int64
-			eScoreKey []byte
+			score    float64
+			newScore float64
 		)
 
-		eDataKey := tidis.RawZSetDataKey(dbId, key, member)
-		s, err := tidis.db.GetWithTxn(eDataKey, txn)
+		eDataKey := tidis.RawZSetDataKey(dbId, key, metaObj.Version, member)
+		scoreRaw, err := tidis.db.GetWithTxn(eDataKey, txn)
 		if err != nil {
 			return 0, err
 		}
-		if s == nil {
-			// member not exists, add it with new score
-			metaObj.Size++
-			newScore = delta
-			eScoreKey = tidis.RawZSetScoreKey(dbId, key, member, newScore)
-
-			// add data key and score key, then update meta key
-			scoreRaw, _ := util.Int64ToBytes(newScore)
-			err = txn.Set(eDataKey, scoreRaw)
-			if err != nil {
-				return 0, err
-			}
+		if scoreRaw != nil {
+			score = metaObj.UnmarshalScore(scoreRaw)
+		}
 
-			err = txn.Set(eScoreKey, []byte{0})
+		newScore = score + delta
+		if math.IsNaN(newScore) {
+			// inf plus -inf
+			return 0, terror.ErrScoreNaN
+		}
+		if !params.allowed(scoreRaw != nil, score, newScore) {
+			return score, nil
+		}
+		updated = true
+		if !metaObj.ScoreAccepted(newScore) {
+			err = tidis.zsetConvertWithTxn(dbId, txn, key, metaObj)
 			if err != nil {
 				return 0, err
 			}
+		}
 
-			eMetaValue := MarshalZSetObj(metaObj)
-			err = txn.Set(eMetaKey, eMetaValue)
-			if err != nil {
-				return 0, err
-			}
+		if scoreRaw == nil {
+			// member not exists, add it with new score
+			metaObj.Size++
 		} else {
-			// get the member score
-			scoreRaw, err := tidis.db.GetWithTxn(eDataKey, txn)
-			if err != nil {
-				return 0, err
-			}
-			if scoreRaw == nil {
-				return 0, terror.ErrInvalidMeta
-			}
-			score, _ := util.BytesToInt64(scoreRaw)
-
-			newScore = score + delta
-
-			// update datakey
-			scoreRaw, _ = util.Int64ToBytes(newScore)
-			err = txn.Set(eDataKey, scoreRaw)
-			if err != nil {
-				return 0, err
-			}
-
 			// delete old score key
-			eScoreKey = tidis.RawZSetScoreKey(dbId, key, member, score)
-			err = txn.Delete(eScoreKey)
+			err = txn.Delete(tidis.RawZSetScoreKey(dbId, key, metaObj.Version, member, metaObj.EncodeScore(score)))
 			if err != nil {
 				return 0, err
 			}
+		}
 
-			eScoreKey = tidis.RawZSetScoreKey(dbId, key, member, newScore)
-			err = txn.Set(eScoreKey, []byte{0})
-			if err != nil {
-				return 0, err
-			}
+		err = txn.Set(eDataKey, metaObj.MarshalScore(newScore))
+		if err != nil {
+			return 0, err
+		}
+		err = txn.Set(tidis.RawZSetScoreKey(dbId, key, metaObj.Version, member, metaObj.EncodeScore(newScore)), []byte{0})
+		if err != nil {
+			return 0, err
+		}
 
+		// meta key is always written, watchers are notified by in-place update
+		err = txn.Set(eMetaKey, MarshalZSetObj(metaObj))
+		if err != nil {
+			return 0, err
 		}
 
 		return newScore, nil
@@ -1146,13 +1689,13 @@ func (tidis *Tidis) ZincrbyWithTxn(dbId uint8, txn interface{}, key []byte, delt
 	// execute txn
 	v, err := tidis.db.BatchWithTxn(f, txn)
 	if err != nil {
-		return 0, err
+		return 0, false, err
 	}
 
-	return v.(int64), nil
+	return v.(float64), updated, nil
 }
 
-func (tidis *Tidis) Zrank(dbId uint8, txn interface{}, key, member []byte, score int64) (int64, bool, error) {
+func (tidis *Tidis) Zrank(dbId uint8, txn interface{}, key, member []byte, score float64) (int64, bool, error) {
 	if len(key) == 0 {
 		return -1, false, terror.ErrKeyEmpty
 	}
@@ -1164,15 +1707,25 @@ func (tidis *Tidis) Zrank(dbId uint8, txn interface{}, key, member []byte, score
 		ss    interface{}
 	)
 
-	startKey := tidis.RawZSetScoreKey(dbId, key, []byte{0}, ScoreMin)
-	endKey := tidis.RawZSetScoreKey(dbId, key, []byte{0}, ScoreMax)
-	objKey := tidis.RawZSetScoreKey(dbId, key, member, score)
-
 	if txn == nil {
-		ss, err = tidis.db.GetNewestSnapshot()
+		ss, err = tidis.zsetSnapshot(dbId, key)
 		if err != nil {
 			return -1, false, err
 		}
+	}
+	metaObj, _, err := tidis.ZSetMetaObj(dbId, txn, ss, key)
+	if err != nil {
+		return -1, false, err
+	}
+	if metaObj == nil {
+		return -1, false, nil
+	}
+
+	startKey := tidis.rawZSetScorePrefix(dbId, key, metaObj.Version)
+	endKey := kv.Key(startKey).PrefixNext()
+	objKey := tidis.RawZSetScoreKey(dbId, key, metaObj.Version, member, metaObj.EncodeScore(score))
+
+	if txn == nil {
 		v, exist, err = tidis.db.GetRank(startKey, endKey, objKey, ss)
 	} else {
 		v, exist, err = tidis.db.GetRankWithTxn(startKey, endKey, objKey, txn)
@@ -1180,3 +1733,538 @@ func (tidis *Tidis) Zrank(dbId uint8, txn interface{}, key, member []byte, score
 
 	return v, exist, err
 }
+
+func (tidis *Tidis) Zpop(dbId uint8, key []byte, count int64, max bool) ([]*MemberPair, error) {
+	f := func(txn interface{}) (interface{}, error) {
+		return tidis.ZpopWithTxn(dbId, txn, key, count, max)
+	}
+
+	// execute txn
+	v, err := tidis.db.BatchInTxn(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]*MemberPair), nil
+}
+
+// ZpopWithTxn removes count members with the lowest scores through the score
+// keys, or the highest scores if max is true. members are returned in pop order.
+func (tidis *Tidis) ZpopWithTxn(dbId uint8, txn interface{}, key []byte, count int64, max bool) ([]*MemberPair, error) {
+	if len(key) == 0 {
+		return nil, terror.ErrKeyEmpty
+	}
+	if count < 0 {
+		return nil, terror.ErrCmdParams
+	}
+
+	metaObj, _, err := tidis.ZSetMetaObj(dbId, txn, nil, key)
+	if err != nil {
+		return nil, err
+	}
+	if metaObj == nil || count == 0 {
+		return []*MemberPair{}, nil
+	}
+
+	f := func(txn1 interface{}) (interface{}, error) {
+		txn, ok := txn1.(kv.Transaction)
+		if !ok {
+			return nil, terror.ErrBackendType
+		}
+
+		if count > int64(metaObj.Size) {
+			count = int64(metaObj.Size)
+		}
+		var offset int64
+		if max {
+			offset = int64(metaObj.Size) - count
+		}
+
+		startKey := tidis.rawZSetScorePrefix(dbId, key, metaObj.Version)
+		endKey := kv.Key(startKey).PrefixNext()
+		members, err := tidis.db.GetRangeKeysWithTxn(startKey, endKey, uint64(offset), uint64(count), txn)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(members)) != count {
+			return nil, terror.ErrInvalidMeta
+		}
+
+		keyPrefixLen := len(tidis.RawKeyPrefix(dbId, key))
+		mps := make([]*MemberPair, len(members))
+		for i, scoreKey := range members {
+			rscore, member, err := ZScoreDecoder(keyPrefixLen, scoreKey)
+			if err != nil {
+				return nil, err
+			}
+			err = txn.Delete(scoreKey)
+			if err != nil {
+				return nil, err
+			}
+			err = txn.Delete(tidis.RawZSetDataKey(dbId, key, metaObj.Version, member))
+			if err != nil {
+				return nil, err
+			}
+
+			idx := i
+			if max {
+				// highest score first
+				idx = len(members) - 1 - i
+			}
+			mps[idx] = &MemberPair{Score: metaObj.DecodeScore(rscore), Member: member}
+		}
+
+		metaObj.Size -= uint64(count)
+		eMetaKey := tidis.RawKeyPrefix(dbId, key)
+		if metaObj.Size == 0 {
+			err = txn.Delete(eMetaKey)
+		} else {
+			err = txn.Set(eMetaKey, MarshalZSetObj(metaObj))
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return mps, nil
+	}
+
+	// execute txn
+	v, err := tidis.db.BatchWithTxn(f, txn)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]*MemberPair), nil
+}
+
+const (
+	ZAggregateSum = iota
+	ZAggregateMin
+	ZAggregateMax
+)
+
+// max data keys fetched in one range scan by zset iterator
+const zsetIterBatch = 256
+
+// options of zset algebra, nil params means weight 1 and sum aggregate
+type ZopsParams struct {
+	Weights   []float64
+	Aggregate int
+}
+
+func (p *ZopsParams) weight(i int) float64 {
+	if p == nil || p.Weights == nil {
+		return 1
+	}
+	return p.Weights[i]
+}
+
+func (p *ZopsParams) aggregate(a, b float64) float64 {
+	agg := ZAggregateSum
+	if p != nil {
+		agg = p.Aggregate
+	}
+	switch agg {
+	case ZAggregateMin:
+		return math.Min(a, b)
+	case ZAggregateMax:
+		return math.Max(a, b)
+	}
+	if sum := a + b; !math.IsNaN(sum) {
+		return sum
+	}
+	// inf plus -inf is 0 as redis does
+	return 0
+}
+
+// zsetIter pages data keys of a zset or set in member order, members of set
+// have score 1
+type zsetIter struct {
+	tidis  *Tidis
+	txn    interface{}
+	ss     interface{}
+	prefix []byte
+	obj    *ZSetObj
+	kvs    [][]byte
+	pos    int
+	more   bool
+}
+
+func (tidis *Tidis) newZSetIter(dbId uint8, txn, ss interface{}, key []byte) (*zsetIter, error) {
+	it := &zsetIter{tidis: tidis, txn: txn, ss: ss}
+
+	obj, _, err := tidis.ZSetMetaObj(dbId, txn, ss, key)
+	if err == terror.ErrTypeNotMatch {
+		// plain set is accepted as input
+		setObj, _, err := tidis.SetMetaObj(dbId, txn, ss, key)
+		if err != nil || setObj == nil {
+			return nil, err
+		}
+		it.prefix = tidis.RawSetDataKey(dbId, key, nil)
+	} else if err != nil || obj == nil {
+		return nil, err
+	} else {
+		it.obj = obj
+		it.prefix = tidis.rawZSetDataPrefix(dbId, key, obj.Version)
+	}
+
+	return it, it.fill(it.prefix)
+}
+
+func (it *zsetIter) fill(start []byte) error {
+	var err error
+
+	end := kv.Key(it.prefix).PrefixNext()
+	if it.txn == nil {
+		it.kvs, err = it.tidis.db.GetRangeKeysVals(start, end, zsetIterBatch, it.ss)
+	} else {
+		it.kvs, err = it.tidis.db.GetRangeKeysValsWithTxn(start, end, zsetIterBatch, it.txn)
+	}
+	if err != nil {
+		return err
+	}
+	it.more = len(it.kvs) >= zsetIterBatch*2
+	it.pos = 0
+	for it.pos < len(it.kvs)-1 && !bytes.HasPrefix(it.kvs[it.pos], it.prefix) {
+		it.pos += 2
+	}
+	return nil
+}
+
+func (it *zsetIter) valid() bool {
+	return it != nil && it.pos < len(it.kvs)-1 && bytes.HasPrefix(it.kvs[it.pos], it.prefix)
+}
+
+func (it *zsetIter) member() []byte {
+	return it.kvs[it.pos][len(it.prefix):]
+}
+
+func (it *zsetIter) score() float64 {
+	if it.obj == nil {
+		return 1
+	}
+	return it.obj.UnmarshalScore(it.kvs[it.pos+1])
+}
+
+func (it *zsetIter) next() error {
+	it.pos += 2
+	if it.pos < len(it.kvs)-1 || !it.more {
+		return nil
+	}
+	return it.fill(kv.Key(it.kvs[len(it.kvs)-2]).Next())
+}
+
+// zopsMerge merges data keys of all keys in member order, f is called with
+// each member of the result and its score. old iterator is merged as well but
+// not counted in the result, f gets whether member exists in it and its score.
+func (tidis *Tidis) zopsMerge(dbId uint8, txn, ss interface{}, opType int, params *ZopsParams, old *zsetIter, keys [][]byte, f func(member []byte, score float64, inResult, inOld bool, oldScore float64) error) error {
+	iters := make([]*zsetIter, len(keys))
+	for i, key := range keys {
+		it, err := tidis.newZSetIter(dbId, txn, ss, key)
+		if err != nil {
+			return err
+		}
+		if it == nil && old == nil && (opType == opInter || (opType == opDiff && i == 0)) {
+			// result is empty
+			return nil
+		}
+		iters[i] = it
+	}
+	all := append(iters, old)
+
+	for {
+		// find the smallest member of all iterators
+		var member []byte
+		for _, it := range all {
+			if it.valid() && (member == nil || bytes.Compare(it.member(), member) < 0) {
+				member = it.member()
+			}
+		}
+		if member == nil {
+			return nil
+		}
+		member = append([]byte{}, member...)
+
+		var (
+			score    float64
+			oldScore float64
+			inOld    bool
+			inFirst  bool
+			found    int
+		)
+		for i, it := range iters {
+			if !it.valid() || !bytes.Equal(it.member(), member) {
+				continue
+			}
+			inFirst = inFirst || i == 0
+			s := it.score() * params.weight(i)
+			if math.IsNaN(s) {
+				// inf multiplied by 0
+				s = 0
+			}
+			if found == 0 {
+				score = s
+			} else {
+				score = params.aggregate(score, s)
+			}
+			found++
+			if err := it.next(); err != nil {
+				return err
+			}
+		}
+		if old.valid() && bytes.Equal(old.member(), member) {
+			inOld = true
+			oldScore = old.score()
+			if err := old.next(); err != nil {
+				return err
+			}
+		}
+
+		var inResult bool
+		switch opType {
+		case opUnion:
+			inResult = found > 0
+		case opInter:
+			inResult = found == len(iters)
+		case opDiff:
+			inResult = inFirst && found == 1
+		}
+		if !inResult && !inOld {
+			continue
+		}
+		if err := f(member, score, inResult, inOld, oldScore); err != nil {
+			return err
+		}
+	}
+}
+
+// Zops computes union, intersection or difference of zsets, members are sorted
+// by score
+func (tidis *Tidis) Zops(dbId uint8, txn interface{}, opType int, params *ZopsParams, keys ...[]byte) ([]*MemberPair, error) {
+	if len(keys) == 0 {
+		return nil, terror.ErrKeyEmpty
+	}
+
+	var (
+		ss  interface{}
+		err error
+		mps []*MemberPair
+	)
+	if txn == nil {
+		ss, err = tidis.zsetSnapshot(dbId, keys...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f := func(member []byte, score float64, inResult, inOld bool, oldScore float64) error {
+		mps = append(mps, &MemberPair{Score: score, Member: member})
+		return nil
+	}
+	err = tidis.zopsMerge(dbId, txn, ss, opType, params, nil, keys, f)
+	if err != nil {
+		return nil, err
+	}
+
+	// members are merged in lex order, stable sort keeps it for equal scores
+	sort.SliceStable(mps, func(i, j int) bool {
+		return mps[i].Score < mps[j].Score
+	})
+	return mps, nil
+}
+
+func (tidis *Tidis) ZopsStore(dbId uint8, opType int, dest []byte, params *ZopsParams, keys ...[]byte) (uint64, error) {
+	if len(dest) == 0 || len(keys) == 0 {
+		return uint64(0), terror.ErrKeyEmpty
+	}
+
+	// write in txn
+	f := func(txn interface{}) (interface{}, error) {
+		return tidis.ZopsStoreWithTxn(dbId, txn, opType, dest, params, keys...)
+	}
+
+	// execute in txn
+	v, err := tidis.db.BatchInTxn(f)
+	if err != nil {
+		return 0, err
+	}
+	tidis.SignalKeyReady(dbId, dest)
+
+	return v.(uint64), nil
+}
+
+// zsetStoreWithTxn writes members into dest which does not exist
+func (tidis *Tidis) zsetStoreWithTxn(dbId uint8, txn1 interface{}, dest []byte, mps []*MemberPair) (uint64, error) {
+	txn, ok := txn1.(kv.Transaction)
+	if !ok {
+		return uint64(0), terror.ErrBackendType
+	}
+	if len(mps) == 0 {
+		return uint64(0), nil
+	}
+
+	metaObj, err := tidis.newZSetMetaObjWithTxn(dbId, txn, dest)
+	if err != nil {
+		return uint64(0), err
+	}
+	for _, mp := range mps {
+		err := txn.Set(tidis.RawZSetDataKey(dbId, dest, metaObj.Version, mp.Member), metaObj.MarshalScore(mp.Score))
+		if err != nil {
+			return uint64(0), err
+		}
+		err = txn.Set(tidis.RawZSetScoreKey(dbId, dest, metaObj.Version, mp.Member, metaObj.EncodeScore(mp.Score)), []byte{0})
+		if err != nil {
+			return uint64(0), err
+		}
+	}
+	metaObj.Size = uint64(len(mps))
+	err = txn.Set(tidis.RawKeyPrefix(dbId, dest), MarshalZSetObj(metaObj))
+	if err != nil {
+		return uint64(0), err
+	}
+	return metaObj.Size, nil
+}
+
+// ZopsStoreWithTxn stores result of zset algebra into dest, result members are
+// written while merging. dest is merged as well, so its old members are removed
+// and it can be one of the input keys. dest of other type or big zset dest is
+// deleted and the result is written as a new zset.
+func (tidis *Tidis) ZopsStoreWithTxn(dbId uint8, txn interface{}, opType int, dest []byte, params *ZopsParams, keys ...[]byte) (uint64, error) {
+	if len(dest) == 0 || len(keys) == 0 {
+		return uint64(0), terror.ErrKeyEmpty
+	}
+
+	destType, destObj, err := tidis.GetObject(dbId, txn, dest)
+	if err != nil {
+		return uint64(0), err
+	}
+	if destObj != nil && (destType != TZSETMETA || collectionSize(destObj) > asyncDelThreshold) {
+		// dest can be an input set, result is computed before deletion. big
+		// collection is purged after commit, the result is written with a new
+		// version apart from its data keys
+		mps, err := tidis.Zops(dbId, txn, opType, params, keys...)
+		if err != nil {
+			return uint64(0), err
+		}
+		if _, err = tidis.DeleteKeys(dbId, txn, [][]byte{dest}); err != nil {
+			return uint64(0), err
+		}
+		return tidis.zsetStoreWithTxn(dbId, txn, dest, mps)
+	}
+
+	destMetaObj, _, err := tidis.ZSetMetaObj(dbId, txn, nil, dest)
+	if err != nil {
+		return uint64(0), err
+	}
+
+	// write in txn
+	f := func(txn1 interface{}) (interface{}, error) {
+		txn, ok := txn1.(kv.Transaction)
+		if !ok {
+			return uint64(0), terror.ErrBackendType
+		}
+
+		var (
+			old        *zsetIter
+			newMetaObj *ZSetObj
+			err        error
+		)
+		if destMetaObj != nil {
+			old, err = tidis.newZSetIter(dbId, txn, nil, dest)
+			if err != nil {
+				return uint64(0), err
+			}
+			// members are rewritten in place
+			newMetaObj = tidis.newZSetMetaObj()
+			newMetaObj.Version = destMetaObj.Version
+		} else {
+			newMetaObj, err = tidis.newZSetMetaObjWithTxn(dbId, txn, dest)
+			if err != nil {
+				return uint64(0), err
+			}
+		}
+
+		store := func(member []byte, score float64, inResult, inOld bool, oldScore float64) error {
+			eDataKey := tidis.RawZSetDataKey(dbId, dest, newMetaObj.Version, member)
+			if inOld {
+				err := txn.Delete(tidis.RawZSetScoreKey(dbId, dest, destMetaObj.Version, member, destMetaObj.EncodeScore(oldScore)))
+				if err != nil {
+					return err
+				}
+				if !inResult {
+					return txn.Delete(eDataKey)
+				}
+			}
+			// members before the merging position can be written, they are
+			// not read again
+			newMetaObj.Size++
+			err := txn.Set(eDataKey, newMetaObj.MarshalScore(score))
+			if err != nil {
+				return err
+			}
+			return txn.Set(tidis.RawZSetScoreKey(dbId, dest, newMetaObj.Version, member, newMetaObj.EncodeScore(score)), []byte{0})
+		}
+		err = tidis.zopsMerge(dbId, txn, nil, opType, params, old, keys, store)
+		if err != nil {
+			return uint64(0), err
+		}
+
+		eDestMetaKey := tidis.RawKeyPrefix(dbId, dest)
+		if newMetaObj.Size == 0 {
+			if destMetaObj != nil {
+				err = txn.Delete(eDestMetaKey)
+			}
+		} else {
+			err = txn.Set(eDestMetaKey, MarshalZSetObj(newMetaObj))
+		}
+		if err != nil {
+			return uint64(0), err
+		}
+
+		return newMetaObj.Size, nil
+	}
+
+	// execute in txn
+	v, err := tidis.db.BatchWithTxn(f, txn)
+	if err != nil {
+		return 0, err
+	}
+
+	return v.(uint64), nil
+}
+
+func (tidis *Tidis) Zdiff(dbId uint8, txn interface{}, keys ...[]byte) ([]*MemberPair, error) {
+	return tidis.Zops(dbId, txn, opDiff, nil, keys...)
+}
+
+func (tidis *Tidis) Zinter(dbId uint8, txn interface{}, params *ZopsParams, keys ...[]byte) ([]*MemberPair, error) {
+	return tidis.Zops(dbId, txn, opInter, params, keys...)
+}
+
+func (tidis *Tidis) Zunion(dbId uint8, txn interface{}, params *ZopsParams, keys ...[]byte) ([]*MemberPair, error) {
+	return tidis.Zops(dbId, txn, opUnion, params, keys...)
+}
+
+func (tidis *Tidis) Zdiffstore(dbId uint8, dest []byte, keys ...[]byte) (uint64, error) {
+	return tidis.ZopsStore(dbId, opDiff, dest, nil, keys...)
+}
+
+func (tidis *Tidis) Zinterstore(dbId uint8, dest []byte, params *ZopsParams, keys ...[]byte) (uint64, error) {
+	return tidis.ZopsStore(dbId, opInter, dest, params, keys...)
+}
+
+func (tidis *Tidis) Zunionstore(dbId uint8, dest []byte, params *ZopsParams, keys ...[]byte) (uint64, error) {
+	return tidis.ZopsStore(dbId, opUnion, dest, params, keys...)
+}
+
+func (tidis *Tidis) ZdiffstoreWithTxn(dbId uint8, txn interface{}, dest []byte, keys ...[]byte) (uint64, error) {
+	return tidis.ZopsStoreWithTxn(dbId, txn, opDiff, dest, nil, keys...)
+}
+
+func (tidis *Tidis) ZinterstoreWithTxn(dbId uint8, txn interface{}, dest []byte, params *ZopsParams, keys ...[]byte) (uint64, error) {
+	return tidis.ZopsStoreWithTxn(dbId, txn, opInter, dest, params, keys...)
+}
+
+func (tidis *Tidis) ZunionstoreWithTxn(dbId uint8, txn interface{}, dest []byte, params *ZopsParams, keys ...[]byte) (uint64, error) {
+	return tidis.ZopsStoreWithTxn(dbId, txn, opUnion, dest, params, keys...)
+}
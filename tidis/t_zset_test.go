@@ -0,0 +1,298 @@
+//
+// t_zset_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/pingcap/tidb/kv"
+	"github.com/yongman/go/util"
+)
+
+func TestZSetFloatScore(t *testing.T) {
+	tdb := newTestTidis(t)
+	defer tdb.Close()
+
+	key := []byte("zset")
+	tdb.Zadd(0, key,
+		&MemberPair{Score: 1.5, Member: []byte("a")},
+		&MemberPair{Score: -2.25, Member: []byte("b")},
+		&MemberPair{Score: math.Inf(1), Member: []byte("c")},
+		&MemberPair{Score: math.Inf(-1), Member: []byte("d")},
+		&MemberPair{Score: 0, Member: []byte("e")},
+		&MemberPair{Score: -0.5, Member: []byte("f")},
+	)
+
+	v, err := tdb.Zrange(0, nil, key, 0, -1, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%s", v); got != "[d -inf b -2.25 f -0.5 e 0 a 1.5 c inf]" {
+		t.Fatalf("zrange got %s", got)
+	}
+
+	bound := func(s string) ScoreBound {
+		b, err := ParseScoreBound([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	v, _ = tdb.Zrangebyscore(0, nil, key, bound("(-2.25"), bound("1.5"), false, -1, -1, false)
+	if got := fmt.Sprintf("%s", v); got != "[f e a]" {
+		t.Fatalf("zrangebyscore got %s", got)
+	}
+	v, _ = tdb.Zrangebyscore(0, nil, key, bound("(1.5"), bound("-inf"), false, -1, -1, true)
+	if got := fmt.Sprintf("%s", v); got != "[e f b d]" {
+		t.Fatalf("zrevrangebyscore got %s", got)
+	}
+	if n, _ := tdb.Zcount(0, nil, key, bound("-1"), bound("(1.5")); n != 2 {
+		t.Fatalf("zcount got %d", n)
+	}
+	if _, err := ParseScoreBound([]byte("nan")); err == nil {
+		t.Fatalf("nan score bound should fail")
+	}
+
+	score, _ := tdb.Zincrby(0, key, 0.25, []byte("a"))
+	if score != 1.75 {
+		t.Fatalf("zincrby got %v", score)
+	}
+	if _, err := tdb.Zincrby(0, key, math.Inf(-1), []byte("c")); err == nil {
+		t.Fatalf("zincrby to nan should fail")
+	}
+	if rank, _, _ := tdb.Zrank(0, nil, key, []byte("a"), score); rank != 4 {
+		t.Fatalf("zrank got %d", rank)
+	}
+	if n, _ := tdb.Zremrangebyscore(0, key, bound("(-inf"), bound("(inf")); n != 4 {
+		t.Fatalf("zremrangebyscore got %d", n)
+	}
+
+	for score, expect := range map[float64]string{
+		3: "3", -0.125: "-0.125", 1e20: "1e+20", 2.5e-5: "2.5e-05",
+	} {
+		if got := string(FormatScore(score)); got != expect {
+			t.Fatalf("format %v got %s", score, got)
+		}
+	}
+}
+
+func TestZSetIntScoreConvert(t *testing.T) {
+	tdb := newTestTidis(t)
+	defer tdb.Close()
+
+	// zset written by old versions with int64 scores
+	key := []byte("legacy")
+	metaObj := &ZSetObj{Object: Object{Type: TZSETMETA}, Size: 2, ScoreType: ZScoreInt}
+	tdb.db.Set(tdb.RawKeyPrefix(0, key), MarshalZSetObj(metaObj))
+	for member, score := range map[string]int64{"a": -3, "b": 7} {
+		raw, _ := util.Int64ToBytes(score)
+		tdb.db.Set(tdb.RawZSetDataKey(0, key, 0, []byte(member)), raw)
+		tdb.db.Set(tdb.RawZSetScoreKey(0, key, 0, []byte(member), ZScoreOffset(score)), []byte{0})
+	}
+
+	score, exist, _ := tdb.Zscore(0, nil, key, []byte("a"))
+	if !exist || score != -3 {
+		t.Fatalf("zscore got %v", score)
+	}
+	tdb.Zadd(0, key, &MemberPair{Score: 5, Member: []byte("c")})
+	obj, _, _ := tdb.ZSetMetaObj(0, nil, nil, key)
+	if obj.ScoreType != ZScoreInt {
+		t.Fatalf("zset with int scores should not be converted")
+	}
+
+	tdb.Zadd(0, key, &MemberPair{Score: 0.5, Member: []byte("d")})
+	obj, _, _ = tdb.ZSetMetaObj(0, nil, nil, key)
+	if obj.ScoreType != ZScoreFloat || obj.Size != 4 {
+		t.Fatalf("zset not converted, meta %+v", obj)
+	}
+	v, _ := tdb.Zrange(0, nil, key, 0, -1, true, false)
+	if got := fmt.Sprintf("%s", v); got != "[a -3 d 0.5 c 5 b 7]" {
+		t.Fatalf("zrange got %s", got)
+	}
+}
+
+func TestZSetIntScoreConvertBatches(t *testing.T) {
+	tdb := newTestTidis(t)
+	defer tdb.Close()
+
+	key := []byte("legacy")
+	size := zsetConvertBatch*2 + 10
+	metaObj := &ZSetObj{Object: Object{Type: TZSETMETA}, Size: uint64(size), ScoreType: ZScoreInt}
+	tdb.db.Set(tdb.RawKeyPrefix(0, key), MarshalZSetObj(metaObj))
+	for i := 0; i < size; i++ {
+		member := []byte(fmt.Sprintf("m%05d", i))
+		raw, _ := util.Int64ToBytes(int64(i))
+		tdb.db.Set(tdb.RawZSetDataKey(0, key, 0, member), raw)
+		tdb.db.Set(tdb.RawZSetScoreKey(0, key, 0, member, ZScoreOffset(int64(i))), []byte{0})
+	}
+
+	if score, err := tdb.Zincrby(0, key, 0.5, []byte("m00003")); err != nil || score != 3.5 {
+		t.Fatalf("zincrby got %v %v", score, err)
+	}
+	obj, _, _ := tdb.ZSetMetaObj(0, nil, nil, key)
+	if obj.ScoreType != ZScoreFloat || obj.Size != uint64(size) {
+		t.Fatalf("zset not converted, meta %+v", obj)
+	}
+	v, _ := tdb.Zrange(0, nil, key, -2, -1, true, false)
+	if got := fmt.Sprintf("%s", v); got != fmt.Sprintf("[m%05d %d m%05d %d]", size-2, size-2, size-1, size-1) {
+		t.Fatalf("zrange got %s", got)
+	}
+
+	// interrupted conversion is finished by the next access
+	metaObj.ScoreType, metaObj.Converted = ZScoreConverting, []byte("m00000")
+	tdb.db.Set(tdb.RawKeyPrefix(0, key), MarshalZSetObj(metaObj))
+	raw, _ := util.Int64ToBytes(7)
+	tdb.db.Set(tdb.RawZSetDataKey(0, key, 0, []byte("m00001")), raw)
+	tdb.db.Delete([][]byte{tdb.RawZSetScoreKey(0, key, 0, []byte("m00001"), ZScoreFloatEncode(1))})
+	tdb.db.Set(tdb.RawZSetScoreKey(0, key, 0, []byte("m00001"), ZScoreOffset(7)), []byte{0})
+	if score, _, err := tdb.Zscore(0, nil, key, []byte("m00001")); err != nil || score != 7 {
+		t.Fatalf("zscore of converting zset got %v %v", score, err)
+	}
+	if n, _ := tdb.Zcount(0, nil, key, ScoreBound{Score: 7}, ScoreBound{Score: 7}); n != 2 {
+		t.Fatalf("zcount after conversion got %d", n)
+	}
+}
+
+func TestZSetOps(t *testing.T) {
+	tdb := newTestTidis(t)
+	defer tdb.Close()
+
+	tdb.Zadd(0, []byte("z1"),
+		&MemberPair{Score: 1, Member: []byte("a")},
+		&MemberPair{Score: 2, Member: []byte("b")},
+		&MemberPair{Score: 3, Member: []byte("c")},
+	)
+	tdb.Zadd(0, []byte("z2"),
+		&MemberPair{Score: 10, Member: []byte("b")},
+		&MemberPair{Score: 20, Member: []byte("d")},
+	)
+	tdb.Sadd(0, []byte("s"), []byte("c"), []byte("d"))
+
+	format := func(mps []*MemberPair) string {
+		s := ""
+		for _, mp := range mps {
+			s += fmt.Sprintf("%s:%s ", mp.Member, FormatScore(mp.Score))
+		}
+		return s
+	}
+
+	mps, _ := tdb.Zunion(0, nil, nil, []byte("z1"), []byte("z2"), []byte("s"))
+	if got := format(mps); got != "a:1 c:4 b:12 d:21 " {
+		t.Fatalf("zunion got %s", got)
+	}
+	params := &ZopsParams{Weights: []float64{2, 0.5}, Aggregate: ZAggregateMax}
+	mps, _ = tdb.Zinter(0, nil, params, []byte("z1"), []byte("z2"))
+	if got := format(mps); got != "b:5 " {
+		t.Fatalf("zinter got %s", got)
+	}
+	mps, _ = tdb.Zinter(0, nil, nil, []byte("z1"), []byte("none"))
+	if len(mps) != 0 {
+		t.Fatalf("zinter with missing key got %s", format(mps))
+	}
+	mps, _ = tdb.Zdiff(0, nil, []byte("z1"), []byte("z2"), []byte("s"))
+	if got := format(mps); got != "a:1 " {
+		t.Fatalf("zdiff got %s", got)
+	}
+
+	// dest is one of the inputs and members span several range scans
+	for i := 0; i < zsetIterBatch*2+10; i++ {
+		tdb.Zadd(0, []byte("big"), &MemberPair{Score: float64(i), Member: []byte(fmt.Sprintf("m%04d", i))})
+	}
+	n, err := tdb.Zunionstore(0, []byte("big"), nil, []byte("big"), []byte("z1"))
+	if err != nil || n != zsetIterBatch*2+13 {
+		t.Fatalf("zunionstore got %d %v", n, err)
+	}
+	n, _ = tdb.Zinterstore(0, []byte("big"), &ZopsParams{Weights: []float64{3, 1}}, []byte("big"), []byte("z1"))
+	if n != 3 {
+		t.Fatalf("zinterstore got %d", n)
+	}
+	mps, _ = tdb.Zunion(0, nil, nil, []byte("big"))
+	if got := format(mps); got != "a:4 b:8 c:12 " {
+		t.Fatalf("zinterstore result %s", got)
+	}
+	if v, _ := tdb.Zrange(0, nil, []byte("big"), 0, -1, true, false); fmt.Sprintf("%s", v) != "[a 4 b 8 c 12]" {
+		t.Fatalf("zinterstore score keys %s", v)
+	}
+	n, _ = tdb.Zdiffstore(0, []byte("big"), []byte("none"), []byte("z1"))
+	if n != 0 {
+		t.Fatalf("zdiffstore got %d", n)
+	}
+	if cnt, _ := tdb.Exists(0, nil, []byte("big")); cnt != 0 {
+		t.Fatalf("empty result should delete dest")
+	}
+}
+
+func TestZSetOpsStoreOverwrite(t *testing.T) {
+	tdb := newTestTidis(t)
+	defer tdb.Close()
+
+	tdb.Zadd(0, []byte("z"), &MemberPair{Score: 1, Member: []byte("a")})
+	tdb.Set(0, nil, []byte("str"), []byte("v"))
+	tdb.Sadd(0, []byte("s"), []byte("a"), []byte("b"))
+
+	// dest of other type is overwritten, and can be an input set
+	if n, err := tdb.Zunionstore(0, []byte("str"), nil, []byte("z")); err != nil || n != 1 {
+		t.Fatalf("zunionstore to string got %d %v", n, err)
+	}
+	if n, err := tdb.Zunionstore(0, []byte("s"), nil, []byte("s"), []byte("z")); err != nil || n != 2 {
+		t.Fatalf("zunionstore to input set got %d %v", n, err)
+	}
+	if v, _ := tdb.Zrange(0, nil, []byte("s"), 0, -1, true, false); fmt.Sprintf("%s", v) != "[b 1 a 2]" {
+		t.Fatalf("zunionstore result %s", v)
+	}
+
+	// big collection is deleted asynchronously, result is written with a new
+	// version before purge
+	members := make([][]byte, 0, asyncDelThreshold+1)
+	for i := uint64(0); i <= asyncDelThreshold; i++ {
+		members = append(members, []byte(fmt.Sprintf("m%d", i)))
+	}
+	tdb.Sadd(0, []byte("bigset"), members...)
+	if n, err := tdb.Zinterstore(0, []byte("bigset"), nil, []byte("bigset"), []byte("z")); err != nil || n != 0 {
+		t.Fatalf("zinterstore to big set got %d %v", n, err)
+	}
+	if n, err := tdb.Zunionstore(0, []byte("bigset"), nil, []byte("z")); err != nil || n != 1 {
+		t.Fatalf("zunionstore to purging key got %d %v", n, err)
+	}
+	tdb.Sadd(0, []byte("bigset2"), members...)
+	if n, err := tdb.Zunionstore(0, []byte("bigset2"), nil, []byte("bigset2")); err != nil || n != asyncDelThreshold+1 {
+		t.Fatalf("zunionstore to big input set got %d %v", n, err)
+	}
+	if n, _ := tdb.Zcard(0, nil, []byte("bigset2")); n != asyncDelThreshold+1 {
+		t.Fatalf("zcard of stored big set got %d", n)
+	}
+	// big zset dest is replaced in one txn as well
+	if _, err := tdb.db.BatchInTxn(func(txn interface{}) (interface{}, error) {
+		return tdb.ZunionstoreWithTxn(0, txn, []byte("bigset2"), nil, []byte("z"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for len(tdb.asyncDelCh) > 0 {
+		item := <-tdb.asyncDelCh
+		if err := tdb.asyncPurge(item); err != nil {
+			t.Fatal(err)
+		}
+		tdb.AsyncDelDone(item.dbId, item.keyType, item.ukey)
+	}
+	for _, key := range []string{"bigset", "bigset2"} {
+		if v, _ := tdb.Zrange(0, nil, []byte(key), 0, -1, true, false); fmt.Sprintf("%s", v) != "[a 1]" {
+			t.Fatalf("%s after purge got %s", key, v)
+		}
+		prefix := tdb.RawKeyPrefix(0, []byte(key))
+		kvs, _ := tdb.db.GetRangeKeysVals(prefix, kv.Key(prefix).PrefixNext(), 10, nil)
+		if len(kvs) != 6 {
+			t.Fatalf("%s keeps %d raw keys after purge", key, len(kvs)/2)
+		}
+		if v, _ := tdb.db.Get(tdb.RawAsyncDelKey(0, []byte(key))); v != nil {
+			t.Fatalf("%s async deletion left", key)
+		}
+	}
+}
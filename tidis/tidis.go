@@ -20,9 +20,13 @@ import (
 	"github.com/deckarep/golang-set"
 	"github.com/yongman/tidis/config"
 	"github.com/yongman/tidis/store"
+	"github.com/yongman/tidis/store/tikv"
 )
 
 type Tidis struct {
+	// updated atomically, keep it first for 64-bit alignment
+	ttlStats ttlStats
+
 	uuid uuid.UUID
 	conf *config.Config
 	db   store.DB
@@ -33,21 +37,48 @@ type Tidis struct {
 
 	asyncDelCh  chan AsyncDelItem
 	asyncDelSet mapset.Set
+	// async deletions recorded in outer txns, queued after commit
+	asyncDelTxns map[interface{}][]AsyncDelItem
+
+	// clients blocked on keys
+	keyWaiters *keyWaiters
+
+	// carries published messages to other instances
+	pubsub PubSubTransport
+	// delivers messages to subscribers of this instance
+	pubsubDeliver func(channel, message []byte)
+
+	// enabled keyspace event classes
+	notifyFlags int32
 }
 
 func NewTidis(conf *config.Config) (*Tidis, error) {
 	var err error
 
 	tidis := &Tidis{
-		uuid:        uuid.New(),
-		conf:        conf,
-		asyncDelCh:  make(chan AsyncDelItem, 10240),
-		asyncDelSet: mapset.NewSet(),
+		uuid:         uuid.New(),
+		conf:         conf,
+		asyncDelCh:   make(chan AsyncDelItem, 10240),
+		asyncDelSet:  mapset.NewSet(),
+		asyncDelTxns: make(map[interface{}][]AsyncDelItem),
+		keyWaiters:   newKeyWaiters(),
+	}
+	tidis.pubsub = newStorePubSub(tidis)
+
+	flags, err := ParseKeyspaceEvents(conf.Tidis.KeyspaceEvents)
+	if err != nil {
+		return nil, err
 	}
+	tidis.SetKeyspaceEvents(flags)
+
 	tidis.db, err = store.Open(conf)
 	if err != nil {
 		return nil, err
 	}
+	tidis.db.SetTxnDoneHook(tidis.txnDone)
+	if conf.Tidis.CDCEnabled {
+		tidis.db.SetCommitHook(tidis.recordChanges)
+	}
 
 	return tidis, nil
 }
@@ -64,6 +95,21 @@ func (tidis *Tidis) NewTxn() (interface{}, error) {
 	return tidis.db.NewTxn()
 }
 
+// CommitTxn commits txn created by NewTxn, changes are recorded for change
+// feed in it
+func (tidis *Tidis) CommitTxn(txn interface{}) error {
+	return tidis.db.CommitTxn(txn)
+}
+
+func (tidis *Tidis) RollbackTxn(txn interface{}) error {
+	return tidis.db.RollbackTxn(txn)
+}
+
+// InstanceId identifies this instance in leader election and pubsub
+func (tidis *Tidis) InstanceId() string {
+	return tidis.uuid.String()
+}
+
 func (tidis *Tidis) TenantId() string {
 	return tidis.conf.Tidis.TenantId
 }
@@ -72,10 +118,23 @@ func (tidis *Tidis) RawKeyPrefix(dbid uint8, key []byte) []byte {
 	return RawKeyPrefix(tidis.TenantId(), dbid, key)
 }
 
+func (tidis *Tidis) RawTTLKey(dbid uint8, expireAt uint64, key []byte) []byte {
+	return RawTTLKey(tidis.TenantId(), dbid, expireAt, key)
+}
+
 func (tidis *Tidis) RunGC(safePoint uint64, concurrency int) error {
 	return tidis.db.RunGC(safePoint, concurrency)
 }
 
+// SetTxnRetry changes retry count of txns failed by conflicts
+func (tidis *Tidis) SetTxnRetry(count int) {
+	tidis.db.SetTxnRetry(count)
+}
+
+func (tidis *Tidis) TxnStats() tikv.TxnStats {
+	return tidis.db.TxnStats()
+}
+
 func (tidis *Tidis) IsLeader() bool {
 	leaderKey := RawSysLeaderKey()
 	val, err := tidis.db.Get(leaderKey)
@@ -171,3 +230,30 @@ func (tidis *Tidis) renewLeader(txn interface{}) error {
 	txn1, _ := txn.(kv.Transaction)
 	return txn1.Set(leaderKey, val)
 }
+
+// ReleaseLeader deletes leader lease if it is held by this instance, so
+// another instance becomes leader without waiting for lease timeout
+func (tidis *Tidis) ReleaseLeader() error {
+	f := func(txn interface{}) (interface{}, error) {
+		leaderKey := RawSysLeaderKey()
+		val, err := tidis.db.GetWithTxn(leaderKey, txn)
+		if err != nil {
+			return false, err
+		}
+		if len(val) < 36 || string(val[:36]) != tidis.uuid.String() {
+			return false, nil
+		}
+
+		txn1, _ := txn.(kv.Transaction)
+		return true, txn1.Delete(leaderKey)
+	}
+
+	released, err := tidis.db.BatchInTxn(f)
+	if err != nil {
+		return err
+	}
+	if released.(bool) {
+		log.Infof("leader lease with uuid %s released", tidis.uuid)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+//
+// tidis_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"testing"
+
+	"github.com/yongman/tidis/config"
+)
+
+// newTestTidis opens tidis with in-memory backend
+func newTestTidis(t *testing.T) *Tidis {
+	conf := config.NewConfig(nil, "", "", 0, "")
+	conf.Backend.Type = "memory"
+	conf.Tidis.TxnRetry = 10
+
+	tdb, err := NewTidis(conf)
+	if err != nil {
+		t.Fatalf("open tidis failed: %v", err)
+	}
+	return tdb
+}
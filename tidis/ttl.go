@@ -8,40 +8,164 @@
 package tidis
 
 import (
+	"context"
+	"math"
+	"sync/atomic"
 	"time"
+
+	"github.com/yongman/go/log"
+	"github.com/yongman/tidis/utils"
 )
 
 // ttl for user key checker and operater
 
+// progress of the sweeper on this instance
+type ttlStats struct {
+	expired   uint64
+	lastSweep uint64
+}
+
+// TTLStats returns the number of keys expired by sweeper of this instance and
+// the time in ms its last sweep finished, 0 if it never sweeps
+func (tidis *Tidis) TTLStats() (uint64, uint64) {
+	return atomic.LoadUint64(&tidis.ttlStats.expired), atomic.LoadUint64(&tidis.ttlStats.lastSweep)
+}
+
 type ttlChecker struct {
-	dataType   byte
 	maxPerLoop int
 	interval   int
 	tdb        *Tidis
 }
 
-func NewTTLChecker(datatype byte, max, interval int, tdb *Tidis) *ttlChecker {
+func NewTTLChecker(max, interval int, tdb *Tidis) *ttlChecker {
 	return &ttlChecker{
-		dataType:   datatype,
 		maxPerLoop: max,
 		interval:   interval,
 		tdb:        tdb,
 	}
 }
 
-func (ch *ttlChecker) Run() {
+func (ch *ttlChecker) Run(ctx context.Context) {
+	log.Infof("start ttl checker with interval %d milliseconds", ch.interval)
 	c := time.Tick(time.Duration(ch.interval) * time.Millisecond)
-	for _ = range c {
-		switch ch.dataType {
-		case TSTRING:
+	for {
+		select {
+		case <-c:
+			// only leader sweeps expired keys, other instances just check lazily on read
+			if !ch.tdb.IsLeader() {
+				continue
+			}
+			ch.check()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check walks ttl index of all dbs and deletes at most maxPerLoop expired keys
+func (ch *ttlChecker) check() {
+	left := ch.maxPerLoop
+	now := utils.Now()
+
+	for dbId := 0; dbId <= math.MaxUint8 && left > 0; dbId++ {
+		expired, err := ch.tdb.ExpireKeys(uint8(dbId), now, left)
+		if err != nil {
+			log.Errorf("ttl checker expire keys in db %d failed, error: %s", dbId, err.Error())
+			continue
+		}
+		left -= expired
+	}
+	if left < ch.maxPerLoop {
+		log.Debugf("ttl checker checked %d ttl keys", ch.maxPerLoop-left)
+	}
+	atomic.StoreUint64(&ch.tdb.ttlStats.lastSweep, utils.Now())
+
+	// scan cursors expire as well
+	if err := ch.tdb.ClearScanCursors(); err != nil {
+		log.Errorf("ttl checker clear scan cursors failed, error: %s", err.Error())
+	}
+	if err := ch.tdb.ClearPubSubMessages(); err != nil {
+		log.Errorf("ttl checker clear pubsub messages failed, error: %s", err.Error())
+	}
+}
+
+// updateTTLIndex moves the ttl index of key from oldTs to newTs, zero means no ttl
+func (tidis *Tidis) updateTTLIndex(dbId uint8, txn interface{}, key []byte, oldTs, newTs uint64) error {
+	if oldTs == newTs {
+		return nil
+	}
+	if oldTs > 0 {
+		_, err := tidis.db.DeleteWithTxn([][]byte{tidis.RawTTLKey(dbId, oldTs, key)}, txn)
+		if err != nil {
+			return err
+		}
+	}
+	if newTs > 0 {
+		err := tidis.db.SetWithTxn(tidis.RawTTLKey(dbId, newTs, key), []byte{TTTLDATA}, txn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		case THASHMETA:
+// ExpireKeys deletes keys in db whose ttl index is not after now, at most limit
+// ttl keys are handled, it returns the count of handled ttl keys
+func (tidis *Tidis) ExpireKeys(dbId uint8, now uint64, limit int) (int, error) {
+	if limit <= 0 {
+		return 0, nil
+	}
+
+	startKey := tidis.RawTTLKey(dbId, 0, nil)
+	endKey := tidis.RawTTLKey(dbId, now+1, nil)
 
-		case TLISTMETA:
+	ttlKeys, err := tidis.db.GetRangeKeys(startKey, endKey, 0, uint64(limit), nil)
+	if err != nil {
+		return 0, err
+	}
 
-		case TSETMETA:
-		case TZSETMETA:
+	for _, ttlKey := range ttlKeys {
+		// each key is deleted in its own txn, keep txn small and conflicts local
+		f := func(txn interface{}) (interface{}, error) {
+			return tidis.expireKeyWithTxn(dbId, txn, ttlKey)
+		}
+		expired, err := tidis.db.BatchInTxn(f)
+		if err != nil {
+			return 0, err
+		}
+		if expired.(bool) {
+			atomic.AddUint64(&tidis.ttlStats.expired, 1)
+			_, key, _ := TTLKeyDecoder(tidis.TenantId(), ttlKey)
+			tidis.NotifyKeyspaceEvent(NotifyExpired, "expired", dbId, key)
 		}
+	}
+	return len(ttlKeys), nil
+}
+
+func (tidis *Tidis) expireKeyWithTxn(dbId uint8, txn interface{}, ttlKey []byte) (bool, error) {
+	ts, key, err := TTLKeyDecoder(tidis.TenantId(), ttlKey)
+	if err != nil {
+		return false, err
+	}
+
+	var expired bool
+
+	// ttl index may be stale if the key is deleted, overwritten or ttl changed
+	_, obj, err := tidis.GetObject(dbId, txn, key)
+	if err != nil {
+		return false, err
+	}
+	if obj != nil && obj.GetExpireAt() == ts && obj.ObjectExpired(utils.Now()) {
+		_, err = tidis.Delete(dbId, txn, [][]byte{key})
+		if err != nil {
+			return false, err
+		}
+		expired = true
+	}
 
+	_, err = tidis.db.DeleteWithTxn([][]byte{ttlKey}, txn)
+	if err != nil {
+		return false, err
 	}
+	return expired, nil
 }
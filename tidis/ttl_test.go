@@ -0,0 +1,65 @@
+//
+// ttl_test.go
+// Copyright (C) 2021 YanMing <yming0221@gmail.com>
+//
+// Distributed under terms of the MIT license.
+//
+
+package tidis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yongman/tidis/utils"
+)
+
+func TestExpireKeys(t *testing.T) {
+	tdb := newTestTidis(t)
+	defer tdb.Close()
+
+	now := int64(utils.Now())
+
+	if _, err := tdb.SetWithParam(0, nil, []byte("str"), []byte("v"), 1, false, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tdb.Hset(0, []byte("hash"), []byte("f1"), []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := tdb.PExpireAt(0, []byte("hash"), now+1); err != nil || n != 1 {
+		t.Fatalf("pexpireat hash got %d %v", n, err)
+	}
+	// ttl is removed by a plain set, the stale index must not delete the key
+	tdb.SetWithParam(0, nil, []byte("persist"), []byte("v"), 1, false, false)
+	tdb.Set(0, nil, []byte("persist"), []byte("v"))
+	// ttl in future is not touched
+	tdb.SetWithParam(0, nil, []byte("future"), []byte("v"), 60*1000, false, false)
+
+	time.Sleep(5 * time.Millisecond)
+
+	handled, err := tdb.ExpireKeys(0, utils.Now(), 100)
+	if err != nil || handled != 3 {
+		t.Fatalf("expire keys expect 3 handled, got %d %v", handled, err)
+	}
+
+	for _, key := range []string{"str", "hash"} {
+		v, _ := tdb.db.Get(tdb.RawKeyPrefix(0, []byte(key)))
+		if v != nil {
+			t.Fatalf("expired key %s still exists", key)
+		}
+	}
+	if v, _ := tdb.db.Get(tdb.RawHashDataKey(0, []byte("hash"), []byte("f1"))); v != nil {
+		t.Fatalf("expired hash field still exists")
+	}
+	for _, key := range []string{"persist", "future"} {
+		if v, _ := tdb.Get(0, nil, []byte(key)); string(v) != "v" {
+			t.Fatalf("key %s should not be expired", key)
+		}
+	}
+
+	// all expired index keys are consumed
+	handled, err = tdb.ExpireKeys(0, utils.Now(), 100)
+	if err != nil || handled != 0 {
+		t.Fatalf("expire keys expect 0 handled, got %d %v", handled, err)
+	}
+}
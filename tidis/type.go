@@ -36,6 +36,9 @@ const (
 	MetaTypeKey byte = iota
 	DataTypeKey
 	ScoreTypeKey
+	// data keys and score keys of versioned zset
+	VersionDataTypeKey
+	VersionScoreTypeKey
 )
 
 var (